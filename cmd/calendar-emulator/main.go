@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/emulator"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8085", "address to listen on")
+	owner := flag.String("owner", "calendar@example.com", "owner, and id of the primary calendar")
+	calendars := flag.String("calendars", "", "comma separated ids of other calendars")
+	credentials := flag.String("credentials", "",
+		"write a CREDENTIALS file using the emulator to this path")
+	domains := flag.String("domains", "example", "comma separated domains of the CREDENTIALS file")
+	flag.Parse()
+
+	memory := backend.NewMemory(*owner)
+	for _, id := range strings.Split(*calendars, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			memory.AddCalendar(id, id)
+		}
+	}
+
+	if *credentials != "" {
+		b, err := emulator.Credentials("http://"+*addr, strings.Split(*domains, ","))
+		if err != nil {
+			logrus.Fatalf("Unable to create credentials: %v", err)
+		}
+
+		err = ioutil.WriteFile(*credentials, b, 0600)
+		if err != nil {
+			logrus.Fatalf("Unable to write credentials: %v", err)
+		}
+		logrus.Infof("Wrote credentials to %s", *credentials)
+	}
+
+	logrus.Infof("Calendar api at http://%s%s", *addr, emulator.APIPath)
+	logrus.Fatal(http.ListenAndServe(*addr, emulator.New(memory)))
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/tktip/google-calendar/pkg/client"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+//Export formats
+const (
+	exportICS  = "ics"
+	exportJSON = "json"
+)
+
+//stringList - flag given once per value
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+//Set - adds v
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+//flags - flag set of the command run
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(c.stderr, "usage: gcalctl "+c.usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+//parse - parses args, requiring n positional args
+func parse(fs *flag.FlagSet, args []string, n int) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != n {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	return nil
+}
+
+//readFile - contents of the file name, or of stdin if name is -
+func (c *cli) readFile(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(c.stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+//eventFlags - flags setting fields of an event. The returned func reads
+//the event of -f, and sets the fields of the flags given on it.
+func (c *cli) eventFlags(fs *flag.FlagSet) func() (global.Event, error) {
+	file := fs.String("f", "", "json file of the event, - for stdin")
+	fields := map[string]func(event *global.Event) **string{
+		"title":       func(e *global.Event) **string { return &e.Title },
+		"description": func(e *global.Event) **string { return &e.Description },
+		"location":    func(e *global.Event) **string { return &e.Location },
+		"start":       func(e *global.Event) **string { return &e.Start },
+		"end":         func(e *global.Event) **string { return &e.End },
+		"status":      func(e *global.Event) **string { return &e.Status },
+	}
+	for name := range fields {
+		fs.String(name, "", "sets "+name+" of the event, RFC3339 if a time")
+	}
+
+	return func() (global.Event, error) {
+		event := global.Event{}
+		if *file != "" {
+			b, err := c.readFile(*file)
+			if err != nil {
+				return event, err
+			}
+
+			err = json.Unmarshal(b, &event)
+			if err != nil {
+				return event, fmt.Errorf("bad event in %s: %v", *file, err)
+			}
+		}
+
+		fs.Visit(func(f *flag.Flag) {
+			if field, ok := fields[f.Name]; ok {
+				v := f.Value.String()
+				*field(&event) = &v
+			}
+		})
+		return event, nil
+	}
+}
+
+//getCommand - prints an event
+func getCommand(c *cli, args []string) error {
+	fs := c.flags("get")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	event, err := c.store.get(c.ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return c.out.print(event)
+}
+
+//listFlags - flags of event list filters
+func (c *cli) listFlags(fs *flag.FlagSet) *client.ListOptions {
+	opts := &client.ListOptions{}
+	fs.StringVar(&opts.TimeMin, "from", "", "RFC3339, events ending after")
+	fs.StringVar(&opts.TimeMax, "to", "", "RFC3339, events starting before")
+	fs.BoolVar(&opts.ShowDeleted, "deleted", false, "include cancelled events")
+	return opts
+}
+
+//listCommand - prints the events matching the flags
+func listCommand(c *cli, args []string) error {
+	fs := c.flags("list")
+	opts := c.listFlags(fs)
+	fs.StringVar(&opts.Query, "q", "", "free text search")
+	fs.StringVar(&opts.UpdatedMin, "updated-min", "", "RFC3339, events modified at or after")
+	fs.StringVar(&opts.OrderBy, "order-by", "", "startTime or updated")
+	fs.StringVar(&opts.ICalUID, "ical-uid", "", "iCalendar UID of events")
+	fs.StringVar(&opts.Attendee, "attendee", "", "email of an attendee of events")
+	fs.StringVar(&opts.ResponseStatus, "response-status", "",
+		"response status of -attendee, or of the calendar owner")
+	fs.Var((*stringList)(&opts.PrivateExtendedProperties), "property",
+		"key=value of a private extended property of events, may be repeated")
+	fs.Var((*stringList)(&opts.SharedExtendedProperties), "shared-property",
+		"key=value of a shared extended property of events, may be repeated")
+	err := parse(fs, args, 0)
+	if err != nil {
+		return err
+	}
+
+	events, err := c.store.list(c.ctx, *opts)
+	if err != nil {
+		return err
+	}
+	return c.out.print(events)
+}
+
+//createCommand - creates an event, and prints it
+func createCommand(c *cli, args []string) error {
+	fs := c.flags("create")
+	readEvent := c.eventFlags(fs)
+	err := parse(fs, args, 0)
+	if err != nil {
+		return err
+	}
+
+	event, err := readEvent()
+	if err != nil {
+		return err
+	}
+
+	id, err := c.store.create(c.ctx, event)
+	if err != nil {
+		return err
+	}
+	return getCommand(c, []string{id})
+}
+
+//patchCommand - sets the fields given of an event, and prints it
+func patchCommand(c *cli, args []string) error {
+	fs := c.flags("patch")
+	readEvent := c.eventFlags(fs)
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	event, err := readEvent()
+	if err != nil {
+		return err
+	}
+
+	id := fs.Arg(0)
+	event.ID = &id
+	err = c.store.patch(c.ctx, event)
+	if err != nil {
+		return err
+	}
+	return getCommand(c, []string{id})
+}
+
+//deleteCommand - cancels an event
+func deleteCommand(c *cli, args []string) error {
+	fs := c.flags("delete")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	return c.store.delete(c.ctx, fs.Arg(0))
+}
+
+//participantsCommand - lists, adds or removes participants of an event,
+//printing the participants after
+func participantsCommand(c *cli, args []string) error {
+	fs := c.flags("participants")
+	optional := fs.Bool("optional", false, "participants added are optional")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	action, id, emails := fs.Arg(0), fs.Arg(1), []string{}
+	if fs.NArg() > 2 {
+		emails = fs.Args()[2:]
+	}
+
+	switch {
+	case action == "list" && id != "" && len(emails) == 0:
+	case action == "add" && id != "" && len(emails) > 0:
+		participants := make([]global.Participant, len(emails))
+		for i, email := range emails {
+			participants[i] = global.Participant{Email: email}
+			if *optional {
+				participants[i].Optional = optional
+			}
+		}
+		err = c.store.addParticipants(c.ctx, id, participants)
+	case action == "remove" && id != "" && len(emails) > 0:
+		err = c.store.removeParticipants(c.ctx, id, emails)
+	default:
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	if err != nil {
+		return err
+	}
+
+	event, err := c.store.get(c.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	participants := []global.Participant{}
+	if event.Participants != nil {
+		participants = *event.Participants
+	}
+	return c.out.print(participants)
+}
+
+//importCommand - upserts the events of an iCalendar file, keyed by UID,
+//or of a json file of events: events with an id are patched, the others
+//created
+func importCommand(c *cli, args []string) error {
+	fs := c.flags("import")
+	dryRun := fs.Bool("dry-run", false, "only print what would be changed")
+	err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var result *global.ImportResult
+	if filepath.Ext(fs.Arg(0)) == ".json" || isJSON(b) {
+		result, err = c.importJSON(b, *dryRun)
+	} else {
+		result, err = c.store.importICS(c.ctx, b, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	return c.out.print(result)
+}
+
+//isJSON - whether b looks like json rather than iCalendar, i.e. on stdin
+func isJSON(b []byte) bool {
+	s := strings.TrimSpace(string(b))
+	return strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{")
+}
+
+//importJSON - patches the events of b with an id, and creates the others.
+//b is a json array of events, or a single event.
+func (c *cli) importJSON(b []byte, dryRun bool) (*global.ImportResult, error) {
+	events := []global.Event{}
+	err := json.Unmarshal(b, &events)
+	if err != nil {
+		event := global.Event{}
+		if json.Unmarshal(b, &event) != nil {
+			return nil, fmt.Errorf("expected a json event or array of events: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	result := &global.ImportResult{DryRun: dryRun, Events: []global.ImportedEvent{}}
+	for _, event := range events {
+		imported := global.ImportedEvent{UID: deref(event.ICalUID), ID: deref(event.ID)}
+		if imported.ID == "" {
+			imported.Action = "create"
+			if !dryRun {
+				imported.ID, err = c.store.create(c.ctx, event)
+			}
+		} else {
+			imported.Action = "update"
+			if !dryRun {
+				err = c.store.patch(c.ctx, event)
+			}
+		}
+
+		if err != nil {
+			imported.Action = "error"
+			imported.Error = err.Error()
+			err = nil
+		}
+		result.Events = append(result.Events, imported)
+	}
+	return result, nil
+}
+
+//exportCommand - writes the events between -from and -to to a file, or
+//stdout
+func exportCommand(c *cli, args []string) error {
+	fs := c.flags("export")
+	opts := c.listFlags(fs)
+	format := fs.String("format", "", "ics or json, by the extension of file if empty")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	file := fs.Arg(0)
+	if *format == "" {
+		*format = exportICS
+		if filepath.Ext(file) == ".json" {
+			*format = exportJSON
+		}
+	}
+
+	var b []byte
+	switch *format {
+	case exportICS:
+		b, err = c.store.exportICS(c.ctx, opts.TimeMin, opts.TimeMax, opts.ShowDeleted)
+	case exportJSON:
+		var events []*global.Event
+		events, err = c.store.list(c.ctx, *opts)
+		if err == nil {
+			b, err = json.MarshalIndent(events, "", "  ")
+			b = append(b, '\n')
+		}
+	default:
+		return fmt.Errorf("unknown export format %q, use ics or json", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	if file == "" || file == "-" {
+		_, err = c.stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
@@ -0,0 +1,119 @@
+//Command gcalctl reads and fixes the events of a domain, through the
+//service or directly with the connector and a credentials file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/tktip/google-calendar/pkg/client"
+	"golang.org/x/net/context"
+)
+
+//cli - state of a run
+type cli struct {
+	ctx    context.Context
+	store  eventStore
+	out    printer
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	usage  string //of the command run
+}
+
+//command - a subcommand, run with the args after its name
+type command struct {
+	usage string
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"get":          {"get <id>", getCommand},
+	"list":         {"list [-from time] [-to time] [-q text] [-attendee email] ...", listCommand},
+	"create":       {"create [-f event.json] [-title text] [-start time] [-end time]", createCommand},
+	"patch":        {"patch [-f event.json] [-title text] [-start time] ... <id>", patchCommand},
+	"delete":       {"delete <id>", deleteCommand},
+	"participants": {"participants list|add|remove <id> [email ...]", participantsCommand},
+	"import":       {"import [-dry-run] <file.ics|file.json|->", importCommand},
+	"export":       {"export [-format ics|json] [-from time] [-to time] [file]", exportCommand},
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gcalctl:", err)
+		os.Exit(1)
+	}
+}
+
+//run - runs the command of args
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	fs := flag.NewFlagSet("gcalctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", os.Getenv("GCALCTL_SERVER"),
+		"url of the service, i.e. http://localhost:5555. The connector is used if empty")
+	token := fs.String("token", os.Getenv("GCALCTL_TOKEN"), "bearer token of service requests")
+	credentials := fs.String("credentials", "",
+		"credentials file of the connector, CREDENTIALS if empty")
+	domain := fs.String("domain", os.Getenv("GCALCTL_DOMAIN"), "domain of the events")
+	format := fs.String("o", formatTable, "output format: table, json or yaml")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gcalctl [flags] <command> [args]\n\ncommands:")
+		names := []string{}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(stderr, "  "+commands[name].usage)
+		}
+		fmt.Fprintln(stderr, "\nflags:")
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	if *domain == "" {
+		return fmt.Errorf("missing -domain")
+	}
+
+	c := &cli{
+		ctx:    context.Background(),
+		out:    printer{format: *format, w: stdout},
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		usage:  cmd.usage,
+	}
+
+	if *server != "" {
+		service := client.New(*server, *domain)
+		if *token != "" {
+			service.Auth = client.BearerToken(*token)
+		}
+		c.store = serviceStore{client: service}
+	} else {
+		c.store, err = newConnectorStore(*domain, *credentials)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cmd.run(c, fs.Args()[1:])
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/api"
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+const importedICS = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+	"BEGIN:VEVENT\r\nUID:lunch@example.com\r\nDTSTAMP:20200101T000000Z\r\n" +
+	"DTSTART:20200106T110000Z\r\nDTEND:20200106T120000Z\r\nSUMMARY:Lunch\r\n" +
+	"END:VEVENT\r\nEND:VCALENDAR\r\n"
+
+//gcalctl - runs args, failing t unless the output contains all of want
+func gcalctl(t *testing.T, stdin string, args []string, want ...string) string {
+	t.Helper()
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("%v failed: %v %s", args, err, stderr.String())
+	}
+
+	for _, s := range want {
+		if !strings.Contains(stdout.String(), s) {
+			t.Errorf("expected %q in output of %v, got:\n%s", s, args, stdout.String())
+		}
+	}
+	return stdout.String()
+}
+
+func TestCommands(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	googlecal.UseBackend("flyvo", backend.NewMemory("calendar@example.com"))
+	service := httptest.NewServer(api.Handler())
+	defer service.Close()
+
+	dir, err := ioutil.TempDir("", "gcalctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modes := map[string][]string{
+		"service":   {"-domain", "flyvo", "-server", service.URL},
+		"connector": {"-domain", "flyvo"},
+	}
+	for mode, flags := range modes {
+		t.Run(mode, func(t *testing.T) {
+			cmd := func(args ...string) []string {
+				return append(append([]string{}, flags...), args...)
+			}
+
+			out := gcalctl(t, "", cmd("-o", "json", "create", "-title", "Meeting "+mode,
+				"-start", "2020-01-06T09:00:00+01:00", "-end", "2020-01-06T10:00:00+01:00"))
+			event := global.Event{}
+			err := json.Unmarshal([]byte(out), &event)
+			if err != nil || event.ID == nil {
+				t.Fatalf("expected created event, got %s %v", out, err)
+			}
+			id := *event.ID
+
+			gcalctl(t, "", cmd("-o", "yaml", "patch", "-location", "Room 1", id),
+				"id: "+id, "location: Room 1", `startDateTime: "2020-01-06T`)
+			gcalctl(t, "", cmd("participants", "add", id, "a@example.com", "b@example.com"),
+				"EMAIL", "a@example.com", "b@example.com")
+			gcalctl(t, "", cmd("participants", "remove", id, "b@example.com"))
+			gcalctl(t, "", cmd("list", "-q", mode, "-from", "2020-01-06T00:00:00Z"),
+				"PARTICIPANTS", id, "Meeting "+mode)
+			gcalctl(t, "", cmd("export", "-from", "2020-01-06T00:00:00Z"),
+				"BEGIN:VCALENDAR", "SUMMARY:Meeting "+mode)
+
+			file := filepath.Join(dir, mode+".json")
+			gcalctl(t, "", cmd("export", "-from", "2020-01-06T00:00:00Z", file))
+			gcalctl(t, "", cmd("-o", "json", "import", "-dry-run", file),
+				`"dryRun": true`, `"id": "`+id+`"`, `"action": "update"`)
+
+			gcalctl(t, importedICS, cmd("import", "-"), "lunch@example.com")
+			gcalctl(t, "", cmd("list", "-ical-uid", "lunch@example.com"), "Lunch")
+
+			gcalctl(t, "", cmd("delete", id))
+			out = gcalctl(t, "", cmd("list", "-q", mode))
+			if strings.Contains(out, id) {
+				t.Errorf("expected deleted event not listed, got:\n%s", out)
+			}
+		})
+	}
+
+	err = run([]string{"-domain", "flyvo", "unknown"}, nil, ioutil.Discard, ioutil.Discard)
+	if err != flag.ErrHelp {
+		t.Errorf("expected usage of unknown command, got %v", err)
+	}
+
+	err = run([]string{"-domain", "unknown", "list"}, nil, ioutil.Discard, ioutil.Discard)
+	if err == nil {
+		t.Errorf("expected error of domain without credentials")
+	}
+}
+
+func TestYAML(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		yaml  string
+	}{
+		{"Room 1", "Room 1\n"},
+		{"2020-01-06", "\"2020-01-06\"\n"},
+		{"yes", "\"yes\"\n"},
+		{"8uqrhl9u", "8uqrhl9u\n"},
+		{"1.5", "\"1.5\"\n"},
+		{"0x1F", "\"0x1F\"\n"},
+		{"a: b", "'a: b'\n"},
+		{"", "\"\"\n"},
+		{[]string{}, "[]\n"},
+		{map[string]interface{}{"b": 1, "a": nil, "c": true}, "a: null\nb: 1\nc: true\n"},
+		{
+			map[string]interface{}{"participants": []map[string]string{{"email": "a@example.com"}}},
+			"participants:\n- email: a@example.com\n",
+		},
+		{[][]int{{1, 2}}, "- - 1\n  - 2\n"},
+	}
+
+	for _, test := range tests {
+		b, err := marshalYAML(test.value)
+		if err != nil || string(b) != test.yaml {
+			t.Errorf("expected %v as %q, got %q %v", test.value, test.yaml, b, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"gopkg.in/yaml.v2"
+)
+
+//Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+//printer - writes results in a format
+type printer struct {
+	format string
+	w      io.Writer
+}
+
+//print - writes v, as a table if its type has one
+func (p printer) print(v interface{}) error {
+	switch p.format {
+	case formatJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(append(b, '\n'))
+		return err
+	case formatYAML:
+		b, err := marshalYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(b)
+		return err
+	case formatTable:
+		return p.table(v)
+	}
+	return fmt.Errorf("unknown output format %q, use table, json or yaml", p.format)
+}
+
+//table - writes v as columns separated by spaces
+func (p printer) table(v interface{}) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	row := func(columns ...string) {
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	}
+
+	switch v := v.(type) {
+	case *global.Event:
+		row("ID", "START", "END", "STATUS", "PARTICIPANTS", "TITLE")
+		eventRow(row, v)
+	case []*global.Event:
+		row("ID", "START", "END", "STATUS", "PARTICIPANTS", "TITLE")
+		for _, event := range v {
+			eventRow(row, event)
+		}
+	case []global.Participant:
+		row("EMAIL", "NAME", "RESPONSE", "OPTIONAL")
+		for _, participant := range v {
+			row(participant.Email,
+				deref(participant.DisplayName),
+				deref(participant.ResponseStatus),
+				strconv.FormatBool(participant.Optional != nil && *participant.Optional))
+		}
+	case *global.ImportResult:
+		row("UID", "ACTION", "ID", "CHANGES", "ERROR")
+		for _, event := range v.Events {
+			row(event.UID, event.Action, event.ID, strings.Join(event.Changes, ","), event.Error)
+		}
+	default:
+		return fmt.Errorf("no table for %T, use json or yaml", v)
+	}
+	return tw.Flush()
+}
+
+//eventRow - the columns of event
+func eventRow(row func(columns ...string), event *global.Event) {
+	participants := 0
+	if event.Participants != nil {
+		participants = len(*event.Participants)
+	}
+
+	row(deref(event.ID),
+		deref(event.Start),
+		deref(event.End),
+		deref(event.Status),
+		strconv.Itoa(participants),
+		deref(event.Title))
+}
+
+//deref - value of s, empty if nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+//marshalYAML - v as a yaml document. v is converted through json, so
+//json tags and omitempty apply.
+func marshalYAML(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	//json is yaml. Decoded as yaml, integers stay integers rather than
+	//floats, and strings like "2020-01-06" stay strings.
+	var value interface{}
+	err = yaml.Unmarshal(b, &value)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(value)
+}
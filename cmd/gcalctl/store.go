@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/pkg/client"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"github.com/tktip/google-calendar/pkg/ics"
+	"golang.org/x/net/context"
+)
+
+//eventStore - events of a domain, through the service or the connector
+type eventStore interface {
+	create(ctx context.Context, event global.Event) (string, error)
+	get(ctx context.Context, id string) (*global.Event, error)
+	list(ctx context.Context, opts client.ListOptions) ([]*global.Event, error)
+	patch(ctx context.Context, event global.Event) error
+	delete(ctx context.Context, id string) error
+	addParticipants(ctx context.Context, id string, participants []global.Participant) error
+	removeParticipants(ctx context.Context, id string, emails []string) error
+	importICS(ctx context.Context, b []byte, dryRun bool) (*global.ImportResult, error)
+	exportICS(ctx context.Context, timeMin string, timeMax string, showDeleted bool) ([]byte, error)
+}
+
+//serviceStore - events through the endpoints of the service
+type serviceStore struct {
+	client *client.Client
+}
+
+func (s serviceStore) create(ctx context.Context, event global.Event) (string, error) {
+	result, err := s.client.CreateEvent(ctx, event, client.WriteOptions{})
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+func (s serviceStore) get(ctx context.Context, id string) (*global.Event, error) {
+	return s.client.GetEvent(ctx, id)
+}
+
+func (s serviceStore) list(ctx context.Context, opts client.ListOptions) ([]*global.Event, error) {
+	return s.client.ListEvents(ctx, opts)
+}
+
+func (s serviceStore) patch(ctx context.Context, event global.Event) error {
+	_, err := s.client.PatchEvent(ctx, event, client.WriteOptions{})
+	return err
+}
+
+func (s serviceStore) delete(ctx context.Context, id string) error {
+	_, err := s.client.DeleteEvent(ctx, id, client.WriteOptions{})
+	return err
+}
+
+func (s serviceStore) addParticipants(
+	ctx context.Context,
+	id string,
+	participants []global.Participant,
+) error {
+	_, err := s.client.AddParticipants(ctx, id, participants, client.WriteOptions{})
+	return err
+}
+
+func (s serviceStore) removeParticipants(ctx context.Context, id string, emails []string) error {
+	_, err := s.client.RemoveParticipants(ctx, id, emails, client.WriteOptions{})
+	return err
+}
+
+func (s serviceStore) importICS(ctx context.Context, b []byte, dryRun bool) (
+	*global.ImportResult,
+	error,
+) {
+	return s.client.Import(ctx, b, dryRun)
+}
+
+func (s serviceStore) exportICS(
+	ctx context.Context,
+	timeMin string,
+	timeMax string,
+	showDeleted bool,
+) ([]byte, error) {
+	return s.client.ListEventsICS(ctx, timeMin, timeMax, showDeleted)
+}
+
+//connectorStore - events through the connector, using the credentials
+//of the domain
+type connectorStore struct {
+	domain string
+}
+
+//newConnectorStore - configures the connector like the service does,
+//with the credentials file instead of CREDENTIALS if given
+func newConnectorStore(domain string, credentials string) (connectorStore, error) {
+	if credentials != "" {
+		err := os.Setenv("CREDENTIALS", credentials)
+		if err != nil {
+			return connectorStore{}, err
+		}
+	}
+
+	err := googlecal.ConfigureFromEnv()
+	if err != nil {
+		return connectorStore{}, err
+	}
+
+	if !googlecal.KnownDomain(domain) {
+		return connectorStore{}, fmt.Errorf("domain %q is not in the credentials", domain)
+	}
+	return connectorStore{domain: domain}, nil
+}
+
+func (s connectorStore) connector(ctx context.Context) *googlecal.CalendarConnector {
+	return googlecal.NewCalendarConnector(ctx, s.domain)
+}
+
+func (s connectorStore) create(ctx context.Context, event global.Event) (string, error) {
+	id, _, err := s.connector(ctx).CreateEvent(event)
+	return id, err
+}
+
+func (s connectorStore) get(ctx context.Context, id string) (*global.Event, error) {
+	event, err := s.connector(ctx).GetCalendarEvent(id)
+	if err != nil {
+		return nil, err
+	}
+	return global.FromGoogle(event), nil
+}
+
+func (s connectorStore) list(ctx context.Context, opts client.ListOptions) (
+	[]*global.Event,
+	error,
+) {
+	events, err := s.connector(ctx).GetEvents(opts.TimeMin, opts.TimeMax, opts.ShowDeleted,
+		googlecal.EventListFilter{
+			PrivateExtendedProperties: opts.PrivateExtendedProperties,
+			SharedExtendedProperties:  opts.SharedExtendedProperties,
+			Query:                     opts.Query,
+			UpdatedMin:                opts.UpdatedMin,
+			OrderBy:                   opts.OrderBy,
+			ICalUID:                   opts.ICalUID,
+			ShowHiddenInvitations:     opts.ShowHiddenInvitations,
+			MaxAttendees:              opts.MaxAttendees,
+			Attendee:                  opts.Attendee,
+			ResponseStatus:            opts.ResponseStatus,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*global.Event, len(events.Items))
+	for i, event := range events.Items {
+		result[i] = global.FromGoogle(event)
+	}
+	return result, nil
+}
+
+func (s connectorStore) patch(ctx context.Context, event global.Event) error {
+	_, err := s.connector(ctx).PatchEvent(event)
+	return err
+}
+
+func (s connectorStore) delete(ctx context.Context, id string) error {
+	return s.connector(ctx).DeleteEvent(id)
+}
+
+func (s connectorStore) addParticipants(
+	ctx context.Context,
+	id string,
+	participants []global.Participant,
+) error {
+	return s.connector(ctx).AddParticipants(id, participants)
+}
+
+func (s connectorStore) removeParticipants(ctx context.Context, id string, emails []string) error {
+	return s.connector(ctx).RemoveParticipants(id, emails)
+}
+
+func (s connectorStore) importICS(ctx context.Context, b []byte, dryRun bool) (
+	*global.ImportResult,
+	error,
+) {
+	result, err := s.connector(ctx).ImportICS(bytes.NewReader(b), dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s connectorStore) exportICS(
+	ctx context.Context,
+	timeMin string,
+	timeMax string,
+	showDeleted bool,
+) ([]byte, error) {
+	events, err := s.connector(ctx).
+		GetEvents(timeMin, timeMax, showDeleted, googlecal.EventListFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	err = ics.Calendar{
+		Name:     events.Summary,
+		TimeZone: events.TimeZone,
+		Events:   events.Items,
+	}.Encode(&buf)
+	return buf.Bytes(), err
+}
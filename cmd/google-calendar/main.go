@@ -1,11 +1,57 @@
 package main
 
 import (
+	"log"
+
 	"github.com/tktip/google-calendar/internal/api"
+	"github.com/tktip/google-calendar/internal/audit"
+	"github.com/tktip/google-calendar/internal/consumer"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/webhook"
 	"github.com/tktip/google-calendar/pkg/healthcheck"
+	"golang.org/x/net/context"
 )
 
 func main() {
+	err := googlecal.ConfigureFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure calendars: %v", err)
+	}
+
+	err = googlecal.ConfigureCacheFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure cache: %v", err)
+	}
+
+	dispatcher, err := webhook.DispatcherFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure webhooks: %v", err)
+	}
+	api.UseWebhooks(dispatcher)
+
+	auditor, err := audit.FromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure audit log: %v", err)
+	}
+	api.UseAuditor(auditor)
+
+	err = api.ConfigureJobsFromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure jobs: %v", err)
+	}
+
+	commands, err := consumer.FromEnv()
+	if err != nil {
+		log.Fatalf("Unable to configure consumer: %v", err)
+	}
+
+	if commands != nil {
+		go func() {
+			err := commands.Run(context.Background())
+			log.Fatalf("Consumer stopped: %v", err)
+		}()
+	}
+
 	//Starting health check
 	go healthcheck.StartHealthService()
 
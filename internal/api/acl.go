@@ -0,0 +1,162 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+// @Summary List calendar access rules
+// @Description Returns all access rules (ACL) of a calendar
+// @Produce json
+// @Param domain path string true "Domain of calendar"
+// @Param calendarId path string true "ID of calendar, or primary"
+// @Success 200 {array} global.ACLRule "The calendar access rules"
+// @Failure 400 {string} string "On unknown domain"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/acl/{calendarId}/list [get]
+func listACL(c *gin.Context) {
+	rules, err := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		ListACL(c.Param("calendarId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"rules": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "error": nil})
+}
+
+// @Summary Grant calendar access
+// @Description Adds an access rule to a calendar.
+// @Description Role must be one of freeBusyReader, reader, writer or owner.
+// @Description Scope type must be one of user, group, domain or default.
+// @Description Returns the id of newly created rule.
+// @Produce json
+// @Accept json
+// @Param body body global.ACLRule true "Rule details"
+// @Param domain path string true "Domain of calendar"
+// @Param calendarId path string true "ID of calendar, or primary"
+// @Param broadcastChanges query bool false "Whether to mail grantee about access"
+// @Success 200 "rule was created"
+// @Failure 400 {string} string "If role or scope is invalid"
+// @Failure 422 {string} string "On bad body"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/acl/{calendarId}/insert [post]
+func insertACL(c *gin.Context) {
+	rule := global.ACLRule{}
+	err := c.ShouldBindJSON(&rule)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"id": "", "error": err.Error()})
+		return
+	}
+
+	calendarConnector, ok := createCalendarConnector(c)
+	if !ok {
+		return
+	}
+
+	id, err := calendarConnector.InsertACL(c.Param("calendarId"), rule)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"id": "", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id, "error": nil})
+}
+
+// @Summary Change calendar access
+// @Description Changes the role of an existing access rule
+// @Produce json
+// @Accept json
+// @Param body body global.ACLRule true "Rule details, only role is used"
+// @Param domain path string true "Domain of calendar"
+// @Param calendarId path string true "ID of calendar, or primary"
+// @Param ruleId path string true "ID of rule to change"
+// @Param broadcastChanges query bool false "Whether to mail grantee about access"
+// @Success 200 {string} string "If successfully patched"
+// @Failure 400 {string} string "If role is invalid"
+// @Failure 422 {string} string "On bad body"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/acl/{calendarId}/patch/{ruleId} [patch]
+func patchACL(c *gin.Context) {
+	rule := global.ACLRule{}
+	err := c.ShouldBindJSON(&rule)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	calendarConnector, ok := createCalendarConnector(c)
+	if !ok {
+		return
+	}
+
+	err = calendarConnector.PatchACL(c.Param("calendarId"), c.Param("ruleId"), rule)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
+}
+
+// @Summary Revoke calendar access
+// @Description Deletes an access rule from a calendar
+// @Produce json
+// @Param domain path string true "Domain of calendar"
+// @Param calendarId path string true "ID of calendar, or primary"
+// @Param ruleId path string true "ID of rule to delete"
+// @Success 200 {string} string "If successfully deleted"
+// @Failure 400 {string} string "If no ID provided"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/acl/{calendarId}/delete/{ruleId} [delete]
+func deleteACL(c *gin.Context) {
+	err := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		DeleteACL(c.Param("calendarId"), c.Param("ruleId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"deleted": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": true, "error": nil})
+}
+
+// @Summary Sync calendar access
+// @Description Makes the calendar ACL match the provided rule set.
+// @Description Only the difference is applied: missing rules are inserted,
+// @Description rules with another role are patched and rules not in the set are deleted.
+// @Description Owner rules not in the set are kept.
+// @Produce json
+// @Accept json
+// @Param body body []global.ACLRule true "Desired rule set"
+// @Param domain path string true "Domain of calendar"
+// @Param calendarId path string true "ID of calendar, or primary"
+// @Param broadcastChanges query bool false "Whether to mail grantees about access"
+// @Success 200 {object} global.ACLSyncResult "The applied changes"
+// @Failure 400 {string} string "If a rule is invalid"
+// @Failure 422 {string} string "On bad body"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/acl/{calendarId}/sync [put]
+func syncACL(c *gin.Context) {
+	rules := []global.ACLRule{}
+	err := c.ShouldBindJSON(&rules)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"result": nil, "error": err.Error()})
+		return
+	}
+
+	calendarConnector, ok := createCalendarConnector(c)
+	if !ok {
+		return
+	}
+
+	result, err := calendarConnector.SyncACL(c.Param("calendarId"), rules)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"result": result, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result, "error": nil})
+}
@@ -7,17 +7,36 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/caldav"
 	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/imip"
+	"github.com/tktip/google-calendar/internal/jobs"
+	"github.com/tktip/google-calendar/internal/webhook"
 	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 )
 
 type calendarQueryParams struct {
-	BroadcastChanges *bool `form:"broadcastChanges"`
-	GuestsCanModify  *bool `form:"guestsCanModify"`
-	GuestsMayInvite  *bool `form:"guestsMayInvite"`
-	GuestsVisible    *bool `form:"guestsVisible"`
-	GuestsAutoAccept *bool `form:"guestsAutoAccept"`
-	PrivateEvent     *bool `form:"privateEvent"`
+	BroadcastChanges *bool `form:"broadcastChanges" json:"broadcastChanges,omitempty"`
+	GuestsCanModify  *bool `form:"guestsCanModify" json:"guestsCanModify,omitempty"`
+	GuestsMayInvite  *bool `form:"guestsMayInvite" json:"guestsMayInvite,omitempty"`
+	GuestsVisible    *bool `form:"guestsVisible" json:"guestsVisible,omitempty"`
+	GuestsAutoAccept *bool `form:"guestsAutoAccept" json:"guestsAutoAccept,omitempty"`
+	PrivateEvent     *bool `form:"privateEvent" json:"privateEvent,omitempty"`
+	SendInvitations  bool  `form:"sendInvitations" json:"sendInvitations,omitempty"`
+	Async            bool  `form:"async" json:"-"`
+	DryRun           bool  `form:"dryRun" json:"-"`
+}
+
+//inviter sends iTIP invitations by mail, if SMTP is configured
+var inviter = imip.InviterFromEnv()
+
+//UseWebhooks - publish event changes with dispatcher, i.e. one with
+//persisted subscriptions
+func UseWebhooks(dispatcher *webhook.Dispatcher) {
+	googlecal.UseWebhooks(dispatcher)
 }
 
 func getQueryParams(c *gin.Context) (queryParams calendarQueryParams, ok bool) {
@@ -37,14 +56,67 @@ func createCalendarConnector(c *gin.Context) (connector *googlecal.CalendarConne
 		return nil, false
 	}
 
-	return googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+	connector, err := newCalendarConnector(c.Request.Context(), c.Param("domain"), queryParams)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"id": "", "error": err.Error()})
+		return nil, false
+	}
+
+	auditConnector(c, connector)
+	dryRunConnector(c, connector, queryParams)
+	return connector, true
+
+}
+
+//errorStatus - http status of an error of the connector. Bad input is a
+//bad request, and google failing a bad gateway, or unavailable when it
+//is rate limiting or down, so clients know to retry.
+func errorStatus(err error) int {
+	if err == googlecal.ErrorEventNotFound {
+		return http.StatusNotFound
+	}
+
+	if _, ok := err.(googlecal.UserError); ok {
+		return http.StatusBadRequest
+	}
+
+	gErr, _ := err.(*googleapi.Error)
+	if gErr != nil && (gErr.Code == http.StatusNotFound || gErr.Code == http.StatusGone) {
+		return http.StatusNotFound
+	}
+
+	if !googlecal.Temporary(err) {
+		return http.StatusInternalServerError
+	}
+
+	if gErr != nil && (gErr.Code == http.StatusServiceUnavailable ||
+		gErr.Code == http.StatusTooManyRequests || gErr.Code == http.StatusForbidden) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+//newCalendarConnector - connector of domain, set up by the query params
+func newCalendarConnector(
+	ctx context.Context,
+	domain string,
+	queryParams calendarQueryParams,
+) (*googlecal.CalendarConnector, error) {
+	connector := googlecal.NewCalendarConnector(ctx, domain).
 		InformGuestsAboutUpdates(queryParams.BroadcastChanges).
 		GuestsCanModify(queryParams.GuestsCanModify).
 		GuestsAutoAccept(queryParams.GuestsAutoAccept).
 		EventIsprivate(queryParams.PrivateEvent).
 		GuestsMayInviteOthers(queryParams.GuestsMayInvite).
-		GuestsMaySeeOtherGuests(queryParams.GuestsVisible), true
+		GuestsMaySeeOtherGuests(queryParams.GuestsVisible)
 
+	if queryParams.SendInvitations {
+		if inviter == nil {
+			return nil, googlecal.ErrorInvitationsDisabled
+		}
+		connector.SendInvitations(inviter)
+	}
+	return connector, nil
 }
 
 // @Summary Create event in Google Calendar
@@ -52,22 +124,28 @@ func createCalendarConnector(c *gin.Context) (connector *googlecal.CalendarConne
 // @Description Event changes by users are only local, not global.
 // @Description Key values cannot be changed (i.e. date)
 // @Description Returns the id of newly created event.
+// @Description If a conference is requested, its details are also returned.
+// @Description Conference creation may be pending, see event/{domain}/conference.
 // @Produce json
 // @Accept json
 // @Param body body global.Event true "Event details"
 // @Param domain path string true "Domain of event"
 // @Param broadcastChanges query bool false "Whether to mail users about event"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
 // @Param guestsCanModify query bool false "Whether guests may modify the event"
 // @Param guestsMayInvite query bool false "Whether guests may invite others"
 // @Param guestsVisible query bool false "Whether guests are visible"
+// @Param async query bool false "Whether to queue the write, see jobs/{id}"
 // @Success 200 "event was created and uploaded"
+// @Success 202 {object} jobs.Job "If queued, the job creating the event"
 // @Failure 400 {string} string "If body missing or param is missing from body"
 // @Failure 422 {string} string "On bad body"
 // @Failure 500 {string} string "On unexpected error"
 // @Router /event/{domain}/create [post]
 func addEventToGoogle(c *gin.Context) {
 	event := global.Event{}
-	err := c.BindJSON(&event)
+	err := c.ShouldBindJSON(&event)
 	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"id": "", "error": err.Error()})
 		return
@@ -78,19 +156,22 @@ func addEventToGoogle(c *gin.Context) {
 		return
 	}
 
-	id, err := calendarConnector.CreateEvent(event)
+	if enqueueWrite(c, jobs.KindCreate, &event, "") {
+		return
+	}
+
+	id, conference, err := calendarConnector.CreateEvent(event)
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"id": "", "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"id": "", "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"id": "", "error": err.Error()})
+	if writePreview(c) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"id": id, "error": nil})
+	c.JSON(http.StatusOK, gin.H{"id": id, "conference": conference, "error": nil})
 }
 
 // @Summary Delete event from google
@@ -99,6 +180,10 @@ func addEventToGoogle(c *gin.Context) {
 // @Param id path string true "ID of event to delete"
 // @Param domain path string true "Domain of event"
 // @Param broadcastChanges query bool false "Whether to mail users about event"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
+// @Param async query bool false "Whether to queue the write, see jobs/{id}"
+// @Success 202 {object} jobs.Job "If queued, the job deleting the event"
 // @Failure 400 {string} string "If no ID provided"
 // @Failure 500 {string} string "On unexpected error"
 // @Router /event/{domain}/delete [delete]
@@ -108,15 +193,18 @@ func deleteEvent(c *gin.Context) {
 		return
 	}
 
+	if enqueueWrite(c, jobs.KindDelete, nil, c.Param("id")) {
+		return
+	}
+
 	err := calendarConnector.DeleteEvent(c.Param("id"))
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"deleted": false, "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"deleted": false, "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"deleted": false, "error": err.Error()})
+	if writePreview(c) {
 		return
 	}
 
@@ -125,16 +213,21 @@ func deleteEvent(c *gin.Context) {
 
 // @Summary Update google event
 // @Description Update google event, overwrite preexisting values
+// @Description If a conference is requested, its details are also returned.
 // @Produce json
 // @Accept json
 // @Param body body global.Event true "New event details to set"
 // @Param id path string true "ID of event to update"
 // @Param domain path string true "Domain of event"
 // @Param broadcastChanges query bool false "Whether to mail users about event"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
 // @Param guestsCanModify query bool false "Whether guests may modify the event"
 // @Param guestsMayInvite query bool false "Whether guests may invite others"
 // @Param guestsVisible query bool false "Whether guests are visible"
+// @Param async query bool false "Whether to queue the write, see jobs/{id}"
 // @Success 200 {string} string "On successful update"
+// @Success 202 {object} jobs.Job "If queued, the job updating the event"
 // @Failure 400 {string} string "If ID is missing, or query params bad"
 // @Failure 422 {string} string "If body is missing or bad"
 // @Failure 500 {string} string "On unexpected error"
@@ -142,7 +235,7 @@ func deleteEvent(c *gin.Context) {
 func updateEvent(c *gin.Context) {
 
 	event := global.Event{}
-	err := c.BindJSON(&event)
+	err := c.ShouldBindJSON(&event)
 	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": err.Error()})
 		return
@@ -153,33 +246,41 @@ func updateEvent(c *gin.Context) {
 		return
 	}
 
-	err = calendarConnector.UpdateEvent(event)
+	if enqueueWrite(c, jobs.KindUpdate, &event, "") {
+		return
+	}
+
+	conference, err := calendarConnector.UpdateEvent(event)
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	if writePreview(c) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
+	c.JSON(http.StatusOK, gin.H{"success": true, "conference": conference, "error": nil})
 }
 
 // @Summary Patch google event
 // @Description Patch google event, adding or replacing specified.
+// @Description If a conference is requested, its details are also returned.
 // @Produce json
 // @Accept json
 // @Param body body global.Event true "New event details to set"
 // @Param id path string true "ID of event to update"
 // @Param domain path string true "Domain of event"
 // @Param broadcastChanges query bool false "Whether to mail users about event"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
 // @Param guestsCanModify query bool false "Whether guests may modify the event"
 // @Param guestsMayInvite query bool false "Whether guests may invite others"
 // @Param guestsVisible query bool false "Whether guests are visible"
+// @Param async query bool false "Whether to queue the write, see jobs/{id}"
 // @Success 200 {string} string "If successfully patched"
+// @Success 202 {object} jobs.Job "If queued, the job patching the event"
 // @Failure 400 {string} string "If ID is missing, or query params bad"
 // @Failure 422 {string} string "If body is missing or bad"
 // @Failure 500 {string} string "On unexpected error"
@@ -187,7 +288,7 @@ func updateEvent(c *gin.Context) {
 func patchEvent(c *gin.Context) {
 
 	event := global.Event{}
-	err := c.BindJSON(&event)
+	err := c.ShouldBindJSON(&event)
 	if err != nil {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"id": "", "error": err.Error()})
 		return
@@ -198,18 +299,21 @@ func patchEvent(c *gin.Context) {
 		return
 	}
 
-	err = calendarConnector.PatchEvent(event)
+	if enqueueWrite(c, jobs.KindPatch, &event, "") {
+		return
+	}
+
+	conference, err := calendarConnector.PatchEvent(event)
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
-			return
-		}
-
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
+	if writePreview(c) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "conference": conference, "error": nil})
 }
 
 // @Summary Remove event participants
@@ -219,6 +323,8 @@ func patchEvent(c *gin.Context) {
 // @Param participants path string true "list of participants to remove (emails), comma separated"
 // @Param domain path string true "Domain of event"
 // @Param broadcastChanges query bool false "Whether to mail users about change"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
 // @Success 200 {string} string "On successfully removed"
 // @Failure 400 {string} string "If ID is missing"
 // @Failure 500 {string} string "On unexpected error"
@@ -234,12 +340,11 @@ func removeParticipants(c *gin.Context) {
 	)
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	if writePreview(c) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
@@ -253,28 +358,66 @@ func removeParticipants(c *gin.Context) {
 // @Param participants path string true "list of participants to add (emails), comma separated"
 // @Param domain path string true "Domain of event"
 // @Param broadcastChanges query bool false "Whether to mail users about change"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
+// @Param guestsAutoAccept query bool false "Whether new participants have accepted"
 // @Success 200 {string} string "On successfully added"
 // @Failure 400 {string} string "If ID is missing"
 // @Failure 500 {string} string "On unexpected error"
-// @Router /event/{domain}/participants/{eventId}/{participants} [delete]
+// @Router /event/{domain}/participants/{eventId}/{participants} [post]
 func addParticipants(c *gin.Context) {
+	participants := []global.Participant{}
+	for _, email := range strings.Split(c.Param("participants"), ",") {
+		participants = append(participants, global.Participant{Email: email})
+	}
 
+	addParticipantList(c, participants)
+}
+
+// @Summary Add event participants with details
+// @Description Patch google event, adding specified participants.
+// @Description Participants already on the event have the specified fields updated,
+// @Description other details of theirs are kept.
+// @Description Participants may be given as objects or plain emails.
+// @Produce json
+// @Accept json
+// @Param body body []global.Participant true "Participants to add"
+// @Param eventId path string true "ID of event to update"
+// @Param domain path string true "Domain of event"
+// @Param broadcastChanges query bool false "Whether to mail users about change"
+// @Param sendInvitations query bool false "Whether to mail iTIP invitations to non-Google attendees"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
+// @Param guestsAutoAccept query bool false "Whether new participants have accepted"
+// @Success 200 {string} string "On successfully added"
+// @Failure 400 {string} string "If ID is missing or a participant is invalid"
+// @Failure 422 {string} string "If body is missing or bad"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /event/{domain}/participants/{eventId} [post]
+func addDetailedParticipants(c *gin.Context) {
+	participants := []global.Participant{}
+	err := c.ShouldBindJSON(&participants)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	addParticipantList(c, participants)
+}
+
+func addParticipantList(c *gin.Context, participants []global.Participant) {
 	calendarConnector, ok := createCalendarConnector(c)
 	if !ok {
 		return
 	}
 
-	err := calendarConnector.AddParticipants(c.Param("eventId"),
-		strings.Split(c.Param("participants"), ","),
-	)
+	err := calendarConnector.AddParticipants(c.Param("eventId"), participants)
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	if writePreview(c) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
@@ -287,75 +430,262 @@ func addParticipants(c *gin.Context) {
 // @Param domain path string true "Domain of event"
 // @Failure 400 {string} string "If body or ID is missing"
 // @Failure 500 {string} string "On unexpected error"
+// @Param raw query bool false "Whether to return the google calendar event, rather than global.Event"
 // @Router /event/{domain}/get [GET]
-// @Success 200 {object} T "The google calendar event"
-// \@Success 200 {object} calendar.Event "The google calendar event"
-// \Have created an issue on github.
+// @Success 200 {object} global.Event "The event"
+// @Success 304 "If the client has the event already (If-None-Match)"
 func getEvent(c *gin.Context) {
 
+	if id := c.Param("id"); strings.HasSuffix(id, icsSuffix) {
+		getEventICS(c, strings.TrimSuffix(id, icsSuffix))
+		return
+	}
+
 	event, err := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		Cached().
 		GetCalendarEvent(c.Param("id"))
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"event": nil, "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"event": nil, "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"event": nil, "error": err.Error()})
+	if rawQuery(c) {
+		writeCacheableJSON(c, gin.H{"event": event, "error": nil})
 		return
 	}
+	writeCacheableJSON(c, gin.H{"event": global.FromGoogle(event), "error": nil})
+}
 
-	c.JSON(http.StatusOK, gin.H{"event": event, "error": nil})
+// @Summary Retrieve event conference
+// @Description Retrieve conference details of an event.
+// @Description Used to poll status of conference creation (pending, success or failure).
+// @Produce json
+// @Param id path string true "ID of event"
+// @Param domain path string true "Domain of event"
+// @Success 200 {object} global.ConferenceInfo "The conference, null if event has none"
+// @Failure 400 {string} string "If ID is missing"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /event/{domain}/conference/{id} [GET]
+func getConference(c *gin.Context) {
+
+	conference, err := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		GetConference(c.Param("id"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"conference": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conference": conference, "error": nil})
 }
 
-// @Summary Retrieve google event list
-// @Description Retrieve google event list
+// @Summary Find events by external ID
+// @Description Retrieve events with private extended property key set to the external ID,
+// @Description i.e. the id of a course or booking in another system
+// @Produce json
+// @Param domain path string true "Domain of event"
+// @Param key path string true "Extended property holding the external ID"
+// @Param externalId path string true "The external ID"
+// @Failure 400 {string} string "On missing param"
+// @Failure 500 {string} string "On unexpected error"
+// @Param raw query bool false "Whether to return google calendar events, rather than global.Event"
+// @Router /event/{domain}/external/{key}/{externalId} [GET]
+// @Success 200 {array} global.Event "The events"
+func getEventsByExternalID(c *gin.Context) {
+
+	events, err := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		Cached().
+		FindEventsByExternalID(c.Param("key"), c.Param("externalId"))
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"events": nil, "error": err.Error()})
+		return
+	}
+
+	if rawQuery(c) {
+		writeCacheableJSON(c, gin.H{"events": events, "error": nil})
+		return
+	}
+	writeCacheableJSON(c, gin.H{"events": fromGoogle(events), "error": nil})
+}
+
+//rawQuery - whether the request asks for google calendar events, rather
+//than global.Event
+func rawQuery(c *gin.Context) bool {
+	raw, _ := strconv.ParseBool(c.Query("raw"))
+	return raw
+}
+
+//fromGoogle - google calendar events as global.Event
+func fromGoogle(events []*calendar.Event) []*global.Event {
+	converted := []*global.Event{}
+	for _, v := range events {
+		converted = append(converted, global.FromGoogle(v))
+	}
+	return converted
+}
+
+//listQueryParams - filters of event lists
+type listQueryParams struct {
+	TimeMin                 string   `form:"timeMin"`
+	TimeMax                 string   `form:"timeMax"`
+	ShowDeleted             bool     `form:"showDeleted"`
+	Query                   string   `form:"q"`
+	UpdatedMin              string   `form:"updatedMin"`
+	OrderBy                 string   `form:"orderBy"`
+	ICalUID                 string   `form:"iCalUID"`
+	ShowHiddenInvitations   bool     `form:"showHiddenInvitations"`
+	MaxAttendees            int64    `form:"maxAttendees"`
+	Attendee                string   `form:"attendee"`
+	ResponseStatus          string   `form:"responseStatus"`
+	PrivateExtendedProperty []string `form:"privateExtendedProperty"`
+	SharedExtendedProperty  []string `form:"sharedExtendedProperty"`
+	Raw                     bool     `form:"raw"`
+}
+
+// @Summary Retrieve event list
+// @Description Retrieve event list, recurring events expanded into their instances.
+// @Description Deprecated, use {domain}/event/list with timeMin and timeMax, which takes the same query params.
 // @Produce json
 // @Param domain path string true "Domain of event"
 // @Param startTimeMin path string true "Lower bounds for start time of events"
 // @Param endTimeMax path string true "Upper bounds for end time of events"
+// @Param showDeleted query bool false "Whether to include cancelled events"
+// @Param privateExtendedProperty query []string false "key=value private property events must have"
+// @Param sharedExtendedProperty query []string false "key=value shared property events must have"
 // @Failure 400 {string} string "On missing param"
 // @Failure 500 {string} string "On unexpected error"
 // @Router /event/{domain}/list/:startTimeMin/:endTimeMax [GET]
-// @Success 200 {object} T "The google calendar event"
+// @Success 200 {array} global.Event "The events"
 func getEvents(c *gin.Context) {
+	listEvents(c, c.Param("startTimeMin"), c.Param("endTimeMax"))
+}
+
+// @Summary List events
+// @Description Retrieve events matching the filters, recurring events expanded into their instances.
+// @Description No time bounds means include everything.
+// @Produce json
+// @Param domain path string true "Domain of events"
+// @Param timeMin query string false "RFC3339, lower bound of event end"
+// @Param timeMax query string false "RFC3339, upper bound of event start"
+// @Param showDeleted query bool false "Whether to include cancelled events"
+// @Param q query string false "Free text search in summary, description, location and attendees"
+// @Param updatedMin query string false "RFC3339, only events modified at or after"
+// @Param orderBy query string false "startTime or updated"
+// @Param iCalUID query string false "Only the event with the iCalendar UID"
+// @Param showHiddenInvitations query bool false "Whether to include hidden invitations"
+// @Param maxAttendees query int false "Attendees returned of each event"
+// @Param attendee query string false "Only events with attendee (email)"
+// @Param responseStatus query string false "Only events where attendee, or the calendar owner, responded so"
+// @Param privateExtendedProperty query []string false "key=value private property events must have"
+// @Param sharedExtendedProperty query []string false "key=value shared property events must have"
+// @Param raw query bool false "Whether to return google calendar events, rather than global.Event"
+// @Success 200 {array} global.Event "The events"
+// @Success 304 "If the client has the events already (If-None-Match)"
+// @Failure 400 {string} string "On bad param"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/event/list [GET]
+func listEventsByQuery(c *gin.Context) {
+	listEvents(c, c.Query("timeMin"), c.Query("timeMax"))
+}
 
-	b, _ := strconv.ParseBool(c.Query("showDeleted")) //default: false
+//listEvents - responds with the events between min and max, matching
+//the filters of the query
+func listEvents(c *gin.Context, min string, max string) {
+	params := listQueryParams{}
+	err := c.BindQuery(&params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"events": nil, "error": err.Error()})
+		return
+	}
 
-	//Return events between min (start time) and max (end time)
-	//No min or max means include everything
 	events, err := googlecal.
 		NewCalendarConnector(c.Request.Context(), c.Param("domain")).
-		GetEvents(c.Param("startTimeMin"), c.Param("endTimeMax"), b)
+		Cached().
+		GetEvents(min, max, params.ShowDeleted,
+			googlecal.EventListFilter{
+				PrivateExtendedProperties: params.PrivateExtendedProperty,
+				SharedExtendedProperties:  params.SharedExtendedProperty,
+				Query:                     params.Query,
+				UpdatedMin:                params.UpdatedMin,
+				OrderBy:                   params.OrderBy,
+				ICalUID:                   params.ICalUID,
+				ShowHiddenInvitations:     params.ShowHiddenInvitations,
+				MaxAttendees:              params.MaxAttendees,
+				Attendee:                  params.Attendee,
+				ResponseStatus:            params.ResponseStatus,
+			},
+		)
 
 	if err != nil {
-		if _, ok := err.(googlecal.UserError); ok {
-			c.JSON(http.StatusBadRequest, gin.H{"events": nil, "error": err.Error()})
-			return
-		}
+		c.JSON(errorStatus(err), gin.H{"events": nil, "error": err.Error()})
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"events": nil, "error": err.Error()})
+	if params.Raw {
+		writeCacheableJSON(c, gin.H{"events": events, "error": nil})
 		return
 	}
+	writeCacheableJSON(c, gin.H{"events": fromGoogle(events.Items), "error": nil})
+}
 
-	c.JSON(http.StatusOK, gin.H{"events": events, "error": nil})
+//Handler - the api routes, without request logging
+func Handler() http.Handler {
+	r := gin.New()
+	addRoutes(r)
+	return r
 }
 
 //ListenAndServe starts the api
 func ListenAndServe() {
 	r := gin.New()
 	r.Use(gin.Logger()) // request logging
+	addRoutes(r)
+
+	logrus.Infof("Ready to serve! Listening on port 5555")
+	http.ListenAndServe(":5555", r)
+}
+
+//addRoutes - adds the api endpoints to r
+func addRoutes(r *gin.Engine) {
+	r.Use(auditMutations)
 
 	r.POST("/:domain/event/create", addEventToGoogle)
 	r.DELETE("/:domain/event/delete/:id", deleteEvent)
 	r.DELETE("/:domain/event/participants/:eventId/:participants", removeParticipants)
 	r.POST("/:domain/event/participants/:eventId/:participants", addParticipants)
+	r.POST("/:domain/event/participants/:eventId", addDetailedParticipants)
+	r.POST("/:domain/event/attachments/:eventId", addAttachments)
+	r.DELETE("/:domain/event/attachments/:eventId", removeAttachments)
 	r.PATCH("/:domain/event/patch", patchEvent)
 	r.PUT("/:domain/event/update", updateEvent)
 	r.GET("/:domain/event/get/:id", getEvent)
+	r.GET("/:domain/event/conference/:id", getConference)
+	r.GET("/:domain/event/external/:key/:externalId", getEventsByExternalID)
+	r.GET("/:domain/event/list.ics", getEventsICS)
+	r.POST("/:domain/import", importICS)
 	//r.GET("/api-doc", swagex.SwaggerEndpoint)
+	r.GET("/:domain/event/list", listEventsByQuery)
 	r.GET("/:domain/event/list/:startTimeMin/:endTimeMax", getEvents)
 
-	logrus.Infof("Ready to serve! Listening on port 5555")
-	http.ListenAndServe(":5555", r)
+	r.GET("/:domain/acl/:calendarId/list", listACL)
+	r.POST("/:domain/acl/:calendarId/insert", insertACL)
+	r.PATCH("/:domain/acl/:calendarId/patch/:ruleId", patchACL)
+	r.DELETE("/:domain/acl/:calendarId/delete/:ruleId", deleteACL)
+	r.PUT("/:domain/acl/:calendarId/sync", syncACL)
+
+	r.GET("/:domain/audit", queryAudit)
+	r.POST("/:domain/notifications", receiveNotification)
+
+	r.GET("/:domain/jobs/:id", getJob)
+	r.POST("/:domain/jobs/:id/retry", retryJob)
+
+	r.GET("/:domain/webhooks", listWebhooks)
+	r.POST("/:domain/webhooks", addWebhook)
+	r.DELETE("/:domain/webhooks/:id", deleteWebhook)
+	r.GET("/:domain/webhooks/deliveries", listWebhookDeliveries)
+	r.POST("/:domain/webhooks/deliveries/:id/replay", replayWebhookDelivery)
+
+	caldav.SetupConnectors(auditConnector)
+	for _, method := range caldav.Methods {
+		r.Handle(method, "/:domain/caldav/*path", caldav.Handle)
+	}
 }
@@ -0,0 +1,797 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/audit"
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/cache"
+	"github.com/tktip/google-calendar/internal/emulator"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/jobs"
+	"github.com/tktip/google-calendar/internal/webhook"
+	"golang.org/x/oauth2/jwt"
+)
+
+const domain = "flyvo"
+
+//newRouter - api routes, calling google at the stub
+func newRouter(t *testing.T, google http.Handler) (*gin.Engine, func()) {
+	gin.SetMode(gin.TestMode)
+	stub := httptest.NewServer(google)
+
+	googlecal.Configure(googlecal.CalendarConfig{domain: &jwt.Config{}})
+	googlecal.SetEndpoint(stub.URL + emulator.APIPath)
+	googlecal.SetHTTPClient(stub.Client())
+
+	r := gin.New()
+	addRoutes(r)
+	return r, func() {
+		stub.Close()
+		googlecal.Configure(nil)
+		googlecal.SetEndpoint("")
+		googlecal.SetHTTPClient(nil)
+	}
+}
+
+//authorized - the emulator, accepting requests without a token
+func authorized(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set("Authorization", "Bearer test")
+		h.ServeHTTP(w, r)
+	})
+}
+
+func newEmulator() http.Handler {
+	return authorized(emulator.New(backend.NewMemory("calendar@example.com")))
+}
+
+type response struct {
+	status int
+	body   map[string]interface{}
+	raw    string
+}
+
+func request(t *testing.T, r *gin.Engine, method string, path string, body string) response {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" && !strings.HasPrefix(body, "BEGIN:") {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	resp := response{status: w.Code, raw: w.Body.String(), body: map[string]interface{}{}}
+	json.Unmarshal(w.Body.Bytes(), &resp.body)
+	return resp
+}
+
+//expect - fails unless resp has status, returning the body
+func expect(t *testing.T, resp response, status int, what string) map[string]interface{} {
+	if resp.status != status {
+		t.Fatalf("%s: got status %d, want %d: %s", what, resp.status, status, resp.raw)
+	}
+	return resp.body
+}
+
+const newEvent = `{
+	"title": "Meeting",
+	"startDateTime": "2020-01-06T09:00:00+01:00",
+	"endDateTime": "2020-01-06T10:00:00+01:00",
+	"participants": ["a@example.com"],
+	"extendedProperties": {"private": {"courseId": "42"}},
+	"conference": {"create": true}
+}`
+
+func TestEventRoutes(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	created := expect(t, request(t, r, "POST", "/flyvo/event/create", newEvent),
+		http.StatusOK, "create")
+	id, _ := created["id"].(string)
+	if id == "" || created["conference"] == nil {
+		t.Fatalf("expected id and conference, got %v", created)
+	}
+
+	event := expect(t, request(t, r, "GET", "/flyvo/event/get/"+id, ""), http.StatusOK, "get")
+	if event := event["event"].(map[string]interface{}); event["title"] != "Meeting" ||
+		event["etag"] == nil || event["conferenceInfo"] == nil {
+		t.Errorf("expected event, got %v", event)
+	}
+
+	raw := expect(t, request(t, r, "GET", "/flyvo/event/get/"+id+"?raw=true", ""), http.StatusOK, "get raw")
+	if summary := raw["event"].(map[string]interface{})["summary"]; summary != "Meeting" {
+		t.Errorf("expected google event, got %v", raw)
+	}
+
+	ics := request(t, r, "GET", "/flyvo/event/get/"+id+".ics", "")
+	if ics.status != http.StatusOK || !strings.Contains(ics.raw, "SUMMARY:Meeting") {
+		t.Errorf("expected iCalendar event, got %d %s", ics.status, ics.raw)
+	}
+
+	conference := expect(t, request(t, r, "GET", "/flyvo/event/conference/"+id, ""),
+		http.StatusOK, "conference")
+	if conference["conference"] == nil {
+		t.Errorf("expected conference, got %v", conference)
+	}
+
+	external := expect(t, request(t, r, "GET", "/flyvo/event/external/courseId/42", ""),
+		http.StatusOK, "external")
+	if events := external["events"].([]interface{}); len(events) != 1 {
+		t.Errorf("expected event by external id, got %d", len(events))
+	}
+
+	expect(t, request(t, r, "PATCH", "/flyvo/event/patch",
+		`{"id": "`+id+`", "location": "Room 1"}`), http.StatusOK, "patch")
+
+	expect(t, request(t, r, "PUT", "/flyvo/event/update",
+		`{"id": "`+id+`", "title": "Updated", "startDateTime": "2020-01-06T11:00:00+01:00",
+		"endDateTime": "2020-01-06T12:00:00+01:00"}`), http.StatusOK, "update")
+
+	expect(t, request(t, r, "POST", "/flyvo/event/participants/"+id+"/b@example.com,c@example.com", ""),
+		http.StatusOK, "add participants")
+
+	expect(t, request(t, r, "POST", "/flyvo/event/participants/"+id,
+		`[{"email": "d@example.com", "optional": true}]`), http.StatusOK, "add detailed participants")
+
+	expect(t, request(t, r, "DELETE", "/flyvo/event/participants/"+id+"/b@example.com", ""),
+		http.StatusOK, "remove participants")
+
+	expect(t, request(t, r, "POST", "/flyvo/event/attachments/"+id,
+		`[{"fileUrl": "https://drive.google.com/file/1", "title": "Agenda"}]`),
+		http.StatusOK, "add attachments")
+
+	expect(t, request(t, r, "DELETE",
+		"/flyvo/event/attachments/"+id+"?fileUrl=https://drive.google.com/file/1", ""),
+		http.StatusOK, "remove attachments")
+
+	list := expect(t, request(t, r, "GET",
+		"/flyvo/event/list/2020-01-06T00:00:00Z/2020-01-07T00:00:00Z", ""), http.StatusOK, "list")
+	items := list["events"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("expected one event, got %d", len(items))
+	}
+
+	updated := items[0].(map[string]interface{})
+	if updated["title"] != "Updated" || len(updated["participants"].([]interface{})) != 2 ||
+		updated["attachments"] != nil {
+		t.Errorf("changes not applied: %v", updated)
+	}
+
+	feed := request(t, r, "GET", "/flyvo/event/list.ics?timeMin=2020-01-06T00:00:00Z", "")
+	if feed.status != http.StatusOK || !strings.Contains(feed.raw, "SUMMARY:Updated") {
+		t.Errorf("expected iCalendar feed, got %d %s", feed.status, feed.raw)
+	}
+
+	expect(t, request(t, r, "DELETE", "/flyvo/event/delete/"+id, ""), http.StatusOK, "delete")
+}
+
+func TestListRoute(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	expect(t, request(t, r, "POST", "/flyvo/event/create", newEvent), http.StatusOK, "create")
+	expect(t, request(t, r, "POST", "/flyvo/event/create",
+		strings.Replace(newEvent, "Meeting", "Lunch", 1)), http.StatusOK, "create")
+
+	count := func(query string) int {
+		list := expect(t, request(t, r, "GET", "/flyvo/event/list?"+query, ""), http.StatusOK, query)
+		return len(list["events"].([]interface{}))
+	}
+
+	for query, expected := range map[string]int{
+		"timeMin=2020-01-06T00:00:00Z&timeMax=2020-01-07T00:00:00Z": 2,
+		"timeMin=2020-01-07T00:00:00Z":                              0,
+		"q=lunch":                                                   1,
+		"attendee=A@example.com":                                    2,
+		"attendee=b@example.com":                                    0,
+		"attendee=a@example.com&responseStatus=needsAction":         2,
+		"attendee=a@example.com&responseStatus=accepted":            0,
+		"privateExtendedProperty=courseId%3D42&orderBy=updated":     2,
+	} {
+		if n := count(query); n != expected {
+			t.Errorf("%s: expected %d events, got %d", query, expected, n)
+		}
+	}
+
+	raw := expect(t, request(t, r, "GET", "/flyvo/event/list?q=lunch&raw=true", ""), http.StatusOK, "raw")
+	if items := raw["events"].(map[string]interface{})["items"].([]interface{}); len(items) != 1 ||
+		items[0].(map[string]interface{})["summary"] != "Lunch" {
+		t.Errorf("expected google events, got %v", raw)
+	}
+
+	for _, query := range []string{"raw=maybe", "orderBy=summary", "updatedMin=today", "maxAttendees=x"} {
+		expect(t, request(t, r, "GET", "/flyvo/event/list?"+query, ""), http.StatusBadRequest, query)
+	}
+}
+
+const file = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:test\r\nBEGIN:VEVENT\r\n" +
+	"UID:import@example.com\r\nDTSTAMP:20200101T000000Z\r\n" +
+	"DTSTART:20200106T090000Z\r\nDTEND:20200106T100000Z\r\nSUMMARY:Imported\r\n" +
+	"END:VEVENT\r\nEND:VCALENDAR\r\n"
+
+func TestImportRoute(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	expect(t, request(t, r, "POST", "/flyvo/import?dryRun=true", file), http.StatusOK, "dry run")
+	if feed := request(t, r, "GET", "/flyvo/event/list.ics", "").raw; strings.Contains(feed, "Imported") {
+		t.Errorf("dry run should not import: %s", feed)
+	}
+
+	result := expect(t, request(t, r, "POST", "/flyvo/import", file), http.StatusOK, "import")
+	events := result["result"].(map[string]interface{})["events"].([]interface{})
+	if action := events[0].(map[string]interface{})["action"]; action != "create" {
+		t.Errorf("expected create, got %v", action)
+	}
+
+	result = expect(t, request(t, r, "POST", "/flyvo/import", file), http.StatusOK, "reimport")
+	events = result["result"].(map[string]interface{})["events"].([]interface{})
+	if action := events[0].(map[string]interface{})["action"]; action != "unchanged" {
+		t.Errorf("expected unchanged, got %v", action)
+	}
+}
+
+func TestACLRoutes(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	inserted := expect(t, request(t, r, "POST", "/flyvo/acl/primary/insert",
+		`{"role": "reader", "scopeType": "user", "scopeValue": "a@example.com"}`),
+		http.StatusOK, "insert")
+	id, _ := inserted["id"].(string)
+	if id == "" {
+		t.Fatalf("expected rule id, got %v", inserted)
+	}
+
+	expect(t, request(t, r, "PATCH", "/flyvo/acl/primary/patch/"+id, `{"role": "writer"}`),
+		http.StatusOK, "patch")
+
+	list := expect(t, request(t, r, "GET", "/flyvo/acl/primary/list", ""), http.StatusOK, "list")
+	if rules := list["rules"].([]interface{}); len(rules) != 2 {
+		t.Errorf("expected owner and inserted rule, got %v", rules)
+	}
+
+	expect(t, request(t, r, "DELETE", "/flyvo/acl/primary/delete/"+id, ""), http.StatusOK, "delete")
+
+	synced := expect(t, request(t, r, "PUT", "/flyvo/acl/primary/sync",
+		`[{"role": "reader", "scopeType": "domain", "scopeValue": "example.com"}]`),
+		http.StatusOK, "sync")
+	if synced["result"] == nil {
+		t.Errorf("expected sync result, got %v", synced)
+	}
+}
+
+func TestCalDAVRoute(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	resp := request(t, r, "PROPFIND", "/flyvo/caldav/", "")
+	if resp.status != http.StatusMultiStatus || !strings.Contains(resp.raw, "/flyvo/caldav/calendar@example.com/") {
+		t.Errorf("expected calendar home, got %d %s", resp.status, resp.raw)
+	}
+
+	dispatcher := webhook.NewDispatcher(webhook.NewRegistry())
+	UseWebhooks(dispatcher)
+	defer UseWebhooks(webhook.NewDispatcher(webhook.NewRegistry()))
+	defer useAuditFile(t)()
+
+	payloads := make(chan webhook.Payload, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := webhook.Payload{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads <- payload
+	}))
+	defer receiver.Close()
+	dispatcher.Registry.Subscribe(domain, webhook.Subscription{URL: receiver.URL})
+
+	resp = request(t, r, "PUT", "/flyvo/caldav/calendar@example.com/caldav.ics", strings.Replace(file,
+		"UID:import@example.com", "UID:caldav", 1))
+	if resp.status != http.StatusCreated {
+		t.Fatalf("expected created, got %d %s", resp.status, resp.raw)
+	}
+	dispatcher.Wait()
+
+	if payload := <-payloads; payload.Type != webhook.EventCreated || payload.After.ICalUID != "caldav" {
+		t.Errorf("expected created event published, got %+v", payload)
+	}
+
+	entries := expect(t, request(t, r, "GET", "/flyvo/audit", ""), http.StatusOK, "audit")["entries"].([]interface{})
+	if len(entries) != 1 {
+		t.Fatalf("expected entry of put, got %v", entries)
+	}
+
+	put := entries[0].(map[string]interface{})
+	if changes, _ := put["changes"].([]interface{}); put["operation"] != "event.created" || len(changes) == 0 {
+		t.Errorf("expected created event audited with its fields, got %v", put)
+	}
+}
+
+func TestAsyncWrites(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	//jobs of an event are run in order, so all can be queued at once
+	created := expect(t, request(t, r, "POST", "/flyvo/event/create?async=true", newEvent),
+		http.StatusAccepted, "create")["job"].(map[string]interface{})
+	id := created["key"].(string)
+
+	patched := expect(t, request(t, r, "PATCH", "/flyvo/event/patch?async=true",
+		`{"id": "`+id+`", "location": "Room 1"}`), http.StatusAccepted, "patch")["job"].(map[string]interface{})
+
+	deleted := expect(t, request(t, r, "DELETE", "/flyvo/event/delete/"+id+"?async=true", ""),
+		http.StatusAccepted, "delete")["job"].(map[string]interface{})
+	queue.Wait()
+
+	for _, job := range []map[string]interface{}{created, patched, deleted} {
+		status := expect(t, request(t, r, "GET", "/flyvo/jobs/"+job["id"].(string), ""),
+			http.StatusOK, "get job")["job"].(map[string]interface{})
+		if status["status"] != "succeeded" || status["key"] != id {
+			t.Errorf("expected %s of %s to succeed, got %v", job["kind"], id, status)
+		}
+	}
+
+	result := expect(t, request(t, r, "GET", "/flyvo/jobs/"+created["id"].(string), ""),
+		http.StatusOK, "get create")["job"].(map[string]interface{})["result"].(map[string]interface{})
+	if result["id"] != id || result["conference"] == nil {
+		t.Errorf("expected event id and conference, got %v", result)
+	}
+
+	event := expect(t, request(t, r, "GET", "/flyvo/event/get/"+id, ""), http.StatusOK, "get")
+	if event := event["event"].(map[string]interface{}); event["status"] != "cancelled" ||
+		event["location"] != "Room 1" {
+		t.Errorf("expected patched and deleted event, got %v", event)
+	}
+
+	//not found is not retried, and can be retried by hand
+	failed := expect(t, request(t, r, "PUT", "/flyvo/event/update?async=true",
+		`{"id": "unknown0", "title": "a", "startDateTime": "2020-01-06T11:00:00Z", "endDateTime": "2020-01-06T12:00:00Z"}`),
+		http.StatusAccepted, "update")["job"].(map[string]interface{})
+	queue.Wait()
+
+	job := expect(t, request(t, r, "GET", "/flyvo/jobs/"+failed["id"].(string), ""),
+		http.StatusOK, "get failed")["job"].(map[string]interface{})
+	if job["status"] != "failed" || job["attempts"] != 1.0 || job["lastError"] == nil {
+		t.Errorf("expected failure after one attempt, got %v", job)
+	}
+
+	expect(t, request(t, r, "POST", "/flyvo/jobs/"+failed["id"].(string)+"/retry", ""),
+		http.StatusOK, "retry")
+	queue.Wait()
+	expect(t, request(t, r, "POST", "/flyvo/jobs/"+created["id"].(string)+"/retry", ""),
+		http.StatusBadRequest, "retry succeeded")
+
+	expect(t, request(t, r, "GET", "/other/jobs/"+created["id"].(string), ""),
+		http.StatusBadRequest, "job of other domain")
+	expect(t, request(t, r, "POST", "/other/event/create?async=true", newEvent),
+		http.StatusBadRequest, "unknown domain")
+	expect(t, request(t, r, "PATCH", "/flyvo/event/patch?async=true", `{"location": "Room 1"}`),
+		http.StatusBadRequest, "missing id")
+}
+
+//lostInsert - google taking the first insert of an event, but the
+//response being lost, i.e. by a timeout
+func lostInsert(google http.Handler) http.Handler {
+	lost := false
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/events") && !lost {
+			lost = true
+			google.ServeHTTP(httptest.NewRecorder(), r)
+			failing(http.StatusServiceUnavailable).ServeHTTP(w, r)
+			return
+		}
+		google.ServeHTTP(w, r)
+	})
+}
+
+func TestAsyncCreateRetried(t *testing.T) {
+	r, stop := newRouter(t, lostInsert(newEmulator()))
+	defer stop()
+
+	defer func(q *jobs.Queue) { queue = q }(queue)
+	queue = newQueue(jobs.NewQueue(jobs.NewMemoryStore(), executeJob))
+	queue.Backoff = func(int) time.Duration { return 0 }
+
+	created := expect(t, request(t, r, "POST", "/flyvo/event/create?async=true", newEvent),
+		http.StatusAccepted, "create")["job"].(map[string]interface{})
+	queue.Wait()
+
+	job := expect(t, request(t, r, "GET", "/flyvo/jobs/"+created["id"].(string), ""),
+		http.StatusOK, "get job")["job"].(map[string]interface{})
+	result, _ := job["result"].(map[string]interface{})
+	if job["status"] != "succeeded" || job["attempts"] != 2.0 || result["id"] != created["key"] ||
+		result["conference"] == nil {
+		t.Errorf("expected the conflict of the retry to succeed, got %v", job)
+	}
+
+	events := expect(t, request(t, r, "GET",
+		"/flyvo/event/list/2020-01-06T00:00:00Z/2020-01-07T00:00:00Z", ""), http.StatusOK, "list")
+	if list, _ := events["events"].([]interface{}); len(list) != 1 {
+		t.Errorf("expected one event, got %v", events)
+	}
+}
+
+func TestWebhookRoutes(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	dispatcher := webhook.NewDispatcher(webhook.NewRegistry())
+	dispatcher.MaxAttempts = 1
+	UseWebhooks(dispatcher)
+	defer UseWebhooks(webhook.NewDispatcher(webhook.NewRegistry()))
+
+	mutex := sync.Mutex{}
+	payloads := map[webhook.EventType]webhook.Payload{}
+	fail := true
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		payload := webhook.Payload{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.Type == webhook.EventDeleted && fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		payloads[payload.Type] = payload
+	}))
+	defer receiver.Close()
+
+	added := expect(t, request(t, r, "POST", "/flyvo/webhooks", `{"url": "`+receiver.URL+`"}`),
+		http.StatusOK, "add webhook")
+	if secret := added["webhook"].(map[string]interface{})["secret"]; secret == "" {
+		t.Errorf("expected generated secret, got %v", added)
+	}
+
+	list := expect(t, request(t, r, "GET", "/flyvo/webhooks", ""), http.StatusOK, "list webhooks")
+	if webhooks := list["webhooks"].([]interface{}); len(webhooks) != 1 {
+		t.Errorf("expected one webhook, got %v", webhooks)
+	}
+
+	id := expect(t, request(t, r, "POST", "/flyvo/event/create", newEvent), http.StatusOK, "create")["id"].(string)
+	expect(t, request(t, r, "PATCH", "/flyvo/event/patch", `{"id": "`+id+`", "location": "Room 1"}`),
+		http.StatusOK, "patch")
+	expect(t, request(t, r, "POST", "/flyvo/event/participants/"+id+"/b@example.com", ""),
+		http.StatusOK, "add participants")
+	expect(t, request(t, r, "DELETE", "/flyvo/event/delete/"+id, ""), http.StatusOK, "delete")
+	dispatcher.Wait()
+
+	if created := payloads[webhook.EventCreated]; created.Before != nil || created.After.Id != id {
+		t.Errorf("expected created event, got %+v", created)
+	}
+
+	if patched := payloads[webhook.EventPatched]; patched.Before.Location != "" ||
+		patched.After.Location != "Room 1" {
+		t.Errorf("expected patch snapshots, got %+v", patched)
+	}
+
+	if participants := payloads[webhook.EventParticipantsAdded]; len(participants.Before.Attendees) != 1 ||
+		len(participants.After.Attendees) != 2 {
+		t.Errorf("expected participant snapshots, got %+v", participants)
+	}
+
+	dead := expect(t, request(t, r, "GET", "/flyvo/webhooks/deliveries?status=failed", ""),
+		http.StatusOK, "list deliveries")["deliveries"].([]interface{})
+	if len(dead) != 1 {
+		t.Fatalf("expected dead-lettered delete, got %v", dead)
+	}
+
+	mutex.Lock()
+	fail = false
+	mutex.Unlock()
+
+	deliveryID := dead[0].(map[string]interface{})["id"].(string)
+	expect(t, request(t, r, "POST", "/flyvo/webhooks/deliveries/"+deliveryID+"/replay", ""),
+		http.StatusOK, "replay")
+	dispatcher.Wait()
+
+	if deleted := payloads[webhook.EventDeleted]; deleted.Before.Id != id || deleted.After != nil {
+		t.Errorf("expected replayed delete, got %+v", deleted)
+	}
+
+	expect(t, request(t, r, "POST", "/flyvo/webhooks/deliveries/"+deliveryID+"/replay", ""),
+		http.StatusBadRequest, "second replay")
+	expect(t, request(t, r, "POST", "/flyvo/webhooks", `{"url": "not a url"}`),
+		http.StatusBadRequest, "bad url")
+	expect(t, request(t, r, "GET", "/other/webhooks", ""), http.StatusBadRequest, "unknown domain")
+
+	webhookID := added["webhook"].(map[string]interface{})["id"].(string)
+	expect(t, request(t, r, "DELETE", "/flyvo/webhooks/"+webhookID, ""), http.StatusOK, "delete webhook")
+	expect(t, request(t, r, "DELETE", "/flyvo/webhooks/"+webhookID, ""), http.StatusBadRequest,
+		"delete unknown webhook")
+}
+
+//failing - google stub failing every request with status
+func failing(status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error": {"code": %d, "message": "stub failure"}}`, status)
+	})
+}
+
+//TestErrorMapping checks statuses of bad requests and google errors.
+//Only bad input is a bad request. Google errors keep google's message,
+//and are not found, or bad gateway or unavailable for clients to retry.
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		name         string
+		google       http.Handler
+		method, path string
+		body         string
+		status       int
+		message      string
+	}{
+		{"unknown domain", newEmulator(), "GET", "/other/event/get/abcdef", "",
+			http.StatusBadRequest, googlecal.ErrorUnknownDomain.Error()},
+		{"unknown domain import", newEmulator(), "POST", "/other/import", file,
+			http.StatusBadRequest, googlecal.ErrorUnknownDomain.Error()},
+		{"bad body", newEmulator(), "POST", "/flyvo/event/create", "{", http.StatusUnprocessableEntity, ""},
+		{"missing title", newEmulator(), "POST", "/flyvo/event/create",
+			`{"startDateTime": "2020-01-06T09:00:00Z", "endDateTime": "2020-01-06T10:00:00Z"}`,
+			http.StatusBadRequest, googlecal.ErrorMissingTitle.Error()},
+		{"bad id", newEmulator(), "POST", "/flyvo/event/create",
+			`{"id": "BAD", "title": "a", "startDateTime": "s", "endDateTime": "e"}`,
+			http.StatusBadRequest, googlecal.ErrorBadID.Error()},
+		{"missing event id", newEmulator(), "PATCH", "/flyvo/event/patch", `{"title": "a"}`,
+			http.StatusBadRequest, googlecal.ErrorMissingEventID.Error()},
+		{"bad query", newEmulator(), "POST", "/flyvo/event/create?guestsCanModify=maybe", newEvent,
+			http.StatusBadRequest, ""},
+		{"invitations disabled", newEmulator(), "DELETE", "/flyvo/event/delete/abcdef?sendInvitations=true",
+			"", http.StatusBadRequest, googlecal.ErrorInvitationsDisabled.Error()},
+		{"bad property filter", newEmulator(), "GET",
+			"/flyvo/event/list/2020-01-06T00:00:00Z/2020-01-07T00:00:00Z?privateExtendedProperty=x",
+			"", http.StatusBadRequest, googlecal.ErrorBadPropertyFilter.Error()},
+		{"bad import", newEmulator(), "POST", "/flyvo/import", "not a calendar",
+			http.StatusUnprocessableEntity, ""},
+		{"google not found", newEmulator(), "GET", "/flyvo/event/get/abcdef", "",
+			http.StatusNotFound, "Error 404"},
+		{"google not found patch", newEmulator(), "PATCH", "/flyvo/event/patch", `{"id": "abcdef", "title": "a"}`,
+			http.StatusNotFound, "Error 404"},
+		{"google gone", failing(http.StatusGone), "DELETE", "/flyvo/acl/primary/delete/user:a", "",
+			http.StatusNotFound, "Error 410"},
+		{"google failure", failing(http.StatusInternalServerError), "GET",
+			"/flyvo/event/list/2020-01-06T00:00:00Z/2020-01-07T00:00:00Z", "",
+			http.StatusBadGateway, "Error 500"},
+		{"google failure ics", failing(http.StatusServiceUnavailable), "GET", "/flyvo/event/list.ics", "",
+			http.StatusServiceUnavailable, "Error 503"},
+		{"google rate limit", failing(http.StatusTooManyRequests), "GET", "/flyvo/event/get/abcdef", "",
+			http.StatusServiceUnavailable, "Error 429"},
+		{"google forbidden", failing(http.StatusForbidden), "GET", "/flyvo/acl/primary/list", "",
+			http.StatusInternalServerError, "Error 403"},
+	}
+
+	for _, test := range tests {
+		r, stop := newRouter(t, test.google)
+		resp := request(t, r, test.method, test.path, test.body)
+		stop()
+
+		if resp.status != test.status {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, resp.status, test.status, resp.raw)
+			continue
+		}
+
+		if message, _ := resp.body["error"].(string); !strings.Contains(message, test.message) {
+			t.Errorf("%s: got error %q, want %q", test.name, message, test.message)
+		}
+	}
+}
+
+//useAuditFile - audits to a temporary file, until the func returned is called
+func useAuditFile(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("temp dir failed: %v", err)
+	}
+
+	file, err := audit.OpenFileSink(filepath.Join(dir, "audit.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	UseAuditor(&audit.Auditor{Sinks: []audit.Sink{file}, File: file, IdentityHeader: "X-Forwarded-User"})
+	return func() {
+		UseAuditor(&audit.Auditor{})
+		file.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	defer useAuditFile(t)()
+
+	id := expect(t, request(t, r, "POST", "/flyvo/event/create", newEvent), http.StatusOK, "create")["id"].(string)
+
+	req := httptest.NewRequest("PATCH", "/flyvo/event/patch", strings.NewReader(`{"id": "`+id+`", "location": "Room 1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-User", "alice")
+	req.Header.Set("X-Request-Id", "patch-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("X-Request-Id") != "patch-1" {
+		t.Fatalf("patch: got %d %v", w.Code, w.Header())
+	}
+
+	expect(t, request(t, r, "POST", "/flyvo/acl/primary/insert", `{"role": "reader", "scopeType": "user", "scopeValue": "b@example.com"}`), http.StatusOK, "insert acl")
+
+	//dry runs go unaudited, and refused dry runs are audited as requests
+	expect(t, request(t, r, "PATCH", "/flyvo/event/patch?dryRun=true", `{"id": "`+id+`", "location": "Room 2"}`),
+		http.StatusOK, "dry patch")
+	expect(t, request(t, r, "POST", "/flyvo/import?dryRun=true", file), http.StatusOK, "dry import")
+	expect(t, request(t, r, "PUT", "/flyvo/caldav/calendar@example.com/caldav.ics?dryRun=true",
+		strings.Replace(file, "UID:import@example.com", "UID:caldav", 1)), http.StatusBadRequest, "dry caldav put")
+
+	entries := expect(t, request(t, r, "GET", "/flyvo/audit", ""), http.StatusOK, "audit")["entries"].([]interface{})
+	if len(entries) != 4 {
+		t.Fatalf("expected create, patch, acl and caldav entries, got %v", entries)
+	}
+
+	patch := entries[1].(map[string]interface{})
+	changes, _ := patch["changes"].([]interface{})
+	if patch["operation"] != "event.patched" || patch["identity"] != "alice" || patch["requestId"] != "patch-1" ||
+		patch["eventId"] != id || len(changes) != 1 {
+		t.Errorf("unexpected patch entry %v", patch)
+	} else if change := changes[0].(map[string]interface{}); change["field"] != "location" ||
+		change["old"] != nil || change["new"] != "Room 1" {
+		t.Errorf("unexpected diff %v", change)
+	}
+
+	if acl := entries[2].(map[string]interface{}); acl["operation"] != "insertACL" || acl["status"] != float64(200) {
+		t.Errorf("expected request entry, got %v", acl)
+	}
+
+	if put := entries[3].(map[string]interface{}); put["method"] != "PUT" || put["status"] != float64(400) {
+		t.Errorf("expected refused caldav put, got %v", put)
+	}
+
+	filtered := expect(t, request(t, r, "GET", "/flyvo/audit?identity=alice", ""),
+		http.StatusOK, "audit by identity")["entries"].([]interface{})
+	if len(filtered) != 1 {
+		t.Errorf("expected one entry of alice, got %v", filtered)
+	}
+
+	expect(t, request(t, r, "GET", "/flyvo/audit?since=yesterday", ""), http.StatusBadRequest, "bad since")
+}
+
+func TestDryRun(t *testing.T) {
+	r, stop := newRouter(t, newEmulator())
+	defer stop()
+
+	preview := expect(t, request(t, r, "POST", "/flyvo/event/create?dryRun=true", newEvent),
+		http.StatusOK, "dry create")["preview"].(map[string]interface{})
+	if preview["method"] != "insert" || preview["payload"].(map[string]interface{})["summary"] != "Meeting" {
+		t.Errorf("unexpected create preview %v", preview)
+	}
+
+	external := expect(t, request(t, r, "GET", "/flyvo/event/external/courseId/42", ""),
+		http.StatusOK, "external")
+	if events, _ := external["events"].([]interface{}); len(events) != 0 {
+		t.Fatalf("expected no event created, got %v", events)
+	}
+
+	id := expect(t, request(t, r, "POST", "/flyvo/event/create", newEvent), http.StatusOK, "create")["id"].(string)
+
+	preview = expect(t, request(t, r, "PATCH", "/flyvo/event/patch?dryRun=true&async=true",
+		`{"id": "`+id+`", "location": "Room 1"}`), http.StatusOK, "dry patch")["preview"].(map[string]interface{})
+	diff := preview["diff"].([]interface{})
+	if preview["method"] != "patch" || preview["eventId"] != id || len(diff) != 1 ||
+		diff[0].(map[string]interface{})["field"] != "location" {
+		t.Errorf("unexpected patch preview %v", preview)
+	}
+
+	preview = expect(t, request(t, r, "DELETE", "/flyvo/event/participants/"+id+"/a@example.com?dryRun=true", ""),
+		http.StatusOK, "dry remove participants")["preview"].(map[string]interface{})
+	if diff := preview["diff"].([]interface{}); len(diff) != 1 ||
+		diff[0].(map[string]interface{})["field"] != "participants" {
+		t.Errorf("unexpected participants preview %v", preview)
+	}
+
+	preview = expect(t, request(t, r, "DELETE", "/flyvo/event/delete/"+id+"?dryRun=true", ""),
+		http.StatusOK, "dry delete")["preview"].(map[string]interface{})
+	if preview["method"] != "delete" || preview["payload"] != nil {
+		t.Errorf("unexpected delete preview %v", preview)
+	}
+
+	event := expect(t, request(t, r, "GET", "/flyvo/event/get/"+id, ""), http.StatusOK, "get")["event"].(map[string]interface{})
+	if event["location"] != nil || event["status"] == "cancelled" || len(event["participants"].([]interface{})) != 1 {
+		t.Errorf("expected event unchanged, got %v", event)
+	}
+
+	if resp := request(t, r, "DELETE", "/flyvo/event/delete/unknown0?dryRun=true", ""); resp.status == http.StatusOK {
+		t.Errorf("expected dry delete of unknown event to fail, got %s", resp.raw)
+	}
+
+	expect(t, request(t, r, "POST", "/flyvo/acl/primary/insert?dryRun=true",
+		`{"role": "reader", "scopeType": "user", "scopeValue": "b@example.com"}`), http.StatusBadRequest, "dry acl")
+}
+
+func TestCachedReads(t *testing.T) {
+	gets := 0
+	emulator := newEmulator()
+	r, stop := newRouter(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			gets++
+		}
+		emulator.ServeHTTP(w, r)
+	}))
+	defer stop()
+
+	googlecal.SetCache(cache.NewLRU(100), time.Minute)
+	defer googlecal.SetCache(nil, 0)
+
+	id := expect(t, request(t, r, "POST", "/flyvo/event/create", newEvent), http.StatusOK, "create")["id"].(string)
+
+	req := httptest.NewRequest("GET", "/flyvo/event/get/"+id, nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Cache-Control") != "private, max-age=60" {
+		t.Fatalf("expected cacheable event, got %d %v", w.Code, w.Header())
+	}
+
+	reads := gets
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || gets != reads {
+		t.Errorf("expected 304 from cache, got %d after %d reads", w.Code, gets-reads)
+	}
+
+	expect(t, request(t, r, "PATCH", "/flyvo/event/patch", `{"id": "`+id+`", "location": "Room 1"}`),
+		http.StatusOK, "patch")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected patched event, got %d %v", w.Code, w.Header())
+	}
+
+	//notifications are refused without a channel token
+	reads = gets
+	notify := func(token string) int {
+		req := httptest.NewRequest("POST", "/flyvo/notifications", nil)
+		req.Header.Set("X-Goog-Channel-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if status := notify(""); status != http.StatusForbidden {
+		t.Errorf("expected notification refused without CACHE_CHANNEL_TOKEN, got %d", status)
+	}
+
+	os.Setenv("CACHE_CHANNEL_TOKEN", "secret")
+	defer os.Unsetenv("CACHE_CHANNEL_TOKEN")
+	if status := notify("guess"); status != http.StatusForbidden {
+		t.Errorf("expected notification with bad token refused, got %d", status)
+	}
+
+	expect(t, request(t, r, "GET", "/flyvo/event/get/"+id, ""), http.StatusOK, "get")
+	if gets != reads {
+		t.Errorf("expected refused notifications not to invalidate, got %d reads", gets-reads)
+	}
+
+	if status := notify("secret"); status != http.StatusOK {
+		t.Errorf("expected notification received, got %d", status)
+	}
+
+	expect(t, request(t, r, "GET", "/flyvo/event/get/"+id, ""), http.StatusOK, "get")
+	if gets != reads+1 {
+		t.Errorf("expected notification to invalidate, got %d reads", gets-reads)
+	}
+}
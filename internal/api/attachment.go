@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+// @Summary Add event attachments
+// @Description Patch google event, adding specified attachments (i.e. Drive file links).
+// @Description Attachments already on the event (same fileUrl) have the specified fields updated.
+// @Description (can also use event/{domain}/patch)
+// @Produce json
+// @Accept json
+// @Param body body []global.Attachment true "Attachments to add"
+// @Param eventId path string true "ID of event to update"
+// @Param domain path string true "Domain of event"
+// @Param broadcastChanges query bool false "Whether to mail users about change"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
+// @Success 200 {string} string "On successfully added"
+// @Failure 400 {string} string "If ID is missing, or attachments are invalid"
+// @Failure 422 {string} string "If body is missing or bad"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /event/{domain}/attachments/{eventId} [post]
+func addAttachments(c *gin.Context) {
+	attachments := []global.Attachment{}
+	err := c.ShouldBindJSON(&attachments)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	calendarConnector, ok := createCalendarConnector(c)
+	if !ok {
+		return
+	}
+
+	err = calendarConnector.AddAttachments(c.Param("eventId"), attachments)
+
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	if writePreview(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
+}
+
+// @Summary Remove event attachments
+// @Description Patch google event, removing attachments with specified file urls
+// @Produce json
+// @Param eventId path string true "ID of event to update"
+// @Param fileUrl query []string true "file urls of attachments to remove"
+// @Param domain path string true "Domain of event"
+// @Param broadcastChanges query bool false "Whether to mail users about change"
+// @Param dryRun query bool false "Only return the write that would be made, and the fields it changes"
+// @Success 200 {string} string "On successfully removed"
+// @Failure 400 {string} string "If ID is missing"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /event/{domain}/attachments/{eventId} [delete]
+func removeAttachments(c *gin.Context) {
+
+	calendarConnector, ok := createCalendarConnector(c)
+	if !ok {
+		return
+	}
+	err := calendarConnector.RemoveAttachments(c.Param("eventId"), c.QueryArray("fileUrl"))
+
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	if writePreview(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
+}
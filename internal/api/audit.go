@@ -0,0 +1,189 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/audit"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/random"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+//auditKey - key of the *auditRequest in the gin context
+const auditKey = "audit"
+
+//auditor records mutations, off unless configured
+var auditor = &audit.Auditor{}
+
+//UseAuditor - record mutations with a, i.e. one configured by audit.FromEnv
+func UseAuditor(a *audit.Auditor) {
+	auditor = a
+}
+
+//auditRequest - entry of a request, and the number of changes recorded
+type auditRequest struct {
+	entry   audit.Entry
+	changes int
+}
+
+//safeMethods - methods not mutating calendars
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+	"REPORT":           true,
+}
+
+//operation - name of the handler of the request, i.e. insertACL
+func operation(c *gin.Context) string {
+	name := c.HandlerName()
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+//auditMutations - middleware recording an entry for every change made by
+//a request, or for the request itself if it changed no events
+func auditMutations(c *gin.Context) {
+	requestID := c.GetHeader("X-Request-Id")
+	if requestID == "" {
+		requestID = random.ID()
+	}
+	c.Header("X-Request-Id", requestID)
+
+	if !auditor.Enabled() || safeMethods[c.Request.Method] {
+		c.Next()
+		return
+	}
+
+	request := &auditRequest{entry: audit.Entry{
+		RequestID:  requestID,
+		Identity:   c.GetHeader(auditor.IdentityHeader),
+		RemoteAddr: c.ClientIP(),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Domain:     c.Param("domain"),
+		Operation:  operation(c),
+	}}
+	c.Set(auditKey, request)
+	c.Next()
+
+	//dry runs changed nothing. Only known after the handler, as not every
+	//handler honours dryRun.
+	if _, ok := c.Get(previewKey); ok {
+		return
+	}
+
+	if request.changes == 0 {
+		entry := request.entry
+		entry.CalendarID = c.Param("calendarId")
+		entry.EventID = c.Param("id")
+		if entry.EventID == "" {
+			entry.EventID = c.Param("eventId")
+		}
+		entry.Status = c.Writer.Status()
+		auditor.Record(entry)
+	}
+}
+
+//recordChanges - records the changes of a connector as entries based on
+//entry, counting them if changes is set
+func recordChanges(entry audit.Entry, changes *int) func(change googlecal.Change) {
+	return func(change googlecal.Change) {
+		if changes != nil {
+			*changes++
+		}
+
+		diff, err := audit.Diff(global.FromGoogle(change.Before), global.FromGoogle(change.After))
+		if err != nil {
+			logrus.Errorf("Could not diff event %s: %v", change.EventID, err)
+		}
+
+		entry.Time = time.Time{}
+		entry.Operation = string(change.Type)
+		entry.CalendarID = change.CalendarID
+		entry.EventID = change.EventID
+		entry.Changes = diff
+		auditor.Record(entry)
+	}
+}
+
+//auditEntry - entry of the request, nil if it is not audited
+func auditEntry(c *gin.Context) *audit.Entry {
+	if v, ok := c.Get(auditKey); ok {
+		return &v.(*auditRequest).entry
+	}
+	return nil
+}
+
+//auditConnector - records the changes made by connector, if the
+//request is audited
+func auditConnector(c *gin.Context, connector *googlecal.CalendarConnector) {
+	if v, ok := c.Get(auditKey); ok {
+		request := v.(*auditRequest)
+		connector.RecordChanges(recordChanges(request.entry, &request.changes))
+	}
+}
+
+// @Summary Query audit log
+// @Description Returns entries of the audit log of a domain, oldest first.
+// @Description Mutations are logged with the caller, request id and the fields changed.
+// @Description Requires an audit file, see AUDIT_FILE.
+// @Produce json
+// @Param domain path string true "Domain of entries"
+// @Param eventId query string false "Only entries of event"
+// @Param identity query string false "Only entries of caller"
+// @Param operation query string false "Only entries of operation, i.e. event.patched"
+// @Param since query string false "Only entries at or after, RFC3339"
+// @Param until query string false "Only entries before, RFC3339"
+// @Param limit query int false "Only the newest entries"
+// @Success 200 {array} audit.Entry "The entries"
+// @Failure 400 {string} string "On unknown domain, bad param or if not logged to file"
+// @Failure 500 {string} string "If the log could not be read"
+// @Router /{domain}/audit [get]
+func queryAudit(c *gin.Context) {
+	if !knownDomain(c, "entries") {
+		return
+	}
+
+	if auditor.File == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"entries": nil, "error": "audit log is not written to file"})
+		return
+	}
+
+	filter := audit.Filter{
+		Domain:    c.Param("domain"),
+		EventID:   c.Query("eventId"),
+		Identity:  c.Query("identity"),
+		Operation: c.Query("operation"),
+	}
+
+	var err error
+	if v := c.Query("since"); v != "" {
+		filter.Since, err = time.Parse(time.RFC3339, v)
+	}
+
+	if v := c.Query("until"); v != "" && err == nil {
+		filter.Until, err = time.Parse(time.RFC3339, v)
+	}
+
+	if v := c.Query("limit"); v != "" && err == nil {
+		filter.Limit, err = strconv.Atoi(v)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"entries": nil, "error": err.Error()})
+		return
+	}
+
+	entries, err := auditor.File.Query(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"entries": nil, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "error": nil})
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/googlecal"
+)
+
+//writeCacheable - responds with body, with an ETag of it and the time
+//it may be cached for. Responds 304 if the client has it already.
+func writeCacheable(c *gin.Context, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	if ttl := int(googlecal.CacheTTL().Seconds()); ttl > 0 {
+		c.Header("Cache-Control", "private, max-age="+strconv.Itoa(ttl))
+	} else {
+		c.Header("Cache-Control", "private, no-cache") //revalidate with the etag
+	}
+
+	for _, v := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		if v = strings.TrimSpace(v); v == etag || v == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+//writeCacheableJSON - as writeCacheable, with obj as json
+func writeCacheableJSON(c *gin.Context, obj interface{}) {
+	body, err := json.Marshal(obj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeCacheable(c, "application/json; charset=utf-8", body)
+}
+
+// @Summary Receive google push notification
+// @Description Receives push notifications of changes to calendars of a domain, sent
+// @Description by google to the address of a watch channel. Invalidates cached events.
+// @Description The channel token must match CACHE_CHANNEL_TOKEN, and notifications
+// @Description are refused if it is not set.
+// @Param domain path string true "Domain of calendar"
+// @Success 200 "Notification received"
+// @Failure 400 {string} string "On unknown domain"
+// @Failure 403 {string} string "On bad channel token, or if CACHE_CHANNEL_TOKEN is not set"
+// @Router /{domain}/notifications [post]
+func receiveNotification(c *gin.Context) {
+	if !knownDomain(c, "success") {
+		return
+	}
+
+	//without a token, anyone could drop the cached events of the domain
+	token := os.Getenv("CACHE_CHANNEL_TOKEN")
+	if token == "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"error":   "notifications are refused, as CACHE_CHANNEL_TOKEN is not set",
+		})
+		return
+	}
+
+	received := c.GetHeader("X-Goog-Channel-Token")
+	if subtle.ConstantTimeCompare([]byte(received), []byte(token)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "bad channel token"})
+		return
+	}
+
+	//the first message of a channel only confirms it
+	if c.GetHeader("X-Goog-Resource-State") != "sync" {
+		googlecal.InvalidateCache(c.Param("domain"))
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "error": nil})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/pkg/ics"
+	"google.golang.org/api/calendar/v3"
+)
+
+const icsSuffix = ".ics"
+
+//writeICS - renders events as an iCalendar file
+func writeICS(c *gin.Context, filename string, cal ics.Calendar) {
+	buf := bytes.Buffer{}
+	err := cal.Encode(&buf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	writeCacheable(c, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+// @Summary Export google event as iCalendar
+// @Description Retrieve google event as an iCalendar (RFC 5545) file
+// @Produce text/calendar
+// @Param id path string true "ID of event to get, followed by .ics"
+// @Param domain path string true "Domain of event"
+// @Success 200 {string} string "The event as iCalendar"
+// @Failure 400 {string} string "If ID is missing"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/event/get/{id}.ics [GET]
+func getEventICS(c *gin.Context, id string) {
+
+	event, err := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		Cached().
+		GetCalendarEvent(id)
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	writeICS(c, id+icsSuffix, ics.Calendar{Events: []*calendar.Event{event}})
+}
+
+// @Summary Export google event list as iCalendar
+// @Description Retrieve google events in a time window as an iCalendar (RFC 5545) feed
+// @Produce text/calendar
+// @Param domain path string true "Domain of events"
+// @Param timeMin query string false "Lower bounds for start time of events"
+// @Param timeMax query string false "Upper bounds for end time of events"
+// @Param showDeleted query bool false "Whether to include cancelled events"
+// @Success 200 {string} string "The events as iCalendar"
+// @Failure 400 {string} string "On bad param"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/event/list.ics [GET]
+func getEventsICS(c *gin.Context) {
+
+	b, _ := strconv.ParseBool(c.Query("showDeleted")) //default: false
+
+	events, err := googlecal.
+		NewCalendarConnector(c.Request.Context(), c.Param("domain")).
+		Cached().
+		GetEvents(c.Query("timeMin"), c.Query("timeMax"), b, googlecal.EventListFilter{})
+	if err != nil {
+		c.JSON(errorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	writeICS(c, c.Param("domain")+icsSuffix, ics.Calendar{
+		Name:     events.Summary,
+		TimeZone: events.TimeZone,
+		Events:   events.Items,
+	})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/googlecal"
+)
+
+//maxImportSize limits the size of uploaded iCalendar files
+const maxImportSize = 10 << 20
+
+// @Summary Import iCalendar file
+// @Description Imports the events of an iCalendar (RFC 5545) file into the calendar.
+// @Description Events are upserted keyed by UID, so repeated imports update the events.
+// @Description The file may be posted as the body, or as multipart form field "file".
+// @Description Returns the action (create, update, unchanged or error) and changed fields per event.
+// @Accept text/calendar
+// @Produce json
+// @Param domain path string true "Domain of calendar"
+// @Param dryRun query bool false "Only report what would be changed"
+// @Success 200 {object} global.ImportResult "The result per event"
+// @Failure 400 {string} string "On unknown domain"
+// @Failure 422 {string} string "If file is missing or can not be parsed"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/import [post]
+func importICS(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun")) //default: false
+	if dryRun {
+		//a preview, so the import is not audited
+		c.Set(previewKey, &googlecal.Preview{})
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	var file io.Reader = c.Request.Body
+	if header, err := c.FormFile("file"); err == nil {
+		f, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"result": nil, "error": err.Error()})
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	connector := googlecal.NewCalendarConnector(c.Request.Context(), c.Param("domain"))
+	auditConnector(c, connector)
+	result, err := connector.ImportICS(file, dryRun)
+	if err != nil {
+		if err == googlecal.ErrorUnknownDomain {
+			c.JSON(http.StatusBadRequest, gin.H{"result": nil, "error": err.Error()})
+			return
+		}
+
+		if _, ok := err.(googlecal.UserError); ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"result": nil, "error": err.Error()})
+			return
+		}
+
+		c.JSON(errorStatus(err), gin.H{"result": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": result, "error": nil})
+}
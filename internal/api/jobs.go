@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/audit"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/jobs"
+	"github.com/tktip/google-calendar/internal/random"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+//jobRequest - a write made by a job, with the query params of the request
+type jobRequest struct {
+	Query   calendarQueryParams `json:"query"`
+	Event   *global.Event       `json:"event,omitempty"`
+	EventID string              `json:"eventId,omitempty"`
+	Audit   *audit.Entry        `json:"audit,omitempty"` //entry of the request, if audited
+
+	//whether the id of the created event was given by the service, so
+	//a conflict can only be with an earlier attempt of the job
+	AssignedID bool `json:"assignedId,omitempty"`
+}
+
+//queue runs writes requested with async=true
+var queue = newQueue(jobs.NewQueue(jobs.NewMemoryStore(), executeJob))
+
+//newQueue - queue retrying only errors google may recover from
+func newQueue(queue *jobs.Queue) *jobs.Queue {
+	queue.Retryable = googlecal.Temporary
+	return queue
+}
+
+//ConfigureJobsFromEnv - runs async writes with a queue configured by
+//the environment, resuming the jobs left unfinished by the last run
+func ConfigureJobsFromEnv() error {
+	configured, err := jobs.QueueFromEnv(executeJob)
+	if err != nil {
+		return err
+	}
+
+	//retryable is set before Start, which runs the unfinished jobs
+	queue = newQueue(configured)
+	return queue.Start()
+}
+
+//executeJob - makes the write of job
+func executeJob(job jobs.Job) (json.RawMessage, error) {
+	request := jobRequest{}
+	err := json.Unmarshal(job.Request, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := newCalendarConnector(context.Background(), job.Domain, request.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	connector.Idempotent(job.ID)
+	if request.Audit != nil {
+		connector.RecordChanges(recordChanges(*request.Audit, nil))
+	}
+
+	var result interface{}
+	switch job.Kind {
+	case jobs.KindCreate:
+		var id string
+		var conference *global.ConferenceInfo
+		id, conference, err = connector.CreateEvent(*request.Event)
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusConflict &&
+			request.AssignedID {
+			//created by an earlier attempt that failed after google took it
+			id = *request.Event.ID
+			conference, err = connector.GetConference(id)
+		}
+		result = gin.H{"id": id, "conference": conference}
+	case jobs.KindUpdate:
+		var conference *global.ConferenceInfo
+		conference, err = connector.UpdateEvent(*request.Event)
+		result = gin.H{"conference": conference}
+	case jobs.KindPatch:
+		var conference *global.ConferenceInfo
+		conference, err = connector.PatchEvent(*request.Event)
+		result = gin.H{"conference": conference}
+	case jobs.KindDelete:
+		err = connector.DeleteEvent(request.EventID)
+	default:
+		err = fmt.Errorf("unknown job kind %s", job.Kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
+
+//enqueueWrite - queues the write if async=true, responding 202 with the
+//job. Returns false if the write is to be made right away.
+func enqueueWrite(c *gin.Context, kind string, event *global.Event, eventID string) bool {
+	queryParams, ok := getQueryParams(c)
+	if !ok {
+		return true
+	}
+
+	if !queryParams.Async || queryParams.DryRun {
+		return false
+	}
+
+	if !googlecal.KnownDomain(c.Param("domain")) {
+		c.JSON(http.StatusBadRequest, gin.H{"job": nil, "error": googlecal.ErrorUnknownDomain.Error()})
+		return true
+	}
+
+	//id of the event created, so retries can not create the event twice,
+	//and later jobs of the event can be queued right away
+	assigned := kind == jobs.KindCreate && event.ID == nil
+	if assigned {
+		id := random.ID()
+		event.ID = &id
+	}
+
+	if event != nil && event.ID != nil {
+		eventID = *event.ID
+	}
+
+	if eventID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"job": nil, "error": googlecal.ErrorMissingEventID.Error()})
+		return true
+	}
+
+	job, err := queue.Enqueue(c.Param("domain"), eventID, kind, jobRequest{
+		Query:   queryParams,
+		Event:   event,
+		EventID: eventID,
+		Audit:   auditEntry(c),
+
+		AssignedID: assigned,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"job": nil, "error": err.Error()})
+		return true
+	}
+
+	c.Header("Location", "/"+c.Param("domain")+"/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "error": nil})
+	return true
+}
+
+//getDomainJob - job with id, if it belongs to the domain of the request
+func getDomainJob(c *gin.Context) (jobs.Job, error) {
+	job, err := queue.Get(c.Param("id"))
+	if err == nil && job.Domain != c.Param("domain") {
+		return jobs.Job{}, jobs.ErrorUnknownJob
+	}
+	return job, err
+}
+
+// @Summary Retrieve job
+// @Description Returns the status of a write queued with async=true.
+// @Description Status is queued (also while waiting for a retry), running, succeeded or failed.
+// @Description The result of succeeded creates and patches holds the id and conference.
+// @Produce json
+// @Param domain path string true "Domain of job"
+// @Param id path string true "ID of job"
+// @Success 200 {object} jobs.Job "The job"
+// @Failure 400 {string} string "On unknown job"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/jobs/{id} [get]
+func getJob(c *gin.Context) {
+	job, err := getDomainJob(c)
+	if err != nil {
+		if err == jobs.ErrorUnknownJob {
+			c.JSON(http.StatusBadRequest, gin.H{"job": nil, "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"job": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job, "error": nil})
+}
+
+// @Summary Retry job
+// @Description Queues a failed (dead-lettered) job again, with a fresh set of attempts
+// @Produce json
+// @Param domain path string true "Domain of job"
+// @Param id path string true "ID of job"
+// @Success 200 {object} jobs.Job "The job, now queued"
+// @Failure 400 {string} string "On unknown job, or if the job has not failed"
+// @Failure 500 {string} string "On unexpected error"
+// @Router /{domain}/jobs/{id}/retry [post]
+func retryJob(c *gin.Context) {
+	job, err := getDomainJob(c)
+	if err == nil {
+		job, err = queue.Retry(job.ID)
+	}
+
+	if err != nil {
+		if err == jobs.ErrorUnknownJob || err == jobs.ErrorNotFailed {
+			c.JSON(http.StatusBadRequest, gin.H{"job": nil, "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"job": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job, "error": nil})
+}
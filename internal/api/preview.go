@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/audit"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+//previewKey - key of the *googlecal.Preview of dry runs in the gin context
+const previewKey = "preview"
+
+//dryRunConnector - makes connector record its write rather than make it,
+//if the request is a dry run
+func dryRunConnector(c *gin.Context, connector *googlecal.CalendarConnector, queryParams calendarQueryParams) {
+	if queryParams.DryRun {
+		preview := &googlecal.Preview{}
+		connector.DryRun(preview)
+		c.Set(previewKey, preview)
+	}
+}
+
+//writePreview - responds with the write a dry run would have made, the
+//payload sent to google and the fields it would change. Returns false
+//unless the request is a dry run.
+func writePreview(c *gin.Context) bool {
+	v, ok := c.Get(previewKey)
+	if !ok {
+		return false
+	}
+
+	preview := v.(*googlecal.Preview)
+	diff, err := audit.Diff(global.FromGoogle(preview.Before), global.FromGoogle(preview.After))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"preview": nil, "error": err.Error()})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"preview": gin.H{
+			"method":  preview.Method,
+			"eventId": preview.EventID,
+			"payload": preview.Payload,
+			"diff":    diff,
+		},
+		"error": nil,
+	})
+	return true
+}
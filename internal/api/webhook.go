@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/webhook"
+)
+
+//knownDomain - writes an error unless the domain of the request is known
+func knownDomain(c *gin.Context, key string) bool {
+	if googlecal.KnownDomain(c.Param("domain")) {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{key: nil, "error": googlecal.ErrorUnknownDomain.Error()})
+	return false
+}
+
+// @Summary List webhooks
+// @Description Returns the webhook subscriptions of a domain, without their secrets
+// @Produce json
+// @Param domain path string true "Domain of subscriptions"
+// @Success 200 {array} webhook.Subscription "The subscriptions"
+// @Failure 400 {string} string "On unknown domain"
+// @Router /{domain}/webhooks [get]
+func listWebhooks(c *gin.Context) {
+	if !knownDomain(c, "webhooks") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": googlecal.Webhooks().Registry.Subscriptions(c.Param("domain")),
+		"error":    nil,
+	})
+}
+
+// @Summary Add webhook
+// @Description Subscribes an url to event changes of a domain.
+// @Description Events may be limited to event.created, event.updated, event.patched,
+// @Description event.deleted, event.participants_added and event.participants_removed,
+// @Description all are sent if none are given.
+// @Description Payloads are signed with the secret, which is generated if not given.
+// @Description Returns the subscription, the only time its secret is returned.
+// @Produce json
+// @Accept json
+// @Param body body webhook.Subscription true "Url, secret and events"
+// @Param domain path string true "Domain of events"
+// @Success 200 {object} webhook.Subscription "The subscription"
+// @Failure 400 {string} string "On unknown domain, or bad url or event type"
+// @Failure 422 {string} string "On bad body"
+// @Failure 500 {string} string "If the subscription could not be stored"
+// @Router /{domain}/webhooks [post]
+func addWebhook(c *gin.Context) {
+	sub := webhook.Subscription{}
+	err := c.ShouldBindJSON(&sub)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"webhook": nil, "error": err.Error()})
+		return
+	}
+
+	if !knownDomain(c, "webhook") {
+		return
+	}
+
+	sub, err = googlecal.Webhooks().Registry.Subscribe(c.Param("domain"), sub)
+	if err != nil {
+		if err == webhook.ErrorBadURL || err == webhook.ErrorBadEventType {
+			c.JSON(http.StatusBadRequest, gin.H{"webhook": nil, "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"webhook": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": sub, "error": nil})
+}
+
+// @Summary Delete webhook
+// @Description Unsubscribes a webhook. Its pending deliveries are dead-lettered.
+// @Produce json
+// @Param domain path string true "Domain of subscription"
+// @Param id path string true "ID of subscription"
+// @Success 200 {string} string "On successful delete"
+// @Failure 400 {string} string "On unknown domain or subscription"
+// @Failure 500 {string} string "If the change could not be stored"
+// @Router /{domain}/webhooks/{id} [delete]
+func deleteWebhook(c *gin.Context) {
+	if !knownDomain(c, "deleted") {
+		return
+	}
+
+	err := googlecal.Webhooks().Registry.Unsubscribe(c.Param("domain"), c.Param("id"))
+	if err != nil {
+		if err == webhook.ErrorUnknownSubscription {
+			c.JSON(http.StatusBadRequest, gin.H{"deleted": false, "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"deleted": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": true, "error": nil})
+}
+
+// @Summary List webhook deliveries
+// @Description Returns recent deliveries of a domain, oldest first.
+// @Description Dead letters (status failed) are kept until replayed.
+// @Produce json
+// @Param domain path string true "Domain of deliveries"
+// @Param status query string false "Only deliveries with status pending, delivered or failed"
+// @Success 200 {array} webhook.Delivery "The deliveries"
+// @Failure 400 {string} string "On unknown domain"
+// @Router /{domain}/webhooks/deliveries [get]
+func listWebhookDeliveries(c *gin.Context) {
+	if !knownDomain(c, "deliveries") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": googlecal.Webhooks().Deliveries(c.Param("domain"), webhook.Status(c.Query("status"))),
+		"error":      nil,
+	})
+}
+
+// @Summary Replay webhook delivery
+// @Description Delivers a dead-lettered delivery again, with a fresh set of retries.
+// @Description The payload is unchanged, and sent with the same delivery id.
+// @Produce json
+// @Param domain path string true "Domain of delivery"
+// @Param id path string true "ID of delivery"
+// @Success 200 {object} webhook.Delivery "The delivery, now pending"
+// @Failure 400 {string} string "On unknown domain or delivery, or if not dead-lettered"
+// @Router /{domain}/webhooks/deliveries/{id}/replay [post]
+func replayWebhookDelivery(c *gin.Context) {
+	if !knownDomain(c, "delivery") {
+		return
+	}
+
+	delivery, err := googlecal.Webhooks().Replay(c.Param("domain"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"delivery": nil, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"delivery": delivery, "error": nil})
+}
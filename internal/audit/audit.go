@@ -0,0 +1,183 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+//Entry - a mutation, or a request to make one
+type Entry struct {
+	Time       time.Time     `json:"time"`
+	RequestID  string        `json:"requestId"`
+	Identity   string        `json:"identity,omitempty"` //caller, as told by the identity header
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	Method     string        `json:"method,omitempty"`
+	Path       string        `json:"path,omitempty"`
+	Domain     string        `json:"domain"`
+	CalendarID string        `json:"calendarId,omitempty"`
+	EventID    string        `json:"eventId,omitempty"`
+	Operation  string        `json:"operation"`
+	Status     int           `json:"status,omitempty"` //of the request, 0 for event changes
+	Changes    []FieldChange `json:"changes,omitempty"`
+}
+
+//FieldChange - a field of global.Event changed, by json name. Old is
+//left out for fields set, New for fields cleared.
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+//metadata - read-only fields changed by every write, not diffed
+var metadata = map[string]bool{"etag": true, "updated": true, "created": true, "htmlLink": true}
+
+//fields - the fields of event that are set, by json name
+func fields(event *global.Event) (map[string]json.RawMessage, error) {
+	set := map[string]json.RawMessage{}
+	if event == nil {
+		return set, nil
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]json.RawMessage{}
+	err = json.Unmarshal(b, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range all {
+		if string(v) != "null" && !metadata[k] {
+			set[k] = v
+		}
+	}
+	return set, nil
+}
+
+//Diff - fields changed from before to after, ordered by name. before
+//is nil for created events, after for deleted events.
+func Diff(before *global.Event, after *global.Event) ([]FieldChange, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for k := range old {
+		names = append(names, k)
+	}
+
+	for k := range updated {
+		if _, ok := old[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []FieldChange{}
+	for _, name := range names {
+		if !bytes.Equal(old[name], updated[name]) {
+			changes = append(changes, FieldChange{Field: name, Old: old[name], New: updated[name]})
+		}
+	}
+	return changes, nil
+}
+
+//Sink - where entries are written, i.e. a file
+type Sink interface {
+	Write(entry Entry) error
+}
+
+//Auditor - writes entries to its sinks. Auditing is off without sinks.
+type Auditor struct {
+	Sinks []Sink
+
+	//queried for entries, if written to a file
+	File *FileSink
+
+	//request header holding the identity of the caller, i.e. set by an
+	//authenticating proxy
+	IdentityHeader string
+}
+
+//FromEnv creates an auditor configured by AUDIT_FILE (with
+//AUDIT_FILE_MAX_BYTES and AUDIT_FILE_MAX_FILES for rotation),
+//AUDIT_STDOUT, AUDIT_HTTP_URL and AUDIT_IDENTITY_HEADER.
+func FromEnv() (*Auditor, error) {
+	auditor := Auditor{IdentityHeader: "X-Forwarded-User"}
+	if v := os.Getenv("AUDIT_IDENTITY_HEADER"); v != "" {
+		auditor.IdentityHeader = v
+	}
+
+	if path := os.Getenv("AUDIT_FILE"); path != "" {
+		maxBytes, maxFiles := int64(100<<20), 10
+		if v := os.Getenv("AUDIT_FILE_MAX_BYTES"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("AUDIT_FILE_MAX_BYTES must be a positive number, got %q", v)
+			}
+			maxBytes = n
+		}
+
+		if v := os.Getenv("AUDIT_FILE_MAX_FILES"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("AUDIT_FILE_MAX_FILES must be a number, got %q", v)
+			}
+			maxFiles = n
+		}
+
+		file, err := OpenFileSink(path, maxBytes, maxFiles)
+		if err != nil {
+			return nil, err
+		}
+		auditor.File = file
+		auditor.Sinks = append(auditor.Sinks, file)
+	}
+
+	if v, _ := strconv.ParseBool(os.Getenv("AUDIT_STDOUT")); v {
+		auditor.Sinks = append(auditor.Sinks, NewWriterSink(os.Stdout))
+	}
+
+	if url := os.Getenv("AUDIT_HTTP_URL"); url != "" {
+		auditor.Sinks = append(auditor.Sinks, NewHTTPSink(url))
+	}
+	return &auditor, nil
+}
+
+//Enabled - whether entries are written anywhere
+func (a *Auditor) Enabled() bool {
+	return len(a.Sinks) > 0
+}
+
+//Record - writes entry to all sinks. Failures are only logged, as the
+//mutation has already been made.
+func (a *Auditor) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	for _, sink := range a.Sinks {
+		err := sink.Write(entry)
+		if err != nil {
+			logrus.Errorf("Could not write audit entry of request %s: %v", entry.RequestID, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+func TestDiff(t *testing.T) {
+	before := &global.Event{ID: str("a"), Title: str("Meeting"), Location: str("Room 1")}
+	after := &global.Event{ID: str("a"), Title: str("Meeting"), Description: str("Agenda")}
+
+	changes, err := Diff(before, after)
+	if err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+
+	want := []FieldChange{
+		{Field: "description", New: json.RawMessage(`"Agenda"`)},
+		{Field: "location", Old: json.RawMessage(`"Room 1"`)},
+	}
+	b, _ := json.Marshal(changes)
+	w, _ := json.Marshal(want)
+	if string(b) != string(w) {
+		t.Errorf("got %s, want %s", b, w)
+	}
+
+	changes, _ = Diff(nil, after)
+	if len(changes) != 3 {
+		t.Errorf("expected all fields of created event, got %+v", changes)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("temp dir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	sink, err := OpenFileSink(path, 300, 2)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer sink.Close()
+
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		domain := "flyvo"
+		if i%2 == 1 {
+			domain = "other"
+		}
+
+		err = sink.Write(Entry{
+			Time:      start.Add(time.Duration(i) * time.Minute),
+			RequestID: string('a' + rune(i)),
+			Domain:    domain,
+			Operation: "event.created",
+		})
+		if err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+
+	if _, err := os.Stat(path + ".2"); err != nil {
+		t.Errorf("expected rotated files: %v", err)
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most two rotated files: %v", err)
+	}
+
+	all, err := sink.Query(Filter{})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	if len(all) < 4 || len(all) == 10 || all[len(all)-1].RequestID != "j" {
+		t.Errorf("expected newest entries kept, got %+v", all)
+	}
+
+	for i := 1; i < len(all); i++ {
+		if !all[i-1].Time.Before(all[i].Time) {
+			t.Errorf("entries out of order: %+v", all)
+		}
+	}
+
+	filtered, _ := sink.Query(Filter{
+		Domain: "flyvo",
+		Since:  start.Add(6 * time.Minute),
+		Until:  start.Add(9 * time.Minute),
+	})
+	if len(filtered) != 2 || filtered[0].RequestID != "g" || filtered[1].RequestID != "i" {
+		t.Errorf("unexpected filtered entries %+v", filtered)
+	}
+
+	limited, _ := sink.Query(Filter{Limit: 1})
+	if len(limited) != 1 || limited[0].RequestID != "j" {
+		t.Errorf("expected newest entry, got %+v", limited)
+	}
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+//FileSink - entries written as json lines to Path. When it would grow
+//beyond MaxBytes it is rotated to Path.1, Path.1 to Path.2 and so on,
+//keeping MaxFiles rotated files.
+type FileSink struct {
+	Path     string
+	MaxBytes int64
+	MaxFiles int
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+//Filter - entries matching all fields set
+type Filter struct {
+	Domain    string
+	EventID   string
+	Identity  string
+	Operation string
+	Since     time.Time
+	Until     time.Time
+
+	//newest entries returned, all if 0
+	Limit int
+}
+
+//OpenFileSink - sink appending to path
+func OpenFileSink(path string, maxBytes int64, maxFiles int) (*FileSink, error) {
+	s := &FileSink{Path: path, MaxBytes: maxBytes, MaxFiles: maxFiles}
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	s.file, s.size = file, info.Size()
+	return nil
+}
+
+//rotated - name of the nth rotated file
+func (s *FileSink) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", s.Path, n)
+}
+
+func (s *FileSink) rotate() error {
+	err := s.file.Close()
+	if err != nil {
+		return err
+	}
+
+	if s.MaxFiles < 1 {
+		os.Remove(s.Path)
+		return s.open()
+	}
+
+	os.Remove(s.rotated(s.MaxFiles))
+	for n := s.MaxFiles - 1; n > 0; n-- {
+		err = os.Rename(s.rotated(n), s.rotated(n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err = os.Rename(s.Path, s.rotated(1))
+	if err != nil {
+		return err
+	}
+	return s.open()
+}
+
+//Write - appends entry, rotating first if the file would grow too large
+func (s *FileSink) Write(entry Entry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.size > 0 && s.MaxBytes > 0 && s.size+int64(len(b)) > s.MaxBytes {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+//Close - closes the file
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+func (f Filter) matches(entry Entry) bool {
+	switch {
+	case f.Domain != "" && entry.Domain != f.Domain:
+		return false
+	case f.EventID != "" && entry.EventID != f.EventID:
+		return false
+	case f.Identity != "" && entry.Identity != f.Identity:
+		return false
+	case f.Operation != "" && entry.Operation != f.Operation:
+		return false
+	case !f.Since.IsZero() && entry.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !entry.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+//Query - entries matching filter, oldest first, from the file and the
+//rotated files kept
+func (s *FileSink) Query(filter Filter) ([]Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	paths := []string{}
+	for n := s.MaxFiles; n > 0; n-- {
+		paths = append(paths, s.rotated(n))
+	}
+	paths = append(paths, s.Path)
+
+	entries := []Entry{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(nil, 16<<20)
+		for scanner.Scan() {
+			entry := Entry{}
+			if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+				continue
+			}
+
+			if filter.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//WriterSink - entries written as json lines, i.e. to stdout
+type WriterSink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+//NewWriterSink - sink writing to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+//Write - writes entry as a line
+func (s *WriterSink) Write(entry Entry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+//HTTPSink - entries posted as json to an url, in the background so
+//a slow collector does not delay requests. Entries are dropped while
+//1000 are waiting.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+
+	entries chan Entry
+}
+
+//NewHTTPSink - sink posting to url, buffering up to 1000 entries
+func NewHTTPSink(url string) *HTTPSink {
+	s := &HTTPSink{
+		URL:     url,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		entries: make(chan Entry, 1000),
+	}
+	go s.run()
+	return s
+}
+
+//Write - queues entry to be posted
+func (s *HTTPSink) Write(entry Entry) error {
+	select {
+	case s.entries <- entry:
+		return nil
+	default:
+		return fmt.Errorf("audit collector at %s is behind, entry dropped", s.URL)
+	}
+}
+
+func (s *HTTPSink) run() {
+	for entry := range s.entries {
+		err := s.post(entry)
+		if err != nil {
+			logrus.Errorf("Could not post audit entry of request %s: %v", entry.RequestID, err)
+		}
+	}
+}
+
+func (s *HTTPSink) post(entry Entry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.Client.Post(s.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+//Package backend abstracts the calendar operations of the connector, so
+//calendars can be served by google or, in tests and local development,
+//from memory. Errors are *googleapi.Error as with google, whatever the
+//implementation.
+package backend
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+)
+
+//SendUpdates values
+const (
+	SendUpdatesAll  = "all"
+	SendUpdatesNone = "none"
+)
+
+//WriteOptions - options of event inserts, updates, patches and deletes
+type WriteOptions struct {
+	SendUpdates           string //empty for google's default
+	ConferenceDataVersion int64  //1 to create or change conferences
+	SupportsAttachments   bool   //keep attachments, else they are ignored
+}
+
+//ListOptions - event list query. Empty fields are not filtered on.
+type ListOptions struct {
+	TimeMin      string //RFC3339, exclusive lower bound of event end
+	TimeMax      string //RFC3339, exclusive upper bound of event start
+	ShowDeleted  bool
+	SingleEvents bool //expand recurring events into instances
+	ICalUID      string
+
+	//property=value
+	PrivateExtendedProperty []string
+	SharedExtendedProperty  []string
+
+	Query                 string //free text, in summary, description, location or attendees
+	UpdatedMin            string //RFC3339, lower bound of last modification
+	OrderBy               string //startTime (of single events) or updated
+	ShowHiddenInvitations bool
+	MaxAttendees          int64 //attendees returned of each event, all if 0
+
+	//only events changed since the list returning the token. Can not be
+	//combined with time bounds, ordering or filters.
+	SyncToken string
+}
+
+//Backend - calendar operations, as in the google calendar v3 api.
+//Calendar ids accept the "primary" alias.
+type Backend interface {
+	InsertEvent(ctx context.Context, calendarID string, event *calendar.Event, opts WriteOptions) (
+		*calendar.Event,
+		error,
+	)
+	GetEvent(ctx context.Context, calendarID string, eventID string) (*calendar.Event, error)
+	PatchEvent(
+		ctx context.Context,
+		calendarID string,
+		eventID string,
+		patch *calendar.Event,
+		opts WriteOptions,
+	) (*calendar.Event, error)
+	UpdateEvent(
+		ctx context.Context,
+		calendarID string,
+		eventID string,
+		event *calendar.Event,
+		opts WriteOptions,
+	) (*calendar.Event, error)
+	DeleteEvent(ctx context.Context, calendarID string, eventID string, opts WriteOptions) error
+
+	//ImportEvent upserts event keyed by iCalUID (and original start time)
+	ImportEvent(ctx context.Context, calendarID string, event *calendar.Event) (*calendar.Event, error)
+
+	//ListEvents returns all matching events, i.e. all pages
+	ListEvents(ctx context.Context, calendarID string, opts ListOptions) (*calendar.Events, error)
+
+	ListCalendars(ctx context.Context) ([]*calendar.CalendarListEntry, error)
+	GetCalendar(ctx context.Context, calendarID string) (*calendar.CalendarListEntry, error)
+	GetColors(ctx context.Context) (*calendar.Colors, error)
+
+	ListACL(ctx context.Context, calendarID string) ([]*calendar.AclRule, error)
+	InsertACL(ctx context.Context, calendarID string, rule *calendar.AclRule, sendNotifications bool) (
+		*calendar.AclRule,
+		error,
+	)
+	PatchACL(
+		ctx context.Context,
+		calendarID string,
+		ruleID string,
+		rule *calendar.AclRule,
+		sendNotifications bool,
+	) (*calendar.AclRule, error)
+	DeleteACL(ctx context.Context, calendarID string, ruleID string) error
+
+	QueryFreeBusy(ctx context.Context, req *calendar.FreeBusyRequest) (*calendar.FreeBusyResponse, error)
+}
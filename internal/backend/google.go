@@ -0,0 +1,237 @@
+package backend
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+)
+
+//google - backend calling the google calendar api
+type google struct {
+	srv *calendar.Service
+}
+
+//NewGoogle creates a backend calling google through srv
+func NewGoogle(srv *calendar.Service) Backend {
+	return &google{srv: srv}
+}
+
+func (g *google) InsertEvent(
+	ctx context.Context,
+	calendarID string,
+	event *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	insert := g.srv.Events.Insert(calendarID, event).Context(ctx).
+		SupportsAttachments(opts.SupportsAttachments)
+	if opts.SendUpdates != "" {
+		insert = insert.SendUpdates(opts.SendUpdates)
+	}
+
+	if opts.ConferenceDataVersion > 0 {
+		insert = insert.ConferenceDataVersion(opts.ConferenceDataVersion)
+	}
+	return insert.Do()
+}
+
+func (g *google) GetEvent(ctx context.Context, calendarID string, eventID string) (
+	*calendar.Event,
+	error,
+) {
+	return g.srv.Events.Get(calendarID, eventID).Context(ctx).Do()
+}
+
+func (g *google) PatchEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	patch *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	call := g.srv.Events.Patch(calendarID, eventID, patch).Context(ctx).
+		SupportsAttachments(opts.SupportsAttachments)
+	if opts.SendUpdates != "" {
+		call = call.SendUpdates(opts.SendUpdates)
+	}
+
+	if opts.ConferenceDataVersion > 0 {
+		call = call.ConferenceDataVersion(opts.ConferenceDataVersion)
+	}
+	return call.Do()
+}
+
+func (g *google) UpdateEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	event *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	update := g.srv.Events.Update(calendarID, eventID, event).Context(ctx).
+		SupportsAttachments(opts.SupportsAttachments)
+	if opts.SendUpdates != "" {
+		update = update.SendUpdates(opts.SendUpdates)
+	}
+
+	if opts.ConferenceDataVersion > 0 {
+		update = update.ConferenceDataVersion(opts.ConferenceDataVersion)
+	}
+	return update.Do()
+}
+
+func (g *google) DeleteEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	opts WriteOptions,
+) error {
+	delete := g.srv.Events.Delete(calendarID, eventID).Context(ctx)
+	if opts.SendUpdates != "" {
+		delete = delete.SendUpdates(opts.SendUpdates)
+	}
+	return delete.Do()
+}
+
+func (g *google) ImportEvent(ctx context.Context, calendarID string, event *calendar.Event) (
+	*calendar.Event,
+	error,
+) {
+	return g.srv.Events.Import(calendarID, event).Context(ctx).Do()
+}
+
+func (g *google) ListEvents(ctx context.Context, calendarID string, opts ListOptions) (
+	*calendar.Events,
+	error,
+) {
+	list := g.srv.Events.List(calendarID).
+		ShowDeleted(opts.ShowDeleted).
+		SingleEvents(opts.SingleEvents)
+
+	if opts.TimeMin != "" {
+		list.TimeMin(opts.TimeMin)
+	}
+
+	if opts.TimeMax != "" {
+		list.TimeMax(opts.TimeMax)
+	}
+
+	if opts.ICalUID != "" {
+		list.ICalUID(opts.ICalUID)
+	}
+
+	if len(opts.PrivateExtendedProperty) > 0 {
+		list.PrivateExtendedProperty(opts.PrivateExtendedProperty...)
+	}
+
+	if len(opts.SharedExtendedProperty) > 0 {
+		list.SharedExtendedProperty(opts.SharedExtendedProperty...)
+	}
+
+	if opts.Query != "" {
+		list.Q(opts.Query)
+	}
+
+	if opts.UpdatedMin != "" {
+		list.UpdatedMin(opts.UpdatedMin)
+	}
+
+	if opts.OrderBy != "" {
+		list.OrderBy(opts.OrderBy)
+	}
+
+	if opts.ShowHiddenInvitations {
+		list.ShowHiddenInvitations(true)
+	}
+
+	if opts.MaxAttendees > 0 {
+		list.MaxAttendees(opts.MaxAttendees)
+	}
+
+	if opts.SyncToken != "" {
+		list.SyncToken(opts.SyncToken)
+	}
+
+	var result *calendar.Events
+	err := list.Pages(ctx, func(page *calendar.Events) error {
+		if result == nil {
+			result = page
+			return nil
+		}
+
+		result.Items = append(result.Items, page.Items...)
+		result.NextSyncToken = page.NextSyncToken
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.NextPageToken = ""
+	return result, nil
+}
+
+func (g *google) ListCalendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	calendars := []*calendar.CalendarListEntry{}
+	err := g.srv.CalendarList.List().Pages(ctx, func(page *calendar.CalendarList) error {
+		calendars = append(calendars, page.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return calendars, nil
+}
+
+func (g *google) GetCalendar(ctx context.Context, calendarID string) (
+	*calendar.CalendarListEntry,
+	error,
+) {
+	return g.srv.CalendarList.Get(calendarID).Context(ctx).Do()
+}
+
+func (g *google) GetColors(ctx context.Context) (*calendar.Colors, error) {
+	return g.srv.Colors.Get().Context(ctx).Do()
+}
+
+func (g *google) ListACL(ctx context.Context, calendarID string) ([]*calendar.AclRule, error) {
+	rules := []*calendar.AclRule{}
+	err := g.srv.Acl.List(calendarID).Pages(ctx, func(acl *calendar.Acl) error {
+		rules = append(rules, acl.Items...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (g *google) InsertACL(
+	ctx context.Context,
+	calendarID string,
+	rule *calendar.AclRule,
+	sendNotifications bool,
+) (*calendar.AclRule, error) {
+	return g.srv.Acl.Insert(calendarID, rule).Context(ctx).
+		SendNotifications(sendNotifications).Do()
+}
+
+func (g *google) PatchACL(
+	ctx context.Context,
+	calendarID string,
+	ruleID string,
+	rule *calendar.AclRule,
+	sendNotifications bool,
+) (*calendar.AclRule, error) {
+	return g.srv.Acl.Patch(calendarID, ruleID, rule).Context(ctx).
+		SendNotifications(sendNotifications).Do()
+}
+
+func (g *google) DeleteACL(ctx context.Context, calendarID string, ruleID string) error {
+	return g.srv.Acl.Delete(calendarID, ruleID).Context(ctx).Do()
+}
+
+func (g *google) QueryFreeBusy(ctx context.Context, req *calendar.FreeBusyRequest) (
+	*calendar.FreeBusyResponse,
+	error,
+) {
+	return g.srv.Freebusy.Query(req).Context(ctx).Do()
+}
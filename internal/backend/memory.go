@@ -0,0 +1,1123 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/random"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	primaryCalendar = "primary"
+	statusCancelled = "cancelled"
+	syncTokenPrefix = "sync-"
+)
+
+//event colors, as google has them
+var eventColors = map[string]calendar.ColorDefinition{
+	"1":  {Background: "#a4bdfc", Foreground: "#1d1d1d"},
+	"2":  {Background: "#7ae7bf", Foreground: "#1d1d1d"},
+	"3":  {Background: "#dbadff", Foreground: "#1d1d1d"},
+	"4":  {Background: "#ff887c", Foreground: "#1d1d1d"},
+	"5":  {Background: "#fbd75b", Foreground: "#1d1d1d"},
+	"6":  {Background: "#ffb878", Foreground: "#1d1d1d"},
+	"7":  {Background: "#46d6db", Foreground: "#1d1d1d"},
+	"8":  {Background: "#e1e1e1", Foreground: "#1d1d1d"},
+	"9":  {Background: "#5484ed", Foreground: "#1d1d1d"},
+	"10": {Background: "#51b749", Foreground: "#1d1d1d"},
+	"11": {Background: "#dc2127", Foreground: "#1d1d1d"},
+}
+
+//storedEvent - an event, or modified instance of a recurring event
+type storedEvent struct {
+	event *calendar.Event
+	seq   int64 //change of last modification, for sync tokens
+}
+
+type memoryCalendar struct {
+	entry    *calendar.CalendarListEntry
+	events   map[string]*storedEvent
+	order    []string //event ids, in order of creation
+	acl      map[string]*calendar.AclRule
+	aclOrder []string
+}
+
+//Memory is a backend keeping calendars in memory, behaving as google
+//does for the operations the connector uses. Deleted events are kept
+//as cancelled, for sync tokens and showDeleted.
+type Memory struct {
+	mu        sync.Mutex
+	owner     string //id of the primary calendar
+	calendars map[string]*memoryCalendar
+	order     []string
+	seq       int64 //incremented on every change
+	now       func() time.Time
+}
+
+//NewMemory creates a backend with the primary calendar of owner
+func NewMemory(owner string) *Memory {
+	m := &Memory{
+		owner:     owner,
+		calendars: map[string]*memoryCalendar{},
+		now:       time.Now,
+	}
+	m.AddCalendar(owner, owner)
+	return m
+}
+
+//AddCalendar adds a calendar owned by the owner of the primary calendar
+func (m *Memory) AddCalendar(calendarID string, summary string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.calendars[calendarID] != nil {
+		return
+	}
+
+	cal := &memoryCalendar{
+		entry: &calendar.CalendarListEntry{
+			Kind:       "calendar#calendarListEntry",
+			Id:         calendarID,
+			Summary:    summary,
+			TimeZone:   "UTC",
+			AccessRole: "owner",
+			Primary:    calendarID == m.owner,
+		},
+		events: map[string]*storedEvent{},
+		acl:    map[string]*calendar.AclRule{},
+	}
+	m.calendars[calendarID] = cal
+	m.order = append(m.order, calendarID)
+	m.setACL(cal, &calendar.AclRule{
+		Role:  "owner",
+		Scope: &calendar.AclRuleScope{Type: "user", Value: m.owner},
+	})
+}
+
+func apiError(code int, message string) error {
+	return &googleapi.Error{Code: code, Message: message}
+}
+
+func notFound() error {
+	return apiError(http.StatusNotFound, "Not Found")
+}
+
+func (m *Memory) calendar(calendarID string) (*memoryCalendar, error) {
+	if calendarID == primaryCalendar {
+		calendarID = m.owner
+	}
+
+	cal := m.calendars[calendarID]
+	if cal == nil {
+		return nil, notFound()
+	}
+	return cal, nil
+}
+
+//copyJSON - deep copy of google api structs
+func copyJSON(from interface{}, to interface{}) {
+	b, err := json.Marshal(from)
+	if err == nil {
+		err = json.Unmarshal(b, to)
+	}
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func copyEvent(event *calendar.Event) *calendar.Event {
+	c := calendar.Event{}
+	copyJSON(event, &c)
+	return &c
+}
+
+//isValidID - google's rules for client specified event ids
+func isValidID(id string) bool {
+	if len(id) < 5 || len(id) > 1024 {
+		return false
+	}
+
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'v' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+//times - start and end of event, validated as google does
+func times(event *calendar.Event) (start eventTime, end eventTime, err error) {
+	start, err = parseEventTime(event.Start)
+	if err != nil {
+		return start, end, apiError(http.StatusBadRequest, "Invalid start time: "+err.Error())
+	}
+
+	end, err = parseEventTime(event.End)
+	if err != nil {
+		return start, end, apiError(http.StatusBadRequest, "Invalid end time: "+err.Error())
+	}
+
+	if end.t.Before(start.t) || start.allDay != end.allDay {
+		return start, end, apiError(http.StatusBadRequest, "The specified time range is empty.")
+	}
+
+	if len(event.Recurrence) > 0 {
+		if !start.allDay && event.Start.TimeZone == "" {
+			return start, end, apiError(http.StatusBadRequest,
+				"Missing time zone definition for start time.")
+		}
+
+		_, err = occurrences(start, event.Recurrence, start.t)
+		if err != nil {
+			return start, end, apiError(http.StatusBadRequest, "Invalid recurrence rule: "+err.Error())
+		}
+	}
+	return start, end, nil
+}
+
+//stamp - marks event as changed
+func (m *Memory) stamp(cal *memoryCalendar, event *calendar.Event) {
+	m.seq++
+	event.Kind = "calendar#event"
+	event.Etag = fmt.Sprintf("\"%d\"", m.seq)
+	event.Updated = m.now().UTC().Format(time.RFC3339)
+
+	stored := cal.events[event.Id]
+	if stored == nil {
+		stored = &storedEvent{}
+		cal.events[event.Id] = stored
+		cal.order = append(cal.order, event.Id)
+	}
+	stored.event = event
+	stored.seq = m.seq
+}
+
+//normalize - fills in what google does on writes. existing is nil on insert.
+func (m *Memory) normalize(
+	cal *memoryCalendar,
+	event *calendar.Event,
+	existing *calendar.Event,
+	opts WriteOptions,
+) {
+	if event.Status == "" {
+		event.Status = "confirmed"
+	}
+
+	if event.Reminders == nil {
+		event.Reminders = &calendar.EventReminders{UseDefault: true}
+	}
+
+	self := &calendar.EventOrganizer{Email: cal.entry.Id, Self: true}
+	if event.Organizer == nil {
+		event.Organizer = self
+	}
+
+	if event.Creator == nil {
+		event.Creator = &calendar.EventCreator{Email: cal.entry.Id, Self: true}
+	}
+
+	for _, v := range event.Attendees {
+		if v.ResponseStatus == "" {
+			v.ResponseStatus = "needsAction"
+		}
+		v.Self = v.Email == cal.entry.Id
+		v.Organizer = v.Email == event.Organizer.Email
+	}
+
+	if existing != nil {
+		event.Id = existing.Id
+		event.ICalUID = existing.ICalUID
+		event.Created = existing.Created
+		event.RecurringEventId = existing.RecurringEventId
+		event.OriginalStartTime = existing.OriginalStartTime
+		event.Sequence = existing.Sequence
+
+		if !sameJSON(existing.Start, event.Start) || !sameJSON(existing.End, event.End) ||
+			!sameJSON(existing.Recurrence, event.Recurrence) {
+			event.Sequence++
+		}
+
+		if opts.ConferenceDataVersion == 0 {
+			event.ConferenceData = existing.ConferenceData
+			event.HangoutLink = existing.HangoutLink
+		}
+
+		if !opts.SupportsAttachments {
+			event.Attachments = existing.Attachments
+		}
+	} else {
+		event.Created = m.now().UTC().Format(time.RFC3339)
+		if event.ICalUID == "" {
+			event.ICalUID = event.Id + "@google.com"
+		}
+
+		if opts.ConferenceDataVersion == 0 {
+			event.ConferenceData = nil
+		}
+
+		if !opts.SupportsAttachments {
+			event.Attachments = nil
+		}
+	}
+
+	event.HtmlLink = "https://calendar.google.com/calendar/event?eid=" + event.Id
+	m.createConference(event)
+}
+
+//sameJSON - compares api structs by their json form
+func sameJSON(a interface{}, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+//createConference - completes conference create requests immediately
+func (m *Memory) createConference(event *calendar.Event) {
+	data := event.ConferenceData
+	if data == nil || data.CreateRequest == nil || data.ConferenceId != "" {
+		return
+	}
+
+	solution := data.CreateRequest.ConferenceSolutionKey
+	if solution == nil {
+		solution = &calendar.ConferenceSolutionKey{Type: "hangoutsMeet"}
+	}
+
+	code := event.Id
+	for len(code) < 10 {
+		code += "x"
+	}
+	conferenceID := code[0:3] + "-" + code[3:7] + "-" + code[7:10]
+	uri := "https://meet.google.com/" + conferenceID
+
+	data.ConferenceId = conferenceID
+	data.ConferenceSolution = &calendar.ConferenceSolution{Key: solution, Name: "Google Meet"}
+	data.CreateRequest.ConferenceSolutionKey = solution
+	data.CreateRequest.Status = &calendar.ConferenceRequestStatus{StatusCode: "success"}
+	data.EntryPoints = []*calendar.EntryPoint{{
+		EntryPointType: "video",
+		Uri:            uri,
+		Label:          strings.TrimPrefix(uri, "https://"),
+	}}
+	event.HangoutLink = uri
+}
+
+//InsertEvent - see Backend
+func (m *Memory) InsertEvent(
+	ctx context.Context,
+	calendarID string,
+	event *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = times(event)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted := copyEvent(event)
+	if inserted.Id == "" {
+		inserted.Id = random.ID()
+	} else if !isValidID(inserted.Id) {
+		return nil, apiError(http.StatusBadRequest, "Invalid resource id value.")
+	} else if cal.events[inserted.Id] != nil {
+		return nil, apiError(http.StatusConflict, "The requested identifier already exists.")
+	}
+
+	inserted.RecurringEventId = ""
+	inserted.OriginalStartTime = nil
+	m.normalize(cal, inserted, nil, opts)
+	m.stamp(cal, inserted)
+	return copyEvent(inserted), nil
+}
+
+//splitInstanceID - recurring event id and instance suffix of an instance id
+func splitInstanceID(eventID string) (string, string, bool) {
+	i := strings.LastIndex(eventID, "_")
+	if i < 0 {
+		return "", "", false
+	}
+	return eventID[:i], eventID[i+1:], true
+}
+
+//instances - instances of recurring event master, starting before end
+func instances(master *calendar.Event, end time.Time) ([]*calendar.Event, error) {
+	start, finish, err := times(master)
+	if err != nil {
+		return nil, err
+	}
+
+	starts, err := occurrences(start, master.Recurrence, end)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := finish.t.Sub(start.t)
+	result := []*calendar.Event{}
+	for _, v := range starts {
+		instance := copyEvent(master)
+		instance.Id = master.Id + "_" + v.instanceSuffix()
+		instance.RecurringEventId = master.Id
+		instance.Recurrence = nil
+		instance.OriginalStartTime = v.format(master.Start.TimeZone)
+		instance.Start = v.format(master.Start.TimeZone)
+		instance.End = eventTime{t: v.t.Add(duration), allDay: v.allDay}.format(master.End.TimeZone)
+		result = append(result, instance)
+	}
+	return result, nil
+}
+
+//findEvent - stored event, or unmodified instance of a recurring event
+func (m *Memory) findEvent(cal *memoryCalendar, eventID string) (*calendar.Event, error) {
+	if stored := cal.events[eventID]; stored != nil {
+		return stored.event, nil
+	}
+
+	masterID, suffix, ok := splitInstanceID(eventID)
+	master := cal.events[masterID]
+	if !ok || master == nil || len(master.event.Recurrence) == 0 ||
+		master.event.Status == statusCancelled {
+		return nil, notFound()
+	}
+
+	end, err := parseICSTime(suffix, time.UTC)
+	if err != nil {
+		return nil, notFound()
+	}
+
+	all, err := instances(master.event, end.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range all {
+		if v.Id == eventID {
+			return v, nil
+		}
+	}
+	return nil, notFound()
+}
+
+//GetEvent - see Backend
+func (m *Memory) GetEvent(ctx context.Context, calendarID string, eventID string) (
+	*calendar.Event,
+	error,
+) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := m.findEvent(cal, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return copyEvent(event), nil
+}
+
+//mergeJSON - merges patch into base, as google patches. Objects are
+//merged, other values (including arrays) replaced and nulls removed.
+func mergeJSON(base map[string]interface{}, patch map[string]interface{}) {
+	for k, v := range patch {
+		if v == nil {
+			delete(base, k)
+			continue
+		}
+
+		if sub, ok := v.(map[string]interface{}); ok {
+			if existing, ok := base[k].(map[string]interface{}); ok {
+				mergeJSON(existing, sub)
+				continue
+			}
+		}
+		base[k] = v
+	}
+}
+
+//write - stores event as the new version of existing
+func (m *Memory) write(
+	cal *memoryCalendar,
+	event *calendar.Event,
+	existing *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	_, _, err := times(event)
+	if err != nil {
+		return nil, err
+	}
+
+	m.normalize(cal, event, existing, opts)
+	m.stamp(cal, event)
+	return copyEvent(event), nil
+}
+
+//PatchEvent - see Backend
+func (m *Memory) PatchEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	patch *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := m.findEvent(cal, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	base := map[string]interface{}{}
+	changes := map[string]interface{}{}
+	copyJSON(existing, &base)
+	copyJSON(patch, &changes)
+	mergeJSON(base, changes)
+
+	patched := calendar.Event{}
+	copyJSON(base, &patched)
+	return m.write(cal, &patched, existing, opts)
+}
+
+//UpdateEvent - see Backend
+func (m *Memory) UpdateEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	event *calendar.Event,
+	opts WriteOptions,
+) (*calendar.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := m.findEvent(cal, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := copyEvent(event)
+	if existing.Organizer != nil && updated.Organizer == nil {
+		updated.Organizer = existing.Organizer
+	}
+	updated.Creator = existing.Creator
+	return m.write(cal, updated, existing, opts)
+}
+
+//DeleteEvent - see Backend. Deleting a recurring event also deletes
+//its modified instances.
+func (m *Memory) DeleteEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	opts WriteOptions,
+) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return err
+	}
+
+	existing, err := m.findEvent(cal, eventID)
+	if err != nil {
+		return err
+	}
+
+	if existing.Status == statusCancelled {
+		return apiError(http.StatusGone, "Resource has been deleted")
+	}
+
+	deleted := copyEvent(existing)
+	deleted.Status = statusCancelled
+	m.stamp(cal, deleted)
+
+	for _, id := range cal.order {
+		v := cal.events[id].event
+		if v.RecurringEventId == eventID && v.Status != statusCancelled {
+			instance := copyEvent(v)
+			instance.Status = statusCancelled
+			m.stamp(cal, instance)
+		}
+	}
+	return nil
+}
+
+//findByICalUID - stored event with uid and original start, if any
+func (m *Memory) findByICalUID(
+	cal *memoryCalendar,
+	uid string,
+	originalStart *calendar.EventDateTime,
+) *calendar.Event {
+	for _, id := range cal.order {
+		v := cal.events[id].event
+		if v.ICalUID != uid {
+			continue
+		}
+
+		if originalStart == nil && v.OriginalStartTime == nil {
+			return v
+		}
+
+		if originalStart != nil && v.OriginalStartTime != nil {
+			a, errA := parseEventTime(originalStart)
+			b, errB := parseEventTime(v.OriginalStartTime)
+			if errA == nil && errB == nil && a.t.Equal(b.t) {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+//ImportEvent - see Backend
+func (m *Memory) ImportEvent(ctx context.Context, calendarID string, event *calendar.Event) (
+	*calendar.Event,
+	error,
+) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	if event.ICalUID == "" {
+		return nil, apiError(http.StatusBadRequest, "Missing iCalUID.")
+	}
+
+	imported := copyEvent(event)
+	opts := WriteOptions{SupportsAttachments: true}
+	existing := m.findByICalUID(cal, event.ICalUID, event.OriginalStartTime)
+	if existing != nil {
+		result, err := m.write(cal, imported, existing, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		//the sequence is the organizer's, so is kept
+		imported.Sequence = event.Sequence
+		result.Sequence = event.Sequence
+		return result, nil
+	}
+
+	imported.Id = random.ID()
+	if event.OriginalStartTime != nil {
+		master := m.findByICalUID(cal, event.ICalUID, nil)
+		original, err := parseEventTime(event.OriginalStartTime)
+		if err != nil {
+			return nil, apiError(http.StatusBadRequest, "Invalid original start time.")
+		}
+
+		if master != nil {
+			imported.Id = master.Id + "_" + original.instanceSuffix()
+			imported.RecurringEventId = master.Id
+		}
+	}
+
+	_, _, err = times(imported)
+	if err != nil {
+		return nil, err
+	}
+
+	m.normalize(cal, imported, nil, opts)
+	imported.ICalUID = event.ICalUID
+	imported.Sequence = event.Sequence
+	m.stamp(cal, imported)
+	return copyEvent(imported), nil
+}
+
+//hasProperties - whether properties has all key=value filters
+func hasProperties(properties map[string]string, filters []string) bool {
+	for _, v := range filters {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || properties[kv[0]] != kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+//matches - whether event passes the non time filters of opts
+func matches(event *calendar.Event, opts ListOptions) bool {
+	if !opts.ShowDeleted && event.Status == statusCancelled {
+		return false
+	}
+
+	if opts.ICalUID != "" && event.ICalUID != opts.ICalUID {
+		return false
+	}
+
+	if opts.Query != "" && !containsText(event, opts.Query) {
+		return false
+	}
+
+	if opts.UpdatedMin != "" {
+		min, _ := time.Parse(time.RFC3339, opts.UpdatedMin)
+		updated, err := time.Parse(time.RFC3339, event.Updated)
+		if err != nil || updated.Before(min) {
+			return false
+		}
+	}
+
+	private, shared := map[string]string{}, map[string]string{}
+	if event.ExtendedProperties != nil {
+		private, shared = event.ExtendedProperties.Private, event.ExtendedProperties.Shared
+	}
+	return hasProperties(private, opts.PrivateExtendedProperty) &&
+		hasProperties(shared, opts.SharedExtendedProperty)
+}
+
+//containsText - whether the text fields of event contain text, ignoring
+//case, as a simple take on google's free text search
+func containsText(event *calendar.Event, text string) bool {
+	fields := []string{event.Summary, event.Description, event.Location}
+	if event.Organizer != nil {
+		fields = append(fields, event.Organizer.Email, event.Organizer.DisplayName)
+	}
+
+	for _, v := range event.Attendees {
+		fields = append(fields, v.Email, v.DisplayName)
+	}
+
+	text = strings.ToLower(text)
+	for _, v := range fields {
+		if strings.Contains(strings.ToLower(v), text) {
+			return true
+		}
+	}
+	return false
+}
+
+//limitAttendees - event with at most max attendees, all if max is 0
+func limitAttendees(event *calendar.Event, max int64) *calendar.Event {
+	if max > 0 && int64(len(event.Attendees)) > max {
+		event.Attendees = event.Attendees[:max]
+		event.AttendeesOmitted = true
+	}
+	return event
+}
+
+//overlaps - whether event is within the time bounds
+func overlaps(event *calendar.Event, min time.Time, max time.Time) bool {
+	start, end, err := times(event)
+	if err != nil {
+		return false
+	}
+
+	if end.t.Equal(start.t) { //zero length events overlap at their start
+		return !start.t.Before(min) && start.t.Before(max)
+	}
+	return end.t.After(min) && start.t.Before(max)
+}
+
+//parseBound - parses time bound of list, with fallback
+func parseBound(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, apiError(http.StatusBadRequest, "Bad Request")
+	}
+	return t, nil
+}
+
+//expand - instances of recurring master between min and max. Stored
+//instances are listed as events themselves, so are left out unless all.
+func expand(
+	cal *memoryCalendar,
+	master *calendar.Event,
+	min time.Time,
+	max time.Time,
+	all bool,
+) ([]*calendar.Event, error) {
+	generated, err := instances(master, max)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*calendar.Event{}
+	for _, v := range generated {
+		if (all || cal.events[v.Id] == nil) && overlaps(v, min, max) {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+//ListEvents - see Backend
+func (m *Memory) ListEvents(ctx context.Context, calendarID string, opts ListOptions) (
+	*calendar.Events,
+	error,
+) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &calendar.Events{
+		Kind:          "calendar#events",
+		Summary:       cal.entry.Summary,
+		TimeZone:      cal.entry.TimeZone,
+		AccessRole:    cal.entry.AccessRole,
+		Updated:       m.now().UTC().Format(time.RFC3339),
+		Items:         []*calendar.Event{},
+		NextSyncToken: syncTokenPrefix + strconv.FormatInt(m.seq, 10),
+	}
+
+	if opts.SyncToken != "" {
+		since, err := m.parseSyncToken(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range cal.order {
+			if stored := cal.events[id]; stored.seq > since {
+				result.Items = append(result.Items, limitAttendees(copyEvent(stored.event), opts.MaxAttendees))
+			}
+		}
+		return result, nil
+	}
+
+	orderable := opts.OrderBy == "" || opts.OrderBy == "updated" || opts.OrderBy == "startTime" && opts.SingleEvents
+	if !orderable {
+		return nil, apiError(http.StatusBadRequest, "The requested ordering is not available for the particular query.")
+	}
+
+	if opts.UpdatedMin != "" {
+		_, err = parseBound(opts.UpdatedMin, time.Time{})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	min, err := parseBound(opts.TimeMin, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := parseBound(opts.TimeMax, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return nil, err
+	}
+
+	//endless recurrences are expanded for a limited time
+	expandMax := max
+	if opts.TimeMax == "" {
+		expandMax = m.now().AddDate(2, 0, 0)
+	}
+
+	for _, id := range cal.order {
+		event := cal.events[id].event
+		if !matches(event, opts) {
+			continue
+		}
+
+		if len(event.Recurrence) == 0 {
+			if overlaps(event, min, max) {
+				result.Items = append(result.Items, copyEvent(event))
+			}
+			continue
+		}
+
+		expanded, err := expand(cal, event, min, expandMax, !opts.SingleEvents)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.SingleEvents {
+			result.Items = append(result.Items, expanded...)
+		} else if len(expanded) > 0 || opts.TimeMin == "" && opts.TimeMax == "" {
+			result.Items = append(result.Items, copyEvent(event))
+		}
+	}
+
+	if opts.SingleEvents {
+		sort.SliceStable(result.Items, func(i, j int) bool {
+			a, _ := parseEventTime(result.Items[i].Start)
+			b, _ := parseEventTime(result.Items[j].Start)
+			return a.t.Before(b.t)
+		})
+	}
+
+	if opts.OrderBy == "updated" {
+		sort.SliceStable(result.Items, func(i, j int) bool {
+			return result.Items[i].Updated < result.Items[j].Updated
+		})
+	}
+
+	for _, v := range result.Items {
+		limitAttendees(v, opts.MaxAttendees)
+	}
+	return result, nil
+}
+
+//parseSyncToken - change a sync token was issued at
+func (m *Memory) parseSyncToken(opts ListOptions) (int64, error) {
+	if opts.TimeMin != "" || opts.TimeMax != "" || opts.ICalUID != "" || opts.Query != "" ||
+		opts.UpdatedMin != "" || opts.OrderBy != "" ||
+		len(opts.PrivateExtendedProperty) > 0 || len(opts.SharedExtendedProperty) > 0 {
+		return 0, apiError(http.StatusBadRequest, "Sync token can not be combined with filters.")
+	}
+
+	since, err := strconv.ParseInt(strings.TrimPrefix(opts.SyncToken, syncTokenPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(opts.SyncToken, syncTokenPrefix) || since > m.seq {
+		return 0, apiError(http.StatusGone, "Sync token is no longer valid, a full sync is required.")
+	}
+	return since, nil
+}
+
+//ListCalendars - see Backend
+func (m *Memory) ListCalendars(ctx context.Context) ([]*calendar.CalendarListEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	calendars := []*calendar.CalendarListEntry{}
+	for _, id := range m.order {
+		entry := calendar.CalendarListEntry{}
+		copyJSON(m.calendars[id].entry, &entry)
+		calendars = append(calendars, &entry)
+	}
+	return calendars, nil
+}
+
+//GetCalendar - see Backend
+func (m *Memory) GetCalendar(ctx context.Context, calendarID string) (
+	*calendar.CalendarListEntry,
+	error,
+) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := calendar.CalendarListEntry{}
+	copyJSON(cal.entry, &entry)
+	return &entry, nil
+}
+
+//GetColors - see Backend
+func (m *Memory) GetColors(ctx context.Context) (*calendar.Colors, error) {
+	return &calendar.Colors{Kind: "calendar#colors", Event: eventColors}, nil
+}
+
+//aclID - google's id of rules, by scope
+func aclID(scope *calendar.AclRuleScope) string {
+	if scope == nil || scope.Type == "default" {
+		return "default"
+	}
+	return scope.Type + ":" + scope.Value
+}
+
+func (m *Memory) setACL(cal *memoryCalendar, rule *calendar.AclRule) *calendar.AclRule {
+	m.seq++
+	rule.Kind = "calendar#aclRule"
+	rule.Id = aclID(rule.Scope)
+	rule.Etag = fmt.Sprintf("\"%d\"", m.seq)
+
+	if cal.acl[rule.Id] == nil {
+		cal.aclOrder = append(cal.aclOrder, rule.Id)
+	}
+	cal.acl[rule.Id] = rule
+
+	copied := calendar.AclRule{}
+	copyJSON(rule, &copied)
+	return &copied
+}
+
+//ListACL - see Backend
+func (m *Memory) ListACL(ctx context.Context, calendarID string) ([]*calendar.AclRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []*calendar.AclRule{}
+	for _, id := range cal.aclOrder {
+		if rule := cal.acl[id]; rule != nil {
+			copied := calendar.AclRule{}
+			copyJSON(rule, &copied)
+			rules = append(rules, &copied)
+		}
+	}
+	return rules, nil
+}
+
+//InsertACL - see Backend. Inserting an existing scope replaces its role.
+func (m *Memory) InsertACL(
+	ctx context.Context,
+	calendarID string,
+	rule *calendar.AclRule,
+	sendNotifications bool,
+) (*calendar.AclRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.Scope == nil || rule.Role == "" {
+		return nil, apiError(http.StatusBadRequest, "Missing scope or role.")
+	}
+
+	inserted := calendar.AclRule{}
+	copyJSON(rule, &inserted)
+	return m.setACL(cal, &inserted), nil
+}
+
+//PatchACL - see Backend
+func (m *Memory) PatchACL(
+	ctx context.Context,
+	calendarID string,
+	ruleID string,
+	rule *calendar.AclRule,
+	sendNotifications bool,
+) (*calendar.AclRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := cal.acl[ruleID]
+	if existing == nil {
+		return nil, notFound()
+	}
+
+	patched := calendar.AclRule{}
+	copyJSON(existing, &patched)
+	if rule.Role != "" {
+		patched.Role = rule.Role
+	}
+	return m.setACL(cal, &patched), nil
+}
+
+//DeleteACL - see Backend
+func (m *Memory) DeleteACL(ctx context.Context, calendarID string, ruleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cal, err := m.calendar(calendarID)
+	if err != nil {
+		return err
+	}
+
+	if cal.acl[ruleID] == nil {
+		return notFound()
+	}
+	delete(cal.acl, ruleID)
+	m.seq++
+	return nil
+}
+
+//QueryFreeBusy - see Backend. Busy periods are those of opaque, not
+//cancelled events, merged where they overlap.
+func (m *Memory) QueryFreeBusy(ctx context.Context, req *calendar.FreeBusyRequest) (
+	*calendar.FreeBusyResponse,
+	error,
+) {
+	min, errMin := time.Parse(time.RFC3339, req.TimeMin)
+	max, errMax := time.Parse(time.RFC3339, req.TimeMax)
+	if errMin != nil || errMax != nil || !min.Before(max) {
+		return nil, apiError(http.StatusBadRequest, "Bad time range.")
+	}
+
+	response := &calendar.FreeBusyResponse{
+		Kind:      "calendar#freeBusy",
+		TimeMin:   req.TimeMin,
+		TimeMax:   req.TimeMax,
+		Calendars: map[string]calendar.FreeBusyCalendar{},
+	}
+
+	for _, item := range req.Items {
+		events, err := m.ListEvents(ctx, item.Id, ListOptions{
+			TimeMin:      req.TimeMin,
+			TimeMax:      req.TimeMax,
+			SingleEvents: true,
+		})
+		if err != nil {
+			response.Calendars[item.Id] = calendar.FreeBusyCalendar{
+				Errors: []*calendar.Error{{Domain: "global", Reason: "notFound"}},
+			}
+			continue
+		}
+
+		busy := []*calendar.TimePeriod{}
+		var last time.Time
+		for _, v := range events.Items {
+			if v.Transparency == "transparent" {
+				continue
+			}
+
+			start, end, _ := times(v)
+			if start.t.Before(min) {
+				start.t = min
+			}
+
+			if end.t.After(max) {
+				end.t = max
+			}
+
+			if len(busy) > 0 && !start.t.After(last) {
+				if end.t.After(last) {
+					last = end.t
+					busy[len(busy)-1].End = last.UTC().Format(time.RFC3339)
+				}
+				continue
+			}
+
+			last = end.t
+			busy = append(busy, &calendar.TimePeriod{
+				Start: start.t.UTC().Format(time.RFC3339),
+				End:   end.t.UTC().Format(time.RFC3339),
+			})
+		}
+		response.Calendars[item.Id] = calendar.FreeBusyCalendar{Busy: busy}
+	}
+	return response, nil
+}
@@ -0,0 +1,445 @@
+package backend
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+const owner = "calendar@example.com"
+
+func errorCode(err error) int {
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func insert(t *testing.T, m *Memory, event *calendar.Event) *calendar.Event {
+	inserted, err := m.InsertEvent(context.Background(), primaryCalendar, event, WriteOptions{})
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	return inserted
+}
+
+func list(t *testing.T, m *Memory, opts ListOptions) *calendar.Events {
+	events, err := m.ListEvents(context.Background(), primaryCalendar, opts)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	return events
+}
+
+func newEvent(id string, start string, end string) *calendar.Event {
+	return &calendar.Event{
+		Id:      id,
+		Summary: "Meeting",
+		Start:   &calendar.EventDateTime{DateTime: start},
+		End:     &calendar.EventDateTime{DateTime: end},
+	}
+}
+
+func TestMemoryInsert(t *testing.T) {
+	m := NewMemory(owner)
+	ctx := context.Background()
+
+	event := newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z")
+	event.Attendees = []*calendar.EventAttendee{{Email: "guest@example.com"}, {Email: owner}}
+	inserted := insert(t, m, event)
+
+	if inserted.Id == "" || inserted.Etag == "" || inserted.ICalUID != inserted.Id+"@google.com" {
+		t.Errorf("id, etag and iCalUID should be set, got %q %q %q",
+			inserted.Id, inserted.Etag, inserted.ICalUID)
+	}
+
+	if inserted.Organizer == nil || inserted.Organizer.Email != owner {
+		t.Errorf("organizer should default to the calendar owner, got %+v", inserted.Organizer)
+	}
+
+	if inserted.Attendees[0].ResponseStatus != "needsAction" || !inserted.Attendees[1].Self {
+		t.Errorf("attendees not normalized: %+v %+v", inserted.Attendees[0], inserted.Attendees[1])
+	}
+
+	got, err := m.GetEvent(ctx, owner, inserted.Id)
+	if err != nil || got.Etag != inserted.Etag {
+		t.Errorf("get by calendar id failed: %v", err)
+	}
+
+	tests := []struct {
+		event *calendar.Event
+		code  int
+	}{
+		{newEvent(inserted.Id, "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z"), http.StatusConflict},
+		{newEvent("Not-Valid", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z"), http.StatusBadRequest},
+		{newEvent("", "", "2020-01-06T10:00:00Z"), http.StatusBadRequest},
+		{newEvent("", "2020-01-06T10:00:00Z", "2020-01-06T09:00:00Z"), http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		_, err := m.InsertEvent(ctx, primaryCalendar, test.event, WriteOptions{})
+		if errorCode(err) != test.code {
+			t.Errorf("insert %+v: got %v, want status %d", test.event, err, test.code)
+		}
+	}
+
+	_, err = m.GetEvent(ctx, "other@example.com", inserted.Id)
+	if errorCode(err) != http.StatusNotFound {
+		t.Errorf("unknown calendar should be 404, got %v", err)
+	}
+}
+
+func TestMemoryPatch(t *testing.T) {
+	m := NewMemory(owner)
+	ctx := context.Background()
+
+	event := newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z")
+	event.Location = "Room 1"
+	event.ExtendedProperties = &calendar.EventExtendedProperties{
+		Private: map[string]string{"a": "1", "b": "2"},
+	}
+	event.Attachments = []*calendar.EventAttachment{{FileUrl: "https://example.com/f"}}
+	inserted := insert(t, m, event)
+
+	patch := &calendar.Event{
+		Summary:            "Renamed",
+		ExtendedProperties: &calendar.EventExtendedProperties{Private: map[string]string{"b": "3"}},
+		NullFields:         []string{"Location"},
+	}
+	patched, err := m.PatchEvent(ctx, primaryCalendar, inserted.Id, patch, WriteOptions{})
+	if err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	if patched.Summary != "Renamed" || patched.Location != "" {
+		t.Errorf("patch should set summary and clear location, got %q %q",
+			patched.Summary, patched.Location)
+	}
+
+	if private := patched.ExtendedProperties.Private; private["a"] != "1" || private["b"] != "3" {
+		t.Errorf("extended properties should be merged, got %v", private)
+	}
+
+	if patched.Etag == inserted.Etag || patched.Sequence != inserted.Sequence {
+		t.Errorf("etag should change, sequence only on time changes: %q %d",
+			patched.Etag, patched.Sequence)
+	}
+
+	//attachments are dropped unless supported
+	if len(patched.Attachments) != 0 {
+		t.Errorf("attachments should be ignored on insert without support")
+	}
+
+	moved, err := m.PatchEvent(ctx, primaryCalendar, inserted.Id, &calendar.Event{
+		Start: &calendar.EventDateTime{DateTime: "2020-01-06T11:00:00Z"},
+		End:   &calendar.EventDateTime{DateTime: "2020-01-06T12:00:00Z"},
+	}, WriteOptions{})
+	if err != nil || moved.Sequence != inserted.Sequence+1 {
+		t.Errorf("moving an event should increment sequence: %v", err)
+	}
+}
+
+func TestMemoryConference(t *testing.T) {
+	m := NewMemory(owner)
+	event := newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z")
+	event.ConferenceData = &calendar.ConferenceData{
+		CreateRequest: &calendar.CreateConferenceRequest{RequestId: "r1"},
+	}
+
+	ignored := insert(t, m, event)
+	if ignored.ConferenceData != nil {
+		t.Errorf("conference should need ConferenceDataVersion 1")
+	}
+
+	created, err := m.InsertEvent(context.Background(), primaryCalendar, event,
+		WriteOptions{ConferenceDataVersion: 1})
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	data := created.ConferenceData
+	if data == nil || data.ConferenceId == "" || data.CreateRequest.Status.StatusCode != "success" ||
+		created.HangoutLink == "" {
+		t.Errorf("conference should be created, got %+v", data)
+	}
+}
+
+func TestMemoryRecurrence(t *testing.T) {
+	m := NewMemory(owner)
+	ctx := context.Background()
+
+	event := newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z")
+	event.Start.TimeZone, event.End.TimeZone = "UTC", "UTC"
+	event.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=3"}
+	master := insert(t, m, event)
+
+	opts := ListOptions{SingleEvents: true}
+	items := list(t, m, opts).Items
+	if len(items) != 3 || items[1].Id != master.Id+"_20200107T090000Z" ||
+		items[1].RecurringEventId != master.Id {
+		t.Fatalf("expected 3 instances, got %d", len(items))
+	}
+
+	_, err := m.PatchEvent(ctx, primaryCalendar, items[1].Id, &calendar.Event{Summary: "Moved"},
+		WriteOptions{})
+	if err != nil {
+		t.Fatalf("patch of instance failed: %v", err)
+	}
+
+	err = m.DeleteEvent(ctx, primaryCalendar, items[2].Id, WriteOptions{})
+	if err != nil {
+		t.Fatalf("delete of instance failed: %v", err)
+	}
+
+	items = list(t, m, opts).Items
+	if len(items) != 2 || items[1].Summary != "Moved" {
+		t.Errorf("expected first and modified instance, got %d", len(items))
+	}
+
+	if unexpanded := list(t, m, ListOptions{}).Items; len(unexpanded) != 2 {
+		t.Errorf("expected master and modified instance, got %d", len(unexpanded))
+	}
+
+	if deleted := list(t, m, ListOptions{ShowDeleted: true}).Items; len(deleted) != 3 {
+		t.Errorf("expected cancelled instance to be shown, got %d", len(deleted))
+	}
+
+	bounded := list(t, m, ListOptions{
+		SingleEvents: true,
+		TimeMin:      "2020-01-07T00:00:00Z",
+		TimeMax:      "2020-01-08T00:00:00Z",
+	}).Items
+	if len(bounded) != 1 || bounded[0].Id != items[1].Id {
+		t.Errorf("expected only the modified instance in range, got %d", len(bounded))
+	}
+
+	err = m.DeleteEvent(ctx, primaryCalendar, master.Id, WriteOptions{})
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if items = list(t, m, opts).Items; len(items) != 0 {
+		t.Errorf("deleting the master should delete all instances, got %d", len(items))
+	}
+
+	err = m.DeleteEvent(ctx, primaryCalendar, master.Id, WriteOptions{})
+	if errorCode(err) != http.StatusGone {
+		t.Errorf("deleting twice should be 410, got %v", err)
+	}
+}
+
+func TestMemorySyncToken(t *testing.T) {
+	m := NewMemory(owner)
+	ctx := context.Background()
+
+	first := insert(t, m, newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z"))
+	token := list(t, m, ListOptions{}).NextSyncToken
+
+	if items := list(t, m, ListOptions{SyncToken: token}).Items; len(items) != 0 {
+		t.Errorf("no changes expected, got %d", len(items))
+	}
+
+	second := insert(t, m, newEvent("", "2020-01-07T09:00:00Z", "2020-01-07T10:00:00Z"))
+	err := m.DeleteEvent(ctx, primaryCalendar, first.Id, WriteOptions{})
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	changes := list(t, m, ListOptions{SyncToken: token})
+	if len(changes.Items) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes.Items))
+	}
+
+	if changes.Items[0].Status != statusCancelled || changes.Items[1].Id != second.Id {
+		t.Errorf("expected deleted and inserted event, got %+v", changes.Items)
+	}
+
+	tests := []struct {
+		opts ListOptions
+		code int
+	}{
+		{ListOptions{SyncToken: "bogus"}, http.StatusGone},
+		{ListOptions{SyncToken: "sync-1000"}, http.StatusGone},
+		{ListOptions{SyncToken: token, TimeMin: "2020-01-01T00:00:00Z"}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		_, err := m.ListEvents(ctx, primaryCalendar, test.opts)
+		if errorCode(err) != test.code {
+			t.Errorf("list %+v: got %v, want status %d", test.opts, err, test.code)
+		}
+	}
+}
+
+func TestMemoryListFilters(t *testing.T) {
+	m := NewMemory(owner)
+	event := newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z")
+	event.ExtendedProperties = &calendar.EventExtendedProperties{
+		Private: map[string]string{"externalId": "42"},
+	}
+	event.Description = "Quarterly review"
+	event.Attendees = []*calendar.EventAttendee{{Email: "a@example.com"}, {Email: "b@example.com"}}
+	tagged := insert(t, m, event)
+	insert(t, m, newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z"))
+
+	tests := []struct {
+		opts ListOptions
+		want int
+	}{
+		{ListOptions{}, 2},
+		{ListOptions{PrivateExtendedProperty: []string{"externalId=42"}}, 1},
+		{ListOptions{PrivateExtendedProperty: []string{"externalId=43"}}, 0},
+		{ListOptions{SharedExtendedProperty: []string{"externalId=42"}}, 0},
+		{ListOptions{ICalUID: tagged.ICalUID}, 1},
+		{ListOptions{TimeMin: "2020-01-06T10:00:00Z"}, 0},
+		{ListOptions{TimeMax: "2020-01-06T09:00:00Z"}, 0},
+		{ListOptions{TimeMin: "2020-01-06T09:30:00Z", TimeMax: "2020-01-06T09:45:00Z"}, 2},
+		{ListOptions{Query: "QUARTERLY"}, 1},
+		{ListOptions{Query: "b@example"}, 1},
+		{ListOptions{Query: "Meeting"}, 2},
+		{ListOptions{Query: "lunch"}, 0},
+		{ListOptions{UpdatedMin: "2000-01-01T00:00:00Z"}, 2},
+		{ListOptions{UpdatedMin: "9000-01-01T00:00:00Z"}, 0},
+	}
+
+	for _, test := range tests {
+		if got := len(list(t, m, test.opts).Items); got != test.want {
+			t.Errorf("list %+v: got %d events, want %d", test.opts, got, test.want)
+		}
+	}
+}
+
+func TestMemoryListOrder(t *testing.T) {
+	m := NewMemory(owner)
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+
+	late := newEvent("", "2020-01-07T09:00:00Z", "2020-01-07T10:00:00Z")
+	late.Attendees = []*calendar.EventAttendee{{Email: "a@example.com"}, {Email: "b@example.com"}}
+	late = insert(t, m, late)
+	early := insert(t, m, newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z"))
+
+	byStart := list(t, m, ListOptions{SingleEvents: true, OrderBy: "startTime", MaxAttendees: 1}).Items
+	if byStart[0].Id != early.Id || len(byStart[1].Attendees) != 1 || !byStart[1].AttendeesOmitted {
+		t.Errorf("expected events by start, attendees limited, got %+v", byStart)
+	}
+
+	m.PatchEvent(context.Background(), primaryCalendar, late.Id, &calendar.Event{Location: "Room 1"}, WriteOptions{})
+	if byUpdate := list(t, m, ListOptions{OrderBy: "updated"}).Items; byUpdate[0].Id != early.Id {
+		t.Errorf("expected events by update, got %+v", byUpdate)
+	}
+
+	for _, opts := range []ListOptions{{OrderBy: "startTime"}, {OrderBy: "summary"}, {UpdatedMin: "yesterday"}} {
+		if _, err := m.ListEvents(context.Background(), primaryCalendar, opts); errorCode(err) != http.StatusBadRequest {
+			t.Errorf("list %+v: expected bad request, got %v", opts, err)
+		}
+	}
+
+	stored, _ := m.GetEvent(context.Background(), primaryCalendar, late.Id)
+	if len(stored.Attendees) != 2 {
+		t.Errorf("expected stored attendees kept, got %+v", stored.Attendees)
+	}
+}
+
+func TestMemoryImport(t *testing.T) {
+	m := NewMemory(owner)
+	ctx := context.Background()
+
+	master := newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z")
+	master.ICalUID = "uid@example.com"
+	master.Start.TimeZone, master.End.TimeZone = "UTC", "UTC"
+	master.Recurrence = []string{"RRULE:FREQ=DAILY;COUNT=3"}
+
+	first, err := m.ImportEvent(ctx, primaryCalendar, master)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	master.Summary = "Renamed"
+	second, err := m.ImportEvent(ctx, primaryCalendar, master)
+	if err != nil || second.Id != first.Id || second.Summary != "Renamed" {
+		t.Errorf("import should update event with same uid: %v", err)
+	}
+
+	exception := newEvent("", "2020-01-07T11:00:00Z", "2020-01-07T12:00:00Z")
+	exception.ICalUID = master.ICalUID
+	exception.OriginalStartTime = &calendar.EventDateTime{DateTime: "2020-01-07T09:00:00Z"}
+	imported, err := m.ImportEvent(ctx, primaryCalendar, exception)
+	if err != nil || imported.RecurringEventId != first.Id {
+		t.Fatalf("import of exception failed: %v", err)
+	}
+
+	items := list(t, m, ListOptions{SingleEvents: true}).Items
+	if len(items) != 3 || items[1].Start.DateTime != "2020-01-07T11:00:00Z" {
+		t.Errorf("exception should replace its instance, got %d", len(items))
+	}
+}
+
+func TestMemoryACL(t *testing.T) {
+	m := NewMemory(owner)
+	ctx := context.Background()
+
+	rules, err := m.ListACL(ctx, primaryCalendar)
+	if err != nil || len(rules) != 1 || rules[0].Role != "owner" {
+		t.Fatalf("expected owner rule, got %v %v", rules, err)
+	}
+
+	rule := &calendar.AclRule{
+		Role:  "reader",
+		Scope: &calendar.AclRuleScope{Type: "user", Value: "reader@example.com"},
+	}
+	inserted, err := m.InsertACL(ctx, primaryCalendar, rule, false)
+	if err != nil || inserted.Id != "user:reader@example.com" {
+		t.Fatalf("insert failed: %v %v", inserted, err)
+	}
+
+	patched, err := m.PatchACL(ctx, primaryCalendar, inserted.Id, &calendar.AclRule{Role: "writer"}, false)
+	if err != nil || patched.Role != "writer" {
+		t.Errorf("patch failed: %v", err)
+	}
+
+	err = m.DeleteACL(ctx, primaryCalendar, inserted.Id)
+	if err != nil {
+		t.Errorf("delete failed: %v", err)
+	}
+
+	err = m.DeleteACL(ctx, primaryCalendar, inserted.Id)
+	if errorCode(err) != http.StatusNotFound {
+		t.Errorf("deleting twice should be 404, got %v", err)
+	}
+}
+
+func TestMemoryFreeBusy(t *testing.T) {
+	m := NewMemory(owner)
+	insert(t, m, newEvent("", "2020-01-06T09:00:00Z", "2020-01-06T10:00:00Z"))
+	insert(t, m, newEvent("", "2020-01-06T09:30:00Z", "2020-01-06T11:00:00Z"))
+
+	free := newEvent("", "2020-01-06T12:00:00Z", "2020-01-06T13:00:00Z")
+	free.Transparency = "transparent"
+	insert(t, m, free)
+
+	resp, err := m.QueryFreeBusy(context.Background(), &calendar.FreeBusyRequest{
+		TimeMin: "2020-01-06T00:00:00Z",
+		TimeMax: "2020-01-07T00:00:00Z",
+		Items:   []*calendar.FreeBusyRequestItem{{Id: owner}, {Id: "other@example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	busy := resp.Calendars[owner].Busy
+	if len(busy) != 1 || busy[0].Start != "2020-01-06T09:00:00Z" || busy[0].End != "2020-01-06T11:00:00Z" {
+		t.Errorf("expected one merged busy period, got %+v", busy)
+	}
+
+	if len(resp.Calendars["other@example.com"].Errors) != 1 {
+		t.Errorf("unknown calendar should have an error")
+	}
+}
@@ -0,0 +1,385 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	dateFormat      = "2006-01-02"
+	localTimeFormat = "2006-01-02T15:04:05"
+	icsDateFormat   = "20060102"
+	icsLocalFormat  = "20060102T150405"
+	icsUTCFormat    = "20060102T150405Z"
+
+	//occurrences are not expanded beyond this, to bound endless rules
+	maxOccurrences = 5000
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+//eventTime - instant of an event start or end, with the location
+//recurrences are expanded in
+type eventTime struct {
+	t      time.Time
+	allDay bool
+}
+
+//parseEventTime - parses start or end. Times without offset are in the
+//time zone of dt.
+func parseEventTime(dt *calendar.EventDateTime) (eventTime, error) {
+	if dt == nil || dt.Date == "" && dt.DateTime == "" {
+		return eventTime{}, fmt.Errorf("missing time")
+	}
+
+	if dt.Date != "" {
+		t, err := time.Parse(dateFormat, dt.Date)
+		return eventTime{t: t, allDay: true}, err
+	}
+
+	loc := time.UTC
+	if dt.TimeZone != "" {
+		var err error
+		loc, err = time.LoadLocation(dt.TimeZone)
+		if err != nil {
+			return eventTime{}, fmt.Errorf("invalid time zone %q", dt.TimeZone)
+		}
+	}
+
+	t, err := time.Parse(time.RFC3339, dt.DateTime)
+	if err != nil {
+		t, err = time.ParseInLocation(localTimeFormat, dt.DateTime, loc)
+		if err != nil {
+			return eventTime{}, err
+		}
+	}
+
+	if dt.TimeZone != "" {
+		t = t.In(loc)
+	}
+	return eventTime{t: t}, nil
+}
+
+//format - as google formats event times
+func (et eventTime) format(timeZone string) *calendar.EventDateTime {
+	if et.allDay {
+		return &calendar.EventDateTime{Date: et.t.Format(dateFormat)}
+	}
+	return &calendar.EventDateTime{DateTime: et.t.Format(time.RFC3339), TimeZone: timeZone}
+}
+
+//instanceSuffix - suffix of instance ids, i.e. 20200106T090000Z
+func (et eventTime) instanceSuffix() string {
+	if et.allDay {
+		return et.t.Format(icsDateFormat)
+	}
+	return et.t.UTC().Format(icsUTCFormat)
+}
+
+//rule - the supported subset of RRULE
+type rule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []string //weekday, optionally with ordinal, i.e. -1FR
+	byMonthDay []int
+}
+
+func parseRule(value string) (rule, error) {
+	r := rule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return r, fmt.Errorf("bad rule part %q", part)
+		}
+
+		var err error
+		switch key, v := strings.ToUpper(kv[0]), strings.ToUpper(kv[1]); key {
+		case "FREQ":
+			r.freq = v
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, err = parseICSTime(v, time.UTC)
+		case "BYDAY":
+			r.byDay = strings.Split(v, ",")
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return r, fmt.Errorf("bad BYMONTHDAY %q", v)
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "WKST":
+		default:
+			return r, fmt.Errorf("unsupported rule part %q", key)
+		}
+
+		if err != nil {
+			return r, fmt.Errorf("bad rule part %q", part)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return r, fmt.Errorf("unsupported FREQ %q", r.freq)
+	}
+
+	if r.interval < 1 {
+		return r, fmt.Errorf("bad INTERVAL")
+	}
+
+	for _, day := range r.byDay {
+		_, _, err := parseByDay(day)
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+//parseByDay - weekday and ordinal (0 for every) of a BYDAY value
+func parseByDay(value string) (time.Weekday, int, error) {
+	if len(value) < 2 {
+		return 0, 0, fmt.Errorf("bad BYDAY %q", value)
+	}
+
+	day, ok := weekdays[value[len(value)-2:]]
+	if !ok {
+		return 0, 0, fmt.Errorf("bad BYDAY %q", value)
+	}
+
+	ordinal := 0
+	if len(value) > 2 {
+		var err error
+		ordinal, err = strconv.Atoi(value[:len(value)-2])
+		if err != nil || ordinal == 0 {
+			return 0, 0, fmt.Errorf("bad BYDAY %q", value)
+		}
+	}
+	return day, ordinal, nil
+}
+
+//parseICSTime - DATE, local DATE-TIME (in loc) or UTC DATE-TIME
+func parseICSTime(value string, loc *time.Location) (time.Time, error) {
+	switch {
+	case len(value) == len(icsDateFormat):
+		return time.ParseInLocation(icsDateFormat, value, loc)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse(icsUTCFormat, value)
+	}
+	return time.ParseInLocation(icsLocalFormat, value, loc)
+}
+
+//atClock - date of day at the clock time of start
+func atClock(day time.Time, start time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(),
+		start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+}
+
+//daysInMonth - days of the month of t
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+//monthCandidates - days of the month of period matching the rule
+func (r rule) monthCandidates(period time.Time, start time.Time) []time.Time {
+	first := time.Date(period.Year(), period.Month(), 1, 0, 0, 0, 0, start.Location())
+	days := daysInMonth(first)
+	candidates := []time.Time{}
+
+	for _, n := range r.byMonthDay {
+		if n < 0 {
+			n = days + n + 1
+		}
+
+		if n >= 1 && n <= days {
+			candidates = append(candidates, atClock(first.AddDate(0, 0, n-1), start))
+		}
+	}
+
+	for _, v := range r.byDay {
+		weekday, ordinal, _ := parseByDay(v)
+		matching := []time.Time{}
+		for day := 1; day <= days; day++ {
+			t := first.AddDate(0, 0, day-1)
+			if t.Weekday() == weekday {
+				matching = append(matching, atClock(t, start))
+			}
+		}
+
+		switch {
+		case ordinal == 0:
+			candidates = append(candidates, matching...)
+		case ordinal > 0 && ordinal <= len(matching):
+			candidates = append(candidates, matching[ordinal-1])
+		case ordinal < 0 && -ordinal <= len(matching):
+			candidates = append(candidates, matching[len(matching)+ordinal])
+		}
+	}
+
+	if len(r.byMonthDay) == 0 && len(r.byDay) == 0 && start.Day() <= days {
+		candidates = append(candidates, atClock(first.AddDate(0, 0, start.Day()-1), start))
+	}
+	return candidates
+}
+
+//candidates - occurrences in the k-th period of the rule from start
+func (r rule) candidates(start time.Time, k int) []time.Time {
+	n := k * r.interval
+	switch r.freq {
+	case "DAILY":
+		return []time.Time{start.AddDate(0, 0, n)}
+	case "WEEKLY":
+		if len(r.byDay) == 0 {
+			return []time.Time{start.AddDate(0, 0, 7*n)}
+		}
+
+		offset := (int(start.Weekday()) + 6) % 7 //days since monday
+		monday := start.AddDate(0, 0, 7*n-offset)
+		candidates := []time.Time{}
+		for _, v := range r.byDay {
+			weekday, _, _ := parseByDay(v)
+			candidates = append(candidates, atClock(monday.AddDate(0, 0, (int(weekday)+6)%7), start))
+		}
+		return candidates
+	case "MONTHLY":
+		period := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, start.Location())
+		return r.monthCandidates(period, start)
+	default: //YEARLY
+		t := time.Date(start.Year()+n, start.Month(), start.Day(),
+			start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		if t.Month() != start.Month() { //i.e. february 29th
+			return nil
+		}
+		return []time.Time{t}
+	}
+}
+
+//dateList - instants of an RDATE or EXDATE line
+func dateList(line string, loc *time.Location) ([]time.Time, error) {
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("bad recurrence line %q", line)
+	}
+
+	for _, param := range strings.Split(line[:colon], ";")[1:] {
+		if strings.HasPrefix(strings.ToUpper(param), "TZID=") {
+			var err error
+			loc, err = time.LoadLocation(strings.Trim(param[5:], "\""))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	times := []time.Time{}
+	for _, v := range strings.Split(line[colon+1:], ",") {
+		t, err := parseICSTime(strings.TrimSpace(v), loc)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+//occurrences - start times of the instances of a recurring event,
+//starting before end. start is always the first occurrence.
+func occurrences(start eventTime, recurrence []string, end time.Time) ([]eventTime, error) {
+	loc := start.t.Location()
+	var rules []rule
+	var added []time.Time
+	excluded := map[int64]bool{}
+
+	for _, line := range recurrence {
+		name := strings.ToUpper(line)
+		if i := strings.IndexAny(name, ";:"); i > 0 {
+			name = name[:i]
+		}
+
+		switch name {
+		case "RRULE":
+			r, err := parseRule(line[strings.Index(line, ":")+1:])
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, r)
+		case "RDATE", "EXDATE":
+			times, err := dateList(line, loc)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, t := range times {
+				if name == "RDATE" {
+					added = append(added, t)
+				} else {
+					excluded[t.Unix()] = true
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence line %q", line)
+		}
+	}
+
+	found := map[int64]time.Time{start.t.Unix(): start.t}
+	for _, r := range rules {
+		count := 1
+	periods:
+		for k := 0; len(found) < maxOccurrences; k++ {
+			candidates := r.candidates(start.t, k)
+			sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+			for _, t := range candidates {
+				if !r.until.IsZero() && t.After(r.until) || !t.Before(end) ||
+					r.count > 0 && count >= r.count {
+					break periods
+				}
+
+				if t.After(start.t) {
+					found[t.Unix()] = t
+					count++
+				}
+			}
+
+			//periods without candidates still end eventually
+			if k > maxOccurrences {
+				break
+			}
+		}
+	}
+
+	for _, t := range added {
+		if t.Before(end) {
+			found[t.Unix()] = t.In(loc)
+		}
+	}
+
+	result := []eventTime{}
+	for unix, t := range found {
+		if !excluded[unix] {
+			result = append(result, eventTime{t: t, allDay: start.allDay})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].t.Before(result[j].t) })
+	return result, nil
+}
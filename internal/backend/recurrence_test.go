@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func TestOccurrences(t *testing.T) {
+	end := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		start      *calendar.EventDateTime
+		recurrence []string
+		want       []string
+	}{
+		{
+			name:       "daily count",
+			start:      &calendar.EventDateTime{DateTime: "2020-01-06T09:00:00Z"},
+			recurrence: []string{"RRULE:FREQ=DAILY;COUNT=3"},
+			want:       []string{"20200106T090000Z", "20200107T090000Z", "20200108T090000Z"},
+		},
+		{
+			name:       "weekly by day until",
+			start:      &calendar.EventDateTime{DateTime: "2020-01-06T09:00:00Z"},
+			recurrence: []string{"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20200113T090000Z"},
+			want:       []string{"20200106T090000Z", "20200108T090000Z", "20200113T090000Z"},
+		},
+		{
+			name:       "monthly last friday",
+			start:      &calendar.EventDateTime{DateTime: "2020-01-31T12:00:00Z"},
+			recurrence: []string{"RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=3"},
+			want:       []string{"20200131T120000Z", "20200228T120000Z", "20200327T120000Z"},
+		},
+		{
+			name:       "monthly skips short months",
+			start:      &calendar.EventDateTime{Date: "2020-01-31"},
+			recurrence: []string{"RRULE:FREQ=MONTHLY;COUNT=3"},
+			want:       []string{"20200131", "20200331", "20200531"},
+		},
+		{
+			name:  "exdate and rdate",
+			start: &calendar.EventDateTime{DateTime: "2020-01-06T09:00:00Z"},
+			recurrence: []string{
+				"RRULE:FREQ=DAILY;COUNT=3",
+				"EXDATE:20200107T090000Z",
+				"RDATE:20200110T090000Z",
+			},
+			want: []string{"20200106T090000Z", "20200108T090000Z", "20200110T090000Z"},
+		},
+		{
+			name: "local time across daylight saving",
+			start: &calendar.EventDateTime{
+				DateTime: "2020-03-28T09:00:00",
+				TimeZone: "Europe/Oslo",
+			},
+			recurrence: []string{"RRULE:FREQ=DAILY;COUNT=2"},
+			want:       []string{"20200328T080000Z", "20200329T070000Z"},
+		},
+	}
+
+	for _, test := range tests {
+		start, err := parseEventTime(test.start)
+		if err != nil {
+			t.Fatalf("%s: bad start: %v", test.name, err)
+		}
+
+		found, err := occurrences(start, test.recurrence, end)
+		if err != nil {
+			t.Errorf("%s: occurrences failed: %v", test.name, err)
+			continue
+		}
+
+		got := []string{}
+		for _, v := range found {
+			got = append(got, v.instanceSuffix())
+		}
+
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestOccurrencesUnsupported(t *testing.T) {
+	start := eventTime{t: time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)}
+	tests := []string{
+		"RRULE:FREQ=HOURLY",
+		"RRULE:FREQ=DAILY;INTERVAL=0",
+		"RRULE:FREQ=WEEKLY;BYDAY=XX",
+		"RRULE:FREQ=DAILY;BYSETPOS=1",
+		"EXRULE:FREQ=DAILY",
+	}
+
+	for _, recurrence := range tests {
+		_, err := occurrences(start, []string{recurrence}, start.t.AddDate(1, 0, 0))
+		if err == nil {
+			t.Errorf("occurrences(%q) should fail", recurrence)
+		}
+	}
+}
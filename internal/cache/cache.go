@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Cache - values by key, expiring after their ttl. A value may be evicted
+//before, so a miss is always possible.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+
+	//Set stores value, without expiry if ttl is 0
+	Set(key string, value []byte, ttl time.Duration)
+	Delete(key string)
+}
+
+//FromEnv creates the cache configured by CACHE_SIZE (entries kept in
+//memory) or CACHE_REDIS_ADDR (with CACHE_REDIS_PASSWORD and
+//CACHE_REDIS_DB), and the ttl of entries in CACHE_TTL. The cache is nil
+//if neither is set.
+func FromEnv() (Cache, time.Duration, error) {
+	ttl := 30 * time.Second
+	if v := os.Getenv("CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("CACHE_TTL must be a positive duration, got %q", v)
+		}
+		ttl = d
+	}
+
+	if addr := os.Getenv("CACHE_REDIS_ADDR"); addr != "" {
+		db := 0
+		if v := os.Getenv("CACHE_REDIS_DB"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, 0, fmt.Errorf("CACHE_REDIS_DB must be a number, got %q", v)
+			}
+			db = n
+		}
+		return NewRedis(addr, os.Getenv("CACHE_REDIS_PASSWORD"), db), ttl, nil
+	}
+
+	if v := os.Getenv("CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, 0, fmt.Errorf("CACHE_SIZE must be a positive number, got %q", v)
+		}
+		return NewLRU(n), ttl, nil
+	}
+	return nil, 0, nil
+}
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time //zero if never
+}
+
+//LRU - in memory cache, evicting the least recently used entries when
+//full
+type LRU struct {
+	mutex   sync.Mutex
+	size    int
+	entries *list.List //most recently used first
+	keys    map[string]*list.Element
+}
+
+//NewLRU - cache of at most size entries
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:    size,
+		entries: list.New(),
+		keys:    map[string]*list.Element{},
+	}
+}
+
+//Get - value of key, unless missing or expired
+func (l *LRU) Get(key string) ([]byte, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	element, ok := l.keys[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		l.remove(element)
+		return nil, false
+	}
+
+	l.entries.MoveToFront(element)
+	return e.value, true
+}
+
+//Set - stores value, evicting the least recently used entry if full
+func (l *LRU) Set(key string, value []byte, ttl time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	e := &entry{key: key, value: value}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+
+	if element, ok := l.keys[key]; ok {
+		element.Value = e
+		l.entries.MoveToFront(element)
+		return
+	}
+
+	l.keys[key] = l.entries.PushFront(e)
+	for l.entries.Len() > l.size {
+		l.remove(l.entries.Back())
+	}
+}
+
+//Delete - removes key
+func (l *LRU) Delete(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.keys[key]; ok {
+		l.remove(element)
+	}
+}
+
+//Len - entries kept, including expired ones not yet removed
+func (l *LRU) Len() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.entries.Len()
+}
+
+func (l *LRU) remove(element *list.Element) {
+	l.entries.Remove(element)
+	delete(l.keys, element.Value.(*entry).key)
+}
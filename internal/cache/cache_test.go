@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	l := NewLRU(2)
+	l.Set("a", []byte("1"), 0)
+	l.Set("b", []byte("2"), 0)
+	l.Get("a")
+	l.Set("c", []byte("3"), 0)
+
+	if _, ok := l.Get("b"); ok {
+		t.Errorf("expected least recently used entry evicted")
+	}
+
+	if v, ok := l.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("expected a kept, got %q %v", v, ok)
+	}
+
+	l.Set("c", []byte("4"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := l.Get("c"); ok || l.Len() != 1 {
+		t.Errorf("expected c expired, %d entries kept", l.Len())
+	}
+
+	l.Delete("a")
+	if _, ok := l.Get("a"); ok {
+		t.Errorf("expected a deleted")
+	}
+}
+
+//fakeRedis - serves GET, SET and DEL from memory, ignoring expiry
+func fakeRedis(t *testing.T) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+
+	mutex := sync.Mutex{}
+	values := map[string]string{}
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			args := []string{}
+			for i := 0; i < n; i++ {
+				line, _ = r.ReadString('\n')
+				size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+				b := make([]byte, size+2)
+				io.ReadFull(r, b)
+				args = append(args, string(b[:size]))
+			}
+
+			mutex.Lock()
+			switch strings.ToUpper(args[0]) {
+			case "GET":
+				if v, ok := values[args[1]]; ok {
+					fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+				} else {
+					fmt.Fprint(conn, "$-1\r\n")
+				}
+			case "SET":
+				values[args[1]] = args[2]
+				fmt.Fprint(conn, "+OK\r\n")
+			case "DEL":
+				delete(values, args[1])
+				fmt.Fprint(conn, ":1\r\n")
+			default:
+				fmt.Fprint(conn, "-ERR unknown command\r\n")
+			}
+			mutex.Unlock()
+		}
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func TestRedis(t *testing.T) {
+	addr, stop := fakeRedis(t)
+	defer stop()
+
+	r := NewRedis(addr, "", 0)
+	if _, ok := r.Get("a"); ok {
+		t.Errorf("expected miss")
+	}
+
+	r.Set("a", []byte("line\r\nbreak"), time.Minute)
+	if v, ok := r.Get("a"); !ok || string(v) != "line\r\nbreak" {
+		t.Errorf("got %q %v", v, ok)
+	}
+
+	r.Delete("a")
+	if _, ok := r.Get("a"); ok {
+		t.Errorf("expected a deleted")
+	}
+
+	//server errors keep the connection
+	if _, err := r.do("PING"); err == nil || r.conn == nil {
+		t.Errorf("expected error reply, got %v", err)
+	}
+
+	stop()
+	r.conn.Close()
+	if _, ok := r.Get("a"); ok || r.conn != nil {
+		t.Errorf("expected miss and connection dropped when down")
+	}
+}
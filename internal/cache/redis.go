@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//Redis - cache in redis, or a server speaking its protocol. Commands
+//are sent on a single connection, redialed after failures. Failures
+//are logged and count as misses, as the cache is only an optimization.
+type Redis struct {
+	Addr     string
+	Password string
+	DB       int
+	Timeout  time.Duration //of dialing and each command
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+//NewRedis - cache in the redis server at addr, i.e. localhost:6379
+func NewRedis(addr string, password string, db int) *Redis {
+	return &Redis{Addr: addr, Password: password, DB: db, Timeout: 2 * time.Second}
+}
+
+//Get - value of key, unless missing
+func (r *Redis) Get(key string) ([]byte, bool) {
+	reply, err := r.do("GET", key)
+	if err != nil {
+		logrus.Warnf("Could not get %s from redis: %v", key, err)
+		return nil, false
+	}
+
+	value, ok := reply.([]byte)
+	return value, ok
+}
+
+//Set - stores value, expiring after ttl unless it is 0
+func (r *Redis) Set(key string, value []byte, ttl time.Duration) {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(ttl/time.Millisecond), 10))
+	}
+
+	_, err := r.do(args...)
+	if err != nil {
+		logrus.Warnf("Could not set %s in redis: %v", key, err)
+	}
+}
+
+//Delete - removes key
+func (r *Redis) Delete(key string) {
+	_, err := r.do("DEL", key)
+	if err != nil {
+		logrus.Warnf("Could not delete %s from redis: %v", key, err)
+	}
+}
+
+//do - sends a command, returning its reply: a []byte for bulk strings,
+//nil if missing, a string for status replies or an int64
+func (r *Redis) do(args ...string) (interface{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.conn == nil {
+		err := r.dial()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := r.command(args...)
+	if _, ok := err.(redisError); !ok && err != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return reply, err
+}
+
+func (r *Redis) dial() error {
+	conn, err := net.DialTimeout("tcp", r.Addr, r.Timeout)
+	if err != nil {
+		return err
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+
+	if r.Password != "" {
+		_, err = r.command("AUTH", r.Password)
+	}
+
+	if err == nil && r.DB != 0 {
+		_, err = r.command("SELECT", strconv.Itoa(r.DB))
+	}
+
+	if err != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return err
+}
+
+//redisError - an error replied by the server, the connection is usable
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+func (r *Redis) command(args ...string) (interface{}, error) {
+	r.conn.SetDeadline(time.Now().Add(r.Timeout))
+
+	w := bufio.NewWriter(r.conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	err := w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return r.reply()
+}
+
+func (r *Redis) reply() (interface{}, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 {
+		return nil, fmt.Errorf("bad redis reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		b := make([]byte, n+2)
+		_, err = io.ReadFull(r.reader, b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+	return nil, fmt.Errorf("unsupported redis reply %q", kind)
+}
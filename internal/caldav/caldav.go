@@ -0,0 +1,299 @@
+//Package caldav is a CalDAV (RFC 4791) front-end for the google calendars
+//of a domain, letting calendar clients use the service as a gateway.
+//Authentication is left to whatever is in front of the service.
+//
+//	/{domain}/caldav/                        principal and calendar home
+//	/{domain}/caldav/{calendarId}/           calendar collection
+//	/{domain}/caldav/{calendarId}/{uid}.ics  event, named by its iCalendar uid
+package caldav
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/pkg/ics"
+	"google.golang.org/api/googleapi"
+)
+
+//Methods - http methods to route to Handle
+var Methods = []string{"OPTIONS", "PROPFIND", "REPORT", "GET", "HEAD", "PUT", "DELETE"}
+
+//maxResourceSize limits the size of iCalendar objects put
+const maxResourceSize = 1 << 20
+
+//target - what a request path refers to
+type target struct {
+	domain     string
+	calendarID string //empty for calendar home
+	uid        string //empty for calendar collection
+}
+
+//parseTarget - target of path below /{domain}/caldav/
+func parseTarget(domain string, path string) (t target, ok bool) {
+	t.domain = domain
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		return t, true
+	case len(parts) == 1 || len(parts) == 2 && parts[1] == "":
+		t.calendarID = parts[0]
+		return t, true
+	case len(parts) == 2 && strings.HasSuffix(parts[1], icsSuffix):
+		t.calendarID = parts[0]
+		t.uid = strings.TrimSuffix(parts[1], icsSuffix)
+		return t, t.uid != ""
+	}
+	return t, false
+}
+
+func (t target) isHome() bool {
+	return t.calendarID == ""
+}
+
+func (t target) isCalendar() bool {
+	return t.calendarID != "" && t.uid == ""
+}
+
+func (t target) isResource() bool {
+	return t.uid != ""
+}
+
+//homeHref - href of the calendar home, which is also the principal
+func (t target) homeHref() string {
+	return "/" + url.PathEscape(t.domain) + "/caldav/"
+}
+
+func (t target) calendarHref(calendarID string) string {
+	return t.homeHref() + url.PathEscape(calendarID) + "/"
+}
+
+func (t target) resourceHref(uid string) string {
+	return t.calendarHref(t.calendarID) + url.PathEscape(uid) + icsSuffix
+}
+
+//setup - prepares the connectors of requests, see SetupConnectors
+var setup = func(c *gin.Context, connector *googlecal.CalendarConnector) {}
+
+//SetupConnectors - calls f with the connector of every request before it
+//is used, i.e. to record the changes made
+func SetupConnectors(f func(c *gin.Context, connector *googlecal.CalendarConnector)) {
+	setup = f
+}
+
+func connector(c *gin.Context, t target) *googlecal.CalendarConnector {
+	connector := googlecal.NewCalendarConnector(c.Request.Context(), t.domain).
+		InCalendar(t.calendarID)
+	setup(c, connector)
+	return connector
+}
+
+//requestError - error in the request, rather than from the calendar
+type requestError string
+
+func (e requestError) Error() string {
+	return string(e)
+}
+
+//errorStatus - http status of an error
+func errorStatus(err error) int {
+	if _, ok := err.(requestError); ok {
+		return http.StatusBadRequest
+	}
+
+	if err == googlecal.ErrorEventNotFound || err == googlecal.ErrorUnknownDomain {
+		return http.StatusNotFound
+	}
+
+	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code >= 400 && gErr.Code < 500 {
+		return gErr.Code
+	}
+	return http.StatusInternalServerError
+}
+
+func fail(c *gin.Context, err error) {
+	c.String(errorStatus(err), err.Error())
+}
+
+//findResource - the events of the target resource
+func findResource(c *gin.Context, t target) (*resource, error) {
+	events, err := connector(c, t).FindEventsByUID(t.uid, true)
+	if err != nil {
+		return nil, err
+	}
+
+	r := groupByUID(events)[0]
+	if r.deleted() {
+		return nil, googlecal.ErrorEventNotFound
+	}
+	return r, nil
+}
+
+//preconditionFailed - checks If-Match and If-None-Match against the etag
+//of the resource, which is nil if it does not exist
+func preconditionFailed(c *gin.Context, r *resource) bool {
+	if c.GetHeader("If-None-Match") == "*" && r != nil {
+		return true
+	}
+
+	match := c.GetHeader("If-Match")
+	if match == "" {
+		return false
+	}
+	return r == nil || match != "*" && match != r.etag()
+}
+
+//Handle serves CalDAV requests on /:domain/caldav/*path
+func Handle(c *gin.Context) {
+	t, ok := parseTarget(c.Param("domain"), c.Param("path"))
+	if !ok {
+		c.String(http.StatusNotFound, "unknown resource")
+		return
+	}
+
+	//writes are made right away, so asking for a dry run is an error
+	if dryRun, _ := strconv.ParseBool(c.Query("dryRun")); dryRun &&
+		(c.Request.Method == "PUT" || c.Request.Method == "DELETE") {
+		c.String(http.StatusBadRequest, googlecal.ErrorDryRunUnsupported.Error())
+		return
+	}
+
+	switch c.Request.Method {
+	case "OPTIONS":
+		c.Header("DAV", "1, 3, calendar-access")
+		c.Header("Allow", strings.Join(Methods, ", "))
+		c.Status(http.StatusOK)
+	case "PROPFIND":
+		propfind(c, t)
+	case "REPORT":
+		report(c, t)
+	case "GET", "HEAD":
+		getResource(c, t)
+	case "PUT":
+		putResource(c, t)
+	case "DELETE":
+		deleteResource(c, t)
+	default:
+		c.Status(http.StatusMethodNotAllowed)
+	}
+}
+
+func getResource(c *gin.Context, t target) {
+	if !t.isResource() {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+
+	r, err := findResource(c, t)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	data, err := r.encode()
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	c.Header("ETag", r.etag())
+	c.Data(http.StatusOK, icsContentType, data)
+}
+
+//putResource - creates or replaces the events of an iCalendar object.
+//The object must have a single uid, matching the resource name.
+func putResource(c *gin.Context, t target) {
+	if !t.isResource() {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxResourceSize))
+	if err != nil {
+		c.String(http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	roots, err := ics.Decode(bytes.NewReader(body))
+	if err != nil {
+		c.String(http.StatusBadRequest, "could not parse iCalendar data: "+err.Error())
+		return
+	}
+
+	if len(roots) != 1 || roots[0].Name != "VCALENDAR" {
+		c.String(http.StatusBadRequest, "expected a single VCALENDAR")
+		return
+	}
+
+	events, errs := ics.ToEvents(roots[0])
+	if len(errs) > 0 {
+		c.String(http.StatusBadRequest, errs[0].Error())
+		return
+	}
+
+	if len(events) == 0 {
+		c.String(http.StatusBadRequest, "expected a VEVENT")
+		return
+	}
+
+	for _, v := range events {
+		if v.ICalUID != t.uid {
+			c.String(http.StatusBadRequest, "UID must match resource name")
+			return
+		}
+	}
+
+	existing, err := findResource(c, t)
+	if err != nil && errorStatus(err) != http.StatusNotFound {
+		fail(c, err)
+		return
+	}
+
+	if preconditionFailed(c, existing) {
+		c.Status(http.StatusPreconditionFailed)
+		return
+	}
+
+	err = connector(c, t).StoreEvents(events)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	//no etag, as google alters the event, so clients must fetch it again
+	if existing == nil {
+		c.Status(http.StatusCreated)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func deleteResource(c *gin.Context, t target) {
+	if !t.isResource() {
+		c.String(http.StatusForbidden, "only events can be deleted")
+		return
+	}
+
+	r, err := findResource(c, t)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	if preconditionFailed(c, r) {
+		c.Status(http.StatusPreconditionFailed)
+		return
+	}
+
+	err = connector(c, t).DeleteEventsByUID(t.uid)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
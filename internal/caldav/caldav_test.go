@@ -0,0 +1,286 @@
+package caldav
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	calendarPath = "/dav/caldav/calendar@example.com/"
+	meetingPath  = calendarPath + "meeting.ics"
+)
+
+//newHandler - routes CalDAV requests of domain dav, served from memory
+func newHandler() http.Handler {
+	gin.SetMode(gin.TestMode)
+	googlecal.UseBackend("dav", backend.NewMemory("calendar@example.com"))
+
+	r := gin.New()
+	for _, method := range Methods {
+		r.Handle(method, "/:domain/caldav/*path", Handle)
+	}
+	return r
+}
+
+//serve - response of a request, with headers as name, value pairs
+func serve(h http.Handler, method string, path string, body string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+//vcalendar - iCalendar object of vevents
+func vcalendar(vevents ...string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//test//EN\r\n" +
+		strings.Join(vevents, "") + "END:VCALENDAR\r\n"
+}
+
+//vevent - event uid from start to end, UTC in basic format
+func vevent(uid string, start string, end string, summary string, extra ...string) string {
+	return "BEGIN:VEVENT\r\nUID:" + uid + "\r\nDTSTAMP:20200101T000000Z\r\n" +
+		"DTSTART:" + start + "\r\nDTEND:" + end + "\r\nSUMMARY:" + summary + "\r\n" +
+		strings.Join(extra, "") + "END:VEVENT\r\n"
+}
+
+var meeting = vcalendar(vevent("meeting", "20200106T090000Z", "20200106T100000Z", "Meeting"))
+
+func TestPropfind(t *testing.T) {
+	h := newHandler()
+
+	home := serve(h, "PROPFIND", "/dav/caldav/", "", "Depth", "0")
+	if home.Code != http.StatusMultiStatus || !strings.Contains(home.Body.String(), "<d:href>/dav/caldav/</d:href>") ||
+		strings.Contains(home.Body.String(), calendarPath) {
+		t.Errorf("expected only the calendar home at depth 0, got %d %s", home.Code, home.Body)
+	}
+
+	home = serve(h, "PROPFIND", "/dav/caldav/", "", "Depth", "1")
+	if !strings.Contains(home.Body.String(), "<d:href>"+calendarPath+"</d:href>") {
+		t.Errorf("expected calendar below home at depth 1, got %s", home.Body)
+	}
+
+	if resp := serve(h, "PUT", meetingPath, meeting); resp.Code != http.StatusCreated {
+		t.Fatalf("put failed: %d %s", resp.Code, resp.Body)
+	}
+
+	collection := serve(h, "PROPFIND", calendarPath, "", "Depth", "0")
+	if !strings.Contains(collection.Body.String(), "<c:calendar/>") ||
+		strings.Contains(collection.Body.String(), meetingPath) {
+		t.Errorf("expected only the calendar at depth 0, got %s", collection.Body)
+	}
+
+	collection = serve(h, "PROPFIND", calendarPath, "", "Depth", "1")
+	if !strings.Contains(collection.Body.String(), "<d:href>"+meetingPath+"</d:href>") ||
+		!strings.Contains(collection.Body.String(), "<d:getetag>") {
+		t.Errorf("expected event below calendar at depth 1, got %s", collection.Body)
+	}
+
+	props := `<d:propfind xmlns:d="DAV:" xmlns:x="urn:example"><d:prop>` +
+		`<d:displayname/><x:color/></d:prop></d:propfind>`
+	selected := serve(h, "PROPFIND", calendarPath, props, "Depth", "0").Body.String()
+	if !strings.Contains(selected, "<d:displayname>") || strings.Contains(selected, "<d:resourcetype>") ||
+		!strings.Contains(selected, `<x:color xmlns:x="urn:example"/>`) ||
+		!strings.Contains(selected, "HTTP/1.1 404 Not Found") {
+		t.Errorf("expected displayname, and color as missing, got %s", selected)
+	}
+
+	if resp := serve(h, "PROPFIND", calendarPath+"unknown.ics", ""); resp.Code != http.StatusNotFound {
+		t.Errorf("expected unknown event not found, got %d", resp.Code)
+	}
+
+	if resp := serve(h, "PROPFIND", calendarPath, "<d:propfind"); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request of bad xml, got %d", resp.Code)
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	h := newHandler()
+
+	if resp := serve(h, "PUT", meetingPath, meeting, "If-Match", "*"); resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected If-Match of missing event to fail, got %d", resp.Code)
+	}
+
+	if resp := serve(h, "PUT", meetingPath, meeting, "If-None-Match", "*"); resp.Code != http.StatusCreated {
+		t.Fatalf("expected event created, got %d %s", resp.Code, resp.Body)
+	}
+
+	if resp := serve(h, "PUT", meetingPath, meeting, "If-None-Match", "*"); resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected If-None-Match of existing event to fail, got %d", resp.Code)
+	}
+
+	got := serve(h, "GET", meetingPath, "")
+	etag := got.Header().Get("ETag")
+	if got.Code != http.StatusOK || etag == "" || !strings.Contains(got.Body.String(), "SUMMARY:Meeting") {
+		t.Fatalf("expected event with etag, got %d %s", got.Code, got.Body)
+	}
+
+	moved := vcalendar(vevent("meeting", "20200106T110000Z", "20200106T120000Z", "Moved"))
+	if resp := serve(h, "PUT", meetingPath, moved, "If-Match", `"stale"`); resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected stale If-Match to fail, got %d", resp.Code)
+	}
+
+	if resp := serve(h, "PUT", meetingPath, moved, "If-Match", etag); resp.Code != http.StatusNoContent {
+		t.Fatalf("expected event replaced, got %d %s", resp.Code, resp.Body)
+	}
+
+	if resp := serve(h, "DELETE", meetingPath, "", "If-Match", etag); resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected delete with etag before put to fail, got %d", resp.Code)
+	}
+
+	etag = serve(h, "GET", meetingPath, "").Header().Get("ETag")
+	if resp := serve(h, "DELETE", meetingPath, "", "If-Match", etag); resp.Code != http.StatusNoContent {
+		t.Errorf("expected event deleted, got %d %s", resp.Code, resp.Body)
+	}
+
+	if resp := serve(h, "GET", meetingPath, ""); resp.Code != http.StatusNotFound {
+		t.Errorf("expected deleted event not found, got %d", resp.Code)
+	}
+
+	if resp := serve(h, "DELETE", meetingPath, "", "If-Match", "*"); resp.Code != http.StatusNotFound {
+		t.Errorf("expected delete of deleted event not found, got %d", resp.Code)
+	}
+
+	other := vcalendar(vevent("other", "20200106T090000Z", "20200106T100000Z", "Other"))
+	if resp := serve(h, "PUT", meetingPath, other); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected uid not matching name rejected, got %d", resp.Code)
+	}
+}
+
+func TestDryRunRefused(t *testing.T) {
+	h := newHandler()
+
+	if resp := serve(h, "PUT", meetingPath+"?dryRun=true", meeting); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected dry run of put refused, got %d", resp.Code)
+	}
+
+	if resp := serve(h, "GET", meetingPath, ""); resp.Code != http.StatusNotFound {
+		t.Errorf("expected no event put by a dry run, got %d", resp.Code)
+	}
+
+	serve(h, "PUT", meetingPath, meeting)
+	if resp := serve(h, "DELETE", meetingPath+"?dryRun=true", ""); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected dry run of delete refused, got %d", resp.Code)
+	}
+
+	if resp := serve(h, "GET", meetingPath, ""); resp.Code != http.StatusOK {
+		t.Errorf("expected event not deleted by a dry run, got %d", resp.Code)
+	}
+}
+
+func TestReport(t *testing.T) {
+	h := newHandler()
+
+	serve(h, "PUT", meetingPath, meeting)
+	serve(h, "PUT", calendarPath+"lunch.ics",
+		vcalendar(vevent("lunch", "20200108T110000Z", "20200108T120000Z", "Lunch")))
+
+	query := func(start string, end string) string {
+		return `<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+			`<d:prop><d:getetag/><c:calendar-data/></d:prop><c:filter>` +
+			`<c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT">` +
+			`<c:time-range start="` + start + `" end="` + end + `"/>` +
+			`</c:comp-filter></c:comp-filter></c:filter></c:calendar-query>`
+	}
+
+	resp := serve(h, "REPORT", calendarPath, query("20200106T000000Z", "20200107T000000Z"))
+	if resp.Code != http.StatusMultiStatus || !strings.Contains(resp.Body.String(), meetingPath) ||
+		!strings.Contains(resp.Body.String(), "SUMMARY:Meeting") || strings.Contains(resp.Body.String(), "lunch.ics") {
+		t.Errorf("expected only the meeting in range, got %d %s", resp.Code, resp.Body)
+	}
+
+	resp = serve(h, "REPORT", calendarPath, query("20200101T000000Z", "20200201T000000Z"))
+	if !strings.Contains(resp.Body.String(), meetingPath) || !strings.Contains(resp.Body.String(), "lunch.ics") {
+		t.Errorf("expected both events in range, got %s", resp.Body)
+	}
+
+	if resp := serve(h, "REPORT", calendarPath, query("yesterday", "")); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected bad time-range rejected, got %d", resp.Code)
+	}
+
+	multiget := `<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">` +
+		`<d:prop><d:getetag/></d:prop>` +
+		`<d:href>` + meetingPath + `</d:href>` +
+		`<d:href>` + calendarPath + `missing.ics</d:href>` +
+		`<d:href>/dav/caldav/other@example.com/lunch.ics</d:href>` +
+		`</c:calendar-multiget>`
+	body := serve(h, "REPORT", calendarPath, multiget).Body.String()
+	if strings.Count(body, "<d:response>") != 3 || strings.Count(body, "HTTP/1.1 404 Not Found") != 2 ||
+		!strings.Contains(body, "<d:getetag>") {
+		t.Errorf("expected meeting, and missing and foreign hrefs not found, got %s", body)
+	}
+
+	if resp := serve(h, "REPORT", "/dav/caldav/", multiget); resp.Code != http.StatusBadRequest {
+		t.Errorf("expected report on calendar home rejected, got %d", resp.Code)
+	}
+}
+
+func TestRecurrenceExceptions(t *testing.T) {
+	h := newHandler()
+
+	weekly := vcalendar(
+		vevent("weekly", "20200106T090000Z", "20200106T100000Z", "Weekly", "RRULE:FREQ=WEEKLY;COUNT=4\r\n"),
+		vevent("weekly", "20200113T100000Z", "20200113T110000Z", "Moved",
+			"RECURRENCE-ID:20200113T090000Z\r\n"))
+	if resp := serve(h, "PUT", calendarPath+"weekly.ics", weekly); resp.Code != http.StatusCreated {
+		t.Fatalf("put failed: %d %s", resp.Code, resp.Body)
+	}
+
+	body := serve(h, "GET", calendarPath+"weekly.ics", "").Body.String()
+	master, exception := strings.Index(body, "SUMMARY:Weekly"), strings.Index(body, "SUMMARY:Moved")
+	if strings.Count(body, "BEGIN:VEVENT") != 2 || master < 0 || exception < master ||
+		!strings.Contains(body, "RECURRENCE-ID") {
+		t.Errorf("expected recurring event followed by its exception, got %s", body)
+	}
+
+	collection := serve(h, "PROPFIND", calendarPath, "", "Depth", "1").Body.String()
+	if strings.Count(collection, "weekly.ics") != 1 {
+		t.Errorf("expected one resource of recurring event, got %s", collection)
+	}
+}
+
+func TestGroupByUID(t *testing.T) {
+	start := &calendar.EventDateTime{DateTime: "2020-01-13T09:00:00Z"}
+	events := []*calendar.Event{
+		{Id: "weekly_1", ICalUID: "weekly", RecurringEventId: "weekly", Summary: "Moved"},
+		{Id: "lunch", ICalUID: "lunch"},
+		{Id: "weekly_2", ICalUID: "weekly", RecurringEventId: "weekly", Status: statusCancelled,
+			OriginalStartTime: start},
+		{Id: "weekly", ICalUID: "weekly", Recurrence: []string{"RRULE:FREQ=WEEKLY"}},
+	}
+
+	resources := groupByUID(events)
+	if len(resources) != 2 || resources[0].uid != "weekly" || resources[1].uid != "lunch" {
+		t.Fatalf("expected resources in order of first appearance, got %+v", resources)
+	}
+
+	weekly := resources[0]
+	if len(weekly.events) != 3 || weekly.events[0].Id != "weekly" || weekly.deleted() {
+		t.Errorf("expected recurring event first, got %+v", weekly.events)
+	}
+
+	rendered := weekly.calendarEvents()
+	if len(rendered) != 2 || rendered[1].Summary != "Moved" ||
+		strings.Join(rendered[0].Recurrence, ",") != "RRULE:FREQ=WEEKLY,EXDATE:20200113T090000Z" {
+		t.Errorf("expected cancelled instance as EXDATE, got %+v", rendered)
+	}
+
+	if len(events[3].Recurrence) != 1 {
+		t.Errorf("expected recurring event not modified, got %v", events[3].Recurrence)
+	}
+
+	cancelled := groupByUID([]*calendar.Event{{Id: "a", Status: statusCancelled}})
+	if !cancelled[0].deleted() {
+		t.Errorf("expected resource of cancelled events deleted")
+	}
+}
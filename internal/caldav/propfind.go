@@ -0,0 +1,312 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	xmlContentType   = "application/xml; charset=utf-8"
+	eventContentType = "text/calendar; charset=utf-8; component=vevent"
+)
+
+//readXML - parses the request body into v. Returns false on empty body.
+func readXML(c *gin.Context, v interface{}) (found bool, err error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxResourceSize))
+	if err != nil || len(strings.TrimSpace(string(body))) == 0 {
+		return false, err
+	}
+	return true, xml.Unmarshal(body, v)
+}
+
+func writeMultistatus(c *gin.Context, responses []response) {
+	c.Data(http.StatusMultiStatus, xmlContentType, multistatus(responses))
+}
+
+func (t target) homeProperties() []property {
+	home := hrefValue(t.homeHref())
+	return []property{
+		{propResourceType, "<d:collection/><d:principal/>"},
+		{propDisplayName, escape(t.domain)},
+		{propPrincipal, home},
+		{propPrincipalURL, home},
+		{propHomeSet, home},
+	}
+}
+
+func (t target) calendarProperties(entry *calendar.CalendarListEntry) []property {
+	name := entry.SummaryOverride
+	if name == "" {
+		name = entry.Summary
+	}
+
+	return []property{
+		{propResourceType, "<d:collection/><c:calendar/>"},
+		{propDisplayName, escape(name)},
+		{propCalendarDesc, escape(entry.Description)},
+		{propComponentSet, "<c:comp name=\"VEVENT\"/>"},
+		{propReportSet, "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>"},
+		{propPrincipal, hrefValue(t.homeHref())},
+	}
+}
+
+//resourceResponse - properties of an event resource. calendar-data is
+//only included if requested.
+func (t target) resourceResponse(r *resource, requested []xml.Name) (response, error) {
+	properties := []property{
+		{propResourceType, ""},
+		{propETag, escape(r.etag())},
+		{propContentType, eventContentType},
+	}
+
+	for _, name := range requested {
+		if name == propCalendarData {
+			data, err := r.encode()
+			if err != nil {
+				return response{}, err
+			}
+			properties = append(properties, property{propCalendarData, escape(string(data))})
+		}
+	}
+	return newResponse(t.resourceHref(r.uid), properties, requested), nil
+}
+
+//resourceResponses - responses of all resources of events not deleted
+func (t target) resourceResponses(events []*calendar.Event, requested []xml.Name) (
+	[]response,
+	error,
+) {
+	responses := []response{}
+	for _, r := range groupByUID(events) {
+		if r.deleted() {
+			continue
+		}
+
+		resp, err := t.resourceResponse(r, requested)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+//propfind - properties of the calendar home, a calendar or an event.
+//Depth infinity is treated as 1.
+func propfind(c *gin.Context, t target) {
+	req := propfindRequest{}
+	_, err := readXML(c, &req)
+	if err != nil {
+		c.String(http.StatusBadRequest, "bad propfind request: "+err.Error())
+		return
+	}
+
+	requested := req.Prop.names()
+	depth := c.GetHeader("Depth")
+	responses := []response{}
+
+	switch {
+	case t.isHome():
+		responses = append(responses, newResponse(t.homeHref(), t.homeProperties(), requested))
+		if depth == "0" {
+			break
+		}
+
+		calendars, err := connector(c, t).ListCalendars()
+		if err != nil {
+			fail(c, err)
+			return
+		}
+
+		for _, v := range calendars {
+			responses = append(responses,
+				newResponse(t.calendarHref(v.Id), t.calendarProperties(v), requested))
+		}
+	case t.isCalendar():
+		entry, err := connector(c, t).GetCalendarEntry()
+		if err != nil {
+			fail(c, err)
+			return
+		}
+
+		responses = append(responses, newResponse(
+			t.calendarHref(t.calendarID), t.calendarProperties(entry), requested,
+		))
+		if depth == "0" {
+			break
+		}
+
+		events, err := connector(c, t).ListEvents("", "", true)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+
+		resources, err := t.resourceResponses(events, requested)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		responses = append(responses, resources...)
+	default:
+		r, err := findResource(c, t)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+
+		resp, err := t.resourceResponse(r, requested)
+		if err != nil {
+			fail(c, err)
+			return
+		}
+		responses = append(responses, resp)
+	}
+
+	writeMultistatus(c, responses)
+}
+
+//toRFC3339 - converts a time-range bound
+func toRFC3339(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	t, err := time.Parse(utcTimeFormat, value)
+	if err != nil {
+		return "", requestError("bad time-range: " + err.Error())
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+//queryRange - time range of a calendar-query filter. matches is false if
+//the filter can not match events, i.e. filters on todos.
+func queryRange(f *filter) (min string, max string, matches bool, err error) {
+	if f == nil {
+		return "", "", true, nil
+	}
+
+	for _, cal := range f.CompFilters {
+		if cal.Name != "VCALENDAR" {
+			continue
+		}
+
+		if len(cal.CompFilters) == 0 {
+			return "", "", true, nil
+		}
+
+		for _, comp := range cal.CompFilters {
+			if comp.Name != "VEVENT" {
+				continue
+			}
+
+			if comp.TimeRange == nil {
+				return "", "", true, nil
+			}
+
+			min, err = toRFC3339(comp.TimeRange.Start)
+			if err != nil {
+				return "", "", false, err
+			}
+
+			max, err = toRFC3339(comp.TimeRange.End)
+			return min, max, err == nil, err
+		}
+	}
+	return "", "", false, nil
+}
+
+//calendarQuery - resources of events in the filter's time range
+func calendarQuery(c *gin.Context, t target, req reportRequest) ([]response, error) {
+	min, max, matches, err := queryRange(req.Filter)
+	if err != nil || !matches {
+		return []response{}, err
+	}
+
+	events, err := connector(c, t).ListEvents(min, max, true)
+	if err != nil {
+		return nil, err
+	}
+	return t.resourceResponses(events, req.Prop.names())
+}
+
+//calendarMultiget - resources by href. Missing ones get a 404 status.
+func calendarMultiget(c *gin.Context, t target, req reportRequest) ([]response, error) {
+	home := "/" + t.domain + "/caldav/" //unescaped, as url paths are
+	responses := []response{}
+	for _, href := range req.Hrefs {
+		href = strings.TrimSpace(href)
+		u, err := url.Parse(href)
+		if err != nil || !strings.HasPrefix(u.Path, home) {
+			responses = append(responses, response{href: href, status: http.StatusNotFound})
+			continue
+		}
+
+		resourceTarget, ok := parseTarget(t.domain, strings.TrimPrefix(u.Path, home))
+		if !ok || !resourceTarget.isResource() || resourceTarget.calendarID != t.calendarID {
+			responses = append(responses, response{href: href, status: http.StatusNotFound})
+			continue
+		}
+
+		r, err := findResource(c, resourceTarget)
+		if err != nil {
+			if errorStatus(err) != http.StatusNotFound {
+				return nil, err
+			}
+			responses = append(responses, response{href: href, status: http.StatusNotFound})
+			continue
+		}
+
+		resp, err := resourceTarget.resourceResponse(r, req.Prop.names())
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+//report - calendar-query and calendar-multiget on a calendar collection
+func report(c *gin.Context, t target) {
+	if !t.isCalendar() {
+		c.String(http.StatusBadRequest, "reports are only supported on calendars")
+		return
+	}
+
+	req := reportRequest{}
+	found, err := readXML(c, &req)
+	if err != nil {
+		c.String(http.StatusBadRequest, "bad report request: "+err.Error())
+		return
+	}
+
+	if !found {
+		c.String(http.StatusBadRequest, "missing report request")
+		return
+	}
+
+	var responses []response
+	switch req.XMLName {
+	case reportCalendarQuery:
+		responses, err = calendarQuery(c, t, req)
+	case reportCalendarMultiget:
+		responses, err = calendarMultiget(c, t, req)
+	default:
+		c.String(http.StatusForbidden, "unsupported report "+req.XMLName.Local)
+		return
+	}
+
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	writeMultistatus(c, responses)
+}
@@ -0,0 +1,115 @@
+package caldav
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/tktip/google-calendar/pkg/ics"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	icsSuffix       = ".ics"
+	icsContentType  = "text/calendar; charset=utf-8"
+	utcTimeFormat   = "20060102T150405Z"
+	statusCancelled = "cancelled"
+)
+
+//resource - a calendar object resource, i.e. the google events sharing
+//an iCalendar uid. Modified instances follow the recurring event.
+type resource struct {
+	uid    string
+	events []*calendar.Event
+}
+
+//groupByUID - resources of events, in order of first appearance
+func groupByUID(events []*calendar.Event) []*resource {
+	resources := []*resource{}
+	byUID := map[string]*resource{}
+	for _, v := range events {
+		uid := ics.UID(v)
+		r := byUID[uid]
+		if r == nil {
+			r = &resource{uid: uid}
+			byUID[uid] = r
+			resources = append(resources, r)
+		}
+
+		if v.RecurringEventId == "" {
+			r.events = append([]*calendar.Event{v}, r.events...)
+		} else {
+			r.events = append(r.events, v)
+		}
+	}
+	return resources
+}
+
+//deleted - whether all events are cancelled, i.e. the resource was deleted
+func (r *resource) deleted() bool {
+	for _, v := range r.events {
+		if v.Status != statusCancelled {
+			return false
+		}
+	}
+	return true
+}
+
+//etag - changes whenever one of the events changes
+func (r *resource) etag() string {
+	hash := sha1.New()
+	for _, v := range r.events {
+		hash.Write([]byte(v.Id + v.Etag))
+	}
+	return "\"" + hex.EncodeToString(hash.Sum(nil)) + "\""
+}
+
+//exdate - EXDATE of a deleted occurrence
+func exdate(start *calendar.EventDateTime) string {
+	if start == nil {
+		return ""
+	}
+
+	if start.Date != "" {
+		return "EXDATE;VALUE=DATE:" + start.Date[0:4] + start.Date[5:7] + start.Date[8:10]
+	}
+
+	t, err := time.Parse(time.RFC3339, start.DateTime)
+	if err != nil {
+		return ""
+	}
+	return "EXDATE:" + t.UTC().Format(utcTimeFormat)
+}
+
+//calendarEvents - events to render. Google keeps deleted occurrences as
+//cancelled instances, which iCalendar expects as EXDATEs.
+func (r *resource) calendarEvents() []*calendar.Event {
+	events := []*calendar.Event{}
+	var exdates []string
+	for _, v := range r.events {
+		if v.Status == statusCancelled {
+			if line := exdate(v.OriginalStartTime); line != "" {
+				exdates = append(exdates, line)
+			}
+			continue
+		}
+		events = append(events, v)
+	}
+
+	if len(exdates) == 0 || len(events) == 0 || events[0].RecurringEventId != "" {
+		return events
+	}
+
+	master := *events[0]
+	master.Recurrence = append(append([]string{}, master.Recurrence...), exdates...)
+	events[0] = &master
+	return events
+}
+
+//encode - the resource as an iCalendar object
+func (r *resource) encode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := ics.Calendar{Events: r.calendarEvents()}.Encode(&buf)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,204 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+)
+
+//xml namespaces
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+)
+
+var prefixes = map[string]string{
+	nsDAV:    "d",
+	nsCalDAV: "c",
+}
+
+//properties used by clients
+var (
+	propResourceType       = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName        = xml.Name{Space: nsDAV, Local: "displayname"}
+	propETag               = xml.Name{Space: nsDAV, Local: "getetag"}
+	propContentType        = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propPrincipal          = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL       = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propReportSet          = xml.Name{Space: nsDAV, Local: "supported-report-set"}
+	propHomeSet            = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propComponentSet       = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCalendarData       = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propCalendarDesc       = xml.Name{Space: nsCalDAV, Local: "calendar-description"}
+	reportCalendarQuery    = xml.Name{Space: nsCalDAV, Local: "calendar-query"}
+	reportCalendarMultiget = xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}
+)
+
+//anyElement - element of which only the name matters
+type anyElement struct {
+	XMLName xml.Name
+}
+
+type propNames struct {
+	Names []anyElement `xml:",any"`
+}
+
+//names - requested property names, nil meaning all
+func (p *propNames) names() []xml.Name {
+	if p == nil {
+		return nil
+	}
+
+	names := []xml.Name{}
+	for _, v := range p.Names {
+		names = append(names, v.XMLName)
+	}
+	return names
+}
+
+//propfindRequest - body of PROPFIND. An empty body means allprop.
+type propfindRequest struct {
+	XMLName xml.Name   `xml:"DAV: propfind"`
+	Prop    *propNames `xml:"DAV: prop"`
+}
+
+type timeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	TimeRange   *timeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type filter struct {
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+//reportRequest - body of calendar-query and calendar-multiget REPORTs
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    *propNames `xml:"DAV: prop"`
+	Hrefs   []string   `xml:"DAV: href"`
+	Filter  *filter    `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+//property - name and inner xml of a property value
+type property struct {
+	name  xml.Name
+	value string
+}
+
+//response - properties of a single resource
+type response struct {
+	href    string
+	found   []property
+	missing []xml.Name
+	status  int //instead of properties, i.e. on multiget of missing resource
+}
+
+//escape - xml escaped text
+func escape(s string) string {
+	buf := bytes.Buffer{}
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+//hrefValue - inner xml of properties containing a href
+func hrefValue(href string) string {
+	return "<d:href>" + escape(href) + "</d:href>"
+}
+
+//newResponse - selects the requested properties of available ones.
+//All are selected if requested is nil.
+func newResponse(href string, available []property, requested []xml.Name) response {
+	r := response{href: href}
+	if requested == nil {
+		r.found = available
+		return r
+	}
+
+	for _, name := range requested {
+		found := false
+		for _, v := range available {
+			if v.name == name {
+				r.found = append(r.found, v)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			r.missing = append(r.missing, name)
+		}
+	}
+	return r
+}
+
+//writeElement - writes an element, declaring its namespace if unknown
+func writeElement(buf *bytes.Buffer, name xml.Name, value string) {
+	prefix, ok := prefixes[name.Space]
+	declaration := ""
+	if !ok {
+		prefix = "x"
+		declaration = fmt.Sprintf(" xmlns:x=\"%s\"", escape(name.Space))
+	}
+
+	tag := prefix + ":" + name.Local
+	if value == "" {
+		fmt.Fprintf(buf, "<%s%s/>", tag, declaration)
+		return
+	}
+	fmt.Fprintf(buf, "<%s%s>%s</%s>", tag, declaration, value, tag)
+}
+
+func writeStatus(buf *bytes.Buffer, status int) {
+	fmt.Fprintf(buf, "<d:status>HTTP/1.1 %d %s</d:status>", status, http.StatusText(status))
+}
+
+func writePropstat(buf *bytes.Buffer, props []property, status int) {
+	buf.WriteString("<d:propstat><d:prop>")
+	for _, v := range props {
+		writeElement(buf, v.name, v.value)
+	}
+	buf.WriteString("</d:prop>")
+	writeStatus(buf, status)
+	buf.WriteString("</d:propstat>")
+}
+
+//multistatus - renders responses as a 207 Multi-Status body
+func multistatus(responses []response) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	fmt.Fprintf(&buf, "<d:multistatus xmlns:d=\"%s\" xmlns:c=\"%s\">", nsDAV, nsCalDAV)
+
+	for _, r := range responses {
+		buf.WriteString("<d:response>")
+		buf.WriteString(hrefValue(r.href))
+
+		if r.status != 0 {
+			writeStatus(&buf, r.status)
+			buf.WriteString("</d:response>")
+			continue
+		}
+
+		if len(r.found) > 0 || len(r.missing) == 0 {
+			writePropstat(&buf, r.found, http.StatusOK)
+		}
+
+		if len(r.missing) > 0 {
+			missing := []property{}
+			for _, name := range r.missing {
+				missing = append(missing, property{name: name})
+			}
+			writePropstat(&buf, missing, http.StatusNotFound)
+		}
+		buf.WriteString("</d:response>")
+	}
+
+	buf.WriteString("</d:multistatus>")
+	return buf.Bytes()
+}
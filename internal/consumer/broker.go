@@ -0,0 +1,122 @@
+package consumer
+
+import (
+	"sync"
+
+	"github.com/tktip/google-calendar/internal/random"
+	"golang.org/x/net/context"
+)
+
+//Message - a message on the bus
+type Message struct {
+	ID      string //set by the broker if empty, kept on redelivery
+	Body    []byte
+	Headers map[string]string
+
+	//number of times delivered, 1 on first delivery
+	Attempt int
+}
+
+//Handler - handles a message. The message is acked if nil is returned,
+//and redelivered otherwise.
+type Handler func(msg Message) error
+
+//Broker - connection to a message bus, i.e. AMQP, NATS or Kafka.
+//Delivery is at least once, so handlers may get a message again.
+type Broker interface {
+	//Consume - calls handler for the messages of topic, until ctx is done
+	Consume(ctx context.Context, topic string, handler Handler) error
+
+	Publish(ctx context.Context, topic string, msg Message) error
+}
+
+//MemoryBroker - broker within the process, for tests. Messages not
+//acked are put back at the end of their topic.
+type MemoryBroker struct {
+	mutex  sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	messages []Message
+	notify   chan struct{}
+}
+
+//NewMemoryBroker - broker without messages
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{topics: map[string]*memoryTopic{}}
+}
+
+//topic - topic with name, created on first use. Must hold mutex.
+func (b *MemoryBroker) topic(name string) *memoryTopic {
+	t := b.topics[name]
+	if t == nil {
+		t = &memoryTopic{notify: make(chan struct{}, 1)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+//Publish - adds msg to the end of topic
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg Message) error {
+	if msg.ID == "" {
+		msg.ID = random.ID()
+	}
+	msg.Attempt = 0
+	b.push(topic, msg)
+	return nil
+}
+
+func (b *MemoryBroker) push(topic string, msg Message) {
+	b.mutex.Lock()
+	t := b.topic(topic)
+	t.messages = append(t.messages, msg)
+	b.mutex.Unlock()
+
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+//pop - first message of topic, if any
+func (b *MemoryBroker) pop(topic string) (Message, chan struct{}, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	t := b.topic(topic)
+	if len(t.messages) == 0 {
+		return Message{}, t.notify, false
+	}
+
+	msg := t.messages[0]
+	t.messages = t.messages[1:]
+	return msg, t.notify, true
+}
+
+//Consume - calls handler for the messages of topic, until ctx is done
+func (b *MemoryBroker) Consume(ctx context.Context, topic string, handler Handler) error {
+	for {
+		msg, notify, ok := b.pop(topic)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-notify:
+			}
+			continue
+		}
+
+		msg.Attempt++
+		if handler(msg) != nil {
+			b.push(topic, msg)
+		}
+	}
+}
+
+//Len - number of messages waiting in topic
+func (b *MemoryBroker) Len(topic string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.topic(topic).messages)
+}
@@ -0,0 +1,277 @@
+package consumer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	"github.com/tktip/google-calendar/internal/imip"
+	"github.com/tktip/google-calendar/internal/webhook"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+//revive:disable
+var (
+	ErrorMissingEvent     = fmt.Errorf("command has no event")
+	ErrorBadCommandType   = fmt.Errorf("command type invalid, must be one of create, update, patch, delete, addParticipants or removeParticipants")
+	ErrorMissingCommandID = fmt.Errorf("command has no id, and the message neither")
+)
+
+//revive:enable
+
+//Consumer - executes commands received on a topic, publishing the
+//result of each to another. Commands are deduplicated by id, so
+//redelivered commands are only executed once.
+type Consumer struct {
+	Broker   Broker
+	Commands string //topic commands are consumed from
+	Results  string //topic results are published to
+	Dedup    Deduplicator
+
+	//deliveries of a command failing because google is unavailable,
+	//before a failed result is published
+	MaxAttempts int
+
+	Inviter  *imip.Inviter       //for commands with sendInvitations
+	Webhooks *webhook.Dispatcher //notified of changes, the one of googlecal if nil
+}
+
+//New - consumer of commands, remembering the last 10000 for deduplication
+func New(broker Broker, commands string, results string) *Consumer {
+	return &Consumer{
+		Broker:      broker,
+		Commands:    commands,
+		Results:     results,
+		Dedup:       NewMemoryDeduplicator(10000),
+		MaxAttempts: 5,
+	}
+}
+
+//FromEnv creates a consumer of google cloud pub/sub configured by
+//CONSUMER_PUBSUB_PROJECT, CONSUMER_CREDENTIALS (service account file,
+//application default credentials if not set), CONSUMER_COMMANDS
+//(subscription commands are pulled from), CONSUMER_RESULTS (topic results
+//are published to) and CONSUMER_MAX_ATTEMPTS. The consumer is nil if
+//CONSUMER_PUBSUB_PROJECT is not set.
+func FromEnv() (*Consumer, error) {
+	project := os.Getenv("CONSUMER_PUBSUB_PROJECT")
+	if project == "" {
+		return nil, nil
+	}
+
+	opts := []option.ClientOption{}
+	if file := os.Getenv("CONSUMER_CREDENTIALS"); file != "" {
+		opts = append(opts, option.WithCredentialsFile(file))
+	}
+
+	broker, err := NewPubSubBroker(project, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := map[string]string{
+		"CONSUMER_COMMANDS": "calendar-commands",
+		"CONSUMER_RESULTS":  "calendar-results",
+	}
+	for name := range topics {
+		if v := os.Getenv(name); v != "" {
+			topics[name] = v
+		}
+	}
+
+	consumer := New(broker, topics["CONSUMER_COMMANDS"], topics["CONSUMER_RESULTS"])
+	consumer.Inviter = imip.InviterFromEnv()
+	if v := os.Getenv("CONSUMER_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("CONSUMER_MAX_ATTEMPTS must be a positive number, got %q", v)
+		}
+		consumer.MaxAttempts = attempts
+	}
+	return consumer, nil
+}
+
+//Run - consumes commands until ctx is done
+func (c *Consumer) Run(ctx context.Context) error {
+	return c.Broker.Consume(ctx, c.Commands, func(msg Message) error {
+		return c.handle(ctx, msg)
+	})
+}
+
+//handle - executes the command of msg, unless already executed. Errors
+//google may recover from are returned, so the command is redelivered.
+func (c *Consumer) handle(ctx context.Context, msg Message) error {
+	command := global.Command{}
+	err := json.Unmarshal(msg.Body, &command)
+	if err != nil {
+		//redelivering can not fix a bad message
+		logrus.Warnf("Dropping command %s, not json: %v", msg.ID, err)
+		return nil
+	}
+
+	if command.ID == "" {
+		command.ID = msg.ID
+	}
+
+	if command.ID == "" {
+		logrus.Warnf("Dropping command: %v", ErrorMissingCommandID)
+		return nil
+	}
+
+	//the result may not have been published before the redelivery
+	if result, ok := c.Dedup.Get(command.ID); ok {
+		return c.publish(ctx, result)
+	}
+
+	result, err := c.execute(ctx, command)
+	if err != nil && googlecal.Temporary(err) && msg.Attempt < c.MaxAttempts {
+		logrus.Warnf("Command %s failed, to be redelivered: %v", command.ID, err)
+		return err
+	}
+
+	c.Dedup.Put(command.ID, result)
+	return c.publish(ctx, result)
+}
+
+//connector - connector of the command's domain, with its options
+func (c *Consumer) connector(
+	ctx context.Context,
+	command global.Command,
+) (*googlecal.CalendarConnector, error) {
+	options := command.Options
+	connector := googlecal.NewCalendarConnector(ctx, command.Domain).
+		InformGuestsAboutUpdates(options.BroadcastChanges).
+		GuestsCanModify(options.GuestsCanModify).
+		GuestsAutoAccept(options.GuestsAutoAccept).
+		EventIsprivate(options.PrivateEvent).
+		GuestsMayInviteOthers(options.GuestsMayInvite).
+		GuestsMaySeeOtherGuests(options.GuestsVisible).
+		NotifyWebhooks(c.Webhooks).
+		Idempotent(command.ID)
+
+	if options.SendInvitations {
+		if c.Inviter == nil {
+			return nil, googlecal.ErrorInvitationsDisabled
+		}
+		connector.SendInvitations(c.Inviter)
+	}
+	return connector, nil
+}
+
+//execute - makes the write of command
+func (c *Consumer) execute(ctx context.Context, command global.Command) (global.CommandResult, error) {
+	result := global.CommandResult{
+		CommandID: command.ID,
+		Type:      command.Type,
+		Domain:    command.Domain,
+		EventID:   command.EventID,
+	}
+	if command.Event != nil && command.Event.ID != nil {
+		result.EventID = *command.Event.ID
+	}
+
+	err := c.executeCommand(ctx, command, &result)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+func (c *Consumer) executeCommand(
+	ctx context.Context,
+	command global.Command,
+	result *global.CommandResult,
+) error {
+	connector, err := c.connector(ctx, command)
+	if err != nil {
+		return err
+	}
+
+	switch command.Type {
+	case global.CommandCreate, global.CommandUpdate, global.CommandPatch:
+		if command.Event == nil {
+			return ErrorMissingEvent
+		}
+	}
+
+	switch command.Type {
+	case global.CommandCreate:
+		err = create(connector, command, result)
+	case global.CommandUpdate:
+		result.Conference, err = connector.UpdateEvent(*command.Event)
+	case global.CommandPatch:
+		result.Conference, err = connector.PatchEvent(*command.Event)
+	case global.CommandDelete:
+		err = connector.DeleteEvent(command.EventID)
+	case global.CommandAddParticipants:
+		err = connector.AddParticipants(command.EventID, command.Participants)
+	case global.CommandRemoveParticipants:
+		emails := []string{}
+		for _, v := range command.Participants {
+			emails = append(emails, v.Email)
+		}
+		err = connector.RemoveParticipants(command.EventID, emails)
+	default:
+		err = ErrorBadCommandType
+	}
+	return err
+}
+
+//create - creates the event of command. Unless the event has an id, it
+//is given one derived from the command's, so a command redelivered after
+//its result was forgotten, i.e. by a restart, can not create it twice.
+func create(
+	connector *googlecal.CalendarConnector,
+	command global.Command,
+	result *global.CommandResult,
+) (err error) {
+	event := *command.Event
+	if event.ID != nil {
+		result.EventID, result.Conference, err = connector.CreateEvent(event)
+		return err
+	}
+
+	id := eventID(command.ID)
+	event.ID = &id
+	result.EventID, result.Conference, err = connector.CreateEvent(event)
+	if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == http.StatusConflict {
+		//created by an earlier delivery
+		result.EventID = id
+		result.Conference, err = connector.GetConference(id)
+	}
+	return err
+}
+
+//eventID - id of the event created by the command with id, valid as a
+//google event id like the ones of random.ID
+func eventID(commandID string) string {
+	sum := sha256.Sum256([]byte(commandID))
+	return hex.EncodeToString(sum[:16])
+}
+
+//publish - publishes result, with the command id as message id so
+//results published again can be deduplicated too
+func (c *Consumer) publish(ctx context.Context, result global.CommandResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return c.Broker.Publish(ctx, c.Results, Message{
+		ID:      result.CommandID,
+		Body:    body,
+		Headers: map[string]string{"type": result.Type, "domain": result.Domain},
+	})
+}
@@ -0,0 +1,258 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+//unavailable - backend failing the first inserts, as google does when
+//it is unavailable
+type unavailable struct {
+	backend.Backend
+	failures int
+}
+
+func (b *unavailable) InsertEvent(
+	ctx context.Context,
+	calendarID string,
+	event *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	if b.failures > 0 {
+		b.failures--
+		return nil, &googleapi.Error{Code: http.StatusServiceUnavailable}
+	}
+	return b.Backend.InsertEvent(ctx, calendarID, event, opts)
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func command(t *testing.T, c global.Command) Message {
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	return Message{Body: b}
+}
+
+//run - publishes msgs to a running consumer, returning the results
+//published, and the calendar written to
+func run(t *testing.T, failures int, maxAttempts int, msgs ...Message) ([]global.CommandResult, backend.Backend) {
+	memory := backend.NewMemory("calendar@example.com")
+	googlecal.UseBackend("flyvo", &unavailable{Backend: memory, failures: failures})
+	defer googlecal.UseBackend("flyvo", nil)
+
+	broker := NewMemoryBroker()
+	consumer := New(broker, "commands", "results")
+	consumer.MaxAttempts = maxAttempts
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go consumer.Run(ctx)
+
+	for _, msg := range msgs {
+		broker.Publish(ctx, "commands", msg)
+	}
+
+	timeout, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+
+	results := []global.CommandResult{}
+	broker.Consume(timeout, "results", func(msg Message) error {
+		result := global.CommandResult{}
+		if err := json.Unmarshal(msg.Body, &result); err != nil {
+			t.Errorf("bad result %s: %v", msg.Body, err)
+		}
+
+		if msg.ID != result.CommandID {
+			t.Errorf("result message id %q, command id %q", msg.ID, result.CommandID)
+		}
+
+		results = append(results, result)
+		if len(results) == len(msgs) {
+			stop()
+		}
+		return nil
+	})
+
+	if len(results) != len(msgs) {
+		t.Fatalf("expected %d results, got %+v", len(msgs), results)
+	}
+	return results, memory
+}
+
+func TestCommands(t *testing.T) {
+	event := global.Event{
+		ID:           str("abcdef"),
+		Title:        str("Meeting"),
+		Start:        str("2020-01-06T09:00:00+01:00"),
+		End:          str("2020-01-06T10:00:00+01:00"),
+		Participants: &[]global.Participant{{Email: "a@example.com"}},
+	}
+
+	results, memory := run(t, 0, 5,
+		command(t, global.Command{ID: "1", Type: global.CommandCreate, Domain: "flyvo", Event: &event}),
+		command(t, global.Command{ID: "2", Type: global.CommandPatch, Domain: "flyvo",
+			Event: &global.Event{ID: str("abcdef"), Location: str("Room 1")}}),
+		command(t, global.Command{ID: "3", Type: global.CommandAddParticipants, Domain: "flyvo",
+			EventID: "abcdef", Participants: []global.Participant{{Email: "b@example.com"}, {Email: "c@example.com"}}}),
+		command(t, global.Command{ID: "4", Type: global.CommandRemoveParticipants, Domain: "flyvo",
+			EventID: "abcdef", Participants: []global.Participant{{Email: "a@example.com"}}}),
+		command(t, global.Command{ID: "5", Type: "move", Domain: "flyvo"}),
+		command(t, global.Command{ID: "6", Type: global.CommandUpdate, Domain: "flyvo"}),
+		command(t, global.Command{ID: "7", Type: global.CommandDelete, Domain: "other", EventID: "abcdef"}),
+	)
+
+	want := []struct {
+		success bool
+		err     error
+	}{
+		{true, nil},
+		{true, nil},
+		{true, nil},
+		{true, nil},
+		{false, ErrorBadCommandType},
+		{false, ErrorMissingEvent},
+		{false, googlecal.ErrorUnknownDomain},
+	}
+
+	for i, result := range results {
+		if result.CommandID != fmt.Sprint(i+1) || result.Success != want[i].success {
+			t.Errorf("result %d: unexpected %+v", i, result)
+		}
+
+		if want[i].err != nil && result.Error != want[i].err.Error() {
+			t.Errorf("result %d: got error %q, want %q", i, result.Error, want[i].err)
+		}
+	}
+
+	if results[0].EventID != "abcdef" {
+		t.Errorf("expected event id of create, got %+v", results[0])
+	}
+
+	stored, err := memory.GetEvent(context.Background(), "primary", "abcdef")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+
+	if stored.Location != "Room 1" || len(stored.Attendees) != 2 || stored.Attendees[0].Email != "b@example.com" {
+		t.Errorf("commands not applied: %+v", stored)
+	}
+}
+
+func TestDuplicateCommands(t *testing.T) {
+	create := command(t, global.Command{ID: "1", Type: global.CommandCreate, Domain: "flyvo",
+		Event: &global.Event{
+			Title: str("Meeting"),
+			Start: str("2020-01-06T09:00:00+01:00"),
+			End:   str("2020-01-06T10:00:00+01:00"),
+		}})
+
+	//the id of the message is used if the command has none
+	noID := command(t, global.Command{Type: global.CommandDelete, Domain: "flyvo", EventID: "unknown"})
+	noID.ID = "message"
+
+	results, memory := run(t, 0, 5, create, create, noID)
+	if results[0] != results[1] || !results[0].Success {
+		t.Errorf("expected the result to be published again, got %+v", results)
+	}
+
+	if results[2].CommandID != "message" || results[2].Success {
+		t.Errorf("expected failed delete, got %+v", results[2])
+	}
+
+	events, err := memory.ListEvents(context.Background(), "primary", backend.ListOptions{})
+	if err != nil || len(events.Items) != 1 {
+		t.Errorf("expected one event, got %v %v", events, err)
+	}
+}
+
+func TestCreateAfterRestart(t *testing.T) {
+	memory := backend.NewMemory("calendar@example.com")
+	googlecal.UseBackend("flyvo", memory)
+	defer googlecal.UseBackend("flyvo", nil)
+
+	create := command(t, global.Command{ID: "1", Type: global.CommandCreate, Domain: "flyvo",
+		Event: &global.Event{
+			Title: str("Meeting"),
+			Start: str("2020-01-06T09:00:00+01:00"),
+			End:   str("2020-01-06T10:00:00+01:00"),
+		}})
+
+	ctx := context.Background()
+	broker := NewMemoryBroker()
+	for i := 0; i < 2; i++ {
+		//a new consumer remembers no commands, as after a restart
+		err := New(broker, "commands", "results").handle(ctx, create)
+		if err != nil {
+			t.Fatalf("delivery %d failed: %v", i+1, err)
+		}
+	}
+
+	timeout, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+
+	results := []global.CommandResult{}
+	broker.Consume(timeout, "results", func(msg Message) error {
+		result := global.CommandResult{}
+		json.Unmarshal(msg.Body, &result)
+		results = append(results, result)
+		if len(results) == 2 {
+			stop()
+		}
+		return nil
+	})
+
+	if len(results) != 2 || !results[1].Success || results[1].EventID != results[0].EventID {
+		t.Errorf("expected the redelivery to succeed with the same event, got %+v", results)
+	}
+
+	events, err := memory.ListEvents(ctx, "primary", backend.ListOptions{})
+	if err != nil || len(events.Items) != 1 {
+		t.Errorf("expected one event, got %v %v", events, err)
+	}
+}
+
+func TestRedelivery(t *testing.T) {
+	create := command(t, global.Command{ID: "1", Type: global.CommandCreate, Domain: "flyvo",
+		Event: &global.Event{
+			Title: str("Meeting"),
+			Start: str("2020-01-06T09:00:00+01:00"),
+			End:   str("2020-01-06T10:00:00+01:00"),
+		}})
+
+	results, _ := run(t, 2, 5, create)
+	if !results[0].Success {
+		t.Errorf("expected success on third delivery, got %+v", results[0])
+	}
+
+	results, _ = run(t, 2, 2, create)
+	if results[0].Success || results[0].Error == "" {
+		t.Errorf("expected failure after second delivery, got %+v", results[0])
+	}
+}
+
+func TestMemoryDeduplicator(t *testing.T) {
+	d := NewMemoryDeduplicator(2)
+	for _, id := range []string{"1", "2", "1", "3"} {
+		d.Put(id, global.CommandResult{CommandID: id})
+	}
+
+	for id, want := range map[string]bool{"1": false, "2": true, "3": true} {
+		if _, ok := d.Get(id); ok != want {
+			t.Errorf("%s: remembered %v, want %v", id, ok, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"sync"
+
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+)
+
+//Deduplicator - results of commands already executed, by command id
+type Deduplicator interface {
+	Get(id string) (global.CommandResult, bool)
+	Put(id string, result global.CommandResult)
+}
+
+//MemoryDeduplicator - the results of the last Size commands, in memory.
+//Redeliveries come soon after the first delivery, so old ones are
+//forgotten.
+type MemoryDeduplicator struct {
+	Size int
+
+	mutex   sync.Mutex
+	results map[string]global.CommandResult
+	order   []string //ids, oldest first
+}
+
+//NewMemoryDeduplicator - deduplicator remembering size commands
+func NewMemoryDeduplicator(size int) *MemoryDeduplicator {
+	return &MemoryDeduplicator{Size: size, results: map[string]global.CommandResult{}}
+}
+
+//Get - result of command with id, if executed
+func (d *MemoryDeduplicator) Get(id string) (global.CommandResult, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	result, ok := d.results[id]
+	return result, ok
+}
+
+//Put - remembers the result of command with id
+func (d *MemoryDeduplicator) Put(id string, result global.CommandResult) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.results[id]; !ok {
+		d.order = append(d.order, id)
+	}
+	d.results[id] = result
+
+	for len(d.order) > d.Size {
+		delete(d.results, d.order[0])
+		d.order = d.order[1:]
+	}
+}
@@ -0,0 +1,155 @@
+package consumer
+
+import (
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/jobs"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+//idAttribute - attribute of pub/sub messages holding the message id, as
+//pub/sub assigns its own ids on publish
+const idAttribute = "id"
+
+//PubSubBroker - broker on google cloud pub/sub. Consume pulls from the
+//subscription named topic, and Publish publishes to the topic named, both
+//in Project. Messages not acked are nacked, so pub/sub redelivers them
+//after Backoff of the delivery.
+type PubSubBroker struct {
+	Project    string
+	Service    *pubsub.Service
+	RetryDelay time.Duration //after failing to pull
+
+	//delay before redelivering a nacked message, by its delivery. At most
+	//10 minutes, the longest ack deadline of pub/sub.
+	Backoff func(attempt int) time.Duration
+
+	mutex    sync.Mutex
+	attempts map[string]int //deliveries of messages not acked, by id
+}
+
+//NewPubSubBroker - broker of the topics of project, calling pub/sub with
+//opts, i.e. option.WithCredentialsFile
+func NewPubSubBroker(project string, opts ...option.ClientOption) (*PubSubBroker, error) {
+	opts = append([]option.ClientOption{option.WithScopes(pubsub.PubsubScope)}, opts...)
+	srv, err := pubsub.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubBroker{
+		Project:    project,
+		Service:    srv,
+		RetryDelay: 5 * time.Second,
+		Backoff:    jobs.ExponentialBackoff(10*time.Second, 10*time.Minute),
+		attempts:   map[string]int{},
+	}, nil
+}
+
+//Consume - calls handler for the messages of the subscription topic,
+//until ctx is done. Failed pulls are logged and retried.
+func (b *PubSubBroker) Consume(ctx context.Context, topic string, handler Handler) error {
+	subscription := "projects/" + b.Project + "/subscriptions/" + topic
+	subscriptions := b.Service.Projects.Subscriptions
+
+	for ctx.Err() == nil {
+		resp, err := subscriptions.Pull(subscription, &pubsub.PullRequest{MaxMessages: 10}).
+			Context(ctx).Do()
+		if err != nil {
+			if ctx.Err() == nil {
+				logrus.Warnf("Could not pull from %s: %v", subscription, err)
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(b.RetryDelay):
+			}
+			continue
+		}
+
+		for _, received := range resp.ReceivedMessages {
+			err = b.deliver(ctx, subscription, received, handler)
+			if err != nil {
+				logrus.Warnf("Could not ack or nack message of %s: %v", subscription, err)
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+//deliver - calls handler with a received message, then acks or nacks it
+func (b *PubSubBroker) deliver(
+	ctx context.Context,
+	subscription string,
+	received *pubsub.ReceivedMessage,
+	handler Handler,
+) error {
+	subscriptions := b.Service.Projects.Subscriptions
+	msg := Message{ID: received.Message.MessageId, Headers: received.Message.Attributes}
+	if id := msg.Headers[idAttribute]; id != "" {
+		msg.ID = id
+	}
+
+	body, err := base64.StdEncoding.DecodeString(received.Message.Data)
+	if err != nil {
+		//redelivering can not fix a bad message
+		logrus.Warnf("Dropping message %s, bad data: %v", msg.ID, err)
+	} else {
+		msg.Body, msg.Attempt = body, b.attempt(msg.ID)
+		if handler(msg) != nil {
+			//redelivered once the new deadline expires, right away if 0
+			_, err = subscriptions.ModifyAckDeadline(subscription, &pubsub.ModifyAckDeadlineRequest{
+				AckIds:             []string{received.AckId},
+				AckDeadlineSeconds: int64(b.Backoff(msg.Attempt) / time.Second),
+				ForceSendFields:    []string{"AckDeadlineSeconds"},
+			}).Context(ctx).Do()
+			return err
+		}
+	}
+
+	b.acked(msg.ID)
+	_, err = subscriptions.Acknowledge(subscription, &pubsub.AcknowledgeRequest{
+		AckIds: []string{received.AckId},
+	}).Context(ctx).Do()
+	return err
+}
+
+//attempt - number of the delivery of the message with id, 1 on the first.
+//Only counted by this broker, as pub/sub does not tell.
+func (b *PubSubBroker) attempt(id string) int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.attempts[id]++
+	return b.attempts[id]
+}
+
+//acked - forgets the deliveries of the message with id
+func (b *PubSubBroker) acked(id string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.attempts, id)
+}
+
+//Publish - publishes msg to topic, with its id and headers as attributes
+func (b *PubSubBroker) Publish(ctx context.Context, topic string, msg Message) error {
+	attributes := map[string]string{}
+	for k, v := range msg.Headers {
+		attributes[k] = v
+	}
+
+	if msg.ID != "" {
+		attributes[idAttribute] = msg.ID
+	}
+
+	_, err := b.Service.Projects.Topics.Publish("projects/"+b.Project+"/topics/"+topic,
+		&pubsub.PublishRequest{Messages: []*pubsub.PubsubMessage{{
+			Data:       base64.StdEncoding.EncodeToString(msg.Body),
+			Attributes: attributes,
+		}}}).Context(ctx).Do()
+	return err
+}
@@ -0,0 +1,154 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+//fakePubSub - the pub/sub endpoints used by the broker, with a
+//subscription of the same name for every topic. Nacked messages are
+//available again right away, whatever their deadline.
+type fakePubSub struct {
+	mutex       sync.Mutex
+	published   int
+	acks        int
+	deadlines   []int64                            //of nacks
+	available   map[string][]*pubsub.PubsubMessage //by subscription
+	outstanding map[string]*pubsub.PubsubMessage   //by ack id
+	subscribed  map[string]string                  //subscription, by ack id
+}
+
+func newFakePubSub() *fakePubSub {
+	return &fakePubSub{
+		available:   map[string][]*pubsub.PubsubMessage{},
+		outstanding: map[string]*pubsub.PubsubMessage{},
+		subscribed:  map[string]string{},
+	}
+}
+
+func (f *fakePubSub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(r.URL.Path, ":", 2)
+	name, action := path.Base(parts[0]), parts[len(parts)-1]
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var resp interface{} = struct{}{}
+	switch action {
+	case "publish":
+		req := pubsub.PublishRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, msg := range req.Messages {
+			f.published++
+			msg.MessageId = fmt.Sprint(f.published)
+			f.available[name] = append(f.available[name], msg)
+		}
+	case "pull":
+		received := []*pubsub.ReceivedMessage{}
+		for _, msg := range f.available[name] {
+			f.acks++
+			ackID := fmt.Sprint("ack", f.acks)
+			f.outstanding[ackID], f.subscribed[ackID] = msg, name
+			received = append(received, &pubsub.ReceivedMessage{AckId: ackID, Message: msg})
+		}
+		f.available[name] = nil
+		resp = pubsub.PullResponse{ReceivedMessages: received}
+	case "acknowledge":
+		req := pubsub.AcknowledgeRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, ackID := range req.AckIds {
+			delete(f.outstanding, ackID)
+		}
+	case "modifyAckDeadline":
+		req := pubsub.ModifyAckDeadlineRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, ackID := range req.AckIds {
+			if msg := f.outstanding[ackID]; msg != nil {
+				f.deadlines = append(f.deadlines, req.AckDeadlineSeconds)
+				f.available[f.subscribed[ackID]] = append(f.available[f.subscribed[ackID]], msg)
+				delete(f.outstanding, ackID)
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func TestPubSubBroker(t *testing.T) {
+	fake := newFakePubSub()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	broker, err := NewPubSubBroker("project",
+		option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("broker failed: %v", err)
+	}
+	broker.RetryDelay = time.Millisecond
+
+	memory := backend.NewMemory("calendar@example.com")
+	googlecal.UseBackend("flyvo", &unavailable{Backend: memory, failures: 1})
+	defer googlecal.UseBackend("flyvo", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	create := command(t, global.Command{ID: "1", Type: global.CommandCreate, Domain: "flyvo",
+		Event: &global.Event{
+			Title: str("Meeting"),
+			Start: str("2020-01-06T09:00:00+01:00"),
+			End:   str("2020-01-06T10:00:00+01:00"),
+		}})
+	err = broker.Publish(ctx, "commands", create)
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	go New(broker, "commands", "results").Run(ctx)
+
+	timeout, stop := context.WithTimeout(ctx, 5*time.Second)
+	defer stop()
+
+	results := []global.CommandResult{}
+	broker.Consume(timeout, "results", func(msg Message) error {
+		result := global.CommandResult{}
+		json.Unmarshal(msg.Body, &result)
+		if msg.ID != "1" || msg.Headers["type"] != global.CommandCreate {
+			t.Errorf("unexpected result message %+v", msg)
+		}
+
+		results = append(results, result)
+		stop()
+		return nil
+	})
+
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("expected success on the second delivery, got %+v", results)
+	}
+
+	events, err := memory.ListEvents(ctx, "primary", backend.ListOptions{})
+	if err != nil || len(events.Items) != 1 {
+		t.Errorf("expected one event, got %v %v", events, err)
+	}
+
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	if len(fake.deadlines) != 1 || fake.deadlines[0] != 10 {
+		t.Errorf("expected the first nack to delay 10 seconds, got %v", fake.deadlines)
+	}
+}
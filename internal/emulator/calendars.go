@@ -0,0 +1,92 @@
+package emulator
+
+import (
+	"net/http"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func (e *Emulator) colors(r *http.Request, path []string) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return 0, nil, methodNotAllowed()
+	}
+
+	colors, err := e.backend.GetColors(r.Context())
+	return http.StatusOK, colors, err
+}
+
+func (e *Emulator) freeBusy(r *http.Request, path []string) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return 0, nil, methodNotAllowed()
+	}
+
+	req := &calendar.FreeBusyRequest{}
+	err := decode(r, req)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	response, err := e.backend.QueryFreeBusy(r.Context(), req)
+	return http.StatusOK, response, err
+}
+
+//calendarList - list of calendars, or a calendar list entry
+func (e *Emulator) calendarList(r *http.Request, path []string) (int, interface{}, error) {
+	if r.Method != http.MethodGet {
+		return 0, nil, methodNotAllowed()
+	}
+
+	if len(path) == 4 {
+		entry, err := e.backend.GetCalendar(r.Context(), path[3])
+		return http.StatusOK, entry, err
+	}
+
+	calendars, err := e.backend.ListCalendars(r.Context())
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &calendar.CalendarList{Kind: "calendar#calendarList", Items: calendars}, nil
+}
+
+//acl - rule list, insert, patch and delete
+func (e *Emulator) acl(r *http.Request, path []string) (int, interface{}, error) {
+	calendarID := path[1]
+	sendNotifications := r.URL.Query().Get("sendNotifications") != "false"
+
+	if len(path) == 3 {
+		switch r.Method {
+		case http.MethodGet:
+			rules, err := e.backend.ListACL(r.Context(), calendarID)
+			if err != nil {
+				return 0, nil, err
+			}
+			return http.StatusOK, &calendar.Acl{Kind: "calendar#acl", Items: rules}, nil
+		case http.MethodPost:
+			rule := &calendar.AclRule{}
+			err := decode(r, rule)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			inserted, err := e.backend.InsertACL(r.Context(), calendarID, rule, sendNotifications)
+			return http.StatusOK, inserted, err
+		}
+		return 0, nil, methodNotAllowed()
+	}
+
+	ruleID := path[3]
+	switch r.Method {
+	case http.MethodPatch:
+		rule := &calendar.AclRule{}
+		err := decode(r, rule)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		patched, err := e.backend.PatchACL(r.Context(), calendarID, ruleID, rule, sendNotifications)
+		return http.StatusOK, patched, err
+	case http.MethodDelete:
+		return http.StatusNoContent, nil, e.backend.DeleteACL(r.Context(), calendarID, ruleID)
+	}
+	return 0, nil, methodNotAllowed()
+}
@@ -0,0 +1,43 @@
+package emulator
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+)
+
+//Credentials creates a config file for the service, with a service
+//account per domain getting its tokens from the emulator at baseURL,
+//i.e. http://localhost:8085. The private key is generated, as the
+//emulator does not verify it.
+func Credentials(baseURL string, domains []string) ([]byte, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	config := map[string]interface{}{}
+	for _, domain := range domains {
+		config[domain] = map[string]interface{}{
+			"scopes":         []string{"https://www.googleapis.com/auth/calendar"},
+			"type":           "service_account",
+			"project_id":     "emulator",
+			"private_key_id": "emulator",
+			"private_key":    string(privateKey),
+			"client_email":   "emulator@" + domain,
+			"client_id":      "emulator",
+			"auth_uri":       baseURL + "/auth",
+			"token_uri":      baseURL + TokenPath,
+		}
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
@@ -0,0 +1,207 @@
+//Package emulator serves the subset of the Google Calendar v3 REST api
+//used by the connector, backed by an in-memory calendar, along with a
+//fake OAuth token endpoint. Pointing token_uri and the api endpoint at
+//it runs the service end to end without Google.
+package emulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/random"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	//APIPath is the path of the calendar api, as in google's base url
+	APIPath = "/calendar/v3/"
+
+	//TokenPath is the path of the OAuth token endpoint
+	TokenPath = "/token"
+
+	tokenLifetime = 3600 //seconds
+)
+
+//Emulator - http handler of the calendar api and token endpoint
+type Emulator struct {
+	backend backend.Backend
+	mux     *http.ServeMux
+}
+
+//New creates an emulator serving the calendars of b
+func New(b backend.Backend) *Emulator {
+	e := &Emulator{backend: b, mux: http.NewServeMux()}
+	e.mux.HandleFunc(TokenPath, e.token)
+	e.mux.HandleFunc(APIPath, e.api)
+	return e
+}
+
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+//token - issues a token for any JWT assertion. The assertion is not
+//verified, so any private key does.
+func (e *Emulator) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, &googleapi.Error{Code: http.StatusMethodNotAllowed, Message: "Method not allowed."})
+		return
+	}
+
+	if r.FormValue("assertion") == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error":             "invalid_request",
+			"error_description": "Missing assertion.",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "emulator-" + random.ID(),
+		"token_type":   "Bearer",
+		"expires_in":   tokenLifetime,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+//writeError - writes err as google does, so the client parses it into
+//a googleapi.Error
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		apiErr = &googleapi.Error{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+
+	writeJSON(w, apiErr.Code, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    apiErr.Code,
+			"message": apiErr.Message,
+			"errors": []map[string]string{{
+				"domain":  "global",
+				"reason":  reason(apiErr.Code),
+				"message": apiErr.Message,
+			}},
+		},
+	})
+}
+
+//reason - google's error reason of status code
+func reason(code int) string {
+	switch code {
+	case http.StatusBadRequest:
+		return "invalid"
+	case http.StatusUnauthorized:
+		return "authError"
+	case http.StatusNotFound:
+		return "notFound"
+	case http.StatusConflict:
+		return "duplicate"
+	case http.StatusGone:
+		return "deleted"
+	}
+	return "backendError"
+}
+
+func badRequest(message string) error {
+	return &googleapi.Error{Code: http.StatusBadRequest, Message: message}
+}
+
+func notFound() error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: "Not Found"}
+}
+
+//segments - unescaped path segments after the api path
+func segments(r *http.Request) ([]string, error) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), APIPath)
+	parts := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, v := range parts {
+		unescaped, err := url.PathUnescape(v)
+		if err != nil {
+			return nil, badRequest("Bad path.")
+		}
+		parts[i] = unescaped
+	}
+	return parts, nil
+}
+
+//api - routes calendar api requests
+func (e *Emulator) api(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, &googleapi.Error{Code: http.StatusUnauthorized, Message: "Login Required."})
+		return
+	}
+
+	path, err := segments(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var handler func(*http.Request, []string) (int, interface{}, error)
+	switch {
+	case match(path, "colors"):
+		handler = e.colors
+	case match(path, "freeBusy"):
+		handler = e.freeBusy
+	case match(path, "users", "me", "calendarList"),
+		match(path, "users", "me", "calendarList", "*"):
+		handler = e.calendarList
+	case match(path, "calendars", "*", "events", "import"):
+		handler = e.importEvent
+	case match(path, "calendars", "*", "events"),
+		match(path, "calendars", "*", "events", "*"):
+		handler = e.events
+	case match(path, "calendars", "*", "acl"),
+		match(path, "calendars", "*", "acl", "*"):
+		handler = e.acl
+	default:
+		writeError(w, notFound())
+		return
+	}
+
+	status, v, err := handler(r, path)
+	switch {
+	case err != nil:
+		writeError(w, err)
+	case v == nil:
+		w.WriteHeader(status)
+	default:
+		writeJSON(w, status, v)
+	}
+}
+
+//match - whether path is pattern, where * matches any segment
+func match(path []string, pattern ...string) bool {
+	if len(path) != len(pattern) {
+		return false
+	}
+
+	for i, v := range pattern {
+		if v != "*" && v != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func methodNotAllowed() error {
+	return &googleapi.Error{Code: http.StatusMethodNotAllowed, Message: "Method not allowed."}
+}
+
+func decode(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil {
+		return badRequest("Parse Error: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package emulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const owner = "calendar@example.com"
+
+//newService - emulator, and a client authenticating through its token
+//endpoint as the connector does
+func newService(t *testing.T) (*calendar.Service, func()) {
+	server := httptest.NewServer(New(backend.NewMemory(owner)))
+
+	b, err := Credentials(server.URL, []string{"example"})
+	if err != nil {
+		t.Fatalf("credentials failed: %v", err)
+	}
+
+	credentials := map[string]json.RawMessage{}
+	json.Unmarshal(b, &credentials)
+	config, err := google.JWTConfigFromJSON(credentials["example"], calendar.CalendarScope)
+	if err != nil {
+		t.Fatalf("bad credentials: %v", err)
+	}
+
+	ctx := context.Background()
+	srv, err := calendar.NewService(ctx,
+		option.WithTokenSource(config.TokenSource(ctx)),
+		option.WithEndpoint(server.URL+APIPath),
+	)
+	if err != nil {
+		t.Fatalf("service failed: %v", err)
+	}
+	return srv, server.Close
+}
+
+func errorCode(err error) int {
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		return apiErr.Code
+	}
+	return 0
+}
+
+func TestEvents(t *testing.T) {
+	srv, stop := newService(t)
+	defer stop()
+
+	event := &calendar.Event{
+		Summary:   "Meeting",
+		Location:  "Room 1",
+		Start:     &calendar.EventDateTime{DateTime: "2020-01-06T09:00:00Z"},
+		End:       &calendar.EventDateTime{DateTime: "2020-01-06T10:00:00Z"},
+		Attendees: []*calendar.EventAttendee{{Email: "guest@example.com"}},
+		ConferenceData: &calendar.ConferenceData{
+			CreateRequest: &calendar.CreateConferenceRequest{RequestId: "r1"},
+		},
+	}
+	inserted, err := srv.Events.Insert("primary", event).ConferenceDataVersion(1).Do()
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	if inserted.Id == "" || inserted.HangoutLink == "" {
+		t.Errorf("expected id and conference, got %q %q", inserted.Id, inserted.HangoutLink)
+	}
+
+	patch := &calendar.Event{
+		Summary:         "Renamed",
+		Attendees:       []*calendar.EventAttendee{},
+		ForceSendFields: []string{"Attendees"},
+		NullFields:      []string{"Location"},
+	}
+	patched, err := srv.Events.Patch(owner, inserted.Id, patch).Do()
+	if err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	if patched.Summary != "Renamed" || patched.Location != "" || len(patched.Attendees) != 0 {
+		t.Errorf("patch should rename and clear location and attendees, got %q %q %d",
+			patched.Summary, patched.Location, len(patched.Attendees))
+	}
+
+	events, err := srv.Events.List("primary").SingleEvents(true).
+		TimeMin("2020-01-06T00:00:00Z").TimeMax("2020-01-07T00:00:00Z").Do()
+	if err != nil || len(events.Items) != 1 || events.NextSyncToken == "" {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	err = srv.Events.Delete("primary", inserted.Id).SendUpdates("all").Do()
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	_, err = srv.Events.Get("primary", "unknown1").Do()
+	if errorCode(err) != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", err)
+	}
+
+	err = srv.Events.Delete("primary", inserted.Id).Do()
+	if errorCode(err) != http.StatusGone {
+		t.Errorf("expected 410, got %v", err)
+	}
+}
+
+func TestImportAndCalendars(t *testing.T) {
+	srv, stop := newService(t)
+	defer stop()
+
+	event := &calendar.Event{
+		ICalUID: "uid@example.com",
+		Start:   &calendar.EventDateTime{DateTime: "2020-01-06T09:00:00Z", TimeZone: "UTC"},
+		End:     &calendar.EventDateTime{DateTime: "2020-01-06T10:00:00Z", TimeZone: "UTC"},
+	}
+	first, err := srv.Events.Import("primary", event).Do()
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	second, err := srv.Events.Import("primary", event).Do()
+	if err != nil || second.Id != first.Id {
+		t.Errorf("import should upsert by uid: %v", err)
+	}
+
+	calendars, err := srv.CalendarList.List().Do()
+	if err != nil || len(calendars.Items) != 1 || !calendars.Items[0].Primary {
+		t.Errorf("expected primary calendar: %v", err)
+	}
+
+	colors, err := srv.Colors.Get().Do()
+	if err != nil || len(colors.Event) == 0 {
+		t.Errorf("expected event colors: %v", err)
+	}
+
+	rule, err := srv.Acl.Insert("primary", &calendar.AclRule{
+		Role:  "reader",
+		Scope: &calendar.AclRuleScope{Type: "domain", Value: "example.com"},
+	}).Do()
+	if err != nil {
+		t.Fatalf("acl insert failed: %v", err)
+	}
+
+	acl, err := srv.Acl.List("primary").Do()
+	if err != nil || len(acl.Items) != 2 {
+		t.Errorf("expected owner and inserted rule: %v", err)
+	}
+
+	err = srv.Acl.Delete("primary", rule.Id).Do()
+	if err != nil {
+		t.Errorf("acl delete failed: %v", err)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := httptest.NewServer(New(backend.NewMemory(owner)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + APIPath + "colors")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", resp.StatusCode)
+	}
+}
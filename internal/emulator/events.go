@@ -0,0 +1,172 @@
+package emulator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"google.golang.org/api/calendar/v3"
+)
+
+//writeOptions - write options of the query
+func writeOptions(r *http.Request) (backend.WriteOptions, error) {
+	query := r.URL.Query()
+	opts := backend.WriteOptions{
+		SendUpdates:         query.Get("sendUpdates"),
+		SupportsAttachments: query.Get("supportsAttachments") == "true",
+	}
+
+	if v := query.Get("conferenceDataVersion"); v != "" {
+		version, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || version < 0 || version > 1 {
+			return opts, badRequest("Invalid conferenceDataVersion.")
+		}
+		opts.ConferenceDataVersion = version
+	}
+	return opts, nil
+}
+
+//listOptions - list options of the query. Pages are not supported, so
+//all events are returned at once.
+func listOptions(r *http.Request) backend.ListOptions {
+	query := r.URL.Query()
+	maxAttendees, _ := strconv.ParseInt(query.Get("maxAttendees"), 10, 64)
+	return backend.ListOptions{
+		TimeMin:                 query.Get("timeMin"),
+		TimeMax:                 query.Get("timeMax"),
+		ShowDeleted:             query.Get("showDeleted") == "true",
+		SingleEvents:            query.Get("singleEvents") == "true",
+		ICalUID:                 query.Get("iCalUID"),
+		PrivateExtendedProperty: query["privateExtendedProperty"],
+		SharedExtendedProperty:  query["sharedExtendedProperty"],
+		Query:                   query.Get("q"),
+		UpdatedMin:              query.Get("updatedMin"),
+		OrderBy:                 query.Get("orderBy"),
+		ShowHiddenInvitations:   query.Get("showHiddenInvitations") == "true",
+		MaxAttendees:            maxAttendees,
+		SyncToken:               query.Get("syncToken"),
+	}
+}
+
+//eventFields - go field names of calendar.Event by json name
+var eventFields = func() map[string]string {
+	fields := map[string]string{}
+	t := reflect.TypeOf(calendar.Event{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Name
+		}
+	}
+	return fields
+}()
+
+//decodePatch - decodes a patch, keeping which fields were sent. Fields
+//sent as null are removed, and fields sent empty are cleared.
+func decodePatch(r *http.Request) (*calendar.Event, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := map[string]json.RawMessage{}
+	patch := &calendar.Event{}
+	if json.Unmarshal(body, &raw) != nil || json.Unmarshal(body, patch) != nil {
+		return nil, badRequest("Parse Error")
+	}
+
+	for name, value := range raw {
+		field, ok := eventFields[name]
+		if !ok {
+			continue
+		}
+
+		if string(value) == "null" {
+			patch.NullFields = append(patch.NullFields, field)
+		} else {
+			patch.ForceSendFields = append(patch.ForceSendFields, field)
+		}
+	}
+	return patch, nil
+}
+
+//events - event list, insert, get, patch, update and delete
+func (e *Emulator) events(r *http.Request, path []string) (int, interface{}, error) {
+	calendarID := path[1]
+	if len(path) == 3 {
+		switch r.Method {
+		case http.MethodGet:
+			events, err := e.backend.ListEvents(r.Context(), calendarID, listOptions(r))
+			return http.StatusOK, events, err
+		case http.MethodPost:
+			opts, err := writeOptions(r)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			event := &calendar.Event{}
+			err = decode(r, event)
+			if err != nil {
+				return 0, nil, err
+			}
+
+			inserted, err := e.backend.InsertEvent(r.Context(), calendarID, event, opts)
+			return http.StatusOK, inserted, err
+		}
+		return 0, nil, methodNotAllowed()
+	}
+
+	eventID := path[3]
+	if r.Method == http.MethodGet {
+		event, err := e.backend.GetEvent(r.Context(), calendarID, eventID)
+		return http.StatusOK, event, err
+	}
+
+	opts, err := writeOptions(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch r.Method {
+	case http.MethodPatch:
+		patch, err := decodePatch(r)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		patched, err := e.backend.PatchEvent(r.Context(), calendarID, eventID, patch, opts)
+		return http.StatusOK, patched, err
+	case http.MethodPut:
+		event := &calendar.Event{}
+		err = decode(r, event)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		updated, err := e.backend.UpdateEvent(r.Context(), calendarID, eventID, event, opts)
+		return http.StatusOK, updated, err
+	case http.MethodDelete:
+		return http.StatusNoContent, nil, e.backend.DeleteEvent(r.Context(), calendarID, eventID, opts)
+	}
+	return 0, nil, methodNotAllowed()
+}
+
+//importEvent - upserts an event by iCalUID
+func (e *Emulator) importEvent(r *http.Request, path []string) (int, interface{}, error) {
+	if r.Method != http.MethodPost {
+		return 0, nil, methodNotAllowed()
+	}
+
+	event := &calendar.Event{}
+	err := decode(r, event)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	imported, err := e.backend.ImportEvent(r.Context(), path[1], event)
+	return http.StatusOK, imported, err
+}
@@ -0,0 +1,260 @@
+package googlecal
+
+import (
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	primaryCalendar = "primary"
+	scopeDefault    = "default"
+	roleOwner       = "owner"
+)
+
+var (
+	validACLRoles = map[string]bool{
+		"freeBusyReader": true,
+		"reader":         true,
+		"writer":         true,
+		roleOwner:        true,
+	}
+
+	validACLScopeTypes = map[string]bool{
+		"user":       true,
+		"group":      true,
+		"domain":     true,
+		scopeDefault: true,
+	}
+)
+
+//calendarOrPrimary - defaults empty calendar IDs to the primary calendar
+func calendarOrPrimary(calendarID string) string {
+	if calendarID == "" {
+		return primaryCalendar
+	}
+	return calendarID
+}
+
+func isValidACLRole(role *string) bool {
+	return role != nil && validACLRoles[*role]
+}
+
+//isACLScopeValid - checks scope type, and that a value is set where needed
+func isACLScopeValid(scopeType, scopeValue *string) error {
+	if scopeType == nil || !validACLScopeTypes[*scopeType] {
+		return ErrorBadACLScope
+	}
+
+	if *scopeType != scopeDefault && (scopeValue == nil || *scopeValue == "") {
+		return ErrorMissingACLScope
+	}
+	return nil
+}
+
+//isNewACLRuleValid - checks if rule contains mandatory fields
+func isNewACLRuleValid(rule global.ACLRule) error {
+	if !isValidACLRole(rule.Role) {
+		return ErrorBadACLRole
+	}
+	return isACLScopeValid(rule.ScopeType, rule.ScopeValue)
+}
+
+//aclScopeKey - key identifying the grantee of a rule
+func aclScopeKey(scope *calendar.AclRuleScope) string {
+	if scope == nil {
+		return ""
+	}
+	if scope.Type == scopeDefault {
+		return scopeDefault
+	}
+	return scope.Type + ":" + scope.Value
+}
+
+func toGoogleACLRule(rule global.ACLRule) *calendar.AclRule {
+	gRule := calendar.AclRule{}
+	if rule.Role != nil {
+		gRule.Role = *rule.Role
+	}
+
+	if rule.ScopeType != nil {
+		gRule.Scope = &calendar.AclRuleScope{Type: *rule.ScopeType}
+		if rule.ScopeValue != nil && *rule.ScopeType != scopeDefault {
+			gRule.Scope.Value = *rule.ScopeValue
+		}
+	}
+	return &gRule
+}
+
+func fromGoogleACLRule(gRule *calendar.AclRule) global.ACLRule {
+	rule := global.ACLRule{
+		ID:   &gRule.Id,
+		Role: &gRule.Role,
+	}
+	if gRule.Scope != nil {
+		rule.ScopeType = &gRule.Scope.Type
+		rule.ScopeValue = &gRule.Scope.Value
+	}
+	return rule
+}
+
+func (e *CalendarConnector) sendNotifications() bool {
+	return e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates
+}
+
+//ListACL returns all access rules of a calendar
+func (e *CalendarConnector) ListACL(calendarID string) ([]global.ACLRule, error) {
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	gRules, err := srv.ListACL(e.context, calendarOrPrimary(calendarID))
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []global.ACLRule{}
+	for _, v := range gRules {
+		rules = append(rules, fromGoogleACLRule(v))
+	}
+	return rules, nil
+}
+
+//InsertACL grants access to a calendar. Returns the id of the created rule.
+func (e *CalendarConnector) InsertACL(calendarID string, rule global.ACLRule) (
+	ruleID string,
+	err error,
+) {
+	err = isNewACLRuleValid(rule)
+	if err != nil {
+		return "", err
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return "", err
+	}
+
+	gRule, err := srv.InsertACL(e.context, calendarOrPrimary(calendarID),
+		toGoogleACLRule(rule), e.sendNotifications(),
+	)
+	if err != nil {
+		return "", err
+	}
+	return gRule.Id, nil
+}
+
+//PatchACL changes the role of an existing access rule
+//Note: the scope of a rule can not be changed, only its role.
+func (e *CalendarConnector) PatchACL(calendarID string, ruleID string, rule global.ACLRule) error {
+	if ruleID == "" {
+		return ErrorMissingRuleID
+	}
+
+	if !isValidACLRole(rule.Role) {
+		return ErrorBadACLRole
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return err
+	}
+
+	_, err = srv.PatchACL(e.context, calendarOrPrimary(calendarID), ruleID,
+		&calendar.AclRule{Role: *rule.Role}, e.sendNotifications(),
+	)
+	return err
+}
+
+//DeleteACL revokes an access rule
+func (e *CalendarConnector) DeleteACL(calendarID string, ruleID string) error {
+	if ruleID == "" {
+		return ErrorMissingRuleID
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return err
+	}
+
+	return srv.DeleteACL(e.context, calendarOrPrimary(calendarID), ruleID)
+}
+
+//SyncACL makes the calendar ACL match the desired rule set, applying only
+//the difference. Rules are matched on scope, so a changed role is patched.
+//Note: owner rules missing from the desired set are kept, to avoid locking
+//the service account out of the calendar.
+func (e *CalendarConnector) SyncACL(calendarID string, desired []global.ACLRule) (
+	result global.ACLSyncResult,
+	err error,
+) {
+	result = global.ACLSyncResult{
+		Inserted: []global.ACLRule{},
+		Updated:  []global.ACLRule{},
+		Deleted:  []global.ACLRule{},
+	}
+
+	desiredRules := map[string]*calendar.AclRule{}
+	for _, rule := range desired {
+		err = isNewACLRuleValid(rule)
+		if err != nil {
+			return result, err
+		}
+
+		gRule := toGoogleACLRule(rule)
+		key := aclScopeKey(gRule.Scope)
+		if desiredRules[key] != nil {
+			return result, ErrorDuplicateACLScope
+		}
+		desiredRules[key] = gRule
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return result, err
+	}
+
+	calendarID = calendarOrPrimary(calendarID)
+	gRules, err := srv.ListACL(e.context, calendarID)
+	if err != nil {
+		return result, err
+	}
+
+	existingRules := map[string]*calendar.AclRule{}
+	for _, v := range gRules {
+		existingRules[aclScopeKey(v.Scope)] = v
+	}
+
+	for key, existing := range existingRules {
+		if desiredRules[key] != nil || existing.Role == roleOwner {
+			continue
+		}
+
+		err = srv.DeleteACL(e.context, calendarID, existing.Id)
+		if err != nil {
+			return result, err
+		}
+		result.Deleted = append(result.Deleted, fromGoogleACLRule(existing))
+	}
+
+	for key, rule := range desiredRules {
+		existing := existingRules[key]
+		if existing == nil {
+			inserted, err := srv.InsertACL(e.context, calendarID, rule, e.sendNotifications())
+			if err != nil {
+				return result, err
+			}
+			result.Inserted = append(result.Inserted, fromGoogleACLRule(inserted))
+		} else if existing.Role != rule.Role {
+			patched, err := srv.PatchACL(e.context, calendarID, existing.Id,
+				&calendar.AclRule{Role: rule.Role}, e.sendNotifications(),
+			)
+			if err != nil {
+				return result, err
+			}
+			result.Updated = append(result.Updated, fromGoogleACLRule(patched))
+		}
+	}
+
+	return result, nil
+}
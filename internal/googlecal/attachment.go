@@ -0,0 +1,136 @@
+package googlecal
+
+import (
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/webhook"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"google.golang.org/api/calendar/v3"
+)
+
+const maxAttachments = 25
+
+//areAttachmentsValid - checks attachment count and that urls are set
+func areAttachmentsValid(attachments []global.Attachment) error {
+	if len(attachments) > maxAttachments {
+		return ErrorTooManyAttachments
+	}
+
+	for _, v := range attachments {
+		if v.FileURL == "" {
+			return ErrorMissingAttachmentURL
+		}
+	}
+	return nil
+}
+
+//copyAttachments - snapshot of the attachment list, before it or its
+//attachments are modified
+func copyAttachments(event *calendar.Event) *calendar.Event {
+	snapshot := *event
+	snapshot.Attachments = []*calendar.EventAttachment{}
+	for _, v := range event.Attachments {
+		attachment := *v
+		snapshot.Attachments = append(snapshot.Attachments, &attachment)
+	}
+	return &snapshot
+}
+
+//patchAttachments - replaces the attachment list of an event
+func (e *CalendarConnector) patchAttachments(
+	srv backend.Backend,
+	before *calendar.Event,
+	attachments []*calendar.EventAttachment,
+) error {
+	patchEvent := &calendar.Event{
+		Attachments: attachments,
+	}
+	if len(attachments) == 0 {
+		patchEvent.ForceSendFields = []string{"Attachments"}
+	}
+
+	_event, err := srv.PatchEvent(e.context, e.calendar(), before.Id, patchEvent, e.writeOptions())
+	if err == nil {
+		e.publish(webhook.EventPatched, before.Id, before, _event)
+	}
+	return err
+}
+
+//AddAttachments adds files to an existing events attachment list.
+//Attachments already on the list (same file url) have the specified
+//fields updated.
+func (e *CalendarConnector) AddAttachments(eventID string, toAdd []global.Attachment) error {
+	if eventID == "" {
+		return ErrorMissingEventID
+	}
+
+	err := areAttachmentsValid(toAdd)
+	if err != nil {
+		return err
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return err
+	}
+
+	existingEvent, err := e.GetCalendarEvent(eventID)
+	if err != nil {
+		return err
+	}
+
+	before := copyAttachments(existingEvent)
+
+	existingFiles := map[string]*calendar.EventAttachment{}
+	for _, v := range existingEvent.Attachments {
+		existingFiles[v.FileUrl] = v
+	}
+
+	attachments := existingEvent.Attachments
+	for _, v := range toAdd {
+		if existing := existingFiles[v.FileURL]; existing != nil {
+			global.MergeAttachment(existing, v)
+			continue
+		}
+
+		attachment := global.MergeAttachment(&calendar.EventAttachment{}, v)
+		attachments = append(attachments, attachment)
+		existingFiles[v.FileURL] = attachment
+	}
+
+	if len(attachments) > maxAttachments {
+		return ErrorTooManyAttachments
+	}
+
+	return e.patchAttachments(srv, before, attachments)
+}
+
+//RemoveAttachments removes files with specified urls from an event
+func (e *CalendarConnector) RemoveAttachments(eventID string, fileURLs []string) error {
+	if eventID == "" {
+		return ErrorMissingEventID
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return err
+	}
+
+	filesToIgnore := map[string]bool{}
+	for _, v := range fileURLs {
+		filesToIgnore[v] = true
+	}
+
+	existingEvent, err := e.GetCalendarEvent(eventID)
+	if err != nil {
+		return err
+	}
+
+	attachments := []*calendar.EventAttachment{}
+	for _, v := range existingEvent.Attachments {
+		if !filesToIgnore[v.FileUrl] {
+			attachments = append(attachments, v)
+		}
+	}
+
+	return e.patchAttachments(srv, existingEvent, attachments)
+}
@@ -0,0 +1,308 @@
+package googlecal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/cache"
+	"github.com/tktip/google-calendar/internal/random"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	//events read by cached connectors, nil if not caching
+	readCache cache.Cache
+
+	//time events are cached
+	cacheTTL time.Duration
+
+	//calendars read through the cache, by domain, kept in sync
+	syncedCalendars = map[DomainName]map[string]bool{}
+	syncMutex       sync.Mutex
+
+	//held while generations are made or invalidated, so an invalidation
+	//is not lost to a generation made at the same time
+	generationMutex sync.Mutex
+)
+
+//SetCache caches events read by connectors using Cached, for ttl.
+//Entries of a domain are invalidated when its events are written.
+//nil turns caching off.
+func SetCache(c cache.Cache, ttl time.Duration) {
+	readCache, cacheTTL = c, ttl
+}
+
+//ConfigureCacheFromEnv sets the cache configured by the environment, see
+//cache.FromEnv. Calendars read are synced every CACHE_SYNC_INTERVAL
+//(default 1m, 0 to not sync).
+func ConfigureCacheFromEnv() error {
+	c, ttl, err := cache.FromEnv()
+	if err != nil || c == nil {
+		return err
+	}
+
+	interval := time.Minute
+	if v := os.Getenv("CACHE_SYNC_INTERVAL"); v != "" {
+		interval, err = time.ParseDuration(v)
+		if err != nil || interval < 0 {
+			return fmt.Errorf("CACHE_SYNC_INTERVAL must be a duration, got %q", v)
+		}
+	}
+
+	SetCache(c, ttl)
+	if interval > 0 {
+		go SyncCache(context.Background(), interval)
+	}
+	return nil
+}
+
+//CacheTTL - time events are cached, 0 if not caching
+func CacheTTL() time.Duration {
+	if readCache == nil {
+		return 0
+	}
+	return cacheTTL
+}
+
+//Cached - read events through the cache, if one is set. Only for reads
+//that may be somewhat stale, not those followed by a write.
+func (e *CalendarConnector) Cached() *CalendarConnector {
+	e.cached = true
+	return e
+}
+
+//generationKey - key of the generation of a domain's entries
+func generationKey(domain DomainName) string {
+	return "generation:" + string(domain)
+}
+
+//generation - part of the keys of a domain's entries, replaced to
+//invalidate them. A new one is made if missing, i.e. evicted.
+func generation(domain DomainName) string {
+	generationMutex.Lock()
+	defer generationMutex.Unlock()
+
+	if v, ok := readCache.Get(generationKey(domain)); ok {
+		return string(v)
+	}
+
+	v := random.ID()
+	readCache.Set(generationKey(domain), []byte(v), 0)
+	return v
+}
+
+//InvalidateCache drops the cached events of domain, i.e. when notified
+//of changes by google
+func InvalidateCache(domain string) {
+	if readCache != nil {
+		generationMutex.Lock()
+		defer generationMutex.Unlock()
+		readCache.Delete(generationKey(DomainName(domain)))
+	}
+}
+
+//cachedBackend - backend reading events through the cache, if reads is
+//set, and invalidating it on event writes
+type cachedBackend struct {
+	backend.Backend
+	domain DomainName
+	reads  bool
+}
+
+//cached - reads key from the cache into v, or by read, caching it
+func (b *cachedBackend) cached(key string, v interface{}, read func() (interface{}, error)) error {
+	key = "events:" + string(b.domain) + ":" + generation(b.domain) + ":" + key
+	if data, ok := readCache.Get(key); ok && json.Unmarshal(data, v) == nil {
+		return nil
+	}
+
+	value, err := read()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	readCache.Set(key, data, cacheTTL)
+	return json.Unmarshal(data, v)
+}
+
+//synced - keep calendarID in sync with google, so it is invalidated
+//on changes not made by the service
+func (b *cachedBackend) synced(calendarID string) {
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
+
+	if syncedCalendars[b.domain] == nil {
+		syncedCalendars[b.domain] = map[string]bool{}
+	}
+	syncedCalendars[b.domain][calendarID] = true
+}
+
+func (b *cachedBackend) GetEvent(ctx context.Context, calendarID string, eventID string) (
+	*calendar.Event,
+	error,
+) {
+	if !b.reads {
+		return b.Backend.GetEvent(ctx, calendarID, eventID)
+	}
+
+	b.synced(calendarID)
+	event := calendar.Event{}
+	err := b.cached("get:"+calendarID+":"+eventID, &event, func() (interface{}, error) {
+		return b.Backend.GetEvent(ctx, calendarID, eventID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (b *cachedBackend) ListEvents(ctx context.Context, calendarID string, opts backend.ListOptions) (
+	*calendar.Events,
+	error,
+) {
+	if !b.reads || opts.SyncToken != "" {
+		return b.Backend.ListEvents(ctx, calendarID, opts)
+	}
+
+	query, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(query)
+
+	b.synced(calendarID)
+	events := calendar.Events{}
+	err = b.cached("list:"+calendarID+":"+hex.EncodeToString(sum[:]), &events, func() (interface{}, error) {
+		return b.Backend.ListEvents(ctx, calendarID, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &events, nil
+}
+
+func (b *cachedBackend) InsertEvent(
+	ctx context.Context,
+	calendarID string,
+	event *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	defer InvalidateCache(string(b.domain))
+	return b.Backend.InsertEvent(ctx, calendarID, event, opts)
+}
+
+func (b *cachedBackend) PatchEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	patch *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	defer InvalidateCache(string(b.domain))
+	return b.Backend.PatchEvent(ctx, calendarID, eventID, patch, opts)
+}
+
+func (b *cachedBackend) UpdateEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	event *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	defer InvalidateCache(string(b.domain))
+	return b.Backend.UpdateEvent(ctx, calendarID, eventID, event, opts)
+}
+
+func (b *cachedBackend) DeleteEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	opts backend.WriteOptions,
+) error {
+	defer InvalidateCache(string(b.domain))
+	return b.Backend.DeleteEvent(ctx, calendarID, eventID, opts)
+}
+
+func (b *cachedBackend) ImportEvent(ctx context.Context, calendarID string, event *calendar.Event) (
+	*calendar.Event,
+	error,
+) {
+	defer InvalidateCache(string(b.domain))
+	return b.Backend.ImportEvent(ctx, calendarID, event)
+}
+
+//SyncCache invalidates cached events changed outside the service, by
+//listing the changes of the calendars read every interval with sync
+//tokens. Runs until ctx is done.
+func SyncCache(ctx context.Context, interval time.Duration) {
+	tokens := map[DomainName]map[string]string{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		syncMutex.Lock()
+		calendars := map[DomainName][]string{}
+		for domain, ids := range syncedCalendars {
+			for id := range ids {
+				calendars[domain] = append(calendars[domain], id)
+			}
+		}
+		syncMutex.Unlock()
+
+		for domain, ids := range calendars {
+			if tokens[domain] == nil {
+				tokens[domain] = map[string]string{}
+			}
+
+			for _, id := range ids {
+				tokens[domain][id] = syncCalendar(ctx, domain, id, tokens[domain][id])
+			}
+		}
+	}
+}
+
+//syncCalendar - invalidates the domain if calendarID changed since token,
+//or on the first sync, as changes since the events were cached are not
+//known. Returns the token to sync from next.
+func syncCalendar(ctx context.Context, domain DomainName, calendarID string, token string) string {
+	srv, err := NewCalendarConnector(ctx, string(domain)).getBackend()
+	if err != nil {
+		logrus.Warnf("Could not sync calendar %s of %s: %v", calendarID, domain, err)
+		return token
+	}
+
+	changes, err := srv.ListEvents(ctx, calendarID, backend.ListOptions{SyncToken: token, ShowDeleted: true})
+	if apiErr, ok := err.(*googleapi.Error); ok && apiErr.Code == http.StatusGone {
+		InvalidateCache(string(domain)) //token expired, changes unknown
+		return ""
+	} else if err != nil {
+		logrus.Warnf("Could not sync calendar %s of %s: %v", calendarID, domain, err)
+		return token
+	}
+
+	if token == "" || len(changes.Items) > 0 {
+		InvalidateCache(string(domain))
+	}
+	return changes.NextSyncToken
+}
@@ -0,0 +1,137 @@
+package googlecal
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/cache"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+)
+
+//counting - backend counting event reads
+type counting struct {
+	backend.Backend
+	gets, lists int
+}
+
+func (b *counting) GetEvent(ctx context.Context, calendarID string, eventID string) (*calendar.Event, error) {
+	b.gets++
+	return b.Backend.GetEvent(ctx, calendarID, eventID)
+}
+
+func (b *counting) ListEvents(ctx context.Context, calendarID string, opts backend.ListOptions) (
+	*calendar.Events,
+	error,
+) {
+	if opts.SyncToken == "" {
+		b.lists++
+	}
+	return b.Backend.ListEvents(ctx, calendarID, opts)
+}
+
+func TestCache(t *testing.T) {
+	memory := backend.NewMemory("calendar@example.com")
+	counter := &counting{Backend: memory}
+	UseBackend("cached", counter)
+	defer UseBackend("cached", nil)
+
+	SetCache(cache.NewLRU(100), 0)
+	defer SetCache(nil, 0)
+
+	ctx := context.Background()
+	connector := func() *CalendarConnector {
+		return NewCalendarConnector(ctx, "cached").Cached()
+	}
+
+	start := "2020-01-06T09:00:00+01:00"
+	_, err := memory.InsertEvent(ctx, "primary", &calendar.Event{
+		Id:      "abcdef",
+		Summary: "Meeting",
+		Start:   &calendar.EventDateTime{DateTime: start},
+		End:     &calendar.EventDateTime{DateTime: "2020-01-06T10:00:00+01:00"},
+	}, backend.WriteOptions{})
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		event, err := connector().GetCalendarEvent("abcdef")
+		if err != nil || event.Summary != "Meeting" {
+			t.Fatalf("get failed: %v %v", event, err)
+		}
+
+		_, err = connector().GetEvents("", "", false, EventListFilter{})
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+	}
+
+	if counter.gets != 1 || counter.lists != 1 {
+		t.Errorf("expected one read each, got %d gets and %d lists", counter.gets, counter.lists)
+	}
+
+	//uncached connectors read from the backend, and writes invalidate
+	_, err = NewCalendarConnector(ctx, "cached").PatchEvent(global.Event{ID: str("abcdef"), Location: str("Room 1")})
+	if err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	event, _ := connector().GetCalendarEvent("abcdef")
+	if event.Location != "Room 1" || counter.gets != 2 {
+		t.Errorf("expected patched event read again, got %v after %d gets", event.Location, counter.gets)
+	}
+
+	//changes made outside the service are found by syncing
+	token := syncCalendar(ctx, "cached", "primary", "")
+	connector().GetCalendarEvent("abcdef")
+	gets := counter.gets
+
+	memory.PatchEvent(ctx, "primary", "abcdef", &calendar.Event{Location: "Room 2"}, backend.WriteOptions{})
+	if token = syncCalendar(ctx, "cached", "primary", token); token == "" {
+		t.Errorf("expected next sync token")
+	}
+
+	event, _ = connector().GetCalendarEvent("abcdef")
+	if event.Location != "Room 2" || counter.gets != gets+1 {
+		t.Errorf("expected event changed outside read again, got %v", event.Location)
+	}
+
+	syncCalendar(ctx, "cached", "primary", token)
+	connector().GetCalendarEvent("abcdef")
+	if counter.gets != gets+1 {
+		t.Errorf("expected unchanged calendar to stay cached, got %d gets", counter.gets)
+	}
+}
+
+//TestGenerationInvalidated checks concurrent reads and invalidations,
+//run with -race
+func TestGenerationInvalidated(t *testing.T) {
+	SetCache(cache.NewLRU(100), 0)
+	defer SetCache(nil, 0)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				generation("cached")
+				InvalidateCache("cached")
+			}
+		}()
+	}
+	wg.Wait()
+
+	current := generation("cached")
+	if generation("cached") != current {
+		t.Errorf("expected generation kept until invalidated")
+	}
+
+	InvalidateCache("cached")
+	if generation("cached") == current {
+		t.Errorf("expected new generation after invalidation")
+	}
+}
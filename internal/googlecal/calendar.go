@@ -0,0 +1,145 @@
+package googlecal
+
+import (
+	"fmt"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"google.golang.org/api/calendar/v3"
+)
+
+//InCalendar - which calendar events are in. Defaults to primary.
+func (e *CalendarConnector) InCalendar(calendarID string) *CalendarConnector {
+	e.calendarID = calendarID
+	return e
+}
+
+//calendar - id of the calendar events are in
+func (e *CalendarConnector) calendar() string {
+	return calendarOrPrimary(e.calendarID)
+}
+
+//ListCalendars returns the calendars in the calendar list of the domain
+func (e *CalendarConnector) ListCalendars() ([]*calendar.CalendarListEntry, error) {
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	return srv.ListCalendars(e.context)
+}
+
+//GetCalendarEntry returns the calendar list entry of the calendar
+func (e *CalendarConnector) GetCalendarEntry() (*calendar.CalendarListEntry, error) {
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+	return srv.GetCalendar(e.context, e.calendar())
+}
+
+//findByUID - the event with iCalendar uid, and its modified instances
+func (e *CalendarConnector) findByUID(srv backend.Backend, uid string, showDeleted bool) (
+	[]*calendar.Event,
+	error,
+) {
+	events, err := srv.ListEvents(e.context, e.calendar(), backend.ListOptions{
+		ICalUID:     uid,
+		ShowDeleted: showDeleted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events.Items, nil
+}
+
+//FindEventsByUID returns the event with iCalendar uid, followed by its
+//modified instances. Returns ErrorEventNotFound if there is none.
+func (e *CalendarConnector) FindEventsByUID(uid string, showDeleted bool) (
+	[]*calendar.Event,
+	error,
+) {
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := e.findByUID(srv, uid, showDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) == 0 {
+		return nil, ErrorEventNotFound
+	}
+
+	//recurring event first, as iCalendar expects
+	for i, v := range events {
+		if v.RecurringEventId == "" {
+			events[0], events[i] = events[i], events[0]
+			break
+		}
+	}
+	return events, nil
+}
+
+//ListEvents returns events between min and max (both optional), without
+//expanding recurring events, so each event is returned once. Modified
+//instances of recurring events are returned as separate events.
+func (e *CalendarConnector) ListEvents(min string, max string, showDeleted bool) (
+	[]*calendar.Event,
+	error,
+) {
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := srv.ListEvents(e.context, e.calendar(), backend.ListOptions{
+		TimeMin:     min,
+		TimeMax:     max,
+		ShowDeleted: showDeleted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events.Items, nil
+}
+
+//StoreEvents upserts events keyed by iCalendar uid, i.e. the VEVENTs of
+//a single iCalendar object.
+func (e *CalendarConnector) StoreEvents(events []*calendar.Event) error {
+	srv, err := e.getBackend()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range events {
+		result := e.importEvent(srv, v, false)
+		if result.Action == ImportError {
+			return fmt.Errorf("could not store event %s: %s", v.ICalUID, result.Error)
+		}
+	}
+	return nil
+}
+
+//DeleteEventsByUID deletes the event with iCalendar uid. Deleting a
+//recurring event also deletes its instances.
+func (e *CalendarConnector) DeleteEventsByUID(uid string) error {
+	events, err := e.FindEventsByUID(uid, false)
+	if err != nil {
+		return err
+	}
+
+	if events[0].RecurringEventId == "" {
+		return e.DeleteEvent(events[0].Id)
+	}
+
+	//only modified instances, i.e. of an event we were invited to
+	for _, v := range events {
+		err = e.DeleteEvent(v.Id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
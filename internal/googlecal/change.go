@@ -0,0 +1,47 @@
+package googlecal
+
+import (
+	"github.com/tktip/google-calendar/internal/webhook"
+	"google.golang.org/api/calendar/v3"
+)
+
+//Change - a change of an event made by the connector
+type Change struct {
+	Type       webhook.EventType
+	CalendarID string
+	EventID    string
+	Before     *calendar.Event //nil on create
+	After      *calendar.Event //nil on delete
+}
+
+//RecordChanges - calls record with every change of an event made,
+//i.e. for auditing
+func (e *CalendarConnector) RecordChanges(record func(change Change)) *CalendarConnector {
+	e.recordChange = record
+	return e
+}
+
+//publish - notifies webhook subscribers and the change recorder of a
+//change. before is nil on create, after is nil on delete.
+func (e *CalendarConnector) publish(
+	t webhook.EventType,
+	eventID string,
+	before *calendar.Event,
+	after *calendar.Event,
+) {
+	if e.preview != nil {
+		return
+	}
+
+	if e.recordChange != nil {
+		e.recordChange(Change{
+			Type:       t,
+			CalendarID: e.calendar(),
+			EventID:    eventID,
+			Before:     before,
+			After:      after,
+		})
+	}
+
+	e.dispatcher().Publish(string(e.domain), t, e.calendar(), eventID, before, after)
+}
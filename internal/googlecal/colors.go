@@ -0,0 +1,52 @@
+package googlecal
+
+import (
+	"sync"
+
+	"github.com/tktip/google-calendar/internal/backend"
+)
+
+var (
+	//event color ids are the same for all calendars, so fetched only once
+	eventColors     map[string]bool
+	eventColorsLock sync.Mutex
+)
+
+//getEventColors - returns valid event color ids, fetching them if needed
+func (e *CalendarConnector) getEventColors(srv backend.Backend) (map[string]bool, error) {
+	eventColorsLock.Lock()
+	defer eventColorsLock.Unlock()
+
+	if eventColors != nil {
+		return eventColors, nil
+	}
+
+	colors, err := srv.GetColors(e.context)
+	if err != nil {
+		return nil, err
+	}
+
+	eventColors = map[string]bool{}
+	for id := range colors.Event {
+		eventColors[id] = true
+	}
+	return eventColors, nil
+}
+
+//isColorValid - checks color id against colors of Google calendar.
+//Empty id is valid, as it resets the event to the calendar color.
+func (e *CalendarConnector) isColorValid(srv backend.Backend, colorID *string) error {
+	if colorID == nil || *colorID == "" {
+		return nil
+	}
+
+	colors, err := e.getEventColors(srv)
+	if err != nil {
+		return err
+	}
+
+	if !colors[*colorID] {
+		return ErrorBadColor
+	}
+	return nil
+}
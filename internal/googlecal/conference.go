@@ -0,0 +1,88 @@
+package googlecal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/tktip/google-calendar/internal/random"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"google.golang.org/api/calendar/v3"
+)
+
+const defaultConferenceType = "hangoutsMeet"
+
+var validConferenceTypes = map[string]bool{
+	"eventHangout":         true,
+	"eventNamedHangout":    true,
+	defaultConferenceType: true,
+	"addOn":                true,
+}
+
+//isConferenceValid - checks conference solution type
+func isConferenceValid(conference *global.Conference) error {
+	if conference == nil || conference.Type == nil {
+		return nil
+	}
+
+	if !validConferenceTypes[*conference.Type] {
+		return ErrorBadConferenceType
+	}
+	return nil
+}
+
+//wantsConference - whether event requests a new conference
+func wantsConference(event global.Event) bool {
+	return event.Conference != nil && event.Conference.Create
+}
+
+//Idempotent - derives the request ids of conferences from id, i.e. of the
+//job or command making the writes, so google ignores a conference
+//requested again by a retry of it
+func (e *CalendarConnector) Idempotent(id string) *CalendarConnector {
+	e.requestID = id
+	return e
+}
+
+//conferenceRequestID - id of a conference requested for the event with
+//eventID, random unless the connector is idempotent
+func (e *CalendarConnector) conferenceRequestID(eventID string) string {
+	if e.requestID == "" {
+		return random.ID()
+	}
+
+	sum := sha256.Sum256([]byte(e.requestID + "/" + eventID))
+	return hex.EncodeToString(sum[:16])
+}
+
+func toGoogleConferenceData(
+	conference global.Conference,
+	requestID string,
+) *calendar.ConferenceData {
+	conferenceType := defaultConferenceType
+	if conference.Type != nil {
+		conferenceType = *conference.Type
+	}
+
+	return &calendar.ConferenceData{
+		CreateRequest: &calendar.CreateConferenceRequest{
+			RequestId: requestID, //so google can deduplicate create requests
+			ConferenceSolutionKey: &calendar.ConferenceSolutionKey{
+				Type: conferenceType,
+			},
+		},
+	}
+}
+
+//GetConference returns the conference of an event. Used to poll the status
+//of a pending conference creation. Returns nil if event has no conference.
+func (e *CalendarConnector) GetConference(eventID string) (*global.ConferenceInfo, error) {
+	if eventID == "" {
+		return nil, ErrorMissingEventID
+	}
+
+	event, err := e.GetCalendarEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	return global.FromGoogleConference(event.ConferenceData), nil
+}
@@ -51,11 +51,11 @@ func (c *CalendarConfig) UnmarshalJSON(b []byte) (err error) {
 		}
 
 		config, err := google.JWTConfigFromJSON(data, scopes...)
-		config.Subject = "REPLACEME"
 		if err != nil {
 			c = nil
 			return err
 		}
+		config.Subject = "REPLACEME"
 		(*c)[DomainName(account)] = config
 
 	}
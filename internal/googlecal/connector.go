@@ -5,36 +5,102 @@ package googlecal
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
 	"regexp"
+	"strings"
 
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/imip"
+	"github.com/tktip/google-calendar/internal/webhook"
 	global "github.com/tktip/google-calendar/pkg/googlecal"
 	"golang.org/x/net/context"
 	"google.golang.org/api/calendar/v3"
-	"google.golang.org/api/option"
 )
 
 var (
 	configs CalendarConfig
+
+	//backends of domains not served by google, i.e. in memory
+	backends = map[DomainName]backend.Backend{}
+
+	//base url of the calendar api, google's if empty
+	endpoint string
+
+	//client of calendar api requests, instead of one using the credentials
+	httpClient *http.Client
 )
 
-func init() {
+//ConfigureFromEnv reads the domain configs from the file in CREDENTIALS.
+//Domains in MEMORY_DOMAINS (comma separated) are served from memory, for
+//local development, and need no credentials. CALENDAR_ENDPOINT replaces
+//the base url of the calendar api, i.e. to use an emulator.
+func ConfigureFromEnv() error {
+	SetEndpoint(os.Getenv("CALENDAR_ENDPOINT"))
+
+	for _, domain := range strings.Split(os.Getenv("MEMORY_DOMAINS"), ",") {
+		domain = strings.TrimSpace(domain)
+		if domain != "" {
+			UseBackend(domain, backend.NewMemory("calendar@"+domain))
+		}
+	}
+
+	if os.Getenv("CREDENTIALS") == "" && len(backends) > 0 {
+		return nil
+	}
+
 	b, err := ioutil.ReadFile(os.Getenv("CREDENTIALS"))
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		return fmt.Errorf("unable to read client secret file: %v", err)
 	}
 
-	configs, err = ParseConfig(b)
+	config, err := ParseConfig(b)
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file as config: %v", err)
+		return fmt.Errorf("unable to parse client secret file as config: %v", err)
 	}
+
+	Configure(config)
+	return nil
+}
+
+//Configure sets the domains served by google, and their credentials
+func Configure(config CalendarConfig) {
+	configs = config
+	resetServices()
+}
+
+//SetHTTPClient sets the client of calendar api requests, which then do
+//not authenticate with the credentials of the domain. Used in tests.
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+	resetServices()
+}
+
+//SetEndpoint sets the base url of the calendar api, i.e.
+//http://localhost:8085/calendar/v3/. Empty uses google.
+func SetEndpoint(url string) {
+	if url != "" && !strings.HasSuffix(url, "/") {
+		url += "/" //paths are resolved relative to it
+	}
+	endpoint = url
+	resetServices()
+}
+
+//UseBackend serves domain from b instead of google
+func UseBackend(domain string, b backend.Backend) {
+	backends[DomainName(domain)] = b
+}
+
+//KnownDomain - whether domain has credentials or a backend
+func KnownDomain(domain string) bool {
+	return configs[DomainName(domain)] != nil || backends[DomainName(domain)] != nil
 }
 
 //CalendarConnector - base struct of dsl.
 type CalendarConnector struct {
-	domain  DomainName
-	context context.Context
+	domain     DomainName
+	context    context.Context
+	calendarID string //primary if empty
 
 	//Use pointers to allow patch semantics
 	guestsCanModify          *bool
@@ -43,6 +109,24 @@ type CalendarConnector struct {
 	guestsCanSeeGuests       *bool
 	privateEvent             *bool
 	informGuestsAboutUpdates *bool
+
+	//sends iTIP invitations when set
+	inviter *imip.Inviter
+
+	//publishes changes to webhook subscribers, the one of UseWebhooks if nil
+	webhooks *webhook.Dispatcher
+
+	//called with every change of an event when set
+	recordChange func(change Change)
+
+	//writes are recorded here instead of made, when set
+	preview *Preview
+
+	//reads events through the cache, if one is set
+	cached bool
+
+	//conference request ids are derived from it, random if empty
+	requestID string
 }
 
 //NewCalendarConnector - create calendar connector
@@ -54,22 +138,34 @@ func NewCalendarConnector(ctx context.Context, domain string) *CalendarConnector
 	return &eC
 }
 
-func (e *CalendarConnector) getCalendarService() (*calendar.Service, error) {
-	config := configs[e.domain]
-	if config == nil {
-		return nil, ErrorUnknownDomain
+//getBackend - backend of the domain, google unless another is in use
+func (e *CalendarConnector) getBackend() (backend.Backend, error) {
+	b := backends[e.domain]
+	if b == nil {
+		srv, err := e.getCalendarService()
+		if err != nil {
+			return nil, err
+		}
+		b = backend.NewGoogle(srv)
+	}
+
+	if readCache != nil {
+		b = &cachedBackend{Backend: b, domain: e.domain, reads: e.cached}
 	}
 
-	if e.context == nil {
-		panic("no context provided")
+	if e.preview != nil {
+		return &dryRun{Backend: b, preview: e.preview}, nil
 	}
+	return b, nil
+}
 
-	srv, err := calendar.NewService(e.context,
-		option.WithTokenSource(
-			config.TokenSource(e.context),
-		),
-	)
-	return srv, err
+//writeOptions - options of event writes, from the dsl
+func (e *CalendarConnector) writeOptions() backend.WriteOptions {
+	opts := backend.WriteOptions{SupportsAttachments: true}
+	if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
+		opts.SendUpdates = backend.SendUpdatesAll
+	}
+	return opts
 }
 
 //GuestsCanModify - whether guests can alter event
@@ -130,6 +226,127 @@ func isNewEventValid(event global.Event) error {
 	return nil
 }
 
+const (
+	maxReminderOverrides = 5
+	maxReminderMinutes   = 40320 //4 weeks
+)
+
+//isRemindersValid - checks reminders against Google's limits
+func isRemindersValid(reminders *global.Reminders) error {
+	if reminders == nil || reminders.Overrides == nil {
+		return nil
+	}
+
+	overrides := *reminders.Overrides
+	if len(overrides) > maxReminderOverrides {
+		return ErrorTooManyReminders
+	}
+
+	if len(overrides) > 0 && reminders.UseDefault != nil && *reminders.UseDefault {
+		return ErrorConflictReminders
+	}
+
+	for _, v := range overrides {
+		if v.Method != "email" && v.Method != "popup" {
+			return ErrorBadReminderMethod
+		}
+
+		if v.Minutes < 0 || v.Minutes > maxReminderMinutes {
+			return ErrorBadReminderMinutes
+		}
+	}
+	return nil
+}
+
+var validResponseStatuses = map[string]bool{
+	"needsAction": true,
+	"declined":    true,
+	"tentative":   true,
+	"accepted":    true,
+}
+
+//areParticipantsValid - checks that participants have email and valid status
+func areParticipantsValid(participants []global.Participant) error {
+	for _, v := range participants {
+		if v.Email == "" {
+			return ErrorMissingParticipantEmail
+		}
+
+		if v.ResponseStatus != nil && !validResponseStatuses[*v.ResponseStatus] {
+			return ErrorBadResponseStatus
+		}
+	}
+	return nil
+}
+
+var (
+	validTransparencies = map[string]bool{"opaque": true, "transparent": true}
+	validStatuses       = map[string]bool{
+		"confirmed": true,
+		"tentative": true,
+		"cancelled": true,
+	}
+	validVisibilities = map[string]bool{
+		"default":      true,
+		"public":       true,
+		"private":      true,
+		"confidential": true,
+	}
+)
+
+//isEnumValid - nil values are valid, as they are not changed
+func isEnumValid(value *string, valid map[string]bool) bool {
+	return value == nil || valid[*value]
+}
+
+//areEventFieldsValid - checks optional fields, used by create, update & patch
+func areEventFieldsValid(event global.Event) error {
+	if !isEnumValid(event.Transparency, validTransparencies) {
+		return ErrorBadTransparency
+	}
+
+	if !isEnumValid(event.Status, validStatuses) {
+		return ErrorBadStatus
+	}
+
+	if !isEnumValid(event.Visibility, validVisibilities) {
+		return ErrorBadVisibility
+	}
+
+	if event.Participants != nil {
+		err := areParticipantsValid(*event.Participants)
+		if err != nil {
+			return err
+		}
+	}
+
+	if event.Attachments != nil {
+		err := areAttachmentsValid(*event.Attachments)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := isConferenceValid(event.Conference)
+	if err != nil {
+		return err
+	}
+
+	err = areExtendedPropertiesValid(event.ExtendedProperties)
+	if err != nil {
+		return err
+	}
+	return isRemindersValid(event.Reminders)
+}
+
+//defaultResponseStatus - status of participants not specifying one
+func (e *CalendarConnector) defaultResponseStatus() string {
+	if e.autoAccept != nil && *e.autoAccept {
+		return "accepted"
+	}
+	return "needsAction"
+}
+
 //common functionality for event create, update & patch
 func (e *CalendarConnector) copyGoogleEventUpdate(event global.Event, update *calendar.Event) {
 	if update == nil {
@@ -156,68 +373,56 @@ func (e *CalendarConnector) copyGoogleEventUpdate(event global.Event, update *ca
 		update.GuestsCanSeeOtherGuests = e.guestsCanSeeGuests
 	}
 
-	if event.Title != nil && *event.Title != "" {
-		update.Summary = *event.Title
-	}
-
-	if event.Location != nil {
-		update.Location = *event.Location
-	}
-
-	if event.Description != nil {
-		update.Description = *event.Description
-	}
-
-	if event.Start != nil {
-		update.Start = &calendar.EventDateTime{
-			DateTime: *event.Start,
-			TimeZone: "Europe/Oslo",
-		}
-	}
+	//fields of the event, its visibility being more specific than privateEvent
+	global.ToGoogle(event, update)
 
-	if event.End != nil {
-		update.End = &calendar.EventDateTime{
-			DateTime: *event.End,
-			TimeZone: "Europe/Oslo",
-		}
-	}
-
-	respStatus := "needsAction"
-	if e.autoAccept != nil && *e.autoAccept {
-		respStatus = "accepted"
-	}
-	fmt.Println("RespStatus: " + respStatus)
 	if event.Participants != nil {
-		participants := []*calendar.EventAttendee{}
-		for _, participant := range *event.Participants {
-			participants = append(participants, &calendar.EventAttendee{
-				Email:          participant,
-				ResponseStatus: respStatus,
-			})
+		for _, v := range update.Attendees {
+			if v.ResponseStatus == "" {
+				v.ResponseStatus = e.defaultResponseStatus()
+			}
 		}
-		update.Attendees = participants
 	}
 
-	if event.Organizer != nil {
-		update.Organizer = event.Organizer
+	if wantsConference(event) {
+		eventID := ""
+		if event.ID != nil {
+			eventID = *event.ID
+		}
+		update.ConferenceData = toGoogleConferenceData(*event.Conference, e.conferenceRequestID(eventID))
 	}
 }
 
 //CreateEvent creates and uploads an event in Google Calendar
-//based on contents of a global.Event struct
-func (e *CalendarConnector) CreateEvent(event global.Event) (eventID string, err error) {
+//based on contents of a global.Event struct.
+//Returns conference details if a conference was requested.
+func (e *CalendarConnector) CreateEvent(event global.Event) (
+	eventID string,
+	conference *global.ConferenceInfo,
+	err error,
+) {
 	err = isNewEventValid(event)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	if event.ID != nil && !isValidEventID(*event.ID) {
-		return "", ErrorBadID
+		return "", nil, ErrorBadID
+	}
+
+	err = areEventFieldsValid(event)
+	if err != nil {
+		return "", nil, err
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return "", nil, err
 	}
 
-	srv, err := e.getCalendarService()
+	err = e.isColorValid(srv, event.ColorID)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	gEvent := calendar.Event{}
@@ -227,16 +432,19 @@ func (e *CalendarConnector) CreateEvent(event global.Event) (eventID string, err
 
 	e.copyGoogleEventUpdate(event, &gEvent)
 
-	insert := srv.Events.Insert("primary", &gEvent)
-	if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-		insert = insert.SendUpdates("all")
+	opts := e.writeOptions()
+	if wantsConference(event) {
+		opts.ConferenceDataVersion = 1
 	}
 
-	_event, err := insert.Do()
+	_event, err := srv.InsertEvent(e.context, e.calendar(), &gEvent, opts)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return _event.Id, nil
+
+	e.inviteAttendees(nil, _event)
+	e.publish(webhook.EventCreated, _event.Id, nil, _event)
+	return _event.Id, global.FromGoogleConference(_event.ConferenceData), nil
 }
 
 //DeleteEvent deletes event with ID
@@ -244,75 +452,136 @@ func (e *CalendarConnector) DeleteEvent(eventID string) error {
 	if eventID == "" {
 		return ErrorMissingEventID
 	}
-	config := configs[e.domain]
-	if config == nil {
-		return ErrorUnknownDomain
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return err
 	}
 
-	srv, err := e.getCalendarService()
+	before, err := e.eventBeforeChange(eventID, webhook.EventDeleted)
 	if err != nil {
 		return err
 	}
 
-	delete := srv.Events.Delete("primary", eventID)
-	if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-		delete = delete.SendUpdates("all")
+	err = srv.DeleteEvent(e.context, e.calendar(), eventID, e.writeOptions())
+	if err != nil {
+		return err
 	}
 
-	return delete.Do()
+	if before != nil {
+		e.inviteAttendees(before, nil)
+	}
+	e.publish(webhook.EventDeleted, eventID, before, nil)
+	return nil
 }
 
 //PatchEvent updates an existing event using patch semantics
 //Note: Will not replace entire event, just specified fields.
-func (e *CalendarConnector) PatchEvent(event global.Event) error {
+//Returns conference details if a conference was requested.
+func (e *CalendarConnector) PatchEvent(event global.Event) (*global.ConferenceInfo, error) {
 	if event.ID == nil || *event.ID == "" {
-		return ErrorMissingEventID
+		return nil, ErrorMissingEventID
 	}
 
-	srv, err := e.getCalendarService()
+	err := areEventFieldsValid(event)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.isColorValid(srv, event.ColorID)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := e.eventBeforeChange(*event.ID, webhook.EventPatched)
+	if err != nil {
+		return nil, err
 	}
 
 	gEvent := calendar.Event{}
 	e.copyGoogleEventUpdate(event, &gEvent)
 
-	patch := srv.Events.Patch("primary", *event.ID, &gEvent)
-	if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-		patch = patch.SendUpdates("all")
+	opts := e.writeOptions()
+	if wantsConference(event) {
+		opts.ConferenceDataVersion = 1
 	}
 
-	_, err = patch.Do()
-	return err
+	_event, err := srv.PatchEvent(e.context, e.calendar(), *event.ID, &gEvent, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if before != nil {
+		e.inviteAttendees(before, _event)
+	}
+	e.publish(webhook.EventPatched, _event.Id, before, _event)
+
+	if !wantsConference(event) {
+		return nil, nil
+	}
+	return global.FromGoogleConference(_event.ConferenceData), nil
 }
 
 //UpdateEvent updates an existing event (overwrite)
 //Note: Will overwrite any existing fields, as entire event object is replaced.
-func (e *CalendarConnector) UpdateEvent(event global.Event) error {
+//Returns conference details if a conference was requested.
+func (e *CalendarConnector) UpdateEvent(event global.Event) (*global.ConferenceInfo, error) {
 	if event.ID == nil || *event.ID == "" {
-		return ErrorMissingEventID
+		return nil, ErrorMissingEventID
 	}
 
 	err := isNewEventValid(event)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	srv, err := e.getCalendarService()
+	err = areEventFieldsValid(event)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.isColorValid(srv, event.ColorID)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := e.eventBeforeChange(*event.ID, webhook.EventUpdated)
+	if err != nil {
+		return nil, err
 	}
 
 	gEvent := calendar.Event{}
 	e.copyGoogleEventUpdate(event, &gEvent)
 
-	update := srv.Events.Update("primary", *event.ID, &gEvent)
-	if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-		update = update.SendUpdates("all")
+	opts := e.writeOptions()
+	if wantsConference(event) {
+		opts.ConferenceDataVersion = 1
 	}
 
-	_, err = update.Do()
-	return err
+	_event, err := srv.UpdateEvent(e.context, e.calendar(), *event.ID, &gEvent, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if before != nil {
+		e.inviteAttendees(before, _event)
+	}
+	e.publish(webhook.EventUpdated, _event.Id, before, _event)
+
+	if !wantsConference(event) {
+		return nil, nil
+	}
+	return global.FromGoogleConference(_event.ConferenceData), nil
 }
 
 //RemoveParticipants removes specified participants from an event
@@ -321,7 +590,7 @@ func (e *CalendarConnector) RemoveParticipants(eventID string, toRemove []string
 		return ErrorMissingEventID
 	}
 
-	srv, err := e.getCalendarService()
+	srv, err := e.getBackend()
 	if err != nil {
 		return err
 	}
@@ -336,6 +605,8 @@ func (e *CalendarConnector) RemoveParticipants(eventID string, toRemove []string
 		return err
 	}
 
+	before := copyAttendees(existingEvent)
+
 	participants := []*calendar.EventAttendee{}
 	for _, v := range existingEvent.Attendees {
 		if !emailsToIgnore[v.Email] {
@@ -346,30 +617,38 @@ func (e *CalendarConnector) RemoveParticipants(eventID string, toRemove []string
 	patchEvent := calendar.Event{
 		Attendees: participants,
 	}
+
+	var _event *calendar.Event
 	if len(participants) == 0 { //overwrite on empty, to delete participant list
 		existingEvent.Attendees = participants
-		update := srv.Events.Update("primary", eventID, existingEvent)
-		if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-			update = update.SendUpdates("all")
-		}
-		_, err = update.Do()
+		_event, err = srv.UpdateEvent(e.context, e.calendar(), eventID, existingEvent,
+			e.writeOptions())
 	} else {
-		patch := srv.Events.Patch("primary", eventID, &patchEvent)
-		if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-			patch = patch.SendUpdates("all")
-		}
-		_, err = patch.Do()
+		_event, err = srv.PatchEvent(e.context, e.calendar(), eventID, &patchEvent,
+			e.writeOptions())
+	}
+
+	if err == nil {
+		e.inviteAttendees(before, _event)
+		e.publish(webhook.EventParticipantsRemoved, eventID, before, _event)
 	}
 	return err
 }
 
-//AddParticipants adds users to an existing events participant list
-func (e *CalendarConnector) AddParticipants(eventID string, toAdd []string) error {
+//AddParticipants adds users to an existing events participant list.
+//Participants already on the list have the specified fields updated,
+//while their other attendee metadata is kept.
+func (e *CalendarConnector) AddParticipants(eventID string, toAdd []global.Participant) error {
 	if eventID == "" {
 		return ErrorMissingEventID
 	}
 
-	srv, err := e.getCalendarService()
+	err := areParticipantsValid(toAdd)
+	if err != nil {
+		return err
+	}
+
+	srv, err := e.getBackend()
 	if err != nil {
 		return err
 	}
@@ -379,72 +658,81 @@ func (e *CalendarConnector) AddParticipants(eventID string, toAdd []string) erro
 		return err
 	}
 
-	existingUsersMap := map[string]bool{}
+	before := copyAttendees(existingEvent)
+
+	existingUsersMap := map[string]*calendar.EventAttendee{}
 	for _, v := range existingEvent.Attendees {
-		existingUsersMap[v.Email] = true
+		existingUsersMap[v.Email] = v
 	}
 
 	for _, user := range toAdd {
-		if !existingUsersMap[user] {
-			existingEvent.Attendees = append(
-				existingEvent.Attendees,
-				&calendar.EventAttendee{Email: user},
-			)
+		if existing := existingUsersMap[user.Email]; existing != nil {
+			global.MergeAttendee(existing, user)
+			continue
 		}
+
+		attendee := global.MergeAttendee(&calendar.EventAttendee{
+			ResponseStatus: e.defaultResponseStatus(),
+		}, user)
+		existingEvent.Attendees = append(existingEvent.Attendees, attendee)
+		existingUsersMap[user.Email] = attendee
 	}
 
 	patchEvent := &calendar.Event{
 		Attendees: existingEvent.Attendees,
 	}
 
-	patch := srv.Events.Patch("primary", eventID, patchEvent)
-	if e.informGuestsAboutUpdates != nil && *e.informGuestsAboutUpdates {
-		patch = patch.SendUpdates("all")
+	_event, err := srv.PatchEvent(e.context, e.calendar(), eventID, patchEvent, e.writeOptions())
+	if err == nil {
+		e.inviteAttendees(before, _event)
+		e.publish(webhook.EventParticipantsAdded, eventID, before, _event)
 	}
-
-	_, err = patch.Do()
 	return err
 }
 
 //GetCalendarEvent returns event by id. Returns calendar.Event type event.
 func (e *CalendarConnector) GetCalendarEvent(ID string) (*calendar.Event, error) {
-	config := configs[e.domain]
-	if config == nil {
-		return nil, ErrorUnknownDomain
-	}
-	srv, err := e.getCalendarService()
+	srv, err := e.getBackend()
 	if err != nil {
 		return nil, err
 	}
-
-	get := srv.Events.Get("primary", ID)
-	return get.Do()
+	return srv.GetEvent(e.context, e.calendar(), ID)
 }
 
-//GetEvents returns event by id. Returns calendar.Event type event.
-func (e *CalendarConnector) GetEvents(min string, max string, showDeleted bool) (
+//GetEvents returns events between min and max, matching filter.
+//Recurring events are expanded into their instances.
+func (e *CalendarConnector) GetEvents(
+	min string,
+	max string,
+	showDeleted bool,
+	filter EventListFilter,
+) (
 	*calendar.Events,
 	error,
 ) {
-	config := configs[e.domain]
-	if config == nil {
-		return nil, ErrorUnknownDomain
-	}
-	srv, err := e.getCalendarService()
+	err := filter.isValid()
 	if err != nil {
 		return nil, err
 	}
 
-	list := srv.Events.List("primary")
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
 
-	list.SingleEvents(true)
-	list.ShowDeleted(showDeleted)
-	if min != "" {
-		list.TimeMin(min)
+	opts := backend.ListOptions{
+		TimeMin:      min,
+		TimeMax:      max,
+		ShowDeleted:  showDeleted,
+		SingleEvents: true,
 	}
+	filter.apply(&opts)
 
-	if max != "" {
-		list.TimeMax(max)
+	events, err := srv.ListEvents(e.context, e.calendar(), opts)
+	if err != nil {
+		return nil, err
 	}
-	return list.Do()
+
+	filter.filterAttendees(events)
+	return events, nil
 }
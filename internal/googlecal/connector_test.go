@@ -0,0 +1,274 @@
+package googlecal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+func boolean(b bool) *bool {
+	return &b
+}
+
+//canonicalJSON - json with keys sorted, for comparison
+func canonicalJSON(t *testing.T, b []byte) string {
+	var v interface{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		t.Fatalf("bad json %s: %v", b, err)
+	}
+
+	b, _ = json.Marshal(v)
+	return string(b)
+}
+
+func TestIsValidEventID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"abcde", true},
+		{"0123456789", true},
+		{"abcd", false},
+		{"", false},
+		{strings.Repeat("a", 1024), true},
+		{strings.Repeat("a", 1025), false},
+		{"ABCDE", false},
+		{"abc-de", false},
+		{"abc_de", false},
+		{"abcdé", false},
+	}
+
+	for _, test := range tests {
+		if got := isValidEventID(test.id); got != test.valid {
+			t.Errorf("isValidEventID(%q) = %v, want %v", test.id, got, test.valid)
+		}
+	}
+}
+
+func TestIsNewEventValid(t *testing.T) {
+	tests := []struct {
+		name  string
+		event global.Event
+		err   error
+	}{
+		{
+			name:  "valid",
+			event: global.Event{Title: str("a"), Start: str("s"), End: str("e")},
+		},
+		{
+			name:  "missing start",
+			event: global.Event{Title: str("a"), End: str("e")},
+			err:   ErrorMissingDates,
+		},
+		{
+			name:  "empty end",
+			event: global.Event{Title: str("a"), Start: str("s"), End: str("")},
+			err:   ErrorMissingDates,
+		},
+		{
+			name:  "missing title",
+			event: global.Event{Start: str("s"), End: str("e")},
+			err:   ErrorMissingTitle,
+		},
+		{
+			name:  "empty title",
+			event: global.Event{Title: str(""), Start: str("s"), End: str("e")},
+			err:   ErrorMissingTitle,
+		},
+		{
+			name:  "dates checked first",
+			event: global.Event{},
+			err:   ErrorMissingDates,
+		},
+	}
+
+	for _, test := range tests {
+		if err := isNewEventValid(test.event); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+//TestCopyGoogleEventUpdate checks the json sent to google, as nil fields
+//must be left out for patches to keep them, and cleared fields sent.
+func TestCopyGoogleEventUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		connector *CalendarConnector
+		event     global.Event
+		want      string
+	}{
+		{
+			name:      "nothing set",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			want:      `{}`,
+		},
+		{
+			name:      "fields",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event: global.Event{
+				Title:       str("Title"),
+				Description: str("Description"),
+				Location:    str(""),
+				Start:       str("2020-01-06T09:00:00+01:00"),
+				End:         str("2020-01-06T10:00:00+01:00"),
+			},
+			want: `{"description":"Description",` +
+				`"end":{"dateTime":"2020-01-06T10:00:00+01:00","timeZone":"Europe/Oslo"},` +
+				`"start":{"dateTime":"2020-01-06T09:00:00+01:00","timeZone":"Europe/Oslo"},` +
+				`"summary":"Title"}`,
+		},
+		{
+			name:      "empty title is ignored",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event:     global.Event{Title: str("")},
+			want:      `{}`,
+		},
+		{
+			name: "connector settings",
+			connector: NewCalendarConnector(context.Background(), "flyvo").
+				GuestsCanModify(boolean(true)).
+				GuestsMayInviteOthers(boolean(false)).
+				GuestsMaySeeOtherGuests(boolean(false)).
+				EventIsprivate(boolean(true)),
+			want: `{"guestsCanInviteOthers":false,"guestsCanModify":true,` +
+				`"guestsCanSeeOtherGuests":false,"visibility":"private"}`,
+		},
+		{
+			name:      "event visibility overrides private",
+			connector: NewCalendarConnector(context.Background(), "flyvo").EventIsprivate(boolean(true)),
+			event:     global.Event{Visibility: str("public")},
+			want:      `{"visibility":"public"}`,
+		},
+		{
+			name:      "color reset",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event:     global.Event{ColorID: str("")},
+			want:      `{"colorId":null}`,
+		},
+		{
+			name:      "participants",
+			connector: NewCalendarConnector(context.Background(), "flyvo").GuestsAutoAccept(boolean(true)),
+			event: global.Event{Participants: &[]global.Participant{
+				{Email: "a@example.com"},
+				{Email: "b@example.com", Optional: boolean(true), ResponseStatus: str("declined")},
+			}},
+			want: `{"attendees":[{"email":"a@example.com","responseStatus":"accepted"},` +
+				`{"email":"b@example.com","optional":true,"responseStatus":"declined"}]}`,
+		},
+		{
+			name:      "empty participants are not sent",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event:     global.Event{Participants: &[]global.Participant{}},
+			want:      `{}`,
+		},
+		{
+			name:      "attachments cleared",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event:     global.Event{Attachments: &[]global.Attachment{}},
+			want:      `{"attachments":[]}`,
+		},
+		{
+			name:      "default reminders",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event:     global.Event{Reminders: &global.Reminders{}},
+			want:      `{"reminders":{"overrides":null,"useDefault":true}}`,
+		},
+		{
+			name:      "reminder overrides",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event: global.Event{Reminders: &global.Reminders{
+				Overrides: &[]global.ReminderOverride{{Method: "popup", Minutes: 0}},
+			}},
+			want: `{"reminders":{"overrides":[{"method":"popup","minutes":0}],"useDefault":false}}`,
+		},
+		{
+			name:      "extended properties",
+			connector: NewCalendarConnector(context.Background(), "flyvo"),
+			event: global.Event{ExtendedProperties: &global.ExtendedProperties{
+				Private: &map[string]string{"id": "1"},
+			}},
+			want: `{"extendedProperties":{"private":{"id":"1"}}}`,
+		},
+	}
+
+	for _, test := range tests {
+		update := &calendar.Event{}
+		test.connector.copyGoogleEventUpdate(test.event, update)
+
+		b, err := json.Marshal(update)
+		if err != nil {
+			t.Errorf("%s: marshal failed: %v", test.name, err)
+			continue
+		}
+
+		if got := canonicalJSON(t, b); got != canonicalJSON(t, []byte(test.want)) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	NewCalendarConnector(context.Background(), "flyvo").copyGoogleEventUpdate(global.Event{}, nil)
+}
+
+func TestCopyGoogleEventUpdateConference(t *testing.T) {
+	update := &calendar.Event{}
+	NewCalendarConnector(context.Background(), "flyvo").copyGoogleEventUpdate(global.Event{
+		Conference: &global.Conference{Create: true},
+	}, update)
+
+	request := update.ConferenceData.CreateRequest
+	if request.RequestId == "" || request.ConferenceSolutionKey.Type != defaultConferenceType {
+		t.Errorf("expected conference request, got %+v", request)
+	}
+
+	//retries of a job request the same conference
+	requestIDs := map[string]bool{}
+	for _, job := range []string{"job1", "job1", "job2"} {
+		update := &calendar.Event{}
+		NewCalendarConnector(context.Background(), "flyvo").Idempotent(job).copyGoogleEventUpdate(
+			global.Event{ID: str("abcdef"), Conference: &global.Conference{Create: true}}, update)
+		requestIDs[update.ConferenceData.CreateRequest.RequestId] = true
+	}
+
+	if len(requestIDs) != 2 {
+		t.Errorf("expected a request id per job, got %v", requestIDs)
+	}
+}
+
+func TestUpdateEventConference(t *testing.T) {
+	UseBackend("update", backend.NewMemory("calendar@example.com"))
+	defer UseBackend("update", nil)
+
+	connector := NewCalendarConnector(context.Background(), "update")
+	event := global.Event{
+		Title: str("Meeting"),
+		Start: str("2020-01-06T09:00:00+01:00"),
+		End:   str("2020-01-06T10:00:00+01:00"),
+	}
+	id, conference, err := connector.CreateEvent(event)
+	if err != nil || conference != nil {
+		t.Fatalf("create failed: %v %v", conference, err)
+	}
+
+	event.ID = &id
+	event.Conference = &global.Conference{Create: true}
+	conference, err = connector.UpdateEvent(event)
+	if err != nil || conference == nil {
+		t.Fatalf("expected conference of update, got %v %v", conference, err)
+	}
+
+	updated, err := connector.GetCalendarEvent(id)
+	if err != nil || updated.ConferenceData == nil || updated.ConferenceData.ConferenceId == "" {
+		t.Errorf("expected conference on updated event, got %+v %v", updated, err)
+	}
+}
@@ -1,16 +1,79 @@
 package googlecal
 
-import "fmt"
+import (
+	"net/http"
+	"net/url"
 
-//revive:disable
-type UserError error
+	"google.golang.org/api/googleapi"
+)
+
+//UserError - an error of bad input, as opposed to errors of google
+type UserError interface {
+	error
+	userError()
+}
+
+//userError - a UserError with a message
+type userError string
 
+func (e userError) Error() string {
+	return string(e)
+}
+
+func (e userError) userError() {}
+
+//revive:disable
 var (
-	ErrorMissingEventID      UserError = fmt.Errorf("missing event ID")
-	ErrorMissingDates        UserError = fmt.Errorf("missing start or end date")
-	ErrorMissingParticipants UserError = fmt.Errorf("no participants in event. must be at least one")
-	ErrorBadLocation         UserError = fmt.Errorf("event has empty location")
-	ErrorMissingTitle        UserError = fmt.Errorf("event has no title")
-	ErrorUnknownDomain       UserError = fmt.Errorf("provided domain name unknown")
-	ErrorBadID               UserError = fmt.Errorf("provided ID invalid, must be length 5 to 1024, and contain only lowercase letters and numbers 0-9")
+	ErrorMissingEventID            UserError = userError("missing event ID")
+	ErrorMissingDates              UserError = userError("missing start or end date")
+	ErrorMissingParticipants       UserError = userError("no participants in event. must be at least one")
+	ErrorBadLocation               UserError = userError("event has empty location")
+	ErrorMissingTitle              UserError = userError("event has no title")
+	ErrorUnknownDomain             UserError = userError("provided domain name unknown")
+	ErrorBadID                     UserError = userError("provided ID invalid, must be length 5 to 1024, and contain only lowercase letters and numbers 0-9")
+	ErrorMissingRuleID             UserError = userError("missing acl rule ID")
+	ErrorBadACLRole                UserError = userError("acl role invalid, must be one of freeBusyReader, reader, writer or owner")
+	ErrorBadACLScope               UserError = userError("acl scope type invalid, must be one of user, group, domain or default")
+	ErrorMissingACLScope           UserError = userError("acl scope value missing, required for scope types user, group and domain")
+	ErrorDuplicateACLScope         UserError = userError("acl rule set contains the same scope more than once")
+	ErrorTooManyReminders          UserError = userError("too many reminder overrides, must be at most 5")
+	ErrorBadReminderMethod         UserError = userError("reminder method invalid, must be email or popup")
+	ErrorBadReminderMinutes        UserError = userError("reminder minutes invalid, must be between 0 and 40320 (4 weeks)")
+	ErrorMissingParticipantEmail   UserError = userError("participant has no email")
+	ErrorBadResponseStatus         UserError = userError("participant response status invalid, must be one of needsAction, declined, tentative or accepted")
+	ErrorBadConferenceType         UserError = userError("conference type invalid, must be one of hangoutsMeet, eventHangout, eventNamedHangout or addOn")
+	ErrorTooManyAttachments        UserError = userError("too many attachments, must be at most 25")
+	ErrorMissingAttachmentURL      UserError = userError("attachment has no file url")
+	ErrorBadExtendedProperty       UserError = userError("extended property invalid, keys must be 1 to 44 characters and values at most 1024 characters")
+	ErrorTooManyExtendedProperties UserError = userError("too many extended properties, must be at most 300")
+	ErrorBadPropertyFilter         UserError = userError("extended property filter invalid, must be on the form key=value")
+	ErrorBadColor                  UserError = userError("event color invalid, must be one of the ids returned by colors")
+	ErrorBadTransparency           UserError = userError("event transparency invalid, must be opaque or transparent")
+	ErrorBadStatus                 UserError = userError("event status invalid, must be one of confirmed, tentative or cancelled")
+	ErrorBadVisibility             UserError = userError("event visibility invalid, must be one of default, public, private or confidential")
+	ErrorEventNotFound             UserError = userError("event not found")
+	ErrorInvitationsDisabled       UserError = userError("invitations can not be sent, as SMTP is not configured")
+	ErrorConflictReminders         UserError = userError("reminders can not both use default and have overrides")
+	ErrorDryRunUnsupported         UserError = userError("dry run is only supported for event writes")
+	ErrorBadUpdatedMin             UserError = userError("updatedMin invalid, must be an RFC3339 time")
+	ErrorBadOrderBy                UserError = userError("orderBy invalid, must be startTime or updated")
+	ErrorBadMaxAttendees           UserError = userError("maxAttendees invalid, must be positive")
 )
+
+//Temporary - whether err may go away if retried, i.e. google being
+//unavailable or rate limiting. Errors of bad input are not.
+func Temporary(err error) bool {
+	switch err := err.(type) {
+	case *googleapi.Error:
+		for _, v := range err.Errors {
+			//google's usage limits are 403s
+			if v.Reason == "rateLimitExceeded" || v.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+		return err.Code == http.StatusTooManyRequests || err.Code >= http.StatusInternalServerError
+	case *url.Error:
+		return true
+	}
+	return false
+}
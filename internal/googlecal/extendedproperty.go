@@ -0,0 +1,79 @@
+package googlecal
+
+import (
+	"strings"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	maxExtendedProperties = 300
+	maxPropertyKeyLength  = 44
+	maxPropertyValLength  = 1024
+)
+
+func arePropertiesValid(properties *map[string]string) error {
+	if properties == nil {
+		return nil
+	}
+
+	if len(*properties) > maxExtendedProperties {
+		return ErrorTooManyExtendedProperties
+	}
+
+	for k, v := range *properties {
+		if k == "" || len(k) > maxPropertyKeyLength || len(v) > maxPropertyValLength {
+			return ErrorBadExtendedProperty
+		}
+	}
+	return nil
+}
+
+//areExtendedPropertiesValid - checks properties against Google's limits
+func areExtendedPropertiesValid(properties *global.ExtendedProperties) error {
+	if properties == nil {
+		return nil
+	}
+
+	err := arePropertiesValid(properties.Private)
+	if err != nil {
+		return err
+	}
+	return arePropertiesValid(properties.Shared)
+}
+
+//isPropertyFilterValid - checks that filters are on the form key=value
+func isPropertyFilterValid(filters []string) error {
+	for _, v := range filters {
+		if strings.Index(v, "=") < 1 {
+			return ErrorBadPropertyFilter
+		}
+	}
+	return nil
+}
+
+//FindEventsByExternalID returns events having the private extended
+//property key set to the external id. Recurring events are not expanded.
+func (e *CalendarConnector) FindEventsByExternalID(key string, externalID string) (
+	[]*calendar.Event,
+	error,
+) {
+	if key == "" || externalID == "" {
+		return nil, ErrorBadPropertyFilter
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := srv.ListEvents(e.context, e.calendar(), backend.ListOptions{
+		PrivateExtendedProperty: []string{key + "=" + externalID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events.Items, nil
+}
@@ -0,0 +1,189 @@
+package googlecal
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/webhook"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"github.com/tktip/google-calendar/pkg/ics"
+	"google.golang.org/api/calendar/v3"
+)
+
+//import actions
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+	ImportError     = "error"
+)
+
+//sameDateTime - compares instants, as offsets may be formatted differently
+func sameDateTime(a, b *calendar.EventDateTime) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	if a.Date != "" || b.Date != "" {
+		return a.Date == b.Date
+	}
+
+	ta, errA := time.Parse(time.RFC3339, a.DateTime)
+	tb, errB := time.Parse(time.RFC3339, b.DateTime)
+	if errA != nil || errB != nil {
+		return a.DateTime == b.DateTime
+	}
+	return ta.Equal(tb)
+}
+
+func attendeeStatuses(attendees []*calendar.EventAttendee) map[string]string {
+	statuses := map[string]string{}
+	for _, v := range attendees {
+		statuses[v.Email] = v.ResponseStatus
+	}
+	return statuses
+}
+
+func reminderOverrides(reminders *calendar.EventReminders) map[string]bool {
+	overrides := map[string]bool{}
+	if reminders != nil {
+		for _, v := range reminders.Overrides {
+			overrides[fmt.Sprintf("%s:%d", v.Method, v.Minutes)] = true
+		}
+	}
+	return overrides
+}
+
+//diffEvents - names of fields an import would change on the existing event
+func diffEvents(existing *calendar.Event, imported *calendar.Event) []string {
+	changes := []string{}
+	compare := func(field string, same bool) {
+		if !same {
+			changes = append(changes, field)
+		}
+	}
+
+	compare("summary", existing.Summary == imported.Summary)
+	compare("description", existing.Description == imported.Description)
+	compare("location", existing.Location == imported.Location)
+	compare("start", sameDateTime(existing.Start, imported.Start))
+	compare("end", sameDateTime(existing.End, imported.End))
+	compare("recurrence", reflect.DeepEqual(existing.Recurrence, imported.Recurrence))
+	compare("status", imported.Status == "" || existing.Status == imported.Status)
+	compare("transparency", imported.Transparency == "" ||
+		existing.Transparency == imported.Transparency)
+	compare("visibility", imported.Visibility == "" ||
+		existing.Visibility == imported.Visibility)
+	compare("attendees", reflect.DeepEqual(
+		attendeeStatuses(existing.Attendees), attendeeStatuses(imported.Attendees),
+	))
+	compare("reminders", imported.Reminders == nil || reflect.DeepEqual(
+		reminderOverrides(existing.Reminders), reminderOverrides(imported.Reminders),
+	))
+	return changes
+}
+
+//findImported - existing event (or modified instance) with same uid
+func (e *CalendarConnector) findImported(srv backend.Backend, event *calendar.Event) (
+	*calendar.Event,
+	error,
+) {
+	events, err := e.findByUID(srv, event.ICalUID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range events {
+		if event.OriginalStartTime == nil && v.RecurringEventId == "" {
+			return v, nil
+		}
+
+		if event.OriginalStartTime != nil &&
+			sameDateTime(event.OriginalStartTime, v.OriginalStartTime) {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+//importEvent - upserts a single event, unless dry run
+func (e *CalendarConnector) importEvent(
+	srv backend.Backend,
+	event *calendar.Event,
+	dryRun bool,
+) (result global.ImportedEvent) {
+	result = global.ImportedEvent{UID: event.ICalUID, Action: ImportCreate}
+	if event.OriginalStartTime != nil {
+		result.RecurrenceID = event.OriginalStartTime.DateTime + event.OriginalStartTime.Date
+	}
+
+	existing, err := e.findImported(srv, event)
+	if err != nil {
+		result.Action, result.Error = ImportError, err.Error()
+		return result
+	}
+
+	if existing != nil {
+		result.ID = existing.Id
+		result.Changes = diffEvents(existing, event)
+		result.Action = ImportUpdate
+		if len(result.Changes) == 0 {
+			result.Action = ImportUnchanged
+		}
+	}
+
+	if dryRun || result.Action == ImportUnchanged {
+		return result
+	}
+
+	imported, err := srv.ImportEvent(e.context, e.calendar(), event)
+	if err != nil {
+		result.Action, result.Error = ImportError, err.Error()
+		return result
+	}
+	result.ID = imported.Id
+
+	if existing == nil {
+		e.publish(webhook.EventCreated, imported.Id, nil, imported)
+	} else {
+		e.publish(webhook.EventUpdated, imported.Id, existing, imported)
+	}
+	return result
+}
+
+//ImportICS imports the events of an iCalendar file. Events are upserted
+//keyed by UID (iCalUID), and failing events do not stop the import.
+//On dry run, nothing is changed, but the result describes what would be.
+func (e *CalendarConnector) ImportICS(r io.Reader, dryRun bool) (global.ImportResult, error) {
+	result := global.ImportResult{DryRun: dryRun, Events: []global.ImportedEvent{}}
+
+	roots, err := ics.Decode(r)
+	if err != nil {
+		return result, userError("could not parse iCalendar data: " + err.Error())
+	}
+
+	srv, err := e.getBackend()
+	if err != nil {
+		return result, err
+	}
+
+	for _, root := range roots {
+		events, errs := ics.ToEvents(root)
+		for _, v := range errs {
+			result.Events = append(result.Events, global.ImportedEvent{
+				UID:          v.UID,
+				RecurrenceID: v.RecurrenceID,
+				Action:       ImportError,
+				Error:        v.Err.Error(),
+			})
+		}
+
+		for _, v := range events {
+			result.Events = append(result.Events, e.importEvent(srv, v, dryRun))
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package googlecal
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/imip"
+	"github.com/tktip/google-calendar/internal/webhook"
+	"google.golang.org/api/calendar/v3"
+)
+
+//SendInvitations - send iTIP invitations by mail when attendees change,
+//as an alternative to Google notifying them (InformGuestsAboutUpdates)
+func (e *CalendarConnector) SendInvitations(inviter *imip.Inviter) *CalendarConnector {
+	e.inviter = inviter
+	return e
+}
+
+//eventBeforeChange - current event, needed to find removed attendees
+//and for change snapshots. Only fetched when invitations are to be
+//sent, changes are recorded, or the change has webhook subscribers.
+func (e *CalendarConnector) eventBeforeChange(
+	eventID string,
+	t webhook.EventType,
+) (*calendar.Event, error) {
+	if e.inviter == nil && e.recordChange == nil && !e.notifiesWebhooks(t) {
+		return nil, nil
+	}
+	return e.GetCalendarEvent(eventID)
+}
+
+//copyAttendees - snapshot of the attendee list, before it or its
+//attendees are modified
+func copyAttendees(event *calendar.Event) *calendar.Event {
+	snapshot := *event
+	snapshot.Attendees = []*calendar.EventAttendee{}
+	for _, v := range event.Attendees {
+		attendee := *v
+		snapshot.Attendees = append(snapshot.Attendees, &attendee)
+	}
+	return &snapshot
+}
+
+//attendeesNotIn - attendees of a missing from b
+func attendeesNotIn(a *calendar.Event, b *calendar.Event) []*calendar.EventAttendee {
+	emails := map[string]bool{}
+	for _, v := range b.Attendees {
+		emails[v.Email] = true
+	}
+
+	missing := []*calendar.EventAttendee{}
+	for _, v := range a.Attendees {
+		if !emails[v.Email] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+//detailsChanged - whether a change concerns all attendees, not just the
+//attendee list itself
+func detailsChanged(before *calendar.Event, after *calendar.Event) bool {
+	if after.Sequence != before.Sequence {
+		return true
+	}
+
+	for _, field := range diffEvents(before, after) {
+		if field != "attendees" && field != "reminders" {
+			return true
+		}
+	}
+	return false
+}
+
+//inviteAttendees - sends iTIP messages for a change. before is nil on
+//create, after is nil on delete. Failures are only logged, as the
+//event has already been changed in Google.
+func (e *CalendarConnector) inviteAttendees(before *calendar.Event, after *calendar.Event) {
+	if e.inviter == nil || e.preview != nil {
+		return
+	}
+
+	var err error
+	switch {
+	case after == nil:
+		err = e.inviter.Cancel(before, before.Attendees)
+	case before == nil:
+		err = e.inviter.Request(after, after.Attendees)
+	case after.Status == "cancelled":
+		err = e.inviter.Cancel(after, before.Attendees)
+	default:
+		removed := attendeesNotIn(before, after)
+		if len(removed) > 0 {
+			err = e.inviter.Cancel(after, removed)
+		}
+
+		recipients := attendeesNotIn(after, before)
+		if detailsChanged(before, after) {
+			recipients = after.Attendees
+		}
+
+		if len(recipients) > 0 {
+			if requestErr := e.inviter.Request(after, recipients); requestErr != nil {
+				err = requestErr
+			}
+		}
+	}
+
+	if err != nil {
+		logrus.Warnf("Could not send invitations for event: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package googlecal
+
+import (
+	"strings"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"google.golang.org/api/calendar/v3"
+)
+
+//EventListFilter - optional filters when listing events
+type EventListFilter struct {
+	//key=value pairs events must have as private extended properties
+	PrivateExtendedProperties []string
+	//key=value pairs events must have as shared extended properties
+	SharedExtendedProperties []string
+
+	//free text search, in summary, description, location and attendees
+	Query string
+	//RFC3339, events modified at or after
+	UpdatedMin string
+	//startTime or updated, google's order if empty
+	OrderBy string
+	ICalUID string
+
+	ShowHiddenInvitations bool
+	//attendees returned of each event, all if 0
+	MaxAttendees int64
+
+	//email of an attendee events must have, filtered by the service
+	Attendee string
+	//response status of Attendee, or of the calendar owner if no
+	//attendee is given, filtered by the service
+	ResponseStatus string
+}
+
+func (f EventListFilter) isValid() error {
+	err := isPropertyFilterValid(f.PrivateExtendedProperties)
+	if err != nil {
+		return err
+	}
+
+	err = isPropertyFilterValid(f.SharedExtendedProperties)
+	if err != nil {
+		return err
+	}
+
+	if f.UpdatedMin != "" {
+		if _, err := time.Parse(time.RFC3339, f.UpdatedMin); err != nil {
+			return ErrorBadUpdatedMin
+		}
+	}
+
+	if f.OrderBy != "" && f.OrderBy != "startTime" && f.OrderBy != "updated" {
+		return ErrorBadOrderBy
+	}
+
+	if f.MaxAttendees < 0 {
+		return ErrorBadMaxAttendees
+	}
+
+	if f.ResponseStatus != "" && !validResponseStatuses[f.ResponseStatus] {
+		return ErrorBadResponseStatus
+	}
+	return nil
+}
+
+//apply - adds filter to list options
+func (f EventListFilter) apply(opts *backend.ListOptions) {
+	opts.PrivateExtendedProperty = f.PrivateExtendedProperties
+	opts.SharedExtendedProperty = f.SharedExtendedProperties
+	opts.Query = f.Query
+	opts.UpdatedMin = f.UpdatedMin
+	opts.OrderBy = f.OrderBy
+	opts.ICalUID = f.ICalUID
+	opts.ShowHiddenInvitations = f.ShowHiddenInvitations
+	opts.MaxAttendees = f.MaxAttendees
+}
+
+//matchesAttendee - whether event has the attendee of the filter, with
+//its response status
+func (f EventListFilter) matchesAttendee(event *calendar.Event) bool {
+	if f.Attendee == "" && f.ResponseStatus == "" {
+		return true
+	}
+
+	for _, v := range event.Attendees {
+		found := v.Self
+		if f.Attendee != "" {
+			found = strings.EqualFold(v.Email, f.Attendee)
+		}
+
+		if found {
+			return f.ResponseStatus == "" || v.ResponseStatus == f.ResponseStatus
+		}
+	}
+	return false
+}
+
+//filterAttendees - removes events not matching the attendee filter
+func (f EventListFilter) filterAttendees(events *calendar.Events) {
+	items := []*calendar.Event{}
+	for _, v := range events.Items {
+		if f.matchesAttendee(v) {
+			items = append(items, v)
+		}
+	}
+	events.Items = items
+}
@@ -0,0 +1,167 @@
+package googlecal
+
+import (
+	"encoding/json"
+
+	"github.com/tktip/google-calendar/internal/backend"
+	"golang.org/x/net/context"
+	"google.golang.org/api/calendar/v3"
+)
+
+//Preview - the write a dry run would have made
+type Preview struct {
+	Method  string          //insert, update, patch or delete
+	EventID string          //empty on insert without id
+	Payload *calendar.Event //sent to google, nil on delete
+	Before  *calendar.Event //nil on insert
+	After   *calendar.Event //as it would be after the write, nil on delete
+}
+
+//DryRun - validate and build writes as usual, but record them in
+//preview rather than making them. Events are still read from google.
+//No invitations are sent and no changes published.
+func (e *CalendarConnector) DryRun(preview *Preview) *CalendarConnector {
+	e.preview = preview
+	return e
+}
+
+//dryRun - backend recording event writes in preview, refusing other
+//writes. Reads are made.
+type dryRun struct {
+	backend.Backend
+	preview *Preview
+}
+
+//patched - event with the fields set in patch replaced, as google
+//patches them
+func patched(event *calendar.Event, patch *calendar.Event) (*calendar.Event, error) {
+	fields := map[string]json.RawMessage{}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]json.RawMessage{}
+	b, err = json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &changed)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range changed {
+		if string(v) == "null" {
+			delete(fields, k)
+			continue
+		}
+		fields[k] = v
+	}
+
+	b, err = json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	after := calendar.Event{}
+	err = json.Unmarshal(b, &after)
+	return &after, err
+}
+
+func (b *dryRun) InsertEvent(
+	ctx context.Context,
+	calendarID string,
+	event *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	*b.preview = Preview{Method: "insert", EventID: event.Id, Payload: event, After: event}
+	return event, nil
+}
+
+func (b *dryRun) PatchEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	patch *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	before, err := b.GetEvent(ctx, calendarID, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := patched(before, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	*b.preview = Preview{Method: "patch", EventID: eventID, Payload: patch, Before: before, After: after}
+	return after, nil
+}
+
+func (b *dryRun) UpdateEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	event *calendar.Event,
+	opts backend.WriteOptions,
+) (*calendar.Event, error) {
+	before, err := b.GetEvent(ctx, calendarID, eventID)
+	if err != nil {
+		return nil, err
+	}
+
+	after := *event
+	after.Id = eventID
+	*b.preview = Preview{Method: "update", EventID: eventID, Payload: event, Before: before, After: &after}
+	return &after, nil
+}
+
+func (b *dryRun) DeleteEvent(
+	ctx context.Context,
+	calendarID string,
+	eventID string,
+	opts backend.WriteOptions,
+) error {
+	before, err := b.GetEvent(ctx, calendarID, eventID)
+	if err != nil {
+		return err
+	}
+
+	*b.preview = Preview{Method: "delete", EventID: eventID, Before: before}
+	return nil
+}
+
+func (b *dryRun) ImportEvent(ctx context.Context, calendarID string, event *calendar.Event) (*calendar.Event, error) {
+	return nil, ErrorDryRunUnsupported
+}
+
+func (b *dryRun) InsertACL(
+	ctx context.Context,
+	calendarID string,
+	rule *calendar.AclRule,
+	sendNotifications bool,
+) (*calendar.AclRule, error) {
+	return nil, ErrorDryRunUnsupported
+}
+
+func (b *dryRun) PatchACL(
+	ctx context.Context,
+	calendarID string,
+	ruleID string,
+	rule *calendar.AclRule,
+	sendNotifications bool,
+) (*calendar.AclRule, error) {
+	return nil, ErrorDryRunUnsupported
+}
+
+func (b *dryRun) DeleteACL(ctx context.Context, calendarID string, ruleID string) error {
+	return ErrorDryRunUnsupported
+}
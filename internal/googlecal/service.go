@@ -0,0 +1,209 @@
+package googlecal
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	//tokens are refreshed this long before they expire
+	refreshBefore = 5 * time.Minute
+
+	//wait before retrying a failed refresh
+	refreshRetry = 30 * time.Second
+)
+
+//transport - shared by the calendar api clients of all domains, so
+//connections to google are reused
+var transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   20,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: time.Second,
+}
+
+//services - pooled by domain
+var (
+	services     = map[DomainName]*pooledService{}
+	servicesLock sync.Mutex
+)
+
+//pooledService - calendar service of a domain, shared by all requests.
+//Calls are made with the context of the request.
+type pooledService struct {
+	srv    *calendar.Service
+	tokens *refreshingTokenSource //nil if calling with httpClient
+}
+
+func (p *pooledService) close() {
+	if p.tokens != nil {
+		p.tokens.Close()
+	}
+}
+
+//tokenSourceFunc - a func as a token source
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+//refreshingTokenSource - reuses tokens until they expire, and mints new
+//ones in the background before they do, so requests rarely wait for one
+type refreshingTokenSource struct {
+	mutex  sync.RWMutex
+	source oauth2.TokenSource //reusing the current token
+	mint   oauth2.TokenSource
+	early  time.Duration //refreshing this long before expiry
+	retry  time.Duration
+	stop   chan struct{}
+
+	now   func() time.Time
+	after func(d time.Duration) <-chan time.Time
+}
+
+//jwtTokens - tokens of config, independent of any request context
+func jwtTokens(config *jwt.Config) oauth2.TokenSource {
+	//the token source of a config reuses its token, so a new one mints one
+	return tokenSourceFunc(func() (*oauth2.Token, error) {
+		return config.TokenSource(context.Background()).Token()
+	})
+}
+
+//newRefreshingTokenSource - reuses the tokens of mint, refreshing them
+//refreshBefore they expire
+func newRefreshingTokenSource(mint oauth2.TokenSource) *refreshingTokenSource {
+	s := &refreshingTokenSource{
+		source: oauth2.ReuseTokenSource(nil, mint),
+		mint:   mint,
+		early:  refreshBefore,
+		retry:  refreshRetry,
+		stop:   make(chan struct{}),
+		now:    time.Now,
+		after:  time.After,
+	}
+	go s.refresh()
+	return s
+}
+
+//Token - the current token, minting one if expired
+func (s *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.source.Token()
+}
+
+//refresh - replaces the token before it expires, until stopped
+func (s *refreshingTokenSource) refresh() {
+	wait := time.Duration(0)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.after(wait):
+		}
+
+		token, err := s.Token()
+		if err != nil {
+			wait = s.retry
+			continue
+		}
+
+		if token.Expiry.IsZero() {
+			return //never expires
+		}
+
+		wait = token.Expiry.Sub(s.now()) - s.early
+		if wait > 0 {
+			continue
+		}
+
+		token, err = s.mint.Token()
+		if err != nil {
+			logrus.Warnf("Could not refresh token: %v", err)
+			wait = s.retry
+			continue
+		}
+
+		s.mutex.Lock()
+		s.source = oauth2.ReuseTokenSource(token, s.mint)
+		s.mutex.Unlock()
+		wait = token.Expiry.Sub(s.now()) - s.early
+		if wait < s.retry {
+			wait = s.retry //tokens living shorter are not refreshed early
+		}
+	}
+}
+
+//Close - stops refreshing
+func (s *refreshingTokenSource) Close() {
+	close(s.stop)
+}
+
+//resetServices - drops the pooled services, i.e. when the config changes
+func resetServices() {
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+
+	for key, pooled := range services {
+		pooled.close()
+		delete(services, key)
+	}
+}
+
+//getCalendarService - the pooled service of the domain, impersonating
+//the subject of its config
+func (e *CalendarConnector) getCalendarService() (*calendar.Service, error) {
+	config := configs[e.domain]
+	if config == nil {
+		return nil, ErrorUnknownDomain
+	}
+
+	if e.context == nil {
+		panic("no context provided")
+	}
+
+	servicesLock.Lock()
+	defer servicesLock.Unlock()
+
+	if pooled := services[e.domain]; pooled != nil {
+		return pooled.srv, nil
+	}
+
+	pooled := &pooledService{}
+	client := httpClient
+	if client == nil {
+		pooled.tokens = newRefreshingTokenSource(jwtTokens(config))
+		client = &http.Client{Transport: &oauth2.Transport{Source: pooled.tokens, Base: transport}}
+	}
+
+	options := []option.ClientOption{option.WithHTTPClient(client)}
+	if endpoint != "" {
+		options = append(options, option.WithEndpoint(endpoint))
+	}
+
+	srv, err := calendar.NewService(context.Background(), options...)
+	if err != nil {
+		pooled.close()
+		return nil, err
+	}
+
+	pooled.srv = srv
+	services[e.domain] = pooled
+	return srv, nil
+}
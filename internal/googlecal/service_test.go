@@ -0,0 +1,132 @@
+package googlecal
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+//fakeClock - time of a refreshing token source, moved by the test. The
+//waits of the source are sent on waits, and end when fire is sent on.
+type fakeClock struct {
+	mutex sync.Mutex
+	time  time.Time
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.time
+}
+
+func (c *fakeClock) after(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+//wait - fails t unless the next wait of the source is want
+func (c *fakeClock) wait(t *testing.T, want time.Duration) {
+	t.Helper()
+	select {
+	case d := <-c.waits:
+		if d != want {
+			t.Fatalf("expected to wait %v, got %v", want, d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected to wait %v", want)
+	}
+}
+
+//advance - moves the clock by the next wait of the source, and ends it
+func (c *fakeClock) advance(t *testing.T, want time.Duration) {
+	t.Helper()
+	c.wait(t, want)
+
+	c.mutex.Lock()
+	c.time = c.time.Add(want)
+	c.mutex.Unlock()
+	c.fire <- c.time
+}
+
+func TestRefreshingTokenSource(t *testing.T) {
+	clock := &fakeClock{
+		time:  time.Now(),
+		waits: make(chan time.Duration, 1),
+		fire:  make(chan time.Time),
+	}
+
+	mutex := sync.Mutex{}
+	minted := 0
+	mint := tokenSourceFunc(func() (*oauth2.Token, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		minted++
+		return &oauth2.Token{
+			AccessToken: fmt.Sprint(minted),
+			Expiry:      clock.now().Add(time.Hour),
+		}, nil
+	})
+
+	s := &refreshingTokenSource{
+		source: oauth2.ReuseTokenSource(nil, mint),
+		mint:   mint,
+		early:  5 * time.Minute,
+		retry:  time.Minute,
+		stop:   make(chan struct{}),
+		now:    clock.now,
+		after:  clock.after,
+	}
+	go s.refresh()
+	defer s.Close()
+
+	first, err := s.Token()
+	if err != nil {
+		t.Fatalf("token failed: %v", err)
+	}
+
+	//refreshes 5 minutes before the first token expires
+	clock.advance(t, 0)
+	clock.advance(t, 55*time.Minute)
+	clock.wait(t, 55*time.Minute)
+
+	second, _ := s.Token()
+	if second.AccessToken == first.AccessToken {
+		t.Errorf("expected token refreshed before expiry, got %s", second.AccessToken)
+	}
+
+	third, _ := s.Token()
+	if third.AccessToken != second.AccessToken {
+		t.Errorf("expected token reused, got %s and %s", second.AccessToken, third.AccessToken)
+	}
+}
+
+func TestServicePool(t *testing.T) {
+	Configure(CalendarConfig{"pooled": &jwt.Config{Subject: "admin@example.com"}})
+	defer Configure(nil)
+
+	ctx := context.Background()
+	a, err := NewCalendarConnector(ctx, "pooled").getCalendarService()
+	if err != nil {
+		t.Fatalf("service failed: %v", err)
+	}
+
+	if b, _ := NewCalendarConnector(ctx, "pooled").getCalendarService(); a != b {
+		t.Errorf("expected a service per domain")
+	}
+
+	Configure(CalendarConfig{"pooled": &jwt.Config{Subject: "admin@example.com"}})
+	if c, _ := NewCalendarConnector(ctx, "pooled").getCalendarService(); c == a {
+		t.Errorf("expected new service after configuring")
+	}
+
+	if _, err := NewCalendarConnector(ctx, "unknown").getCalendarService(); err != ErrorUnknownDomain {
+		t.Errorf("expected unknown domain, got %v", err)
+	}
+}
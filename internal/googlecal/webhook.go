@@ -0,0 +1,37 @@
+package googlecal
+
+import "github.com/tktip/google-calendar/internal/webhook"
+
+//webhooks - dispatcher of connectors not given one by NotifyWebhooks
+var webhooks = webhook.NewDispatcher(webhook.NewRegistry())
+
+//UseWebhooks - publish the event changes of every connector with
+//dispatcher, i.e. one with persisted subscriptions
+func UseWebhooks(dispatcher *webhook.Dispatcher) {
+	webhooks = dispatcher
+}
+
+//Webhooks - dispatcher the event changes of connectors are published with
+func Webhooks() *webhook.Dispatcher {
+	return webhooks
+}
+
+//NotifyWebhooks - publish event changes to the webhook subscribers of
+//dispatcher instead of the one of UseWebhooks, if not nil
+func (e *CalendarConnector) NotifyWebhooks(dispatcher *webhook.Dispatcher) *CalendarConnector {
+	e.webhooks = dispatcher
+	return e
+}
+
+//dispatcher - dispatcher the changes of the connector are published with
+func (e *CalendarConnector) dispatcher() *webhook.Dispatcher {
+	if e.webhooks != nil {
+		return e.webhooks
+	}
+	return webhooks
+}
+
+//notifiesWebhooks - whether a change of type t has webhook subscribers
+func (e *CalendarConnector) notifiesWebhooks(t webhook.EventType) bool {
+	return e.dispatcher().Subscribed(string(e.domain), t)
+}
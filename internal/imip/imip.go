@@ -0,0 +1,145 @@
+//Package imip sends iTIP (RFC 5546) invitations and cancellations by mail
+//(iMIP, RFC 6047), for attendees on calendar systems other than Google.
+package imip
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/tktip/google-calendar/pkg/ics"
+	"google.golang.org/api/calendar/v3"
+)
+
+//iTIP methods
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+//Message is an iMIP message to a single recipient
+type Message struct {
+	From     string
+	To       string
+	Subject  string
+	Text     string //plain text alternative
+	Method   string
+	Calendar []byte //iCalendar object with METHOD
+}
+
+//Sender delivers messages, i.e. over SMTP
+type Sender interface {
+	Send(msg Message) error
+}
+
+//Inviter builds and sends invitations for events
+type Inviter struct {
+	Sender Sender
+	From   string
+
+	//attendees in these domains are on Google, and are notified by it instead
+	SkipDomains []string
+}
+
+//InviterFromEnv creates an inviter sending over SMTP, configured by
+//SMTP_ADDR, SMTP_FROM, SMTP_USERNAME, SMTP_PASSWORD and IMIP_SKIP_DOMAINS.
+//Returns nil if SMTP_ADDR is not set.
+func InviterFromEnv() *Inviter {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	inviter := Inviter{
+		Sender: &SMTPSender{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		},
+		From: os.Getenv("SMTP_FROM"),
+	}
+
+	for _, v := range strings.Split(os.Getenv("IMIP_SKIP_DOMAINS"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			inviter.SkipDomains = append(inviter.SkipDomains, strings.ToLower(v))
+		}
+	}
+	return &inviter
+}
+
+//skip - whether attendee should not get invitations from us
+func (i *Inviter) skip(attendee *calendar.EventAttendee) bool {
+	if attendee.Self || attendee.Resource || attendee.Email == "" {
+		return true
+	}
+
+	email := strings.ToLower(attendee.Email)
+	for _, domain := range i.SkipDomains {
+		if strings.HasSuffix(email, "@"+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+//Request sends the event as an invitation (or update) to attendees
+func (i *Inviter) Request(event *calendar.Event, attendees []*calendar.EventAttendee) error {
+	return i.send(MethodRequest, event, attendees, "Invitation: ")
+}
+
+//Cancel tells attendees they are no longer invited. If attendees are
+//all attendees of the event, this cancels the event for everyone.
+func (i *Inviter) Cancel(event *calendar.Event, attendees []*calendar.EventAttendee) error {
+	cancelled := *event
+	cancelled.Status = "cancelled"
+	cancelled.Attendees = attendees
+	//cancellations must not have a lower sequence than the event
+	cancelled.Sequence = event.Sequence + 1
+	return i.send(MethodCancel, &cancelled, attendees, "Cancelled: ")
+}
+
+//send - one message per recipient, so attendees are not disclosed
+func (i *Inviter) send(
+	method string,
+	event *calendar.Event,
+	attendees []*calendar.EventAttendee,
+	subjectPrefix string,
+) error {
+	//iTIP requires an organizer, which replies are sent to
+	if event.Organizer == nil || event.Organizer.Email == "" {
+		withOrganizer := *event
+		withOrganizer.Organizer = &calendar.EventOrganizer{Email: i.From}
+		event = &withOrganizer
+	}
+
+	buf := bytes.Buffer{}
+	err := ics.Calendar{Method: method, Events: []*calendar.Event{event}}.Encode(&buf)
+	if err != nil {
+		return err
+	}
+
+	text := event.Summary
+	if event.Description != "" {
+		text += "\n\n" + event.Description
+	}
+
+	var firstErr error
+	for _, attendee := range attendees {
+		if i.skip(attendee) {
+			continue
+		}
+
+		err := i.Sender.Send(Message{
+			From:     i.From,
+			To:       attendee.Email,
+			Subject:  subjectPrefix + event.Summary,
+			Text:     text,
+			Method:   method,
+			Calendar: buf.Bytes(),
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
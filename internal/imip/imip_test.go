@@ -0,0 +1,243 @@
+package imip
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/tktip/google-calendar/pkg/ics"
+	"google.golang.org/api/calendar/v3"
+)
+
+//smtpStub - minimal SMTP server, accepting every mail it is given
+type smtpStub struct {
+	listener net.Listener
+	mails    chan stubMail
+}
+
+type stubMail struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	stub := &smtpStub{listener: listener, mails: make(chan stubMail, 10)}
+	go stub.serve()
+	return stub
+}
+
+func (s *smtpStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpStub) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 stub ESMTP")
+	current := stubMail{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 stub")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			current = stubMail{from: strings.Trim(line[10:], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			current.to = append(current.to, strings.Trim(line[8:], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 go ahead")
+			data := bytes.Buffer{}
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			current.data = data.Bytes()
+			s.mails <- current
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+//calendarPart - method and iCalendar data of the text/calendar part
+func calendarPart(t *testing.T, data []byte) (string, []*ics.Component) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("could not read mail: %v", err)
+	}
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("bad content type: %v", err)
+	}
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err != nil {
+			t.Fatalf("no calendar part: %v", err)
+		}
+
+		mediaType, partParams, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if mediaType != "text/calendar" {
+			continue
+		}
+
+		//multipart.Reader decodes quoted-printable only, so do base64 here
+		encoded, _ := ioutil.ReadAll(part)
+		decoded, err := decodeBase64Lines(encoded)
+		if err != nil {
+			t.Fatalf("bad base64: %v", err)
+		}
+
+		roots, err := ics.Decode(bytes.NewReader(decoded))
+		if err != nil {
+			t.Fatalf("bad calendar: %v", err)
+		}
+		return partParams["method"], roots
+	}
+}
+
+func decodeBase64Lines(data []byte) ([]byte, error) {
+	joined := strings.Replace(strings.Replace(string(data), "\r", "", -1), "\n", "", -1)
+	return base64.StdEncoding.DecodeString(joined)
+}
+
+func testEvent() *calendar.Event {
+	return &calendar.Event{
+		Id:      "abc",
+		ICalUID: "abc@google.com",
+		Summary: "Meeting",
+		Start:   &calendar.EventDateTime{DateTime: "2020-06-01T10:00:00Z"},
+		End:     &calendar.EventDateTime{DateTime: "2020-06-01T11:00:00Z"},
+		Attendees: []*calendar.EventAttendee{
+			{Email: "external@example.com"},
+			{Email: "colleague@internal.com"},
+			{Email: "room@example.com", Resource: true},
+		},
+	}
+}
+
+func TestInviterRequest(t *testing.T) {
+	stub := newSMTPStub(t)
+	defer stub.listener.Close()
+
+	inviter := Inviter{
+		Sender:      &SMTPSender{Addr: stub.listener.Addr().String()},
+		From:        "calendar@internal.com",
+		SkipDomains: []string{"internal.com"},
+	}
+
+	event := testEvent()
+	err := inviter.Request(event, event.Attendees)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	sent := <-stub.mails
+	if len(sent.to) != 1 || sent.to[0] != "external@example.com" || sent.from != "calendar@internal.com" {
+		t.Errorf("mail from %q to %v", sent.from, sent.to)
+	}
+
+	select {
+	case extra := <-stub.mails:
+		t.Errorf("unexpected mail to %v", extra.to)
+	default:
+	}
+
+	method, roots := calendarPart(t, sent.data)
+	if method != MethodRequest {
+		t.Errorf("method = %q", method)
+	}
+
+	if p := roots[0].Property("METHOD"); p == nil || p.Value != MethodRequest {
+		t.Errorf("METHOD = %v", p)
+	}
+
+	events, errs := ics.ToEvents(roots[0])
+	if len(errs) != 0 || len(events) != 1 {
+		t.Fatalf("events = %v, errors = %v", events, errs)
+	}
+
+	if events[0].ICalUID != "abc@google.com" || events[0].Organizer == nil ||
+		events[0].Organizer.Email != "calendar@internal.com" {
+		t.Errorf("event = %+v", events[0])
+	}
+}
+
+func TestInviterCancel(t *testing.T) {
+	stub := newSMTPStub(t)
+	defer stub.listener.Close()
+
+	inviter := Inviter{
+		Sender: &SMTPSender{Addr: stub.listener.Addr().String()},
+		From:   "calendar@internal.com",
+	}
+
+	event := testEvent()
+	event.Sequence = 2
+	err := inviter.Cancel(event, event.Attendees[:1])
+	if err != nil {
+		t.Fatalf("cancel failed: %v", err)
+	}
+
+	sent := <-stub.mails
+	method, roots := calendarPart(t, sent.data)
+	if method != MethodCancel {
+		t.Errorf("method = %q", method)
+	}
+
+	events, _ := ics.ToEvents(roots[0])
+	if len(events) != 1 || events[0].Status != "cancelled" || events[0].Sequence != 3 {
+		t.Fatalf("events = %+v", events)
+	}
+
+	if len(events[0].Attendees) != 1 || events[0].Attendees[0].Email != "external@example.com" {
+		t.Errorf("attendees = %+v", events[0].Attendees)
+	}
+
+	if event.Status != "" || event.Sequence != 2 {
+		t.Errorf("original event modified: %+v", event)
+	}
+}
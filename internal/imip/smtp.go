@@ -0,0 +1,96 @@
+package imip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+//SMTPSender sends messages over SMTP. STARTTLS is used if offered.
+type SMTPSender struct {
+	Addr     string //host:port
+	Username string //optional, for PLAIN auth
+	Password string
+}
+
+//base64Lines - base64 with lines of at most 76 characters, as mail requires
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	buf := bytes.Buffer{}
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+//Build renders msg as a multipart/alternative mail, with the plain text
+//and the text/calendar part carrying the iTIP method.
+func (msg Message) Build() ([]byte, error) {
+	body := bytes.Buffer{}
+	w := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"text/plain; charset=utf-8", []byte(msg.Text)},
+		{"text/calendar; charset=utf-8; method=" + msg.Method, msg.Calendar},
+	}
+
+	for _, v := range parts {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {v.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = part.Write(base64Lines(v.data))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	mail := bytes.Buffer{}
+	fmt.Fprintf(&mail, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&mail, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&mail, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&mail, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&mail, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&mail, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", w.Boundary())
+	mail.Write(body.Bytes())
+	return mail.Bytes(), nil
+}
+
+//Send delivers msg to its recipient
+func (s *SMTPSender) Send(msg Message) error {
+	data, err := msg.Build()
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	return smtp.SendMail(s.Addr, auth, msg.From, []string{msg.To}, data)
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//Status - state of a job
+type Status string
+
+//revive:disable
+const (
+	StatusQueued    Status = "queued" //also while waiting for a retry
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed" //dead-lettered, may be retried
+)
+
+//Kinds of jobs, the write made
+const (
+	KindCreate = "create"
+	KindUpdate = "update"
+	KindPatch  = "patch"
+	KindDelete = "delete"
+)
+
+var (
+	ErrorUnknownJob = fmt.Errorf("job not found")
+	ErrorNotFailed  = fmt.Errorf("job has not failed, only failed jobs can be retried")
+)
+
+//revive:enable
+
+//Job - a write queued for a domain. Jobs with the same key, the id of
+//the event written, are run one at a time in the order queued.
+type Job struct {
+	ID       string          `json:"id"`
+	Sequence int64           `json:"sequence"`
+	Domain   string          `json:"domain"`
+	Key      string          `json:"key"`
+	Kind     string          `json:"kind"`
+	Request  json.RawMessage `json:"request"`
+	Status   Status          `json:"status"`
+	Attempts int             `json:"attempts"`
+
+	LastError   string          `json:"lastError,omitempty"`
+	NextAttempt *time.Time      `json:"nextAttempt,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+//done - whether the job will not run again, unless retried
+func (j Job) done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
@@ -0,0 +1,357 @@
+package jobs
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/random"
+)
+
+//Executor - makes the write of a job, returning its result
+type Executor func(job Job) (json.RawMessage, error)
+
+//Queue - runs jobs in the background, by workers per domain. Jobs
+//with the same key are run in order, one at a time, while jobs of
+//different keys run in parallel. Failed jobs are retried with backoff
+//if Retryable, and dead-lettered after MaxAttempts.
+type Queue struct {
+	Store       Store
+	Execute     Executor
+	Workers     int //per domain
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+	Retryable   func(err error) bool
+
+	//time jobs are kept after succeeding or failing, forever if 0.
+	//Failed jobs can not be retried once removed.
+	Retention time.Duration
+
+	mutex    sync.Mutex
+	sequence int64
+	domains  map[string]*domainQueue
+	inflight sync.WaitGroup
+}
+
+//domainQueue - pending jobs of a domain. The first job of a lane is
+//running or waiting for a retry; ready holds keys of lanes to be run.
+type domainQueue struct {
+	lanes map[string][]*Job
+	ready []string
+	cond  *sync.Cond
+}
+
+//NewQueue - queue running jobs with execute, keeping them in store
+func NewQueue(store Store, execute Executor) *Queue {
+	return &Queue{
+		Store:       store,
+		Execute:     execute,
+		Workers:     4,
+		MaxAttempts: 5,
+		Backoff:     ExponentialBackoff(5*time.Second, 10*time.Minute),
+		Retryable:   func(error) bool { return true },
+		Retention:   7 * 24 * time.Hour,
+		domains:     map[string]*domainQueue{},
+	}
+}
+
+//QueueFromEnv creates a queue configured by JOB_STORE (directory jobs
+//are kept in), JOB_WORKERS, JOB_MAX_ATTEMPTS and JOB_RETENTION. Jobs are
+//only kept in memory if JOB_STORE is not set.
+func QueueFromEnv(execute Executor) (*Queue, error) {
+	var store Store = NewMemoryStore()
+	if dir := os.Getenv("JOB_STORE"); dir != "" {
+		var err error
+		store, err = OpenFileStore(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	queue := NewQueue(store, execute)
+	for name, setting := range map[string]*int{
+		"JOB_WORKERS":      &queue.Workers,
+		"JOB_MAX_ATTEMPTS": &queue.MaxAttempts,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("%s must be a positive number, got %q", name, v)
+			}
+			*setting = n
+		}
+	}
+
+	if v := os.Getenv("JOB_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("JOB_RETENTION must be a duration, 0 to keep jobs, got %q", v)
+		}
+		queue.Retention = d
+	}
+	return queue, nil
+}
+
+//ExponentialBackoff - delay doubling from base after each attempt, up to max
+func ExponentialBackoff(base time.Duration, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+//Start - queues the jobs left unfinished in the store, i.e. by a
+//restart. Jobs that were running are run again, and finished jobs past
+//Retention are removed.
+func (q *Queue) Start() error {
+	jobs, err := q.Store.List()
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for i := range jobs {
+		job := jobs[i]
+		if job.Sequence > q.sequence {
+			q.sequence = job.Sequence
+		}
+
+		if job.done() {
+			q.expire(job)
+			continue
+		}
+
+		job.Status = StatusQueued
+		job.NextAttempt = nil
+		q.push(&job)
+	}
+	return nil
+}
+
+//Enqueue - queues a write of kind to the event key of domain. The
+//request is passed to the executor as json.
+func (q *Queue) Enqueue(domain string, key string, kind string, request interface{}) (Job, error) {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now().UTC()
+	q.sequence++
+	job := &Job{
+		ID:       random.ID(),
+		Sequence: q.sequence,
+		Domain:   domain,
+		Key:      key,
+		Kind:     kind,
+		Request:  b,
+		Status:   StatusQueued,
+		Created:  now,
+		Updated:  now,
+	}
+	if job.Key == "" {
+		job.Key = job.ID
+	}
+
+	err = q.Store.Put(*job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.push(job)
+	return *job, nil
+}
+
+//Get - job with id
+func (q *Queue) Get(id string) (Job, error) {
+	return q.Store.Get(id)
+}
+
+//Retry - queues a dead-lettered job again, with a fresh set of attempts
+func (q *Queue) Retry(id string) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, err := q.Store.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if job.Status != StatusFailed {
+		return job, ErrorNotFailed
+	}
+
+	job.Status = StatusQueued
+	job.Attempts = 0
+	job.Updated = time.Now().UTC()
+	err = q.Store.Put(job)
+	if err != nil {
+		return Job{}, err
+	}
+
+	q.push(&job)
+	return job, nil
+}
+
+//Wait - blocks until all queued jobs have succeeded or failed
+func (q *Queue) Wait() {
+	q.inflight.Wait()
+}
+
+//domain - pending jobs of domain, starting its workers on first use.
+//Must hold mutex.
+func (q *Queue) domain(domain string) *domainQueue {
+	d := q.domains[domain]
+	if d != nil {
+		return d
+	}
+
+	d = &domainQueue{lanes: map[string][]*Job{}, cond: sync.NewCond(&q.mutex)}
+	q.domains[domain] = d
+	for i := 0; i < q.Workers; i++ {
+		go q.work(d)
+	}
+	return d
+}
+
+//push - adds job to the end of its lane. Must hold mutex.
+func (q *Queue) push(job *Job) {
+	q.inflight.Add(1)
+
+	d := q.domain(job.Domain)
+	d.lanes[job.Key] = append(d.lanes[job.Key], job)
+	if len(d.lanes[job.Key]) == 1 {
+		d.ready = append(d.ready, job.Key)
+		d.cond.Signal()
+	}
+}
+
+//work - runs the first job of ready lanes, forever
+func (q *Queue) work(d *domainQueue) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		for len(d.ready) == 0 {
+			d.cond.Wait()
+		}
+
+		key := d.ready[0]
+		d.ready = d.ready[1:]
+		q.run(d, key)
+	}
+}
+
+//run - runs the first job of lane key. Must hold mutex, which is
+//released while executing.
+func (q *Queue) run(d *domainQueue, key string) {
+	job := d.lanes[key][0]
+	job.Status = StatusRunning
+	job.Attempts++
+	job.NextAttempt = nil
+	job.Updated = time.Now().UTC()
+	q.put(*job)
+
+	running := *job
+	q.mutex.Unlock()
+	result, err := q.Execute(running)
+	q.mutex.Lock()
+
+	job.Updated = time.Now().UTC()
+	switch {
+	case err == nil:
+		job.Status = StatusSucceeded
+		job.Result = result
+		job.LastError = ""
+	case q.Retryable(err) && job.Attempts < q.MaxAttempts:
+		//stays first in its lane, so later jobs of the event wait
+		next := job.Updated.Add(q.Backoff(job.Attempts))
+		job.Status = StatusQueued
+		job.LastError = err.Error()
+		job.NextAttempt = &next
+		q.put(*job)
+
+		time.AfterFunc(next.Sub(job.Updated), func() {
+			q.mutex.Lock()
+			defer q.mutex.Unlock()
+			d.ready = append(d.ready, key)
+			d.cond.Signal()
+		})
+		return
+	default:
+		job.Status = StatusFailed
+		job.LastError = err.Error()
+		logrus.Warnf("Job %s (%s %s) failed after %d attempts: %v",
+			job.ID, job.Kind, job.Key, job.Attempts, err)
+	}
+	q.put(*job)
+	q.expire(*job)
+
+	d.lanes[key] = d.lanes[key][1:]
+	if len(d.lanes[key]) == 0 {
+		delete(d.lanes, key)
+	} else {
+		d.ready = append(d.ready, key)
+		d.cond.Signal()
+	}
+	q.inflight.Done()
+}
+
+//put - stores job. Failures are only logged, as the job is still
+//known to the queue, only not persisted.
+func (q *Queue) put(job Job) {
+	err := q.Store.Put(job)
+	if err != nil {
+		logrus.Errorf("Could not store job %s: %v", job.ID, err)
+	}
+}
+
+//expire - removes job from the store once Retention has passed since it
+//finished, unless it has been retried
+func (q *Queue) expire(job Job) {
+	if q.Retention == 0 {
+		return
+	}
+
+	time.AfterFunc(time.Until(job.Updated.Add(q.Retention)), func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+
+		current, err := q.Store.Get(job.ID)
+		if err != nil || !current.Updated.Equal(job.Updated) {
+			return
+		}
+
+		err = q.Store.Delete(job.ID)
+		if err != nil {
+			logrus.Errorf("Could not remove job %s: %v", job.ID, err)
+		}
+	})
+}
+
+//isValidID - whether id could have been made by random.ID
+func isValidID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
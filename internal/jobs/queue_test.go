@@ -0,0 +1,235 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/random"
+)
+
+//recorder - executor recording the requests run, by key
+type recorder struct {
+	mutex    sync.Mutex
+	runs     map[string][]string
+	running  map[string]bool
+	failures map[string]int //failures left, by request
+	t        *testing.T
+}
+
+func newRecorder(t *testing.T) *recorder {
+	return &recorder{
+		runs:     map[string][]string{},
+		running:  map[string]bool{},
+		failures: map[string]int{},
+		t:        t,
+	}
+}
+
+func (r *recorder) execute(job Job) (json.RawMessage, error) {
+	request := ""
+	json.Unmarshal(job.Request, &request)
+
+	r.mutex.Lock()
+	if r.running[job.Key] {
+		r.t.Errorf("jobs of %s run at the same time", job.Key)
+	}
+	r.running[job.Key] = true
+	r.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.running[job.Key] = false
+
+	if r.failures[request] > 0 {
+		r.failures[request]--
+		return nil, fmt.Errorf("%s failed", request)
+	}
+
+	r.runs[job.Key] = append(r.runs[job.Key], request)
+	return json.RawMessage(`"done ` + request + `"`), nil
+}
+
+func newTestQueue(store Store, r *recorder) *Queue {
+	q := NewQueue(store, r.execute)
+	q.MaxAttempts = 3
+	q.Backoff = func(int) time.Duration { return time.Millisecond }
+	q.Retention = 0
+	return q
+}
+
+func TestQueueOrder(t *testing.T) {
+	r := newRecorder(t)
+	q := newTestQueue(NewMemoryStore(), r)
+	r.failures["a1"] = 2
+
+	for i := 1; i <= 5; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			_, err := q.Enqueue("flyvo", key, KindPatch, fmt.Sprintf("%s%d", key, i))
+			if err != nil {
+				t.Fatalf("enqueue failed: %v", err)
+			}
+		}
+	}
+	q.Wait()
+
+	for _, key := range []string{"a", "b", "c"} {
+		want := fmt.Sprintf("[%s1 %s2 %s3 %s4 %s5]", key, key, key, key, key)
+		if got := fmt.Sprint(r.runs[key]); got != want {
+			t.Errorf("%s: got %s, want %s", key, got, want)
+		}
+	}
+}
+
+func TestQueueRetry(t *testing.T) {
+	r := newRecorder(t)
+	q := newTestQueue(NewMemoryStore(), r)
+	r.failures["retried"] = 2
+	r.failures["dead"] = 4
+
+	retried, _ := q.Enqueue("flyvo", "a", KindCreate, "retried")
+	dead, _ := q.Enqueue("flyvo", "", KindDelete, "dead")
+	q.Wait()
+
+	job, err := q.Get(retried.ID)
+	if err != nil || job.Status != StatusSucceeded || job.Attempts != 3 ||
+		string(job.Result) != `"done retried"` || job.LastError != "" {
+		t.Errorf("expected success on third attempt, got %+v %v", job, err)
+	}
+
+	job, _ = q.Get(dead.ID)
+	if job.Key != dead.ID || job.Status != StatusFailed || job.Attempts != 3 || job.LastError != "dead failed" {
+		t.Errorf("expected dead letter after 3 attempts, got %+v", job)
+	}
+
+	if _, err := q.Retry(retried.ID); err != ErrorNotFailed {
+		t.Errorf("retry of succeeded job: got %v", err)
+	}
+
+	job, err = q.Retry(dead.ID)
+	if err != nil || job.Status != StatusQueued || job.Attempts != 0 {
+		t.Fatalf("retry failed: %+v %v", job, err)
+	}
+	q.Wait()
+
+	if job, _ = q.Get(dead.ID); job.Status != StatusSucceeded || job.Attempts != 2 {
+		t.Errorf("expected success after retry, got %+v", job)
+	}
+
+	if _, err := q.Get("unknown"); err != ErrorUnknownJob {
+		t.Errorf("unknown job: got %v", err)
+	}
+}
+
+func TestQueueNotRetryable(t *testing.T) {
+	r := newRecorder(t)
+	q := newTestQueue(NewMemoryStore(), r)
+	q.Retryable = func(error) bool { return false }
+	r.failures["bad"] = 1
+
+	bad, _ := q.Enqueue("flyvo", "a", KindUpdate, "bad")
+	q.Wait()
+
+	if job, _ := q.Get(bad.ID); job.Status != StatusFailed || job.Attempts != 1 {
+		t.Errorf("expected failure without retries, got %+v", job)
+	}
+}
+
+func TestQueueRetention(t *testing.T) {
+	store := NewMemoryStore()
+	old := Job{
+		ID:      random.ID(),
+		Domain:  "flyvo",
+		Key:     "a",
+		Kind:    KindPatch,
+		Status:  StatusFailed,
+		Updated: time.Now().Add(-time.Hour),
+	}
+	store.Put(old)
+
+	q := newTestQueue(store, newRecorder(t))
+	q.Retention = 50 * time.Millisecond
+	err := q.Start()
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	done, _ := q.Enqueue("flyvo", "a", KindPatch, "done")
+	q.Wait()
+	if _, err := q.Get(done.ID); err != nil {
+		t.Errorf("expected finished job kept for retention, got %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	for _, id := range []string{old.ID, done.ID} {
+		if _, err := q.Get(id); err != ErrorUnknownJob {
+			t.Errorf("expected job %s removed after retention, got %v", id, err)
+		}
+	}
+}
+
+func TestQueueResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	//jobs left by a previous run, one interrupted while running
+	for i, status := range []Status{StatusSucceeded, StatusRunning, StatusQueued} {
+		request, _ := json.Marshal(fmt.Sprintf("r%d", i+1))
+		store.Put(Job{
+			ID:       random.ID(),
+			Sequence: int64(i + 1),
+			Domain:   "flyvo",
+			Key:      "a",
+			Kind:     KindPatch,
+			Request:  request,
+			Status:   status,
+		})
+	}
+
+	r := newRecorder(t)
+	q := newTestQueue(store, r)
+	err = q.Start()
+	if err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	added, _ := q.Enqueue("flyvo", "a", KindPatch, "r4")
+	q.Wait()
+
+	if got := fmt.Sprint(r.runs["a"]); got != "[r2 r3 r4]" {
+		t.Errorf("expected unfinished jobs run in order, got %s", got)
+	}
+
+	if added.Sequence != 4 {
+		t.Errorf("expected sequence to continue, got %d", added.Sequence)
+	}
+
+	jobs, err := store.List()
+	if err != nil || len(jobs) != 4 {
+		t.Fatalf("expected 4 stored jobs, got %d %v", len(jobs), err)
+	}
+
+	for _, job := range jobs {
+		if job.Status != StatusSucceeded {
+			t.Errorf("expected stored success, got %+v", job)
+		}
+	}
+
+	if _, err := store.Get("../jobs"); err != ErrorUnknownJob {
+		t.Errorf("expected invalid id to be unknown, got %v", err)
+	}
+}
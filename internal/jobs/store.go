@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//Store - where jobs are kept, so queued jobs survive restarts
+type Store interface {
+	Put(job Job) error
+	Get(id string) (Job, error)
+	Delete(id string) error
+
+	//List - all jobs, ordered by sequence
+	List() ([]Job, error)
+}
+
+//MemoryStore - jobs kept in memory, lost on restart
+type MemoryStore struct {
+	mutex sync.RWMutex
+	jobs  map[string]Job
+}
+
+//NewMemoryStore - empty store in memory
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}}
+}
+
+//Put - adds or replaces job
+func (s *MemoryStore) Put(job Job) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+//Get - job with id
+func (s *MemoryStore) Get(id string) (Job, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrorUnknownJob
+	}
+	return job, nil
+}
+
+//Delete - removes the job with id
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrorUnknownJob
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+//List - all jobs, ordered by sequence
+func (s *MemoryStore) List() ([]Job, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	jobs := []Job{}
+	for _, v := range s.jobs {
+		jobs = append(jobs, v)
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+//FileStore - jobs kept as json files in a directory, one per job.
+//Files are replaced by renaming, so a crash never leaves a partial job.
+type FileStore struct {
+	dir string
+}
+
+//OpenFileStore - store in dir, created if missing
+func OpenFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+//Put - adds or replaces job
+func (s *FileStore) Put(job Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(job.ID) + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(job.ID))
+}
+
+//Get - job with id
+func (s *FileStore) Get(id string) (Job, error) {
+	//ids are generated, so anything else can not be a job
+	if !isValidID(id) {
+		return Job{}, ErrorUnknownJob
+	}
+
+	b, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return Job{}, ErrorUnknownJob
+	} else if err != nil {
+		return Job{}, err
+	}
+
+	job := Job{}
+	err = json.Unmarshal(b, &job)
+	return job, err
+}
+
+//Delete - removes the job with id
+func (s *FileStore) Delete(id string) error {
+	if !isValidID(id) {
+		return ErrorUnknownJob
+	}
+
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrorUnknownJob
+	}
+	return err
+}
+
+//List - all jobs, ordered by sequence
+func (s *FileStore) List() ([]Job, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []Job{}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		job, err := s.Get(strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sortJobs(jobs)
+	return jobs, nil
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Sequence < jobs[j].Sequence
+	})
+}
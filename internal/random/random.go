@@ -0,0 +1,19 @@
+//Package random makes the ids of jobs, webhooks, requests and events
+//made by the service
+package random
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+//ID - random id of 32 hex digits. It is also a valid id of a google
+//event, as those may use the digits and the letters a to v.
+func ID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
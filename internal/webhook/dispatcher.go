@@ -0,0 +1,305 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tktip/google-calendar/internal/random"
+	"google.golang.org/api/calendar/v3"
+)
+
+//Status - state of a delivery
+type Status string
+
+//revive:disable
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed" //dead-lettered, may be replayed
+)
+
+//revive:enable
+
+//Delivery - a payload posted to one subscription. The id is kept
+//across retries and replays, so subscribers can drop duplicates.
+type Delivery struct {
+	ID             string          `json:"id"`
+	Domain         string          `json:"domain"`
+	SubscriptionID string          `json:"subscriptionId"`
+	Type           EventType       `json:"type"`
+	Status         Status          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError,omitempty"`
+	Created        time.Time       `json:"created"`
+	Updated        time.Time       `json:"updated"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+//ExponentialBackoff - delay doubling from base after each attempt, up to max
+func ExponentialBackoff(base time.Duration, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+//Dispatcher - posts signed payloads to the subscribers of a domain.
+//Failed deliveries are retried with backoff, and dead-lettered after
+//MaxAttempts, to be replayed once the subscriber is fixed.
+type Dispatcher struct {
+	Registry    *Registry
+	Client      *http.Client
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+
+	//number of deliveries kept for listing. Only delivered ones are
+	//removed, dead letters are kept until replayed.
+	History int
+
+	mutex      sync.Mutex
+	deliveries []*Delivery //oldest first
+	inflight   sync.WaitGroup
+}
+
+//NewDispatcher - dispatcher for the subscriptions of registry
+func NewDispatcher(registry *Registry) *Dispatcher {
+	return &Dispatcher{
+		Registry:    registry,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		Backoff:     ExponentialBackoff(10*time.Second, time.Hour),
+		History:     1000,
+	}
+}
+
+//DispatcherFromEnv creates a dispatcher configured by WEBHOOK_STORE (file
+//subscriptions are persisted to) and WEBHOOK_MAX_ATTEMPTS. Subscriptions
+//are only kept in memory if WEBHOOK_STORE is not set.
+func DispatcherFromEnv() (*Dispatcher, error) {
+	registry := NewRegistry()
+	if path := os.Getenv("WEBHOOK_STORE"); path != "" {
+		var err error
+		registry, err = LoadRegistry(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dispatcher := NewDispatcher(registry)
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		attempts, err := strconv.Atoi(v)
+		if err != nil || attempts < 1 {
+			return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be a positive number, got %q", v)
+		}
+		dispatcher.MaxAttempts = attempts
+	}
+	return dispatcher, nil
+}
+
+//Subscribed - whether any subscriber of domain is notified about t
+func (d *Dispatcher) Subscribed(domain string, t EventType) bool {
+	return len(d.Registry.subscribers(domain, t)) > 0
+}
+
+//Publish - notifies the subscribers of domain about a change. Delivery
+//happens in the background, so slow subscribers never delay requests.
+func (d *Dispatcher) Publish(
+	domain string,
+	t EventType,
+	calendarID string,
+	eventID string,
+	before *calendar.Event,
+	after *calendar.Event,
+) {
+	subs := d.Registry.subscribers(domain, t)
+	if len(subs) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	body, err := json.Marshal(Payload{
+		ID:         random.ID(),
+		Type:       t,
+		Domain:     domain,
+		CalendarID: calendarID,
+		EventID:    eventID,
+		Time:       now,
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		logrus.Warnf("Could not encode webhook payload: %v", err)
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, sub := range subs {
+		delivery := &Delivery{
+			ID:             random.ID(),
+			Domain:         domain,
+			SubscriptionID: sub.ID,
+			Type:           t,
+			Status:         StatusPending,
+			Created:        now,
+			Updated:        now,
+			Payload:        body,
+		}
+		d.deliveries = append(d.deliveries, delivery)
+		d.schedule(delivery, 0)
+	}
+	d.prune()
+}
+
+//Deliveries - recent deliveries of domain, oldest first. All statuses
+//are included if status is empty.
+func (d *Dispatcher) Deliveries(domain string, status Status) []Delivery {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	deliveries := []Delivery{}
+	for _, v := range d.deliveries {
+		if v.Domain == domain && (status == "" || v.Status == status) {
+			deliveries = append(deliveries, *v)
+		}
+	}
+	return deliveries
+}
+
+//Replay - delivers a dead-lettered delivery again, with a fresh set of
+//attempts. The subscription's current url and secret are used.
+func (d *Dispatcher) Replay(domain string, id string) (Delivery, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, v := range d.deliveries {
+		if v.Domain != domain || v.ID != id {
+			continue
+		}
+
+		if v.Status != StatusFailed {
+			return *v, ErrorNotDeadLetter
+		}
+
+		v.Status = StatusPending
+		v.Attempts = 0
+		v.Updated = time.Now().UTC()
+		d.schedule(v, 0)
+		return *v, nil
+	}
+	return Delivery{}, ErrorUnknownDelivery
+}
+
+//Wait - blocks until all deliveries are delivered or dead-lettered
+func (d *Dispatcher) Wait() {
+	d.inflight.Wait()
+}
+
+//schedule - attempts delivery after delay. Must hold mutex.
+func (d *Dispatcher) schedule(delivery *Delivery, delay time.Duration) {
+	d.inflight.Add(1)
+	if delay <= 0 {
+		go d.attempt(delivery)
+		return
+	}
+	time.AfterFunc(delay, func() { d.attempt(delivery) })
+}
+
+//attempt - posts delivery once, and schedules a retry on failure
+func (d *Dispatcher) attempt(delivery *Delivery) {
+	defer d.inflight.Done()
+
+	sub, ok := d.Registry.subscription(delivery.Domain, delivery.SubscriptionID)
+	err := ErrorUnknownSubscription
+	if ok {
+		err = d.post(sub, delivery)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delivery.Attempts++
+	delivery.Updated = time.Now().UTC()
+	if err == nil {
+		delivery.Status = StatusDelivered
+		delivery.LastError = ""
+		d.prune()
+		return
+	}
+
+	delivery.LastError = err.Error()
+
+	//retrying is pointless once the subscription is gone
+	if !ok || delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = StatusFailed
+		logrus.Warnf("Webhook delivery %s dead-lettered after %d attempts: %v",
+			delivery.ID, delivery.Attempts, err)
+		return
+	}
+	d.schedule(delivery, d.Backoff(delivery.Attempts))
+}
+
+//post - sends delivery to sub, signed with its secret
+func (d *Dispatcher) post(sub Subscription, delivery *Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, delivery.ID)
+	req.Header.Set(HeaderEvent, string(delivery.Type))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	//drained, so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+	return nil
+}
+
+//prune - drops the oldest delivered deliveries beyond History. Must
+//hold mutex.
+func (d *Dispatcher) prune() {
+	excess := len(d.deliveries) - d.History
+	if excess <= 0 {
+		return
+	}
+
+	kept := []*Delivery{}
+	for _, v := range d.deliveries {
+		if excess > 0 && v.Status == StatusDelivered {
+			excess--
+			continue
+		}
+		kept = append(kept, v)
+	}
+	d.deliveries = kept
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tktip/google-calendar/internal/random"
+)
+
+//Registry - webhook subscriptions by domain. Optionally persisted to a
+//json file, so subscriptions survive restarts.
+type Registry struct {
+	path string
+
+	mutex         sync.RWMutex
+	subscriptions map[string][]Subscription
+}
+
+//NewRegistry - registry kept in memory only
+func NewRegistry() *Registry {
+	return &Registry{subscriptions: map[string][]Subscription{}}
+}
+
+//LoadRegistry - registry persisted to path. A missing file is an empty
+//registry, created on the first subscription.
+func LoadRegistry(path string) (*Registry, error) {
+	r := NewRegistry()
+	r.path = path
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &r.subscriptions)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//save - writes the registry to its file, if any. Written to a temporary
+//file first, so a failed write does not lose the old subscriptions.
+func (r *Registry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(r.subscriptions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func isValidURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+//Subscribe - adds a subscription to domain. A secret is generated if
+//none is given. Returns the subscription, including its secret.
+func (r *Registry) Subscribe(domain string, sub Subscription) (Subscription, error) {
+	if !isValidURL(sub.URL) {
+		return Subscription{}, ErrorBadURL
+	}
+
+	for _, t := range sub.Events {
+		if !isValidEventType(t) {
+			return Subscription{}, ErrorBadEventType
+		}
+	}
+
+	sub.ID = random.ID()
+	if sub.Secret == "" {
+		sub.Secret = random.ID() + random.ID()
+	}
+	sub.Created = time.Now().UTC()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	old := r.subscriptions[domain]
+	r.subscriptions[domain] = append(append([]Subscription{}, old...), sub)
+
+	err := r.save()
+	if err != nil {
+		r.subscriptions[domain] = old
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+//Unsubscribe - removes subscription with id from domain
+func (r *Registry) Unsubscribe(domain string, id string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	old := r.subscriptions[domain]
+	kept := []Subscription{}
+	for _, v := range old {
+		if v.ID != id {
+			kept = append(kept, v)
+		}
+	}
+
+	if len(kept) == len(old) {
+		return ErrorUnknownSubscription
+	}
+
+	r.subscriptions[domain] = kept
+	err := r.save()
+	if err != nil {
+		r.subscriptions[domain] = old
+	}
+	return err
+}
+
+//Subscriptions - subscriptions of domain, without their secrets
+func (r *Registry) Subscriptions(domain string) []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	subs := []Subscription{}
+	for _, v := range r.subscriptions[domain] {
+		v.Secret = ""
+		subs = append(subs, v)
+	}
+	return subs
+}
+
+//subscription - subscription with id, including its secret
+func (r *Registry) subscription(domain string, id string) (Subscription, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, v := range r.subscriptions[domain] {
+		if v.ID == id {
+			return v, true
+		}
+	}
+	return Subscription{}, false
+}
+
+//subscribers - subscriptions of domain notified about t
+func (r *Registry) subscribers(domain string, t EventType) []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	subs := []Subscription{}
+	for _, v := range r.subscriptions[domain] {
+		if v.wants(t) {
+			subs = append(subs, v)
+		}
+	}
+	return subs
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+//EventType - kind of change subscribers are notified about
+type EventType string
+
+//revive:disable
+const (
+	EventCreated             EventType = "event.created"
+	EventUpdated             EventType = "event.updated"
+	EventPatched             EventType = "event.patched"
+	EventDeleted             EventType = "event.deleted"
+	EventParticipantsAdded   EventType = "event.participants_added"
+	EventParticipantsRemoved EventType = "event.participants_removed"
+)
+
+var (
+	ErrorBadURL              = fmt.Errorf("webhook url invalid, must be an absolute http or https url")
+	ErrorBadEventType        = fmt.Errorf("webhook event type invalid, must be one of event.created, event.updated, event.patched, event.deleted, event.participants_added or event.participants_removed")
+	ErrorUnknownSubscription = fmt.Errorf("webhook subscription not found")
+	ErrorUnknownDelivery     = fmt.Errorf("webhook delivery not found")
+	ErrorNotDeadLetter       = fmt.Errorf("webhook delivery is not dead-lettered, only failed deliveries can be replayed")
+)
+
+//revive:enable
+
+//Headers of a delivery
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+//EventTypes - all event types subscribers can filter on
+var EventTypes = []EventType{
+	EventCreated,
+	EventUpdated,
+	EventPatched,
+	EventDeleted,
+	EventParticipantsAdded,
+	EventParticipantsRemoved,
+}
+
+func isValidEventType(t EventType) bool {
+	for _, v := range EventTypes {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+//Subscription - an url notified of event changes in a domain
+type Subscription struct {
+	ID     string      `json:"id"`
+	URL    string      `json:"url"`
+	Secret string      `json:"secret,omitempty"`
+	Events []EventType `json:"events,omitempty"` //all events if empty
+
+	Created time.Time `json:"created"`
+}
+
+//wants - whether the subscription is notified about t
+func (s Subscription) wants(t EventType) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+
+	for _, v := range s.Events {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+//Payload - body posted to subscribers. Before is null for created
+//events, and After is null for deleted events.
+type Payload struct {
+	ID         string          `json:"id"`
+	Type       EventType       `json:"type"`
+	Domain     string          `json:"domain"`
+	CalendarID string          `json:"calendarId"`
+	EventID    string          `json:"eventId"`
+	Time       time.Time       `json:"time"`
+	Before     *calendar.Event `json:"before"`
+	After      *calendar.Event `json:"after"`
+}
+
+//Sign - signature of a delivery, hex encoded HMAC-SHA256 of the
+//timestamp and body joined by a dot, keyed with the subscription secret
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Verify - whether signature is a valid signature of the delivery. For
+//use by receivers, which should also reject old timestamps.
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
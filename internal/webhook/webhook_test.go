@@ -0,0 +1,278 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+//receiver - subscriber failing the first failures requests
+type receiver struct {
+	t        *testing.T
+	secret   string
+	failures int
+
+	mutex    sync.Mutex
+	requests int
+	payloads []Payload
+	ids      []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if !Verify(rc.secret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+		rc.t.Errorf("bad signature %q", r.Header.Get(HeaderSignature))
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.requests++
+	if rc.requests <= rc.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	payload := Payload{}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		rc.t.Errorf("bad payload %s: %v", body, err)
+	}
+
+	if r.Header.Get(HeaderEvent) != string(payload.Type) {
+		rc.t.Errorf("event header %q, payload type %q", r.Header.Get(HeaderEvent), payload.Type)
+	}
+
+	rc.payloads = append(rc.payloads, payload)
+	rc.ids = append(rc.ids, r.Header.Get(HeaderID))
+}
+
+//newDispatcher - dispatcher retrying without delay, subscribing rc to domain
+func newDispatcher(t *testing.T, rc *receiver, events ...EventType) (*Dispatcher, func()) {
+	server := httptest.NewServer(rc)
+
+	d := NewDispatcher(NewRegistry())
+	d.MaxAttempts = 3
+	d.Backoff = func(int) time.Duration { return time.Millisecond }
+
+	sub, err := d.Registry.Subscribe("flyvo", Subscription{
+		URL: server.URL, Secret: rc.secret, Events: events,
+	})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	if sub.ID == "" || sub.Secret != rc.secret {
+		t.Fatalf("expected id and secret, got %+v", sub)
+	}
+	return d, server.Close
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	signature := Sign("secret", "1577836800", body)
+
+	if !Verify("secret", "1577836800", body, signature) {
+		t.Errorf("signature not verified")
+	}
+
+	if Verify("other", "1577836800", body, signature) ||
+		Verify("secret", "1577836801", body, signature) ||
+		Verify("secret", "1577836800", []byte(`{"id":"2"}`), signature) {
+		t.Errorf("signature verified for other secret, timestamp or body")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	rc := &receiver{t: t, secret: "secret"}
+	d, stop := newDispatcher(t, rc, EventPatched)
+	defer stop()
+
+	before := &calendar.Event{Id: "abcde", Summary: "Before"}
+	after := &calendar.Event{Id: "abcde", Summary: "After"}
+
+	if d.Subscribed("flyvo", EventCreated) || d.Subscribed("other", EventPatched) {
+		t.Errorf("subscribed to other event or domain")
+	}
+
+	d.Publish("flyvo", EventCreated, "primary", "abcde", nil, after)
+	d.Publish("other", EventPatched, "primary", "abcde", before, after)
+	d.Publish("flyvo", EventPatched, "primary", "abcde", before, after)
+	d.Wait()
+
+	if len(rc.payloads) != 1 {
+		t.Fatalf("expected only the patch, got %+v", rc.payloads)
+	}
+
+	payload := rc.payloads[0]
+	if payload.Type != EventPatched || payload.Domain != "flyvo" || payload.CalendarID != "primary" ||
+		payload.EventID != "abcde" || payload.ID == "" {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	if payload.Before.Summary != "Before" || payload.After.Summary != "After" {
+		t.Errorf("expected snapshots, got %+v and %+v", payload.Before, payload.After)
+	}
+
+	deliveries := d.Deliveries("flyvo", StatusDelivered)
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].ID != rc.ids[0] {
+		t.Errorf("expected delivery after 1 attempt, got %+v", deliveries)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	rc := &receiver{t: t, secret: "secret", failures: 2}
+	d, stop := newDispatcher(t, rc)
+	defer stop()
+
+	d.Publish("flyvo", EventDeleted, "primary", "abcde", &calendar.Event{Id: "abcde"}, nil)
+	d.Wait()
+
+	if rc.requests != 3 || len(rc.payloads) != 1 || rc.payloads[0].After != nil {
+		t.Fatalf("expected delivery on third attempt, got %d requests", rc.requests)
+	}
+
+	deliveries := d.Deliveries("flyvo", "")
+	if len(deliveries) != 1 || deliveries[0].Status != StatusDelivered ||
+		deliveries[0].Attempts != 3 || deliveries[0].LastError != "" {
+		t.Errorf("unexpected deliveries %+v", deliveries)
+	}
+}
+
+func TestDeadLetterAndReplay(t *testing.T) {
+	rc := &receiver{t: t, secret: "secret", failures: 3}
+	d, stop := newDispatcher(t, rc)
+	defer stop()
+
+	d.Publish("flyvo", EventCreated, "primary", "abcde", nil, &calendar.Event{Id: "abcde"})
+	d.Wait()
+
+	dead := d.Deliveries("flyvo", StatusFailed)
+	if len(dead) != 1 || dead[0].Attempts != 3 || dead[0].LastError == "" {
+		t.Fatalf("expected dead letter after 3 attempts, got %+v", dead)
+	}
+
+	if _, err := d.Replay("other", dead[0].ID); err != ErrorUnknownDelivery {
+		t.Errorf("replay in other domain: got %v", err)
+	}
+
+	replayed, err := d.Replay("flyvo", dead[0].ID)
+	if err != nil || replayed.Status != StatusPending {
+		t.Fatalf("replay failed: %v %+v", err, replayed)
+	}
+	d.Wait()
+
+	if len(rc.payloads) != 1 || rc.ids[0] != dead[0].ID {
+		t.Fatalf("expected replayed delivery, got %v", rc.ids)
+	}
+
+	if _, err := d.Replay("flyvo", dead[0].ID); err != ErrorNotDeadLetter {
+		t.Errorf("replay of delivered: got %v", err)
+	}
+}
+
+func TestUnsubscribedDeadLetters(t *testing.T) {
+	rc := &receiver{t: t, secret: "secret", failures: 1}
+	d, stop := newDispatcher(t, rc)
+	defer stop()
+
+	d.Backoff = func(int) time.Duration { return 50 * time.Millisecond }
+	d.Publish("flyvo", EventCreated, "primary", "abcde", nil, &calendar.Event{Id: "abcde"})
+
+	sub := d.Registry.Subscriptions("flyvo")[0]
+	if sub.Secret != "" {
+		t.Errorf("secret listed")
+	}
+
+	err := d.Registry.Unsubscribe("flyvo", sub.ID)
+	if err != nil {
+		t.Fatalf("unsubscribe failed: %v", err)
+	}
+	d.Wait()
+
+	dead := d.Deliveries("flyvo", StatusFailed)
+	if len(dead) != 1 || dead[0].LastError != ErrorUnknownSubscription.Error() {
+		t.Errorf("expected dead letter without retries, got %+v", dead)
+	}
+
+	if err := d.Registry.Unsubscribe("flyvo", sub.ID); err != ErrorUnknownSubscription {
+		t.Errorf("second unsubscribe: got %v", err)
+	}
+}
+
+func TestSubscribeValidation(t *testing.T) {
+	r := NewRegistry()
+	tests := []struct {
+		sub Subscription
+		err error
+	}{
+		{Subscription{URL: "https://example.com/hook"}, nil},
+		{Subscription{URL: "http://localhost:8080", Events: []EventType{EventDeleted}}, nil},
+		{Subscription{URL: ""}, ErrorBadURL},
+		{Subscription{URL: "/hook"}, ErrorBadURL},
+		{Subscription{URL: "ftp://example.com"}, ErrorBadURL},
+		{Subscription{URL: "https://example.com", Events: []EventType{"event.moved"}}, ErrorBadEventType},
+	}
+
+	for _, test := range tests {
+		sub, err := r.Subscribe("flyvo", test.sub)
+		if err != test.err {
+			t.Errorf("%+v: got %v, want %v", test.sub, err, test.err)
+		}
+
+		if err == nil && len(sub.Secret) != 64 {
+			t.Errorf("expected generated secret, got %q", sub.Secret)
+		}
+	}
+
+	if subs := r.Subscriptions("flyvo"); len(subs) != 2 {
+		t.Errorf("expected 2 subscriptions, got %+v", subs)
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "webhooks.json")
+
+	r, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+
+	sub, err := r.Subscribe("flyvo", Subscription{URL: "https://example.com/hook", Secret: "s"})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	loaded, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	stored, ok := loaded.subscription("flyvo", sub.ID)
+	if !ok || stored.URL != sub.URL || stored.Secret != "s" {
+		t.Errorf("subscription not stored, got %+v", stored)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, 5*time.Second)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, v := range want {
+		if got := backoff(i + 1); got != v {
+			t.Errorf("attempt %d: got %v, want %v", i+1, got, v)
+		}
+	}
+}
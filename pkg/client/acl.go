@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+)
+
+//ListACL returns the access rules of a calendar, or primary
+func (c *Client) ListACL(ctx context.Context, calendarID string) ([]global.ACLRule, error) {
+	rules := []global.ACLRule{}
+	err := c.call(ctx, newRequest(http.MethodGet, "acl", calendarID, "list"), "rules", &rules)
+	return rules, err
+}
+
+//InsertACL adds an access rule to a calendar, returning its id
+func (c *Client) InsertACL(
+	ctx context.Context,
+	calendarID string,
+	rule global.ACLRule,
+	opts WriteOptions,
+) (string, error) {
+	r, err := jsonRequest(http.MethodPost, rule, "acl", calendarID, "insert")
+	if err != nil {
+		return "", err
+	}
+	r.query = opts.query()
+
+	id := ""
+	err = c.call(ctx, r, "id", &id)
+	return id, err
+}
+
+//PatchACL sets the fields set on rule, of the rule with ruleID
+func (c *Client) PatchACL(
+	ctx context.Context,
+	calendarID string,
+	ruleID string,
+	rule global.ACLRule,
+	opts WriteOptions,
+) error {
+	r, err := jsonRequest(http.MethodPatch, rule, "acl", calendarID, "patch", ruleID)
+	if err != nil {
+		return err
+	}
+	r.query = opts.query()
+	return c.call(ctx, r, "", nil)
+}
+
+//DeleteACL removes the rule with ruleID from a calendar
+func (c *Client) DeleteACL(ctx context.Context, calendarID string, ruleID string) error {
+	return c.call(ctx, newRequest(http.MethodDelete, "acl", calendarID, "delete", ruleID), "", nil)
+}
+
+//SyncACL makes rules the access rules of a calendar, inserting, updating
+//and deleting rules as needed
+func (c *Client) SyncACL(
+	ctx context.Context,
+	calendarID string,
+	rules []global.ACLRule,
+	opts WriteOptions,
+) (*global.ACLSyncResult, error) {
+	r, err := jsonRequest(http.MethodPut, rules, "acl", calendarID, "sync")
+	if err != nil {
+		return nil, err
+	}
+	r.query = opts.query()
+
+	result := &global.ACLSyncResult{}
+	err = c.call(ctx, r, "result", result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+//AuditEntry - a mutation logged by the service, or a request to make one
+type AuditEntry struct {
+	Time       time.Time     `json:"time"`
+	RequestID  string        `json:"requestId"`
+	Identity   string        `json:"identity,omitempty"`
+	RemoteAddr string        `json:"remoteAddr,omitempty"`
+	Method     string        `json:"method,omitempty"`
+	Path       string        `json:"path,omitempty"`
+	Domain     string        `json:"domain"`
+	CalendarID string        `json:"calendarId,omitempty"`
+	EventID    string        `json:"eventId,omitempty"`
+	Operation  string        `json:"operation"`
+	Status     int           `json:"status,omitempty"`
+	Changes    []FieldChange `json:"changes,omitempty"`
+}
+
+//AuditFilter - entries of the audit log returned, all fields optional
+type AuditFilter struct {
+	EventID   string
+	Identity  string
+	Operation string //i.e. event.patched
+	Since     time.Time
+	Until     time.Time
+	Limit     int //only the newest entries
+}
+
+//QueryAudit returns the entries of the audit log matching filter,
+//oldest first
+func (c *Client) QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := url.Values{}
+	values := map[string]string{
+		"eventId":   filter.EventID,
+		"identity":  filter.Identity,
+		"operation": filter.Operation,
+	}
+	for k, v := range values {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	entries := []AuditEntry{}
+	r := newRequest(http.MethodGet, "audit")
+	r.query = query
+	err := c.call(ctx, r, "entries", &entries)
+	return entries, err
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+//Auth - authorizes requests, i.e. for a proxy in front of the service
+type Auth interface {
+	Authorize(req *http.Request) error
+}
+
+//AuthFunc - a func as an Auth
+type AuthFunc func(req *http.Request) error
+
+//Authorize - calls f
+func (f AuthFunc) Authorize(req *http.Request) error {
+	return f(req)
+}
+
+//BearerToken - authorizes requests with a static token
+func BearerToken(token string) Auth {
+	return Header("Authorization", "Bearer "+token)
+}
+
+//Header - authorizes requests with a header, i.e. an api key
+func Header(name string, value string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set(name, value)
+		return nil
+	})
+}
+
+//TokenSource - authorizes requests with tokens of source, refreshed
+//when they expire
+func TokenSource(source oauth2.TokenSource) Auth {
+	source = oauth2.ReuseTokenSource(nil, source)
+	return AuthFunc(func(req *http.Request) error {
+		token, err := source.Token()
+		if err != nil {
+			return err
+		}
+		token.SetAuthHeader(req)
+		return nil
+	})
+}
@@ -0,0 +1,223 @@
+//Package client is a client of the google-calendar service, for the
+//endpoints of a domain. Events are read and written as global.Event.
+package client
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+//Client - client of the endpoints of a domain. Fields may be changed
+//before the first request.
+type Client struct {
+	BaseURL    string //of the service, i.e. http://localhost:5555
+	Domain     string
+	HTTPClient *http.Client
+	Auth       Auth //nil if requests are not authorized
+
+	//attempts of idempotent requests (GET, PUT and DELETE) failing with
+	//a temporary error, see Error.Temporary
+	MaxAttempts int
+	Backoff     func(attempt int) time.Duration
+}
+
+//New - client of the endpoints of domain, of the service at baseURL
+func New(baseURL string, domain string) *Client {
+	return &Client{
+		BaseURL:     strings.TrimSuffix(baseURL, "/"),
+		Domain:      domain,
+		HTTPClient:  http.DefaultClient,
+		MaxAttempts: 3,
+		Backoff:     ExponentialBackoff(200*time.Millisecond, 5*time.Second),
+	}
+}
+
+//ExponentialBackoff - delay doubling from base after each attempt, up to max
+func ExponentialBackoff(base time.Duration, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+
+		if delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+//idempotent - methods safe to retry
+var idempotent = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
+
+//request - a request to an endpoint of the domain
+type request struct {
+	method      string
+	path        []string //segments after the domain, escaped when sent
+	query       url.Values
+	body        []byte
+	contentType string
+}
+
+//newRequest - request without body
+func newRequest(method string, path ...string) request {
+	return request{method: method, path: path}
+}
+
+//jsonRequest - request with v as json body
+func jsonRequest(method string, v interface{}, path ...string) (request, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, body: body, contentType: "application/json"}, nil
+}
+
+//url - url of the request
+func (c *Client) url(r request) string {
+	segments := []string{c.BaseURL, url.PathEscape(c.Domain)}
+	for _, v := range r.path {
+		segments = append(segments, url.PathEscape(v))
+	}
+
+	u := strings.Join(segments, "/")
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	return u
+}
+
+//do - sends r, retrying temporary failures of idempotent requests.
+//Returns the body of a 2xx response, or an *Error.
+func (c *Client) do(ctx context.Context, r request) ([]byte, error) {
+	requestID := newRequestID()
+	for attempt := 1; ; attempt++ {
+		body, retryAfter, err := c.send(ctx, r, requestID)
+		if err == nil {
+			return body, nil
+		}
+
+		if !idempotent[r.method] || attempt >= c.MaxAttempts || !temporary(err) {
+			return nil, err
+		}
+
+		wait := c.Backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+//send - sends r once, returning the delay asked for by Retry-After
+func (c *Client) send(ctx context.Context, r request, requestID string) (
+	[]byte,
+	time.Duration,
+	error,
+) {
+	req, err := http.NewRequest(r.method, c.url(r), bytes.NewReader(r.body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Request-Id", requestID)
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+
+	if c.Auth != nil {
+		err = c.Auth.Authorize(req)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, &Error{Message: err.Error(), RequestID: requestID}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return nil, 0, &Error{StatusCode: resp.StatusCode, Message: err.Error(), RequestID: requestID}
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retryAfter := time.Duration(0)
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, retryAfter, newError(resp, body, requestID)
+	}
+	return body, 0, nil
+}
+
+//maxBody limits the size of responses read
+const maxBody = 64 << 20
+
+//call - sends r, decoding the field key of the response into v, unless
+//v is nil
+func (c *Client) call(ctx context.Context, r request, key string, v interface{}) error {
+	body, err := c.do(ctx, r)
+	if err != nil || v == nil {
+		return err
+	}
+	return decode(body, key, v)
+}
+
+//decode - decodes the field key of the envelope in body into v
+func decode(body []byte, key string, v interface{}) error {
+	envelope := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &envelope)
+	if err != nil {
+		return fmt.Errorf("bad response: %v", err)
+	}
+
+	if field, ok := envelope[key]; ok {
+		return json.Unmarshal(field, v)
+	}
+	return nil
+}
+
+//newRequestID - id of a call, sent with each attempt so they can be
+//found in the audit log. Made like internal/random's, as the packages of
+//pkg import nothing internal, keeping them usable apart from the service.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+//boolString - query value of b
+func boolString(b bool) string {
+	return strconv.FormatBool(b)
+}
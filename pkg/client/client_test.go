@@ -0,0 +1,206 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tktip/google-calendar/internal/api"
+	"github.com/tktip/google-calendar/internal/backend"
+	"github.com/tktip/google-calendar/internal/googlecal"
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+//newService - the api, serving domain flyvo from memory
+func newService() *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	googlecal.UseBackend("flyvo", backend.NewMemory("calendar@example.com"))
+	return httptest.NewServer(api.Handler())
+}
+
+func TestEvents(t *testing.T) {
+	service := newService()
+	defer service.Close()
+
+	ctx := context.Background()
+	c := New(service.URL, "flyvo")
+
+	created, err := c.CreateEvent(ctx, global.Event{
+		Title:              str("Meeting"),
+		Start:              str("2020-01-06T09:00:00+01:00"),
+		End:                str("2020-01-06T10:00:00+01:00"),
+		Participants:       &[]global.Participant{{Email: "a@example.com"}},
+		ExtendedProperties: &global.ExtendedProperties{Private: &map[string]string{"courseId": "42"}},
+	}, WriteOptions{})
+	if err != nil || created.ID == "" {
+		t.Fatalf("create failed: %+v %v", created, err)
+	}
+
+	preview, err := c.PatchEvent(ctx, global.Event{ID: &created.ID, Location: str("Room 1")}, WriteOptions{DryRun: true})
+	if err != nil || preview.Preview == nil || len(preview.Preview.Diff) != 1 {
+		t.Fatalf("dry run failed: %+v %v", preview, err)
+	}
+
+	_, err = c.PatchEvent(ctx, global.Event{ID: &created.ID, Location: str("Room 2")}, WriteOptions{})
+	if err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	_, err = c.AddParticipants(ctx, created.ID, []global.Participant{{Email: "b@example.com"}}, WriteOptions{})
+	if err != nil {
+		t.Fatalf("add participants failed: %v", err)
+	}
+
+	event, err := c.GetEvent(ctx, created.ID)
+	if err != nil || *event.Location != "Room 2" || len(*event.Participants) != 2 || event.ETag == nil {
+		t.Fatalf("unexpected event %+v %v", event, err)
+	}
+
+	events, err := c.ListEvents(ctx, ListOptions{
+		TimeMin:                   "2020-01-06T00:00:00Z",
+		Attendee:                  "b@example.com",
+		PrivateExtendedProperties: []string{"courseId=42"},
+	})
+	if err != nil || len(events) != 1 || *events[0].ID != created.ID {
+		t.Errorf("unexpected list %+v %v", events, err)
+	}
+
+	events, err = c.FindEventsByExternalID(ctx, "courseId", "42")
+	if err != nil || len(events) != 1 {
+		t.Errorf("unexpected events by external id %+v %v", events, err)
+	}
+
+	ics, err := c.GetEventICS(ctx, created.ID)
+	if err != nil || !strings.Contains(string(ics), "SUMMARY:Meeting") {
+		t.Errorf("unexpected iCalendar event %s %v", ics, err)
+	}
+
+	queued, err := c.DeleteEvent(ctx, created.ID, WriteOptions{Async: true})
+	if err != nil || queued.Job == nil {
+		t.Fatalf("async delete failed: %+v %v", queued, err)
+	}
+
+	job, err := c.WaitJob(ctx, queued.Job.ID, 10*time.Millisecond)
+	if err != nil || job.Status != "succeeded" {
+		t.Errorf("expected job to succeed, got %+v %v", job, err)
+	}
+
+	_, err = c.GetEvent(ctx, "unknown0")
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusNotFound || e.Message == "" || e.RequestID == "" {
+		t.Errorf("expected error of unknown event, got %#v", err)
+	}
+
+	_, err = c.CreateEvent(ctx, global.Event{Title: str("No time")}, WriteOptions{})
+	if !IsStatus(err, http.StatusBadRequest) {
+		t.Errorf("expected bad request, got %v", err)
+	}
+}
+
+func TestAdministration(t *testing.T) {
+	service := newService()
+	defer service.Close()
+
+	ctx := context.Background()
+	c := New(service.URL, "flyvo")
+
+	id, err := c.InsertACL(ctx, "primary", global.ACLRule{
+		Role:       str("reader"),
+		ScopeType:  str("user"),
+		ScopeValue: str("a@example.com"),
+	}, WriteOptions{})
+	if err != nil || id == "" {
+		t.Fatalf("insert acl failed: %q %v", id, err)
+	}
+
+	rules, err := c.ListACL(ctx, "primary")
+	if err != nil || len(rules) == 0 {
+		t.Errorf("unexpected rules %+v %v", rules, err)
+	}
+
+	err = c.DeleteACL(ctx, "primary", id)
+	if err != nil {
+		t.Errorf("delete acl failed: %v", err)
+	}
+
+	webhook, err := c.AddWebhook(ctx, Webhook{URL: "https://example.com/hook", Events: []string{"event.created"}})
+	if err != nil || webhook.ID == "" || webhook.Secret == "" {
+		t.Fatalf("add webhook failed: %+v %v", webhook, err)
+	}
+
+	webhooks, err := c.ListWebhooks(ctx)
+	if err != nil || len(webhooks) != 1 || webhooks[0].Secret != "" {
+		t.Errorf("unexpected webhooks %+v %v", webhooks, err)
+	}
+
+	err = c.DeleteWebhook(ctx, webhook.ID)
+	if err != nil {
+		t.Errorf("delete webhook failed: %v", err)
+	}
+
+	_, err = c.QueryAudit(ctx, AuditFilter{Limit: 10})
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusBadRequest ||
+		e.Message != "audit log is not written to file" {
+		t.Errorf("expected error of envelope, got %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	attempts := 0
+	requestIDs := map[string]bool{}
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		requestIDs[r.Header.Get("X-Request-Id")] = true
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"event": null, "error": "backend unavailable"}`))
+			return
+		}
+		w.Write([]byte(`{"event": {"id": "abc", "title": "Meeting"}, "error": null}`))
+	}))
+	defer service.Close()
+
+	ctx := context.Background()
+	c := New(service.URL, "flyvo")
+	c.Backoff = func(int) time.Duration { return time.Millisecond }
+
+	_, err := c.GetEvent(ctx, "abc")
+	if !IsStatus(err, http.StatusUnauthorized) || attempts != 1 {
+		t.Errorf("expected unauthorized without retries, got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	requestIDs = map[string]bool{}
+	c.Auth = BearerToken("secret")
+	event, err := c.GetEvent(ctx, "abc")
+	if err != nil || *event.Title != "Meeting" || attempts != 3 || len(requestIDs) != 1 {
+		t.Errorf("expected event after 3 attempts of one request, got %v after %d", err, attempts)
+	}
+
+	attempts = 0
+	_, err = c.CreateEvent(ctx, global.Event{}, WriteOptions{})
+	if e, ok := err.(*Error); !ok || !e.Temporary() || e.Message != "backend unavailable" || attempts != 1 {
+		t.Errorf("expected create not retried, got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	c.Backoff = func(int) time.Duration { return time.Hour }
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = c.GetEvent(ctx, "abc")
+	if err != context.DeadlineExceeded || attempts != 1 {
+		t.Errorf("expected wait for retry to end with context, got %v after %d attempts", err, attempts)
+	}
+}
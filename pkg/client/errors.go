@@ -0,0 +1,67 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+//Error - a failed request. The message is the error of the response
+//envelope ({"error": "..."}), or the body if it has none.
+type Error struct {
+	StatusCode int //0 if no response was received
+	Message    string
+	RequestID  string //X-Request-Id of the request, i.e. for the audit log
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return "google-calendar: " + e.Message
+	}
+	return "google-calendar: " + http.StatusText(e.StatusCode) + ": " + e.Message
+}
+
+//Temporary - whether the request may succeed if sent again: when no
+//response was received, or google is unavailable or rate limiting
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case 0, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+//temporary - whether err is a temporary *Error
+func temporary(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Temporary()
+}
+
+//IsStatus - whether err is an *Error with status code
+func IsStatus(err error, code int) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == code
+}
+
+//newError - error of a response with body
+func newError(resp *http.Response, body []byte, requestID string) *Error {
+	if id := resp.Header.Get("X-Request-Id"); id != "" {
+		requestID = id
+	}
+
+	e := &Error{StatusCode: resp.StatusCode, RequestID: requestID}
+	envelope := struct {
+		Error *string `json:"error"`
+	}{}
+	if json.Unmarshal(body, &envelope) == nil && envelope.Error != nil {
+		e.Message = *envelope.Error
+		return e
+	}
+
+	e.Message = strings.TrimSpace(string(body))
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
@@ -0,0 +1,352 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	global "github.com/tktip/google-calendar/pkg/googlecal"
+	"golang.org/x/net/context"
+)
+
+//WriteOptions - settings of event writes, the query params of the
+//endpoints. Not all endpoints use all of them.
+type WriteOptions struct {
+	global.CommandOptions
+	Async  bool //queue the write, see WriteResult.Job
+	DryRun bool //only return the write that would be made, see WriteResult.Preview
+}
+
+//query - the options as query params
+func (o WriteOptions) query() url.Values {
+	query := url.Values{}
+	flags := map[string]*bool{
+		"broadcastChanges": o.BroadcastChanges,
+		"guestsCanModify":  o.GuestsCanModify,
+		"guestsMayInvite":  o.GuestsMayInvite,
+		"guestsVisible":    o.GuestsVisible,
+		"guestsAutoAccept": o.GuestsAutoAccept,
+		"privateEvent":     o.PrivateEvent,
+	}
+	for k, v := range flags {
+		if v != nil {
+			query.Set(k, boolString(*v))
+		}
+	}
+
+	if o.SendInvitations {
+		query.Set("sendInvitations", "true")
+	}
+
+	if o.Async {
+		query.Set("async", "true")
+	}
+
+	if o.DryRun {
+		query.Set("dryRun", "true")
+	}
+	return query
+}
+
+//WriteResult - outcome of an event write
+type WriteResult struct {
+	ID         string                 `json:"id,omitempty"`         //of created events
+	Conference *global.ConferenceInfo `json:"conference,omitempty"` //if requested on create or patch
+	Job        *Job                   `json:"job,omitempty"`        //if queued with Async
+	Preview    *Preview               `json:"preview,omitempty"`    //if a DryRun
+}
+
+//Preview - the write a dry run would have made
+type Preview struct {
+	Method  string          `json:"method"` //insert, update, patch or delete
+	EventID string          `json:"eventId,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"` //google calendar event sent
+	Diff    []FieldChange   `json:"diff"`
+}
+
+//FieldChange - a field of global.Event changed, by json name. Old is
+//left out for fields set, New for fields cleared.
+type FieldChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+//write - sends a write, decoding the result
+func (c *Client) write(ctx context.Context, r request, opts WriteOptions) (*WriteResult, error) {
+	query := opts.query()
+	for k, v := range r.query {
+		query[k] = v
+	}
+	r.query = query
+
+	body, err := c.do(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	result := WriteResult{}
+	err = json.Unmarshal(body, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+//CreateEvent creates event, returning its id
+func (c *Client) CreateEvent(
+	ctx context.Context,
+	event global.Event,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r, err := jsonRequest(http.MethodPost, event, "event", "create")
+	if err != nil {
+		return nil, err
+	}
+	return c.write(ctx, r, opts)
+}
+
+//UpdateEvent replaces the event with the id of event
+func (c *Client) UpdateEvent(
+	ctx context.Context,
+	event global.Event,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r, err := jsonRequest(http.MethodPut, event, "event", "update")
+	if err != nil {
+		return nil, err
+	}
+	return c.write(ctx, r, opts)
+}
+
+//PatchEvent sets the fields set on event, of the event with its id
+func (c *Client) PatchEvent(
+	ctx context.Context,
+	event global.Event,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r, err := jsonRequest(http.MethodPatch, event, "event", "patch")
+	if err != nil {
+		return nil, err
+	}
+	return c.write(ctx, r, opts)
+}
+
+//DeleteEvent cancels the event with id
+func (c *Client) DeleteEvent(
+	ctx context.Context,
+	id string,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	return c.write(ctx, newRequest(http.MethodDelete, "event", "delete", id), opts)
+}
+
+//AddParticipants adds participants to an event. Participants already on
+//it have the fields set updated.
+func (c *Client) AddParticipants(
+	ctx context.Context,
+	eventID string,
+	participants []global.Participant,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r, err := jsonRequest(http.MethodPost, participants, "event", "participants", eventID)
+	if err != nil {
+		return nil, err
+	}
+	return c.write(ctx, r, opts)
+}
+
+//RemoveParticipants removes the participants with emails from an event
+func (c *Client) RemoveParticipants(
+	ctx context.Context,
+	eventID string,
+	emails []string,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r := request{
+		method: http.MethodDelete,
+		path:   []string{"event", "participants", eventID, strings.Join(emails, ",")},
+	}
+	return c.write(ctx, r, opts)
+}
+
+//AddAttachments adds files to an event. Attachments already on it (same
+//file url) have the fields set updated.
+func (c *Client) AddAttachments(
+	ctx context.Context,
+	eventID string,
+	attachments []global.Attachment,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r, err := jsonRequest(http.MethodPost, attachments, "event", "attachments", eventID)
+	if err != nil {
+		return nil, err
+	}
+	return c.write(ctx, r, opts)
+}
+
+//RemoveAttachments removes the attachments with file urls from an event
+func (c *Client) RemoveAttachments(
+	ctx context.Context,
+	eventID string,
+	fileURLs []string,
+	opts WriteOptions,
+) (*WriteResult, error) {
+	r := request{
+		method: http.MethodDelete,
+		path:   []string{"event", "attachments", eventID},
+		query:  url.Values{"fileUrl": fileURLs},
+	}
+	return c.write(ctx, r, opts)
+}
+
+//GetEvent returns the event with id
+func (c *Client) GetEvent(ctx context.Context, id string) (*global.Event, error) {
+	event := &global.Event{}
+	err := c.call(ctx, newRequest(http.MethodGet, "event", "get", id), "event", event)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+//icsSuffix - suffix of the iCalendar forms of events and lists
+const icsSuffix = ".ics"
+
+//GetEventICS returns the event with id as an iCalendar file
+func (c *Client) GetEventICS(ctx context.Context, id string) ([]byte, error) {
+	body, err := c.do(ctx, newRequest(http.MethodGet, "event", "get", id+icsSuffix))
+	return body, err
+}
+
+//GetConference returns the conference of an event, nil if it has none.
+//Used to poll the status of a pending conference creation.
+func (c *Client) GetConference(ctx context.Context, eventID string) (
+	*global.ConferenceInfo,
+	error,
+) {
+	var conference *global.ConferenceInfo
+	r := newRequest(http.MethodGet, "event", "conference", eventID)
+	err := c.call(ctx, r, "conference", &conference)
+	return conference, err
+}
+
+//FindEventsByExternalID returns the events with the private extended
+//property key set to externalID
+func (c *Client) FindEventsByExternalID(ctx context.Context, key string, externalID string) (
+	[]*global.Event,
+	error,
+) {
+	events := []*global.Event{}
+	r := newRequest(http.MethodGet, "event", "external", key, externalID)
+	err := c.call(ctx, r, "events", &events)
+	return events, err
+}
+
+//ListOptions - filters of event lists, all optional
+type ListOptions struct {
+	TimeMin               string //RFC3339, lower bound of event end
+	TimeMax               string //RFC3339, upper bound of event start
+	ShowDeleted           bool
+	Query                 string //free text search
+	UpdatedMin            string //RFC3339, events modified at or after
+	OrderBy               string //startTime or updated
+	ICalUID               string
+	ShowHiddenInvitations bool
+	MaxAttendees          int64
+
+	Attendee       string //email of an attendee events must have
+	ResponseStatus string //of Attendee, or the calendar owner
+
+	PrivateExtendedProperties []string //key=value
+	SharedExtendedProperties  []string //key=value
+}
+
+//query - the options as query params
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	values := map[string]string{
+		"timeMin":        o.TimeMin,
+		"timeMax":        o.TimeMax,
+		"q":              o.Query,
+		"updatedMin":     o.UpdatedMin,
+		"orderBy":        o.OrderBy,
+		"iCalUID":        o.ICalUID,
+		"attendee":       o.Attendee,
+		"responseStatus": o.ResponseStatus,
+	}
+	for k, v := range values {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+
+	if o.ShowDeleted {
+		query.Set("showDeleted", "true")
+	}
+
+	if o.ShowHiddenInvitations {
+		query.Set("showHiddenInvitations", "true")
+	}
+
+	if o.MaxAttendees > 0 {
+		query.Set("maxAttendees", strconv.FormatInt(o.MaxAttendees, 10))
+	}
+
+	for _, v := range o.PrivateExtendedProperties {
+		query.Add("privateExtendedProperty", v)
+	}
+
+	for _, v := range o.SharedExtendedProperties {
+		query.Add("sharedExtendedProperty", v)
+	}
+	return query
+}
+
+//ListEvents returns the events matching opts, recurring events expanded
+//into their instances
+func (c *Client) ListEvents(ctx context.Context, opts ListOptions) ([]*global.Event, error) {
+	events := []*global.Event{}
+	r := newRequest(http.MethodGet, "event", "list")
+	r.query = opts.query()
+	err := c.call(ctx, r, "events", &events)
+	return events, err
+}
+
+//ListEventsICS returns the events between timeMin and timeMax (RFC3339,
+//optional) as an iCalendar file
+func (c *Client) ListEventsICS(
+	ctx context.Context,
+	timeMin string,
+	timeMax string,
+	showDeleted bool,
+) ([]byte, error) {
+	r := newRequest(http.MethodGet, "event", "list"+icsSuffix)
+	r.query = ListOptions{TimeMin: timeMin, TimeMax: timeMax, ShowDeleted: showDeleted}.query()
+	body, err := c.do(ctx, r)
+	return body, err
+}
+
+//Import upserts the events of an iCalendar file, keyed by UID. With
+//dryRun, only reports what would be changed.
+func (c *Client) Import(ctx context.Context, ics []byte, dryRun bool) (
+	*global.ImportResult,
+	error,
+) {
+	r := request{
+		method:      http.MethodPost,
+		path:        []string{"import"},
+		query:       url.Values{"dryRun": {boolString(dryRun)}},
+		body:        ics,
+		contentType: "text/calendar",
+	}
+
+	result := &global.ImportResult{}
+	err := c.call(ctx, r, "result", result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
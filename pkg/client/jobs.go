@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+//Job - a write queued with WriteOptions.Async
+type Job struct {
+	ID       string          `json:"id"`
+	Sequence int64           `json:"sequence"`
+	Domain   string          `json:"domain"`
+	Key      string          `json:"key"`  //id of the event written
+	Kind     string          `json:"kind"` //create, update, patch or delete
+	Request  json.RawMessage `json:"request"`
+	Status   string          `json:"status"` //queued, running, succeeded or failed
+	Attempts int             `json:"attempts"`
+
+	LastError   string          `json:"lastError,omitempty"`
+	NextAttempt *time.Time      `json:"nextAttempt,omitempty"`
+	Result      json.RawMessage `json:"result,omitempty"` //id and conference of creates and patches
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+//Done - whether the job will not run again, unless retried
+func (j Job) Done() bool {
+	return j.Status == "succeeded" || j.Status == "failed"
+}
+
+//GetJob returns the job with id
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	job := &Job{}
+	err := c.call(ctx, newRequest(http.MethodGet, "jobs", id), "job", job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+//RetryJob queues a failed job again, with a fresh set of attempts
+func (c *Client) RetryJob(ctx context.Context, id string) (*Job, error) {
+	job := &Job{}
+	err := c.call(ctx, newRequest(http.MethodPost, "jobs", id, "retry"), "job", job)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+//WaitJob polls the job with id every interval until it is done, or ctx is
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*Job, error) {
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+//Webhook - a subscription to event changes of the domain
+type Webhook struct {
+	ID     string   `json:"id,omitempty"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"` //signing payloads, generated if empty
+	Events []string `json:"events,omitempty"` //i.e. event.created, all events if empty
+
+	Created time.Time `json:"created,omitempty"`
+}
+
+//Delivery - a payload posted to a webhook
+type Delivery struct {
+	ID             string          `json:"id"`
+	Domain         string          `json:"domain"`
+	SubscriptionID string          `json:"subscriptionId"`
+	Type           string          `json:"type"`
+	Status         string          `json:"status"` //pending, delivered or failed
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"lastError,omitempty"`
+	Created        time.Time       `json:"created"`
+	Updated        time.Time       `json:"updated"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+//ListWebhooks returns the webhooks of the domain, without their secrets
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks := []Webhook{}
+	err := c.call(ctx, newRequest(http.MethodGet, "webhooks"), "webhooks", &webhooks)
+	return webhooks, err
+}
+
+//AddWebhook subscribes to event changes of the domain, returning the
+//webhook with its secret
+func (c *Client) AddWebhook(ctx context.Context, webhook Webhook) (*Webhook, error) {
+	r, err := jsonRequest(http.MethodPost, webhook, "webhooks")
+	if err != nil {
+		return nil, err
+	}
+
+	added := &Webhook{}
+	err = c.call(ctx, r, "webhook", added)
+	if err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+//DeleteWebhook removes the webhook with id
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.call(ctx, newRequest(http.MethodDelete, "webhooks", id), "", nil)
+}
+
+//ListWebhookDeliveries returns recent deliveries, oldest first. Only
+//those with status, unless it is empty.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, status string) ([]Delivery, error) {
+	r := newRequest(http.MethodGet, "webhooks", "deliveries")
+	if status != "" {
+		r.query = url.Values{"status": {status}}
+	}
+
+	deliveries := []Delivery{}
+	err := c.call(ctx, r, "deliveries", &deliveries)
+	return deliveries, err
+}
+
+//ReplayWebhookDelivery delivers a failed delivery again
+func (c *Client) ReplayWebhookDelivery(ctx context.Context, id string) (*Delivery, error) {
+	delivery := &Delivery{}
+	r := newRequest(http.MethodPost, "webhooks", "deliveries", id, "replay")
+	err := c.call(ctx, r, "delivery", delivery)
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
@@ -0,0 +1,360 @@
+package googlecal
+
+import (
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+//TimeZone of the start and end of events written
+const TimeZone = "Europe/Oslo"
+
+//dateFormat - format of the start and end of all day events
+const dateFormat = "2006-01-02"
+
+//optional - nil if s is empty, as google leaves out empty fields
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+//dateTimeString - time of dt, or date of all day events
+func dateTimeString(dt *calendar.EventDateTime) *string {
+	if dt == nil {
+		return nil
+	}
+
+	if dt.DateTime != "" {
+		return optional(dt.DateTime)
+	}
+	return optional(dt.Date)
+}
+
+//toGoogleDateTime - time s in TimeZone, or the date of all day events
+//if s is a date, as read by dateTimeString
+func toGoogleDateTime(s string) *calendar.EventDateTime {
+	if _, err := time.Parse(dateFormat, s); err == nil {
+		return &calendar.EventDateTime{Date: s}
+	}
+	return &calendar.EventDateTime{DateTime: s, TimeZone: TimeZone}
+}
+
+//FromGoogle converts a google event to an Event, the reverse of ToGoogle,
+//including the read-only fields. Returns nil if event is nil.
+func FromGoogle(event *calendar.Event) *Event {
+	if event == nil {
+		return nil
+	}
+
+	converted := Event{
+		ID:             optional(event.Id),
+		Title:          optional(event.Summary),
+		Description:    optional(event.Description),
+		Location:       optional(event.Location),
+		Start:          dateTimeString(event.Start),
+		End:            dateTimeString(event.End),
+		Organizer:      event.Organizer,
+		ColorID:        optional(event.ColorId),
+		Transparency:   optional(event.Transparency),
+		Status:         optional(event.Status),
+		Visibility:     optional(event.Visibility),
+		ConferenceInfo: FromGoogleConference(event.ConferenceData),
+		HTMLLink:       optional(event.HtmlLink),
+		ICalUID:        optional(event.ICalUID),
+		Created:        optional(event.Created),
+		Updated:        optional(event.Updated),
+		ETag:           optional(event.Etag),
+	}
+
+	if len(event.Attendees) > 0 {
+		participants := []Participant{}
+		for _, v := range event.Attendees {
+			participant := Participant{
+				Email:          v.Email,
+				DisplayName:    optional(v.DisplayName),
+				Comment:        optional(v.Comment),
+				ResponseStatus: optional(v.ResponseStatus),
+			}
+
+			if v.Optional {
+				optional := true
+				participant.Optional = &optional
+			}
+
+			if v.Resource {
+				resource := true
+				participant.Resource = &resource
+			}
+			participants = append(participants, participant)
+		}
+		converted.Participants = &participants
+	}
+
+	if event.Reminders != nil {
+		useDefault := event.Reminders.UseDefault
+		converted.Reminders = &Reminders{UseDefault: &useDefault}
+		if !useDefault {
+			overrides := []ReminderOverride{}
+			for _, v := range event.Reminders.Overrides {
+				overrides = append(overrides, ReminderOverride{
+					Method:  v.Method,
+					Minutes: v.Minutes,
+				})
+			}
+			converted.Reminders.Overrides = &overrides
+		}
+	}
+
+	if len(event.Attachments) > 0 {
+		attachments := []Attachment{}
+		for _, v := range event.Attachments {
+			attachments = append(attachments, Attachment{
+				FileURL:  v.FileUrl,
+				Title:    optional(v.Title),
+				MimeType: optional(v.MimeType),
+				IconLink: optional(v.IconLink),
+			})
+		}
+		converted.Attachments = &attachments
+	}
+
+	if event.ExtendedProperties != nil {
+		properties := ExtendedProperties{}
+		if event.ExtendedProperties.Private != nil {
+			private := event.ExtendedProperties.Private
+			properties.Private = &private
+		}
+
+		if event.ExtendedProperties.Shared != nil {
+			shared := event.ExtendedProperties.Shared
+			properties.Shared = &shared
+		}
+		converted.ExtendedProperties = &properties
+	}
+	return &converted
+}
+
+//FromGoogleConference extracts conference details. Returns nil if no
+//conference.
+func FromGoogleConference(data *calendar.ConferenceData) *ConferenceInfo {
+	if data == nil {
+		return nil
+	}
+
+	info := ConferenceInfo{
+		ID:          data.ConferenceId,
+		EntryPoints: []ConferenceEntryPoint{},
+	}
+
+	if data.CreateRequest != nil && data.CreateRequest.Status != nil {
+		info.Status = data.CreateRequest.Status.StatusCode
+	} else if len(data.EntryPoints) > 0 {
+		info.Status = "success"
+	}
+
+	for _, v := range data.EntryPoints {
+		if v.EntryPointType == "video" && info.JoinURL == "" {
+			info.JoinURL = v.Uri
+		}
+
+		info.EntryPoints = append(info.EntryPoints, ConferenceEntryPoint{
+			Type:  v.EntryPointType,
+			URI:   v.Uri,
+			Label: v.Label,
+			Pin:   v.Pin,
+		})
+	}
+	return &info
+}
+
+//ToGoogle copies the fields set on event onto update, the reverse of
+//FromGoogle. Fields not set are left as they are, so update may be a
+//patch or the existing event. Read-only fields and conference requests
+//are ignored.
+func ToGoogle(event Event, update *calendar.Event) {
+	if update == nil {
+		return
+	}
+
+	if event.Visibility != nil {
+		update.Visibility = *event.Visibility
+	}
+
+	if event.ColorID != nil {
+		update.ColorId = *event.ColorID
+		if *event.ColorID == "" {
+			update.NullFields = append(update.NullFields, "ColorId")
+		}
+	}
+
+	if event.Transparency != nil {
+		update.Transparency = *event.Transparency
+	}
+
+	if event.Status != nil {
+		update.Status = *event.Status
+	}
+
+	if event.Title != nil && *event.Title != "" {
+		update.Summary = *event.Title
+	}
+
+	if event.Location != nil {
+		update.Location = *event.Location
+	}
+
+	if event.Description != nil {
+		update.Description = *event.Description
+	}
+
+	if event.Start != nil {
+		update.Start = toGoogleDateTime(*event.Start)
+	}
+
+	if event.End != nil {
+		update.End = toGoogleDateTime(*event.End)
+	}
+
+	if event.Participants != nil {
+		participants := []*calendar.EventAttendee{}
+		for _, participant := range *event.Participants {
+			participants = append(participants, MergeAttendee(&calendar.EventAttendee{}, participant))
+		}
+		update.Attendees = participants
+	}
+
+	if event.Organizer != nil {
+		update.Organizer = event.Organizer
+	}
+
+	if event.Reminders != nil {
+		update.Reminders = toGoogleReminders(*event.Reminders)
+	}
+
+	if event.ExtendedProperties != nil {
+		update.ExtendedProperties = toGoogleExtendedProperties(*event.ExtendedProperties)
+	}
+
+	if event.Attachments != nil {
+		var forceSend []string
+		update.Attachments, forceSend = toGoogleAttachments(*event.Attachments)
+		update.ForceSendFields = append(update.ForceSendFields, forceSend...)
+	}
+}
+
+//MergeAttendee copies the fields set on participant onto attendee,
+//keeping any attendee metadata the participant does not specify.
+func MergeAttendee(
+	attendee *calendar.EventAttendee,
+	participant Participant,
+) *calendar.EventAttendee {
+	attendee.Email = participant.Email
+
+	if participant.DisplayName != nil {
+		attendee.DisplayName = *participant.DisplayName
+	}
+
+	if participant.Optional != nil {
+		attendee.Optional = *participant.Optional
+	}
+
+	if participant.Resource != nil {
+		attendee.Resource = *participant.Resource
+	}
+
+	if participant.Comment != nil {
+		attendee.Comment = *participant.Comment
+	}
+
+	if participant.ResponseStatus != nil {
+		attendee.ResponseStatus = *participant.ResponseStatus
+	}
+	return attendee
+}
+
+//MergeAttachment copies the fields set on attachment onto gAttachment,
+//keeping any existing metadata the attachment does not specify.
+func MergeAttachment(
+	gAttachment *calendar.EventAttachment,
+	attachment Attachment,
+) *calendar.EventAttachment {
+	gAttachment.FileUrl = attachment.FileURL
+
+	if attachment.Title != nil {
+		gAttachment.Title = *attachment.Title
+	}
+
+	if attachment.MimeType != nil {
+		gAttachment.MimeType = *attachment.MimeType
+	}
+
+	if attachment.IconLink != nil {
+		gAttachment.IconLink = *attachment.IconLink
+	}
+	return gAttachment
+}
+
+//toGoogleReminders - converts reminders. All fields are always sent,
+//so a patch replaces the existing reminders as a whole.
+func toGoogleReminders(reminders Reminders) *calendar.EventReminders {
+	useDefault := reminders.Overrides == nil
+	if reminders.UseDefault != nil {
+		useDefault = *reminders.UseDefault
+	}
+
+	gReminders := calendar.EventReminders{
+		UseDefault:      useDefault,
+		ForceSendFields: []string{"UseDefault"},
+	}
+
+	if useDefault {
+		gReminders.NullFields = []string{"Overrides"}
+		return &gReminders
+	}
+
+	gReminders.Overrides = []*calendar.EventReminder{}
+	gReminders.ForceSendFields = append(gReminders.ForceSendFields, "Overrides")
+	if reminders.Overrides != nil {
+		for _, v := range *reminders.Overrides {
+			gReminders.Overrides = append(gReminders.Overrides, &calendar.EventReminder{
+				Method:          v.Method,
+				Minutes:         v.Minutes,
+				ForceSendFields: []string{"Minutes"},
+			})
+		}
+	}
+	return &gReminders
+}
+
+//toGoogleExtendedProperties - converts properties. On patch, Google merges
+//the specified keys with the existing ones.
+func toGoogleExtendedProperties(properties ExtendedProperties) *calendar.EventExtendedProperties {
+	gProperties := calendar.EventExtendedProperties{}
+	if properties.Private != nil {
+		gProperties.Private = *properties.Private
+	}
+
+	if properties.Shared != nil {
+		gProperties.Shared = *properties.Shared
+	}
+	return &gProperties
+}
+
+//toGoogleAttachments - converts attachments. Empty lists are always sent,
+//so that a patch can remove all attachments.
+func toGoogleAttachments(attachments []Attachment) (
+	gAttachments []*calendar.EventAttachment,
+	forceSend []string,
+) {
+	gAttachments = []*calendar.EventAttachment{}
+	for _, v := range attachments {
+		gAttachments = append(gAttachments, MergeAttachment(&calendar.EventAttachment{}, v))
+	}
+
+	if len(gAttachments) == 0 {
+		forceSend = []string{"Attachments"}
+	}
+	return gAttachments, forceSend
+}
@@ -0,0 +1,92 @@
+package googlecal
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+func TestMapperRoundTrip(t *testing.T) {
+	yes := true
+	event := Event{
+		ID:          str("abc"),
+		Title:       str("Meeting"),
+		Description: str("Agenda"),
+		Location:    str("Room 1"),
+		Start:       str("2020-01-06T09:00:00+01:00"),
+		End:         str("2020-01-06T10:00:00+01:00"),
+		Participants: &[]Participant{
+			{Email: "a@example.com", ResponseStatus: str("accepted")},
+			{Email: "b@example.com", Optional: &yes, ResponseStatus: str("needsAction")},
+		},
+		Reminders: &Reminders{
+			UseDefault: new(bool),
+			Overrides:  &[]ReminderOverride{{Method: "popup", Minutes: 10}},
+		},
+		Attachments:        &[]Attachment{{FileURL: "https://drive.google.com/file/1", Title: str("Agenda")}},
+		ExtendedProperties: &ExtendedProperties{Private: &map[string]string{"courseId": "42"}},
+		ColorID:            str("5"),
+		Transparency:       str("transparent"),
+		Status:             str("confirmed"),
+		Visibility:         str("private"),
+	}
+
+	gEvent := &calendar.Event{Id: "abc", Etag: `"1"`, HtmlLink: "https://calendar.google.com/event?eid=abc"}
+	ToGoogle(event, gEvent)
+	if gEvent.Start.TimeZone != TimeZone || gEvent.Attendees[1].ResponseStatus != "needsAction" {
+		t.Errorf("unexpected google event %+v", gEvent)
+	}
+
+	converted := FromGoogle(gEvent)
+	if *converted.ETag != `"1"` || converted.HTMLLink == nil {
+		t.Errorf("expected read-only fields, got %+v", converted)
+	}
+
+	converted.ETag, converted.HTMLLink = nil, nil
+	want, _ := json.Marshal(event)
+	got, _ := json.Marshal(converted)
+	if string(got) != string(want) {
+		t.Errorf("round trip changed event\ngot  %s\nwant %s", got, want)
+	}
+
+	if FromGoogle(nil) != nil {
+		t.Error("expected nil for nil event")
+	}
+
+	allDay := Event{Title: str("Holiday"), Start: str("2026-10-18"), End: str("2026-10-19")}
+	gEvent = &calendar.Event{}
+	ToGoogle(allDay, gEvent)
+	if gEvent.Start.Date != "2026-10-18" || gEvent.Start.DateTime != "" || gEvent.Start.TimeZone != "" ||
+		gEvent.End.Date != "2026-10-19" {
+		t.Errorf("expected all day event, got %+v %+v", gEvent.Start, gEvent.End)
+	}
+
+	want, _ = json.Marshal(allDay)
+	got, _ = json.Marshal(FromGoogle(gEvent))
+	if string(got) != string(want) {
+		t.Errorf("round trip changed all day event\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestToGoogleKeepsUnset(t *testing.T) {
+	gEvent := &calendar.Event{
+		Summary:   "Meeting",
+		Location:  "Room 1",
+		Attendees: []*calendar.EventAttendee{{Email: "a@example.com"}},
+	}
+
+	ToGoogle(Event{Location: str(""), Title: str("")}, gEvent)
+	if gEvent.Summary != "Meeting" || gEvent.Location != "" || len(gEvent.Attendees) != 1 {
+		t.Errorf("expected only location cleared, got %+v", gEvent)
+	}
+
+	ToGoogle(Event{ColorID: str(""), Attachments: &[]Attachment{}}, gEvent)
+	if len(gEvent.NullFields) != 1 || len(gEvent.ForceSendFields) != 1 {
+		t.Errorf("expected color reset and attachments sent, got %+v", gEvent)
+	}
+}
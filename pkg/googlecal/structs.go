@@ -1,17 +1,192 @@
 package googlecal
 
-import "google.golang.org/api/calendar/v3"
+import (
+	"encoding/json"
+
+	"google.golang.org/api/calendar/v3"
+)
 
 //Event contains event data
 type Event struct {
 
 	//pointers to allow empty values
-	ID           *string                  `json:"id"`
-	Title        *string                  `json:"title"`
-	Description  *string                  `json:"description"`
-	Location     *string                  `json:"location"`
-	Start        *string                  `json:"startDateTime"`
-	End          *string                  `json:"endDateTime"`
-	Participants *[]string                `json:"participants"`
-	Organizer    *calendar.EventOrganizer `json:"organizer"`
+	ID                 *string                  `json:"id"`
+	Title              *string                  `json:"title"`
+	Description        *string                  `json:"description"`
+	Location           *string                  `json:"location"`
+	Start              *string                  `json:"startDateTime"`
+	End                *string                  `json:"endDateTime"`
+	Participants       *[]Participant           `json:"participants"`
+	Organizer          *calendar.EventOrganizer `json:"organizer"`
+	Reminders          *Reminders               `json:"reminders"`
+	Conference         *Conference              `json:"conference"`
+	Attachments        *[]Attachment            `json:"attachments"`
+	ExtendedProperties *ExtendedProperties      `json:"extendedProperties"`
+	ColorID            *string                  `json:"colorId"`      //empty resets to calendar color
+	Transparency       *string                  `json:"transparency"` //opaque (busy) or transparent (free)
+	Status             *string                  `json:"status"`       //confirmed, tentative or cancelled
+	Visibility         *string                  `json:"visibility"`   //default, public, private or confidential
+
+	//read-only, set on events read and ignored on writes
+	ConferenceInfo *ConferenceInfo `json:"conferenceInfo,omitempty"`
+	HTMLLink       *string         `json:"htmlLink,omitempty"` //event in the google calendar web ui
+	ICalUID        *string         `json:"iCalUID,omitempty"`
+	Created        *string         `json:"created,omitempty"` //RFC3339
+	Updated        *string         `json:"updated,omitempty"` //RFC3339
+	ETag           *string         `json:"etag,omitempty"`
+}
+
+//ExtendedProperties contains metadata, i.e. ids in external systems.
+//Private properties are only visible on this calendar's copy of the event,
+//shared properties on all attendees' copies.
+type ExtendedProperties struct {
+	Private *map[string]string `json:"private"`
+	Shared  *map[string]string `json:"shared"`
+}
+
+//Attachment is a file (i.e. Google Drive link) attached to an event
+type Attachment struct {
+	FileURL  string  `json:"fileUrl"`
+	Title    *string `json:"title,omitempty"`
+	MimeType *string `json:"mimeType,omitempty"`
+	IconLink *string `json:"iconLink,omitempty"`
+}
+
+//Conference requests a conference (i.e. Google Meet) for an event
+type Conference struct {
+	Create bool    `json:"create"`
+	Type   *string `json:"type"` //conference solution, defaults to hangoutsMeet
+}
+
+//ConferenceInfo contains details of an event's conference
+type ConferenceInfo struct {
+	ID          string                 `json:"id"`
+	Status      string                 `json:"status"` //pending, success or failure
+	JoinURL     string                 `json:"joinUrl"`
+	EntryPoints []ConferenceEntryPoint `json:"entryPoints"`
+}
+
+//ConferenceEntryPoint is a way of joining a conference
+type ConferenceEntryPoint struct {
+	Type  string `json:"type"` //video, phone, sip or more
+	URI   string `json:"uri"`
+	Label string `json:"label,omitempty"`
+	Pin   string `json:"pin,omitempty"`
+}
+
+//Participant contains event attendee data
+type Participant struct {
+	Email          string  `json:"email"`
+	DisplayName    *string `json:"displayName,omitempty"`
+	Optional       *bool   `json:"optional,omitempty"`
+	Resource       *bool   `json:"resource,omitempty"`
+	Comment        *string `json:"comment,omitempty"`
+	ResponseStatus *string `json:"responseStatus,omitempty"`
+}
+
+//UnmarshalJSON accepts either an attendee object, or a plain
+//email string for backward compatibility.
+func (p *Participant) UnmarshalJSON(b []byte) error {
+	email := ""
+	if json.Unmarshal(b, &email) == nil {
+		*p = Participant{Email: email}
+		return nil
+	}
+
+	//alias to avoid recursing into this method
+	type participant Participant
+	temp := participant{}
+	err := json.Unmarshal(b, &temp)
+	if err != nil {
+		return err
+	}
+	*p = Participant(temp)
+	return nil
+}
+
+//Reminders contains event reminder settings.
+//Omitting overrides and useDefault means the calendar defaults are used.
+type Reminders struct {
+	UseDefault *bool               `json:"useDefault"`
+	Overrides  *[]ReminderOverride `json:"overrides"`
+}
+
+//ReminderOverride is a reminder replacing the calendar defaults
+type ReminderOverride struct {
+	Method  string `json:"method"`  //email or popup
+	Minutes int64  `json:"minutes"` //minutes before event start
+}
+
+//ACLRule contains calendar access rule data
+type ACLRule struct {
+	ID         *string `json:"id"`
+	Role       *string `json:"role"`
+	ScopeType  *string `json:"scopeType"`
+	ScopeValue *string `json:"scopeValue"`
+}
+
+//ACLSyncResult describes changes applied when syncing a calendar ACL
+type ACLSyncResult struct {
+	Inserted []ACLRule `json:"inserted"`
+	Updated  []ACLRule `json:"updated"`
+	Deleted  []ACLRule `json:"deleted"`
+}
+
+//ImportResult describes the outcome of an iCalendar import
+type ImportResult struct {
+	DryRun bool            `json:"dryRun"`
+	Events []ImportedEvent `json:"events"`
+}
+
+//ImportedEvent describes the outcome of importing a single event
+type ImportedEvent struct {
+	UID          string   `json:"uid"`
+	RecurrenceID string   `json:"recurrenceId,omitempty"`
+	ID           string   `json:"id,omitempty"`      //google event id, if existing or created
+	Action       string   `json:"action"`            //create, update, unchanged or error
+	Changes      []string `json:"changes,omitempty"` //fields changed by update
+	Error        string   `json:"error,omitempty"`
+}
+
+//Types of commands
+const (
+	CommandCreate             = "create"
+	CommandUpdate             = "update"
+	CommandPatch              = "patch"
+	CommandDelete             = "delete"
+	CommandAddParticipants    = "addParticipants"
+	CommandRemoveParticipants = "removeParticipants"
+)
+
+//Command is a write to an event, received on a message bus
+type Command struct {
+	ID           string         `json:"id"` //deduplicates redelivered commands
+	Type         string         `json:"type"`
+	Domain       string         `json:"domain"`
+	EventID      string         `json:"eventId,omitempty"` //delete and participant commands
+	Event        *Event         `json:"event,omitempty"`   //create, update and patch
+	Participants []Participant  `json:"participants,omitempty"`
+	Options      CommandOptions `json:"options"`
+}
+
+//CommandOptions are the settings of a command, as the query params of the api
+type CommandOptions struct {
+	BroadcastChanges *bool `json:"broadcastChanges,omitempty"`
+	GuestsCanModify  *bool `json:"guestsCanModify,omitempty"`
+	GuestsMayInvite  *bool `json:"guestsMayInvite,omitempty"`
+	GuestsVisible    *bool `json:"guestsVisible,omitempty"`
+	GuestsAutoAccept *bool `json:"guestsAutoAccept,omitempty"`
+	PrivateEvent     *bool `json:"privateEvent,omitempty"`
+	SendInvitations  bool  `json:"sendInvitations,omitempty"`
+}
+
+//CommandResult is published when a command has been executed
+type CommandResult struct {
+	CommandID  string          `json:"commandId"`
+	Type       string          `json:"type"`
+	Domain     string          `json:"domain"`
+	EventID    string          `json:"eventId,omitempty"`
+	Success    bool            `json:"success"`
+	Error      string          `json:"error,omitempty"`
+	Conference *ConferenceInfo `json:"conference,omitempty"`
 }
@@ -0,0 +1,213 @@
+//Package ics reads and writes iCalendar (RFC 5545) data.
+package ics
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	crlf = "\r\n"
+
+	//lines longer than this (in octets, excluding crlf) must be folded
+	maxLineLength = 75
+)
+
+//Param is a property parameter, i.e. TZID=Europe/Oslo
+type Param struct {
+	Name   string
+	Values []string
+}
+
+//Property is a content line of a component, i.e. SUMMARY:Meeting.
+//Value is kept in its encoded form, see EscapeText and Text.
+type Property struct {
+	Name   string
+	Params []Param
+	Value  string
+}
+
+//Component is an iCalendar component, i.e. VCALENDAR or VEVENT
+type Component struct {
+	Name       string
+	Properties []*Property
+	Components []*Component
+}
+
+//NewComponent - create empty component
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+//AddProperty adds a property with an already encoded value
+func (c *Component) AddProperty(name string, value string, params ...Param) *Property {
+	p := &Property{Name: name, Params: params, Value: value}
+	c.Properties = append(c.Properties, p)
+	return p
+}
+
+//AddText adds a property with a TEXT value, escaping it
+func (c *Component) AddText(name string, text string, params ...Param) *Property {
+	return c.AddProperty(name, EscapeText(text), params...)
+}
+
+//AddComponent adds a sub component
+func (c *Component) AddComponent(sub *Component) {
+	c.Components = append(c.Components, sub)
+}
+
+//Property returns the first property with name, or nil
+func (c *Component) Property(name string) *Property {
+	for _, v := range c.Properties {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+//PropertiesNamed returns all properties with name
+func (c *Component) PropertiesNamed(name string) []*Property {
+	properties := []*Property{}
+	for _, v := range c.Properties {
+		if v.Name == name {
+			properties = append(properties, v)
+		}
+	}
+	return properties
+}
+
+//ComponentsNamed returns all direct sub components with name
+func (c *Component) ComponentsNamed(name string) []*Component {
+	components := []*Component{}
+	for _, v := range c.Components {
+		if v.Name == name {
+			components = append(components, v)
+		}
+	}
+	return components
+}
+
+//Param returns the first value of parameter name, or empty string
+func (p *Property) Param(name string) string {
+	for _, v := range p.Params {
+		if v.Name == name && len(v.Values) > 0 {
+			return v.Values[0]
+		}
+	}
+	return ""
+}
+
+//Text returns the value unescaped, for TEXT properties
+func (p *Property) Text() string {
+	return UnescapeText(p.Value)
+}
+
+//Encode writes the component, with sub components, as folded content lines
+func (c *Component) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.encode(bw)
+	return bw.Flush()
+}
+
+//bufio.Writer keeps the first error, so it is checked on flush
+func (c *Component) encode(w *bufio.Writer) {
+	writeFolded(w, "BEGIN:"+c.Name)
+	for _, p := range c.Properties {
+		writeFolded(w, p.String())
+	}
+
+	for _, sub := range c.Components {
+		sub.encode(w)
+	}
+	writeFolded(w, "END:"+c.Name)
+}
+
+//String returns the unfolded content line of the property
+func (p *Property) String() string {
+	b := strings.Builder{}
+	b.WriteString(p.Name)
+	for _, param := range p.Params {
+		b.WriteString(";")
+		b.WriteString(param.Name)
+		b.WriteString("=")
+		for i, v := range param.Values {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(quoteParamValue(v))
+		}
+	}
+	b.WriteString(":")
+	b.WriteString(p.Value)
+	return b.String()
+}
+
+//writeFolded - writes line, folding it so no line exceeds 75 octets.
+//Never splits a multi-byte character.
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		w.WriteString(line[:cut])
+		w.WriteString(crlf + " ")
+		line = line[cut:]
+
+		//continuation lines start with a space, leaving one octet less
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line)
+	w.WriteString(crlf)
+}
+
+//EscapeText escapes a TEXT value
+func EscapeText(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(text)
+}
+
+//UnescapeText reverses EscapeText
+func UnescapeText(text string) string {
+	b := strings.Builder{}
+	escaped := false
+	for _, r := range text {
+		if !escaped {
+			if r == '\\' {
+				escaped = true
+			} else {
+				b.WriteRune(r)
+			}
+			continue
+		}
+
+		escaped = false
+		if r == 'n' || r == 'N' {
+			b.WriteRune('\n')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+//quoteParamValue - quotes values containing separators. Double quotes
+//are not allowed in parameter values at all, so they are replaced.
+func quoteParamValue(value string) string {
+	value = strings.Replace(value, `"`, "'", -1)
+	if strings.ContainsAny(value, ":;,") {
+		return `"` + value + `"`
+	}
+	return value
+}
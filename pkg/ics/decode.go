@@ -0,0 +1,352 @@
+package ics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+//google allows at most 5 reminder overrides, of at most 4 weeks
+const (
+	maxAlarms       = 5
+	maxAlarmMinutes = 40320
+)
+
+var (
+	responseStatuses = map[string]string{}
+	visibilities     = map[string]string{}
+)
+
+func init() {
+	for k, v := range partStats {
+		responseStatuses[v] = k
+	}
+	for k, v := range classes {
+		visibilities[v] = k
+	}
+}
+
+//EventError is a VEVENT which could not be converted
+type EventError struct {
+	UID          string
+	RecurrenceID string
+	Err          error
+}
+
+func (e EventError) Error() string {
+	return fmt.Sprintf("event %s: %v", e.UID, e.Err)
+}
+
+//decoder - resolves time zones while converting events
+type decoder struct {
+	defaultZone string
+	zones       map[string]*Component //VTIMEZONEs by TZID
+}
+
+//location - time zone of TZID. Unknown zones (i.e. windows names) fall
+//back to the standard offset of the calendar's own VTIMEZONE.
+func (dec *decoder) location(tzid string) (loc *time.Location, name string, err error) {
+	loc, err = time.LoadLocation(tzid)
+	if err == nil {
+		return loc, tzid, nil
+	}
+
+	zone := dec.zones[tzid]
+	if zone != nil {
+		for _, observance := range zone.ComponentsNamed("STANDARD") {
+			offset := observance.Property("TZOFFSETTO")
+			if offset == nil {
+				continue
+			}
+
+			seconds, err := parseOffset(offset.Value)
+			if err == nil {
+				return time.FixedZone(tzid, seconds), "", nil
+			}
+		}
+	}
+	return nil, "", fmt.Errorf("unknown time zone %q", tzid)
+}
+
+//parseOffset - +hhmm(ss) to seconds
+func parseOffset(value string) (int, error) {
+	if len(value) != 5 && len(value) != 7 {
+		return 0, fmt.Errorf("invalid utc offset %q", value)
+	}
+
+	sign := 1
+	if value[0] == '-' {
+		sign = -1
+	} else if value[0] != '+' {
+		return 0, fmt.Errorf("invalid utc offset %q", value)
+	}
+
+	digits := value[1:] + "00"
+	hours, err1 := strconv.Atoi(digits[0:2])
+	minutes, err2 := strconv.Atoi(digits[2:4])
+	seconds, err3 := strconv.Atoi(digits[4:6])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, fmt.Errorf("invalid utc offset %q", value)
+	}
+	return sign * (hours*3600 + minutes*60 + seconds), nil
+}
+
+//dateTime - converts DTSTART, DTEND or similar. Returns the parsed time,
+//for duration calculations.
+func (dec *decoder) dateTime(p *Property) (*calendar.EventDateTime, time.Time, error) {
+	value := strings.TrimSpace(p.Value)
+	if p.Param("VALUE") == "DATE" || len(value) == len(dateFormat) {
+		date, err := time.Parse(dateFormat, value)
+		if err != nil {
+			return nil, date, err
+		}
+		return &calendar.EventDateTime{Date: date.Format("2006-01-02")}, date, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(utcTimeFormat, value)
+		if err != nil {
+			return nil, t, err
+		}
+		return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339)}, t, nil
+	}
+
+	//floating times are given the calendar's time zone
+	tzid := p.Param("TZID")
+	if tzid == "" {
+		tzid = dec.defaultZone
+	}
+
+	loc, name := time.UTC, "UTC"
+	if tzid != "" {
+		var err error
+		loc, name, err = dec.location(tzid)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	t, err := time.ParseInLocation(localTimeFormat, value, loc)
+	if err != nil {
+		return nil, t, err
+	}
+	return &calendar.EventDateTime{DateTime: t.Format(time.RFC3339), TimeZone: name}, t, nil
+}
+
+//email - address of a cal-address value
+func email(value string) string {
+	if len(value) > 7 && strings.EqualFold(value[:7], "mailto:") {
+		return value[7:]
+	}
+	return value
+}
+
+func toAttendee(p *Property) *calendar.EventAttendee {
+	attendee := calendar.EventAttendee{
+		Email:          email(p.Value),
+		DisplayName:    p.Param("CN"),
+		Optional:       p.Param("ROLE") == "OPT-PARTICIPANT" || p.Param("ROLE") == "NON-PARTICIPANT",
+		ResponseStatus: "needsAction",
+	}
+
+	cuType := p.Param("CUTYPE")
+	attendee.Resource = cuType == "RESOURCE" || cuType == "ROOM"
+
+	if status, ok := responseStatuses[p.Param("PARTSTAT")]; ok {
+		attendee.ResponseStatus = status
+	}
+	return &attendee
+}
+
+//toReminders - converts VALARMs triggered before event start
+func toReminders(alarms []*Component) *calendar.EventReminders {
+	reminders := calendar.EventReminders{
+		Overrides:       []*calendar.EventReminder{},
+		ForceSendFields: []string{"UseDefault"},
+	}
+
+	for _, alarm := range alarms {
+		trigger := alarm.Property("TRIGGER")
+		if trigger == nil || trigger.Param("VALUE") == "DATE-TIME" ||
+			trigger.Param("RELATED") == "END" {
+			continue
+		}
+
+		before, err := ParseDuration(trigger.Value)
+		if err != nil {
+			continue
+		}
+
+		minutes := int64(-before / time.Minute)
+		if minutes < 0 || minutes > maxAlarmMinutes {
+			continue
+		}
+
+		method := "popup"
+		if action := alarm.Property("ACTION"); action != nil && action.Value == "EMAIL" {
+			method = "email"
+		}
+
+		reminders.Overrides = append(reminders.Overrides, &calendar.EventReminder{
+			Method:          method,
+			Minutes:         minutes,
+			ForceSendFields: []string{"Minutes"},
+		})
+		if len(reminders.Overrides) == maxAlarms {
+			break
+		}
+	}
+	return &reminders
+}
+
+//toEvent - converts a VEVENT to a google event
+func (dec *decoder) toEvent(c *Component) (*calendar.Event, error) {
+	event := calendar.Event{}
+
+	uid := c.Property("UID")
+	if uid == nil || uid.Text() == "" {
+		return nil, fmt.Errorf("missing UID")
+	}
+	event.ICalUID = uid.Text()
+
+	dtStart := c.Property("DTSTART")
+	if dtStart == nil {
+		return nil, fmt.Errorf("missing DTSTART")
+	}
+
+	var start time.Time
+	var err error
+	event.Start, start, err = dec.dateTime(dtStart)
+	if err != nil {
+		return nil, fmt.Errorf("bad DTSTART: %v", err)
+	}
+
+	if dtEnd := c.Property("DTEND"); dtEnd != nil {
+		event.End, _, err = dec.dateTime(dtEnd)
+		if err != nil {
+			return nil, fmt.Errorf("bad DTEND: %v", err)
+		}
+	} else {
+		duration := time.Duration(0)
+		if p := c.Property("DURATION"); p != nil {
+			duration, err = ParseDuration(p.Value)
+			if err != nil {
+				return nil, fmt.Errorf("bad DURATION: %v", err)
+			}
+		} else if event.Start.Date != "" {
+			duration = 24 * time.Hour
+		}
+
+		end := start.Add(duration)
+		event.End = &calendar.EventDateTime{TimeZone: event.Start.TimeZone}
+		if event.Start.Date != "" {
+			event.End.Date = end.Format("2006-01-02")
+		} else {
+			event.End.DateTime = end.Format(time.RFC3339)
+		}
+	}
+
+	if p := c.Property("RECURRENCE-ID"); p != nil {
+		event.OriginalStartTime, _, err = dec.dateTime(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad RECURRENCE-ID: %v", err)
+		}
+	}
+
+	for _, p := range c.Properties {
+		switch p.Name {
+		case "RRULE", "EXRULE", "RDATE", "EXDATE":
+			event.Recurrence = append(event.Recurrence, p.String())
+		}
+	}
+
+	//google requires a time zone on recurring events
+	if len(event.Recurrence) > 0 && event.Start.DateTime != "" && event.Start.TimeZone == "" {
+		event.Start.TimeZone = "UTC"
+		event.End.TimeZone = "UTC"
+	}
+
+	if p := c.Property("SUMMARY"); p != nil {
+		event.Summary = p.Text()
+	}
+
+	if p := c.Property("DESCRIPTION"); p != nil {
+		event.Description = p.Text()
+	}
+
+	if p := c.Property("LOCATION"); p != nil {
+		event.Location = p.Text()
+	}
+
+	if p := c.Property("STATUS"); p != nil {
+		switch status := strings.ToLower(p.Value); status {
+		case "confirmed", "tentative", "cancelled":
+			event.Status = status
+		}
+	}
+
+	if p := c.Property("TRANSP"); p != nil {
+		event.Transparency = strings.ToLower(p.Value)
+	}
+
+	if p := c.Property("CLASS"); p != nil {
+		event.Visibility = visibilities[strings.ToUpper(p.Value)]
+	}
+
+	if p := c.Property("SEQUENCE"); p != nil {
+		event.Sequence, _ = strconv.ParseInt(p.Value, 10, 64)
+	}
+
+	if p := c.Property("ORGANIZER"); p != nil {
+		event.Organizer = &calendar.EventOrganizer{
+			Email:       email(p.Value),
+			DisplayName: p.Param("CN"),
+		}
+	}
+
+	for _, p := range c.PropertiesNamed("ATTENDEE") {
+		event.Attendees = append(event.Attendees, toAttendee(p))
+	}
+
+	if alarms := c.ComponentsNamed("VALARM"); len(alarms) > 0 {
+		event.Reminders = toReminders(alarms)
+	}
+	return &event, nil
+}
+
+//ToEvents converts the VEVENTs of a VCALENDAR to google events, keyed by
+//UID in iCalUID. Events that can not be converted are returned as errors.
+func ToEvents(cal *Component) (events []*calendar.Event, errs []EventError) {
+	dec := decoder{zones: map[string]*Component{}}
+	if p := cal.Property("X-WR-TIMEZONE"); p != nil {
+		dec.defaultZone = p.Text()
+	}
+
+	for _, zone := range cal.ComponentsNamed("VTIMEZONE") {
+		if p := zone.Property("TZID"); p != nil {
+			dec.zones[p.Value] = zone
+		}
+	}
+
+	events = []*calendar.Event{}
+	errs = []EventError{}
+	for _, c := range cal.ComponentsNamed("VEVENT") {
+		event, err := dec.toEvent(c)
+		if err != nil {
+			eventErr := EventError{Err: err}
+			if p := c.Property("UID"); p != nil {
+				eventErr.UID = p.Text()
+			}
+			if p := c.Property("RECURRENCE-ID"); p != nil {
+				eventErr.RecurrenceID = p.Value
+			}
+			errs = append(errs, eventErr)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, errs
+}
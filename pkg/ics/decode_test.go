@@ -0,0 +1,232 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Test//EN\r\n" +
+	"X-WR-TIMEZONE:Europe/Oslo\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Custom Standard Time\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:16010101T000000\r\n" +
+	"TZOFFSETFROM:+0300\r\n" +
+	"TZOFFSETTO:+0300\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:weekly@example.com\r\n" +
+	"DTSTART;TZID=Europe/Oslo:20200106T100000\r\n" +
+	"DTEND;TZID=Europe/Oslo:20200106T110000\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=4\r\n" +
+	"EXDATE;TZID=Europe/Oslo:20200113T100000\r\n" +
+	"SUMMARY:Weekly\\, with a long summary that is folded over\r\n" +
+	"  two lines\r\n" +
+	"ORGANIZER;CN=Org:mailto:org@example.com\r\n" +
+	"ATTENDEE;CN=\"Doe, Jane\";PARTSTAT=ACCEPTED:mailto:jane@example.com\r\n" +
+	"ATTENDEE;ROLE=OPT-PARTICIPANT;CUTYPE=ROOM:mailto:room@example.com\r\n" +
+	"CLASS:CONFIDENTIAL\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:EMAIL\r\n" +
+	"TRIGGER:-P1D\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:allday@example.com\r\n" +
+	"DTSTART;VALUE=DATE:20200517\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:duration@example.com\r\n" +
+	"DTSTART:20200106T100000Z\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:custom@example.com\r\n" +
+	"DTSTART;TZID=Custom Standard Time:20200106T100000\r\n" +
+	"DTEND;TZID=Custom Standard Time:20200106T110000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:No uid\r\n" +
+	"DTSTART:20200106T100000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in  string
+		out time.Duration
+		ok  bool
+	}{
+		{"-PT15M", -15 * time.Minute, true},
+		{"PT1H30M", 90 * time.Minute, true},
+		{"P1W", 7 * 24 * time.Hour, true},
+		{"+P1DT2H", 26 * time.Hour, true},
+		{"PT10S", 10 * time.Second, true},
+		{"P1M", 0, false},
+		{"PT", 0, false},
+		{"15M", 0, false},
+		{"PT5", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDuration(test.in)
+		if (err == nil) != test.ok || got != test.out {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v (ok: %v)", test.in, got, err, test.out, test.ok)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"BEGIN:VCALENDAR\r\nEND:VEVENT\r\n",
+		"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VEVENT\r\n",
+		"SUMMARY:outside\r\n",
+	}
+
+	for _, test := range tests {
+		if _, err := Decode(strings.NewReader(test)); err == nil {
+			t.Errorf("expected error decoding %q", test)
+		}
+	}
+}
+
+func decodeEvents(t *testing.T, data string) ([]*calendar.Event, []EventError) {
+	roots, err := Decode(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+
+	if len(roots) != 1 || roots[0].Name != "VCALENDAR" {
+		t.Fatalf("expected single VCALENDAR, got %+v", roots)
+	}
+	return ToEvents(roots[0])
+}
+
+func TestToEvents(t *testing.T) {
+	loadLocation(t, "Europe/Oslo")
+	events, errs := decodeEvents(t, testCalendar)
+
+	if len(errs) != 1 || errs[0].UID != "" {
+		t.Errorf("expected one error for event without uid, got %v", errs)
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(events))
+	}
+
+	weekly := events[0]
+	if weekly.ICalUID != "weekly@example.com" {
+		t.Errorf("uid = %q", weekly.ICalUID)
+	}
+
+	if weekly.Summary != "Weekly, with a long summary that is folded over two lines" {
+		t.Errorf("summary = %q", weekly.Summary)
+	}
+
+	if weekly.Start.DateTime != "2020-01-06T10:00:00+01:00" || weekly.Start.TimeZone != "Europe/Oslo" {
+		t.Errorf("start = %+v", weekly.Start)
+	}
+
+	if len(weekly.Recurrence) != 2 ||
+		weekly.Recurrence[0] != "RRULE:FREQ=WEEKLY;COUNT=4" ||
+		weekly.Recurrence[1] != "EXDATE;TZID=Europe/Oslo:20200113T100000" {
+		t.Errorf("recurrence = %v", weekly.Recurrence)
+	}
+
+	if weekly.Organizer == nil || weekly.Organizer.Email != "org@example.com" {
+		t.Errorf("organizer = %+v", weekly.Organizer)
+	}
+
+	if len(weekly.Attendees) != 2 {
+		t.Fatalf("attendees = %+v", weekly.Attendees)
+	}
+
+	jane, room := weekly.Attendees[0], weekly.Attendees[1]
+	if jane.Email != "jane@example.com" || jane.DisplayName != "Doe, Jane" || jane.ResponseStatus != "accepted" {
+		t.Errorf("jane = %+v", jane)
+	}
+
+	if !room.Optional || !room.Resource || room.ResponseStatus != "needsAction" {
+		t.Errorf("room = %+v", room)
+	}
+
+	if weekly.Visibility != "confidential" {
+		t.Errorf("visibility = %q", weekly.Visibility)
+	}
+
+	if weekly.Reminders == nil || len(weekly.Reminders.Overrides) != 2 ||
+		weekly.Reminders.Overrides[0].Method != "popup" || weekly.Reminders.Overrides[0].Minutes != 15 ||
+		weekly.Reminders.Overrides[1].Method != "email" || weekly.Reminders.Overrides[1].Minutes != 1440 {
+		t.Errorf("reminders = %+v", weekly.Reminders)
+	}
+
+	allDay := events[1]
+	if allDay.Start.Date != "2020-05-17" || allDay.End.Date != "2020-05-18" {
+		t.Errorf("all day = %+v - %+v", allDay.Start, allDay.End)
+	}
+
+	duration := events[2]
+	if duration.Start.DateTime != "2020-01-06T10:00:00Z" || duration.End.DateTime != "2020-01-06T11:30:00Z" {
+		t.Errorf("duration = %+v - %+v", duration.Start, duration.End)
+	}
+
+	custom := events[3]
+	if custom.Start.DateTime != "2020-01-06T10:00:00+03:00" {
+		t.Errorf("custom zone = %+v", custom.Start)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	loadLocation(t, "Europe/Oslo")
+	original := &calendar.Event{
+		ICalUID:     "roundtrip@example.com",
+		Summary:     "Round; trip, test",
+		Description: "Line 1\nLine 2",
+		Start:       &calendar.EventDateTime{DateTime: "2020-06-01T10:00:00+02:00", TimeZone: "Europe/Oslo"},
+		End:         &calendar.EventDateTime{DateTime: "2020-06-01T12:00:00+02:00", TimeZone: "Europe/Oslo"},
+		Recurrence:  []string{"RRULE:FREQ=DAILY;COUNT=2"},
+		Attendees:   []*calendar.EventAttendee{{Email: "a@example.com", ResponseStatus: "tentative"}},
+	}
+
+	buf := bytes.Buffer{}
+	err := Calendar{Events: []*calendar.Event{original}}.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+
+	events, errs := decodeEvents(t, buf.String())
+	if len(errs) != 0 || len(events) != 1 {
+		t.Fatalf("events = %v, errors = %v", events, errs)
+	}
+
+	event := events[0]
+	if event.ICalUID != original.ICalUID || event.Summary != original.Summary ||
+		event.Description != original.Description {
+		t.Errorf("text fields differ: %+v", event)
+	}
+
+	if event.Start.DateTime != original.Start.DateTime || event.End.DateTime != original.End.DateTime ||
+		event.Start.TimeZone != "Europe/Oslo" {
+		t.Errorf("times differ: %+v - %+v", event.Start, event.End)
+	}
+
+	if len(event.Recurrence) != 1 || event.Recurrence[0] != original.Recurrence[0] {
+		t.Errorf("recurrence = %v", event.Recurrence)
+	}
+
+	if len(event.Attendees) != 1 || event.Attendees[0].ResponseStatus != "tentative" {
+		t.Errorf("attendees = %+v", event.Attendees)
+	}
+}
@@ -0,0 +1,305 @@
+package ics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+//DefaultProdID identifies this service as producer of calendar files
+const DefaultProdID = "-//TIP//google-calendar//EN"
+
+var (
+	partStats = map[string]string{
+		"needsAction": "NEEDS-ACTION",
+		"accepted":    "ACCEPTED",
+		"declined":    "DECLINED",
+		"tentative":   "TENTATIVE",
+	}
+
+	classes = map[string]string{
+		"public":       "PUBLIC",
+		"private":      "PRIVATE",
+		"confidential": "CONFIDENTIAL",
+	}
+)
+
+//Calendar is a VCALENDAR of google calendar events
+type Calendar struct {
+	ProdID   string //defaults to DefaultProdID
+	Method   string //iTIP method, i.e. REQUEST. Empty for plain calendar files
+	Name     string
+	TimeZone string //used for events without a time zone, defaults to UTC
+	Events   []*calendar.Event
+}
+
+//zoneRange - time span a VTIMEZONE must cover
+type zoneRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+//encoder - collects the time zones used while converting events
+type encoder struct {
+	defaultZone *time.Location
+	zones       map[string]*zoneRange
+}
+
+//location - loads a time zone, falling back to the default (or UTC)
+func (enc *encoder) location(name string) *time.Location {
+	if name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return enc.defaultZone
+}
+
+//dateTimeProperty - adds DTSTART, DTEND or similar, remembering the zone used
+func (enc *encoder) dateTimeProperty(c *Component, name string, dt *calendar.EventDateTime) {
+	if dt == nil {
+		return
+	}
+
+	if dt.Date != "" {
+		date, err := time.Parse("2006-01-02", dt.Date)
+		if err == nil {
+			c.AddProperty(name, date.Format(dateFormat), Param{"VALUE", []string{"DATE"}})
+		}
+		return
+	}
+
+	t, err := time.Parse(time.RFC3339, dt.DateTime)
+	if err != nil {
+		return
+	}
+
+	loc := enc.location(dt.TimeZone)
+	if loc == nil || loc == time.UTC {
+		c.AddProperty(name, t.UTC().Format(utcTimeFormat))
+		return
+	}
+
+	zone := enc.zones[loc.String()]
+	if zone == nil {
+		zone = &zoneRange{loc: loc, from: t, to: t}
+		enc.zones[loc.String()] = zone
+	}
+	if t.Before(zone.from) {
+		zone.from = t
+	}
+	if t.After(zone.to) {
+		zone.to = t
+	}
+
+	c.AddProperty(name, t.In(loc).Format(localTimeFormat),
+		Param{"TZID", []string{loc.String()}},
+	)
+}
+
+//utcProperty - adds a timestamp property (i.e. DTSTAMP) from an RFC3339 time
+func utcProperty(c *Component, name string, value string) bool {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	c.AddProperty(name, t.UTC().Format(utcTimeFormat))
+	return true
+}
+
+func mailto(email string) string {
+	return "mailto:" + email
+}
+
+func attendeeProperty(c *Component, attendee *calendar.EventAttendee) {
+	params := []Param{}
+	if attendee.DisplayName != "" {
+		params = append(params, Param{"CN", []string{attendee.DisplayName}})
+	}
+
+	if attendee.Resource {
+		params = append(params, Param{"CUTYPE", []string{"RESOURCE"}})
+	}
+
+	role := "REQ-PARTICIPANT"
+	if attendee.Optional {
+		role = "OPT-PARTICIPANT"
+	}
+	params = append(params, Param{"ROLE", []string{role}})
+
+	if stat, ok := partStats[attendee.ResponseStatus]; ok {
+		params = append(params, Param{"PARTSTAT", []string{stat}})
+		if stat == "NEEDS-ACTION" {
+			params = append(params, Param{"RSVP", []string{"TRUE"}})
+		}
+	}
+	c.AddProperty("ATTENDEE", mailto(attendee.Email), params...)
+}
+
+//alarmComponents - converts reminder overrides to VALARMs
+func alarmComponents(c *Component, event *calendar.Event) {
+	if event.Reminders == nil {
+		return
+	}
+
+	for _, v := range event.Reminders.Overrides {
+		alarm := NewComponent("VALARM")
+		trigger := fmt.Sprintf("-PT%dM", v.Minutes)
+		if v.Method == "email" {
+			alarm.AddProperty("ACTION", "EMAIL")
+			alarm.AddText("SUMMARY", event.Summary)
+			alarm.AddText("DESCRIPTION", event.Summary)
+			if event.Organizer != nil && event.Organizer.Email != "" {
+				alarm.AddProperty("ATTENDEE", mailto(event.Organizer.Email))
+			}
+		} else {
+			alarm.AddProperty("ACTION", "DISPLAY")
+			alarm.AddText("DESCRIPTION", event.Summary)
+		}
+		alarm.AddProperty("TRIGGER", trigger)
+		c.AddComponent(alarm)
+	}
+}
+
+//UID - iCalendar uid of a google event
+func UID(event *calendar.Event) string {
+	if event.ICalUID != "" {
+		return event.ICalUID
+	}
+	return event.Id + "@google.com"
+}
+
+//eventComponent - converts a google event to a VEVENT
+func (enc *encoder) eventComponent(event *calendar.Event) *Component {
+	c := NewComponent("VEVENT")
+	c.AddText("UID", UID(event))
+
+	if !utcProperty(c, "DTSTAMP", event.Updated) && !utcProperty(c, "DTSTAMP", event.Created) {
+		c.AddProperty("DTSTAMP", time.Now().UTC().Format(utcTimeFormat))
+	}
+
+	enc.dateTimeProperty(c, "DTSTART", event.Start)
+	if !event.EndTimeUnspecified {
+		enc.dateTimeProperty(c, "DTEND", event.End)
+	}
+
+	if event.RecurringEventId != "" {
+		enc.dateTimeProperty(c, "RECURRENCE-ID", event.OriginalStartTime)
+	}
+
+	//recurrence lines (RRULE, EXDATE, RDATE) are already in iCalendar format
+	for _, v := range event.Recurrence {
+		if strings.IndexAny(v, ":;") > 0 {
+			c.Properties = append(c.Properties, parseContentLine(v))
+		}
+	}
+
+	utcProperty(c, "CREATED", event.Created)
+	utcProperty(c, "LAST-MODIFIED", event.Updated)
+	if event.Sequence > 0 {
+		c.AddProperty("SEQUENCE", fmt.Sprint(event.Sequence))
+	}
+
+	if event.Summary != "" {
+		c.AddText("SUMMARY", event.Summary)
+	}
+
+	if event.Description != "" {
+		c.AddText("DESCRIPTION", event.Description)
+	}
+
+	if event.Location != "" {
+		c.AddText("LOCATION", event.Location)
+	}
+
+	if event.Status != "" {
+		c.AddProperty("STATUS", strings.ToUpper(event.Status))
+	}
+
+	if event.Transparency != "" {
+		c.AddProperty("TRANSP", strings.ToUpper(event.Transparency))
+	}
+
+	if class, ok := classes[event.Visibility]; ok {
+		c.AddProperty("CLASS", class)
+	}
+
+	if event.HtmlLink != "" {
+		c.AddProperty("URL", event.HtmlLink)
+	}
+
+	if event.Organizer != nil && event.Organizer.Email != "" {
+		params := []Param{}
+		if event.Organizer.DisplayName != "" {
+			params = append(params, Param{"CN", []string{event.Organizer.DisplayName}})
+		}
+		c.AddProperty("ORGANIZER", mailto(event.Organizer.Email), params...)
+	}
+
+	for _, v := range event.Attendees {
+		if v.Email != "" {
+			attendeeProperty(c, v)
+		}
+	}
+
+	alarmComponents(c, event)
+	return c
+}
+
+//Component builds the VCALENDAR, with a VTIMEZONE for each time zone used
+func (cal Calendar) Component() *Component {
+	enc := encoder{
+		defaultZone: time.UTC,
+		zones:       map[string]*zoneRange{},
+	}
+	enc.defaultZone = enc.location(cal.TimeZone)
+
+	c := NewComponent("VCALENDAR")
+	prodID := cal.ProdID
+	if prodID == "" {
+		prodID = DefaultProdID
+	}
+	c.AddText("PRODID", prodID)
+	c.AddProperty("VERSION", "2.0")
+	c.AddProperty("CALSCALE", "GREGORIAN")
+	if cal.Method != "" {
+		c.AddProperty("METHOD", cal.Method)
+	}
+
+	if cal.Name != "" {
+		c.AddText("X-WR-CALNAME", cal.Name)
+	}
+
+	if cal.TimeZone != "" {
+		c.AddText("X-WR-TIMEZONE", cal.TimeZone)
+	}
+
+	events := []*Component{}
+	for _, v := range cal.Events {
+		events = append(events, enc.eventComponent(v))
+	}
+
+	//sorted, for a stable output
+	names := []string{}
+	for name := range enc.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		zone := enc.zones[name]
+		c.AddComponent(TimeZoneComponent(zone.loc, zone.from, zone.to))
+	}
+
+	c.Components = append(c.Components, events...)
+	return c
+}
+
+//Encode writes the calendar in iCalendar format
+func (cal Calendar) Encode(w io.Writer) error {
+	return cal.Component().Encode(w)
+}
@@ -0,0 +1,255 @@
+package ics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+func encode(t *testing.T, c *Component) string {
+	buf := bytes.Buffer{}
+	err := c.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	return buf.String()
+}
+
+//unfold - joins folded lines, for easier matching
+func unfold(s string) string {
+	return strings.Replace(s, "\r\n ", "", -1)
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"plain", "plain"},
+		{"a;b,c", `a\;b\,c`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines", `two\nlines`},
+		{"crlf\r\nlines", `crlf\nlines`},
+	}
+
+	for _, test := range tests {
+		if got := EscapeText(test.in); got != test.out {
+			t.Errorf("EscapeText(%q) = %q, want %q", test.in, got, test.out)
+		}
+
+		if got := UnescapeText(test.out); got != strings.Replace(test.in, "\r\n", "\n", -1) {
+			t.Errorf("UnescapeText(%q) = %q, want %q", test.out, got, test.in)
+		}
+	}
+}
+
+func TestFolding(t *testing.T) {
+	tests := []string{
+		strings.Repeat("a", 200),
+		strings.Repeat("æøå", 50),
+		strings.Repeat("x", 74),
+	}
+
+	for _, text := range tests {
+		c := NewComponent("VEVENT")
+		c.AddText("DESCRIPTION", text)
+		out := encode(t, c)
+
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Errorf("output does not end with crlf")
+		}
+
+		unfolded := []string{}
+		for i, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+			if len(line) > maxLineLength {
+				t.Errorf("line %d is %d octets: %q", i, len(line), line)
+			}
+
+			if !strings.HasPrefix(line, " ") {
+				unfolded = append(unfolded, line)
+				continue
+			}
+			unfolded[len(unfolded)-1] += line[1:]
+		}
+
+		if unfolded[1] != "DESCRIPTION:"+text {
+			t.Errorf("unfolded line = %q, want %q", unfolded[1], "DESCRIPTION:"+text)
+		}
+	}
+}
+
+func TestPropertyString(t *testing.T) {
+	p := Property{
+		Name: "ATTENDEE",
+		Params: []Param{
+			{"CN", []string{`Doe, "John"`}},
+			{"ROLE", []string{"REQ-PARTICIPANT"}},
+		},
+		Value: "mailto:john@example.com",
+	}
+
+	want := `ATTENDEE;CN="Doe, 'John'";ROLE=REQ-PARTICIPANT:mailto:john@example.com`
+	if got := p.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseContentLine(t *testing.T) {
+	p := parseContentLine(`exdate;TZID=Europe/Oslo;X-A="a:b;c",d:20200101T100000,20200108T100000`)
+	if p.Name != "EXDATE" {
+		t.Errorf("name = %q", p.Name)
+	}
+
+	if p.Param("TZID") != "Europe/Oslo" {
+		t.Errorf("TZID = %q", p.Param("TZID"))
+	}
+
+	if len(p.Params) != 2 || len(p.Params[1].Values) != 2 || p.Params[1].Values[0] != "a:b;c" {
+		t.Errorf("params = %+v", p.Params)
+	}
+
+	if p.Value != "20200101T100000,20200108T100000" {
+		t.Errorf("value = %q", p.Value)
+	}
+}
+
+func TestTimeZoneComponent(t *testing.T) {
+	loc := loadLocation(t, "Europe/Oslo")
+	from := time.Date(2020, time.June, 1, 0, 0, 0, 0, loc)
+	out := encode(t, TimeZoneComponent(loc, from, from))
+
+	for _, want := range []string{
+		"TZID:Europe/Oslo",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20200329T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200",
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU",
+		"BEGIN:STANDARD\r\nDTSTART:20201025T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100",
+		"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestTimeZoneWithoutTransitions(t *testing.T) {
+	loc := time.FixedZone("Fixed", 3*3600)
+	out := encode(t, TimeZoneComponent(loc, time.Now(), time.Now()))
+
+	if strings.Count(out, "BEGIN:STANDARD") != 1 || strings.Contains(out, "DAYLIGHT") {
+		t.Errorf("expected single standard observance:\n%s", out)
+	}
+
+	if !strings.Contains(out, "TZOFFSETTO:+0300") {
+		t.Errorf("missing offset:\n%s", out)
+	}
+}
+
+func TestCalendarEncode(t *testing.T) {
+	loadLocation(t, "Europe/Oslo")
+	cal := Calendar{
+		Name:     "Courses",
+		TimeZone: "Europe/Oslo",
+		Events: []*calendar.Event{
+			{
+				Id:          "abc123def",
+				Summary:     "Course; part 1",
+				Description: "Bring laptop,\nand charger",
+				Location:    "Room 1",
+				Status:      "confirmed",
+				Visibility:  "private",
+				Updated:     "2020-01-02T10:00:00.000Z",
+				Start:       &calendar.EventDateTime{DateTime: "2020-01-06T09:00:00Z", TimeZone: "Europe/Oslo"},
+				End:         &calendar.EventDateTime{DateTime: "2020-01-06T10:00:00Z", TimeZone: "Europe/Oslo"},
+				Recurrence:  []string{"RRULE:FREQ=WEEKLY;COUNT=4"},
+				Organizer:   &calendar.EventOrganizer{Email: "org@example.com", DisplayName: "Org"},
+				Attendees: []*calendar.EventAttendee{
+					{Email: "a@example.com", ResponseStatus: "accepted"},
+					{Email: "b@example.com", ResponseStatus: "needsAction", Optional: true},
+				},
+				Reminders: &calendar.EventReminders{
+					Overrides: []*calendar.EventReminder{{Method: "popup", Minutes: 15}},
+				},
+			},
+			{
+				ICalUID: "allday@example.com",
+				Summary: "Holiday",
+				Created: "2020-01-01T00:00:00Z",
+				Start:   &calendar.EventDateTime{Date: "2020-05-17"},
+				End:     &calendar.EventDateTime{Date: "2020-05-18"},
+			},
+		},
+	}
+
+	buf := bytes.Buffer{}
+	err := cal.Encode(&buf)
+	if err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	out := unfold(buf.String())
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nPRODID:" + DefaultProdID + "\r\nVERSION:2.0",
+		"X-WR-CALNAME:Courses",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Oslo",
+		"UID:abc123def@google.com",
+		"DTSTAMP:20200102T100000Z",
+		"DTSTART;TZID=Europe/Oslo:20200106T100000",
+		"DTEND;TZID=Europe/Oslo:20200106T110000",
+		"RRULE:FREQ=WEEKLY;COUNT=4",
+		`SUMMARY:Course\; part 1`,
+		`DESCRIPTION:Bring laptop\,\nand charger`,
+		"STATUS:CONFIRMED",
+		"CLASS:PRIVATE",
+		"ORGANIZER;CN=Org:mailto:org@example.com",
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED:mailto:a@example.com",
+		"ATTENDEE;ROLE=OPT-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:b@example.com",
+		"BEGIN:VALARM\r\nACTION:DISPLAY\r\nDESCRIPTION:Course\\; part 1\r\nTRIGGER:-PT15M\r\nEND:VALARM",
+		"UID:allday@example.com",
+		"DTSTART;VALUE=DATE:20200517",
+		"DTEND;VALUE=DATE:20200518",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	if strings.Index(out, "BEGIN:VTIMEZONE") > strings.Index(out, "BEGIN:VEVENT") {
+		t.Errorf("time zones must come before events:\n%s", out)
+	}
+
+	if strings.Count(out, "BEGIN:VTIMEZONE") != 1 {
+		t.Errorf("expected exactly one time zone:\n%s", out)
+	}
+}
+
+func TestCalendarEncodeUTC(t *testing.T) {
+	cal := Calendar{
+		Method: "REQUEST",
+		Events: []*calendar.Event{{
+			Id:    "utcevent",
+			Start: &calendar.EventDateTime{DateTime: "2020-01-06T10:00:00+01:00"},
+			End:   &calendar.EventDateTime{DateTime: "2020-01-06T11:00:00+01:00"},
+		}},
+	}
+
+	out := unfold(encode(t, cal.Component()))
+	for _, want := range []string{"METHOD:REQUEST", "DTSTART:20200106T090000Z", "DTEND:20200106T100000Z"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	if strings.Contains(out, "VTIMEZONE") {
+		t.Errorf("utc events need no time zone:\n%s", out)
+	}
+}
@@ -0,0 +1,185 @@
+package ics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//parseContentLine - parses an unfolded content line into a property.
+//Parameter values may be quoted, and then contain ':', ';' and ','.
+func parseContentLine(line string) *Property {
+	p := &Property{}
+	i := strings.IndexAny(line, ";:")
+	if i < 0 {
+		p.Name = strings.ToUpper(line)
+		return p
+	}
+	p.Name = strings.ToUpper(line[:i])
+
+	for i < len(line) && line[i] == ';' {
+		i++
+		eq := strings.IndexByte(line[i:], '=')
+		if eq < 0 {
+			break
+		}
+		param := Param{Name: strings.ToUpper(line[i : i+eq])}
+		i += eq + 1
+
+		for {
+			value := ""
+			if i < len(line) && line[i] == '"' {
+				end := strings.IndexByte(line[i+1:], '"')
+				if end < 0 {
+					end = len(line) - i - 1
+				}
+				value = line[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				end := strings.IndexAny(line[i:], ",;:")
+				if end < 0 {
+					end = len(line) - i
+				}
+				value = line[i : i+end]
+				i += end
+			}
+			param.Values = append(param.Values, value)
+
+			if i >= len(line) || line[i] != ',' {
+				break
+			}
+			i++
+		}
+		p.Params = append(p.Params, param)
+	}
+
+	if i < len(line) && line[i] == ':' {
+		p.Value = line[i+1:]
+	}
+	return p
+}
+
+//maximum length of an unfolded content line
+const maxContentLine = 1 << 20
+
+//unfoldLines - reads content lines, joining folded lines
+func unfoldLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxContentLine)
+
+	lines := []string{}
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+//Decode parses iCalendar data, returning its top level components
+//(usually a single VCALENDAR)
+func Decode(r io.Reader) ([]*Component, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := []*Component{}
+	stack := []*Component{}
+	for i, line := range lines {
+		p := parseContentLine(line)
+		switch p.Name {
+		case "BEGIN":
+			c := NewComponent(strings.ToUpper(p.Value))
+			if len(stack) == 0 {
+				roots = append(roots, c)
+			} else {
+				stack[len(stack)-1].AddComponent(c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside of component", i+1, p.Name)
+			}
+			top := stack[len(stack)-1]
+			top.Properties = append(top.Properties, p)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("component %s is not ended", stack[len(stack)-1].Name)
+	}
+
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no iCalendar data found")
+	}
+	return roots, nil
+}
+
+//ParseDuration parses an iCalendar duration, i.e. -PT15M or P1W
+func ParseDuration(value string) (time.Duration, error) {
+	s := strings.ToUpper(value)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	s = s[1:]
+
+	units := map[byte]time.Duration{
+		'W': 7 * 24 * time.Hour,
+		'D': 24 * time.Hour,
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+	}
+
+	duration := time.Duration(0)
+	number := ""
+	inTime := false
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= '0' && ch <= '9':
+			number += string(ch)
+		case ch == 'T':
+			inTime = true
+		case number != "" && units[ch] != 0:
+			//M means minutes only after T, months are not allowed
+			if (ch == 'M' || ch == 'H' || ch == 'S') != inTime {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			n, _ := strconv.Atoi(number)
+			duration += time.Duration(n) * units[ch]
+			number = ""
+		default:
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+	}
+
+	if number != "" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return sign * duration, nil
+}
@@ -0,0 +1,158 @@
+package ics
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	localTimeFormat = "20060102T150405"
+	utcTimeFormat   = "20060102T150405Z"
+	dateFormat      = "20060102"
+)
+
+var weekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+//transition is a change of utc offset in a time zone
+type transition struct {
+	at         time.Time
+	name       string
+	offsetFrom int
+	offsetTo   int
+	daylight   bool
+}
+
+//formatOffset - utc offset in seconds as +hhmm
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+}
+
+//standardOffset - the smallest offset of the year, which is standard time
+func standardOffset(loc *time.Location, year int) int {
+	_, january := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+	_, july := time.Date(year, time.July, 1, 0, 0, 0, 0, loc).Zone()
+	if july < january {
+		return july
+	}
+	return january
+}
+
+//findTransitions - offset changes in loc between from and to.
+//Steps a day at a time, then narrows each change down to the second.
+func findTransitions(loc *time.Location, from time.Time, to time.Time) []transition {
+	transitions := []transition{}
+	_, offset := from.In(loc).Zone()
+	for t := from; t.Before(to); t = t.Add(24 * time.Hour) {
+		next := t.Add(24 * time.Hour)
+		name, nextOffset := next.In(loc).Zone()
+		if nextOffset == offset {
+			continue
+		}
+
+		low, high := t, next
+		for high.Sub(low) > time.Second {
+			mid := low.Add(high.Sub(low) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				low = mid
+			} else {
+				high = mid
+			}
+		}
+
+		transitions = append(transitions, transition{
+			at:         high.Truncate(time.Second),
+			name:       name,
+			offsetFrom: offset,
+			offsetTo:   nextOffset,
+			daylight:   nextOffset > standardOffset(loc, high.In(loc).Year()),
+		})
+		offset = nextOffset
+	}
+	return transitions
+}
+
+//yearlyRule - rule repeating a transition on the same weekday of the month,
+//i.e. last sunday of march
+func yearlyRule(local time.Time) string {
+	daysInMonth := time.Date(local.Year(), local.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	week := fmt.Sprint((local.Day()-1)/7 + 1)
+	if local.Day()+7 > daysInMonth {
+		week = "-1"
+	}
+
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%s%s",
+		int(local.Month()), week, weekdays[local.Weekday()],
+	)
+}
+
+func observance(daylight bool, start time.Time, name string, from int, to int) *Component {
+	kind := "STANDARD"
+	if daylight {
+		kind = "DAYLIGHT"
+	}
+
+	c := NewComponent(kind)
+	c.AddProperty("DTSTART", start.Format(localTimeFormat))
+	c.AddProperty("TZOFFSETFROM", formatOffset(from))
+	c.AddProperty("TZOFFSETTO", formatOffset(to))
+	if name != "" {
+		c.AddText("TZNAME", name)
+	}
+	return c
+}
+
+//TimeZoneComponent builds a VTIMEZONE for loc, valid from the start of
+//the year of from. Transitions up to the end of the year of to are listed
+//explicitly, and the last transition in each direction repeats yearly.
+func TimeZoneComponent(loc *time.Location, from time.Time, to time.Time) *Component {
+	c := NewComponent("VTIMEZONE")
+	c.AddProperty("TZID", loc.String())
+
+	start := time.Date(from.In(loc).Year(), time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(to.In(loc).Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+	if end.Before(start) {
+		end = time.Date(start.Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+	}
+
+	name, offset := start.Zone()
+	transitions := findTransitions(loc, start, end)
+	initial := observance(
+		offset > standardOffset(loc, start.Year()), start, name, offset, offset,
+	)
+	if len(transitions) == 0 {
+		c.AddComponent(initial)
+		return c
+	}
+
+	//the last transition of each kind gets a yearly rule, if the zone
+	//still observed daylight saving time in the last year
+	lastDaylight, lastStandard := -1, -1
+	for i, v := range transitions {
+		if v.daylight {
+			lastDaylight = i
+		} else {
+			lastStandard = i
+		}
+	}
+
+	repeats := lastDaylight >= 0 && lastStandard >= 0 &&
+		transitions[lastDaylight].at.In(loc).Year() == end.Year()-1 &&
+		transitions[lastStandard].at.In(loc).Year() == end.Year()-1
+
+	c.AddComponent(initial)
+	for i, v := range transitions {
+		//observance start is given in local time before the transition
+		local := v.at.In(time.FixedZone("", v.offsetFrom))
+		o := observance(v.daylight, local, v.name, v.offsetFrom, v.offsetTo)
+		if repeats && (i == lastDaylight || i == lastStandard) {
+			o.AddProperty("RRULE", yearlyRule(local))
+		}
+		c.AddComponent(o)
+	}
+	return c
+}